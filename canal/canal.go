@@ -38,14 +38,32 @@ type Canal struct {
 	dumpDoneCh chan struct{}
 	syncer     *replication.BinlogSyncer
 
+	// set by prepareDumper if Config.Dump.Native is set, instead of dumper
+	snapshotter *snapshotter
+
 	eventHandler EventHandler
 
+	// set by RunFromCheckpoint
+	checkpointStore replication.CheckpointStore
+
 	connLock sync.Mutex
 	conn     *client.Conn
 
 	tableLock          sync.RWMutex
 	tables             map[string]*schema.Table
 	errorTablesGetTime map[string]time.Time
+	// set by run if Config.SchemaHistory is set
+	schemaTracker *SchemaTracker
+	// the table map events of the tables built by Config.TableMapSchema
+	tableMaps map[string]tableMapVersion
+
+	// whether the transaction in progress is started by BEGIN, or by a MariaDB GTID event without
+	// FL_STANDALONE, the queries inside it don't commit the checkpoint until COMMIT or ROLLBACK
+	inBlock bool
+
+	// the incremental snapshots by db.table, started by TriggerSnapshot
+	snapshotLock sync.Mutex
+	snapshots    map[string]*incrementalSnapshot
 
 	tableMatchCache   map[string]bool
 	includeTableRegex []*regexp.Regexp
@@ -80,6 +98,9 @@ func NewCanal(cfg *Config) (*Canal, error) {
 	c.eventHandler = &DummyEventHandler{}
 	c.parser = parser.New()
 	c.tables = make(map[string]*schema.Table)
+	if c.cfg.TableMapSchema {
+		c.tableMaps = make(map[string]tableMapVersion)
+	}
 	if c.cfg.DiscardNoMetaRowEvent {
 		c.errorTablesGetTime = make(map[string]time.Time)
 	}
@@ -99,6 +120,10 @@ func NewCanal(cfg *Config) (*Canal, error) {
 		return nil, errors.Trace(err)
 	}
 
+	if c.cfg.TableMapSchema {
+		c.checkBinlogRowMetadata()
+	}
+
 	if err := c.initTableFilter(); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -137,6 +162,11 @@ func (c *Canal) initTableFilter() error {
 
 func (c *Canal) prepareDumper() error {
 	var err error
+	if c.cfg.Dump.Native {
+		c.snapshotter = newSnapshotter(&c.cfg.Dump)
+		return nil
+	}
+
 	dumpPath := c.cfg.Dump.ExecutionPath
 	if len(dumpPath) == 0 {
 		// ignore mysqldump, use binlog only
@@ -216,6 +246,39 @@ func (c *Canal) StartFromGTID(set mysql.GTIDSet) error {
 	return c.Run()
 }
 
+// RunFromCheckpoint syncs from the checkpoint saved in the store, or works like Run if the
+// store has no checkpoint. The checkpoint is committed to the store after the handler
+// processes the end of every transaction (XID or DDL) and the rotate events, so Canal
+// resumes from the last processed transaction after a crash.
+func (c *Canal) RunFromCheckpoint(store replication.CheckpointStore) error {
+	cp, err := store.Load()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	c.checkpointStore = store
+	if cp != nil {
+		c.cfg.Logger.Info("run from checkpoint", slog.Any("pos", cp.Position), slog.Any("gset", cp.GTIDSet))
+		c.master.Update(cp.Position)
+		c.master.UpdateGTIDSet(cp.GTIDSet)
+	}
+
+	return c.Run()
+}
+
+// saveCheckpoint commits the checkpoint to the store of RunFromCheckpoint.
+func (c *Canal) saveCheckpoint(pos mysql.Position, timestamp uint32) error {
+	if c.checkpointStore == nil {
+		return nil
+	}
+
+	return errors.Trace(c.checkpointStore.Save(&replication.Checkpoint{
+		Position:  pos,
+		GTIDSet:   c.master.GTIDSet(),
+		Timestamp: timestamp,
+	}))
+}
+
 // Dump all data from MySQL master `mysqldump`, ignore sync binlog.
 func (c *Canal) Dump() error {
 	if c.dumped {
@@ -245,6 +308,20 @@ func (c *Canal) run() error {
 		}
 	}
 
+	if c.cfg.SchemaHistory != nil {
+		if err := c.loadSchemaTracker(); err != nil {
+			c.cfg.Logger.Error("canal load schema history err", slog.Any("error", err))
+			return errors.Trace(err)
+		}
+	}
+
+	if c.cfg.SignalTable != "" {
+		if err := c.resumeSnapshots(); err != nil {
+			c.cfg.Logger.Error("canal resume incremental snapshots err", slog.Any("error", err))
+			return errors.Trace(err)
+		}
+	}
+
 	if err := c.runSyncBinlog(); err != nil {
 		if errors.Cause(err) != context.Canceled {
 			c.cfg.Logger.Error("canal start sync binlog err", slog.Any("error", err))
@@ -329,12 +406,17 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 	}
 	c.tableLock.RLock()
 	t, ok := c.tables[key]
+	tracker := c.schemaTracker
 	c.tableLock.RUnlock()
 
 	if ok {
 		return t, nil
 	}
 
+	if tracker != nil {
+		return tracker.Table(db, table)
+	}
+
 	if c.cfg.DiscardNoMetaRowEvent {
 		c.tableLock.RLock()
 		lastTime, ok := c.errorTablesGetTime[key]
@@ -398,6 +480,7 @@ func (c *Canal) ClearTableCache(db []byte, table []byte) {
 	key := fmt.Sprintf("%s.%s", db, table)
 	c.tableLock.Lock()
 	delete(c.tables, key)
+	delete(c.tableMaps, key)
 	if c.cfg.DiscardNoMetaRowEvent {
 		delete(c.errorTablesGetTime, key)
 	}
@@ -446,6 +529,21 @@ func (c *Canal) checkBinlogRowFormat() error {
 	return nil
 }
 
+// checkBinlogRowMetadata warns if binlog_row_metadata isn't FULL for Config.TableMapSchema, the
+// servers before MySQL 8.0.1 or MariaDB 10.5 don't have it. It's only a warning, since the
+// tables are not fetched from the server, which may be unreachable or not the one writing the
+// binlog, and the rows events of a table map event without the metadata fail anyway.
+func (c *Canal) checkBinlogRowMetadata() {
+	res, err := c.Execute(`SHOW GLOBAL VARIABLES LIKE 'binlog_row_metadata';`)
+	if err != nil {
+		c.cfg.Logger.Warn("failed to check binlog_row_metadata", slog.Any("error", err))
+		return
+	}
+	if f, _ := res.GetString(0, 1); f != "FULL" {
+		c.cfg.Logger.Warn("binlog_row_metadata must be FULL to build tables from binlog", slog.String("binlog_row_metadata", f))
+	}
+}
+
 func (c *Canal) prepareSyncer() error {
 	cfg := replication.BinlogSyncerConfig{
 		ServerID:                c.cfg.ServerID,
@@ -460,12 +558,17 @@ func (c *Canal) prepareSyncer() error {
 		SemiSyncEnabled:         c.cfg.SemiSyncEnabled,
 		MaxReconnectAttempts:    c.cfg.MaxReconnectAttempts,
 		DisableRetrySync:        c.cfg.DisableRetrySync,
+		RetryPolicy:             c.cfg.RetryPolicy,
+		OnReconnect:             c.cfg.OnReconnect,
+		Metrics:                 c.cfg.Metrics,
 		TimestampStringLocation: c.cfg.TimestampStringLocation,
 		TLSConfig:               c.cfg.TLSConfig,
 		Logger:                  c.cfg.Logger,
 		Dialer:                  c.cfg.Dialer,
 		Localhost:               c.cfg.Localhost,
 		EventCacheCount:         c.cfg.EventCacheCount,
+		EventCacheBytes:         c.cfg.EventCacheBytes,
+		LazyRowsEvent:           c.cfg.LazyRowsEvent,
 		FillZeroLogPos:          c.cfg.FillZeroLogPos,
 
 		RowsEventDecodeFunc: func(event *replication.RowsEvent, data []byte) error {
@@ -512,10 +615,8 @@ func (c *Canal) connect(options ...client.Option) (*client.Conn, error) {
 		c.cfg.User, c.cfg.Password, "", c.cfg.Dialer, options...)
 }
 
-// Execute a SQL
-func (c *Canal) Execute(cmd string, args ...interface{}) (rr *mysql.Result, err error) {
-	c.connLock.Lock()
-	defer c.connLock.Unlock()
+// connOptions returns the options of the connections to execute SQL.
+func (c *Canal) connOptions() []client.Option {
 	argF := make([]client.Option, 0)
 	if c.cfg.TLSConfig != nil {
 		argF = append(argF, func(conn *client.Conn) error {
@@ -523,6 +624,14 @@ func (c *Canal) Execute(cmd string, args ...interface{}) (rr *mysql.Result, err
 			return nil
 		})
 	}
+	return argF
+}
+
+// Execute a SQL
+func (c *Canal) Execute(cmd string, args ...interface{}) (rr *mysql.Result, err error) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	argF := c.connOptions()
 
 	retryNum := 3
 	for i := 0; i < retryNum; i++ {
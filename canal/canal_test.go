@@ -187,6 +187,106 @@ func (s *canalTestSuite) TestAnalyzeAdvancesSyncedPos() {
 	require.Greater(s.T(), endingPos.Pos, startingPos.Pos)
 }
 
+type testSnapshotHandler struct {
+	DummyEventHandler
+	rows [][]interface{}
+}
+
+func (h *testSnapshotHandler) OnRow(e *RowsEvent) error {
+	if e.Action == InsertAction {
+		h.rows = append(h.rows, e.Rows...)
+	}
+	return nil
+}
+
+func (s *canalTestSuite) TestNativeSnapshot() {
+	cfg := NewDefaultConfig()
+	cfg.Addr = s.c.cfg.Addr
+	cfg.User = "root"
+	cfg.Dump.Native = true
+	cfg.Dump.TableDB = "test"
+	cfg.Dump.Tables = []string{"canal_test"}
+	cfg.Dump.Parallel = 2
+	cfg.Dump.ChunkSize = 2
+	cfg.IncludeTableRegex = []string{".*\\.canal_test"}
+
+	c, err := NewCanal(cfg)
+	require.NoError(s.T(), err)
+	defer c.Close()
+
+	res := s.execute("SELECT COUNT(*) FROM test.canal_test")
+	count, err := res.GetInt(0, 0)
+	require.NoError(s.T(), err)
+
+	h := &testSnapshotHandler{}
+	c.SetEventHandler(h)
+	go func() { _ = c.Run() }()
+	<-c.WaitDumpDone()
+
+	require.Len(s.T(), h.rows, int(count))
+	for i := 1; i < len(h.rows); i++ {
+		require.Less(s.T(), h.rows[i-1][0].(int64), h.rows[i][0].(int64))
+	}
+	require.IsType(s.T(), uint64(0), h.rows[0][4])
+	require.NotEmpty(s.T(), c.SyncedPosition().Name)
+}
+
+type testIncrementalSnapshotHandler struct {
+	DummyEventHandler
+	rows chan []interface{}
+}
+
+func (h *testIncrementalSnapshotHandler) OnRow(e *RowsEvent) error {
+	if e.Header == nil && e.Table.Name == "canal_test" {
+		for _, row := range e.Rows {
+			h.rows <- row
+		}
+	}
+	return nil
+}
+
+func (s *canalTestSuite) TestTriggerSnapshot() {
+	s.execute("DROP TABLE IF EXISTS test.canal_signal")
+	s.execute("CREATE TABLE test.canal_signal (id varchar(255) PRIMARY KEY, type varchar(32) NOT NULL, data varchar(2048))")
+
+	cfg := NewDefaultConfig()
+	cfg.Addr = s.c.cfg.Addr
+	cfg.User = "root"
+	cfg.SignalTable = "test.canal_signal"
+	cfg.Dump.ChunkSize = 2
+	// the table is included by TriggerSnapshot
+	cfg.IncludeTableRegex = []string{"test\\.canal_signal"}
+
+	c, err := NewCanal(cfg)
+	require.NoError(s.T(), err)
+	defer c.Close()
+
+	res := s.execute("SELECT COUNT(*) FROM test.canal_test")
+	count, err := res.GetInt(0, 0)
+	require.NoError(s.T(), err)
+
+	h := &testIncrementalSnapshotHandler{rows: make(chan []interface{}, count)}
+	c.SetEventHandler(h)
+	pos, err := c.GetMasterPos()
+	require.NoError(s.T(), err)
+	go func() { _ = c.RunFrom(pos) }()
+
+	require.NoError(s.T(), c.TriggerSnapshot("test", "canal_test"))
+	for i := 0; i < int(count); i++ {
+		select {
+		case <-h.rows:
+		case <-time.After(10 * time.Second):
+			require.Fail(s.T(), "incremental snapshot timeout")
+		}
+	}
+
+	// the table is still included after restart
+	res = s.execute("SELECT type FROM test.canal_signal WHERE id = 'include:test.canal_test'")
+	tp, err := res.GetString(0, 0)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), SignalIncludeTable, tp)
+}
+
 func (s *canalTestSuite) TestCanalFilter() {
 	// included
 	sch, err := s.c.GetTable("test", "canal_test")
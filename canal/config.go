@@ -13,6 +13,7 @@ import (
 
 	"github.com/go-mysql-org/go-mysql/client"
 	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/utils"
 )
 
@@ -48,6 +49,17 @@ type DumpConfig struct {
 
 	// Set extra options
 	ExtraOptions []string `toml:"extra_options"`
+
+	// Set true to read the tables in a consistent snapshot by the connections of go-mysql,
+	// instead of mysqldump, so ExecutionPath and the options of mysqldump are ignored.
+	// The tables are read in parallel, by the chunks ordered by the primary keys.
+	Native bool `toml:"native"`
+
+	// Parallel is the number of the connections reading the tables for Native, default 4.
+	Parallel int `toml:"parallel"`
+
+	// ChunkSize is the max number of the rows read by a query for Native, default 1000.
+	ChunkSize int `toml:"chunk_size"`
 }
 
 type Config struct {
@@ -85,12 +97,23 @@ type Config struct {
 	SemiSyncEnabled bool `toml:"semi_sync_enabled"`
 
 	// maximum number of attempts to re-establish a broken connection, zero or negative number means infinite retry.
-	// this configuration will not work if DisableRetrySync is true
+	// this configuration will not work if DisableRetrySync is true or RetryPolicy is set
 	MaxReconnectAttempts int `toml:"max_reconnect_attempts"`
 
 	// whether disable re-sync for broken connection
 	DisableRetrySync bool `toml:"disable_retry_sync"`
 
+	// RetryPolicy decides when to re-sync after the connection is broken, e.g,
+	// replication.ExponentialBackoff. Default is 1s delay with MaxReconnectAttempts.
+	RetryPolicy replication.RetryPolicy
+
+	// OnReconnect is called after every attempt to re-sync if it's not nil.
+	OnReconnect func(replication.ReconnectInfo)
+
+	// Metrics receives the metrics of the binlog syncer if it's not nil, e.g,
+	// replication.PrometheusMetrics.
+	Metrics replication.Metrics
+
 	// whether the function WaitUntilPos() can use FLUSH BINARY LOGS
 	// to ensure we advance past a position. This should not strictly be required,
 	// and requires additional privileges.
@@ -114,6 +137,43 @@ type Config struct {
 	// if you table contain large columns, you can decrease this value to avoid OOM.
 	EventCacheCount int
 
+	// EventCacheBytes limits the total size of the events waiting in the BinlogStreamer besides
+	// EventCacheCount, so the huge events don't take too much memory. Default 0, no limit.
+	EventCacheBytes int64 `toml:"event_cache_bytes"`
+
+	// LazyRowsEvent decodes the rows of a rows event one by one when they are read by
+	// RowsEvent.ForEachRow, instead of all the rows before OnRow. RowsEvent.Rows is nil then, except
+	// for the tables in the window of an incremental snapshot, whose rows are decoded before OnRow
+	// to collect the changed keys.
+	LazyRowsEvent bool `toml:"lazy_rows_event"`
+
+	// ApplyJsonDiffs replaces the partial JSON updates of binlog_row_value_options=PARTIAL_JSON in
+	// the updated rows with the full JSON documents, instead of the []*replication.JsonDiff values.
+	// The before images must have the JSON columns, e.g, with binlog_row_image=FULL.
+	ApplyJsonDiffs bool `toml:"apply_json_diffs"`
+
+	// SchemaHistory makes Canal track the schemas of the tables by replaying the DDL in the
+	// binlog, instead of fetching the current schemas from the server, so the rows of the old
+	// binlog are decoded with the schemas in effect when they're written. The versions of the
+	// schemas are saved into it, e.g, NewFileSchemaHistoryStore. The schemas are loaded from
+	// the server only if there is no version saved before the position to sync from.
+	SchemaHistory SchemaHistoryStore
+
+	// TableMapSchema makes Canal build the tables of the rows events from the optional metadata
+	// of the table map events, instead of fetching them from the server, it requires
+	// binlog_row_metadata=FULL. The tables have no display widths of the integers, auto_increment
+	// or generated extras and indexes except the primary key, see NewTableFromTableMap. NewCanal
+	// only warns if binlog_row_metadata can't be checked or isn't FULL, the rows events of the
+	// table map events without the column names fail then.
+	TableMapSchema bool `toml:"table_map_schema"`
+
+	// SignalTable is the table as db.table for the watermarks and the progress of the
+	// incremental snapshots started by TriggerSnapshot, whose first columns are id, type and
+	// data, e.g, CREATE TABLE signal (id varchar(255) PRIMARY KEY, type varchar(32) NOT NULL,
+	// data varchar(2048)). It also keeps the tables included by TriggerSnapshot. Its rows are not
+	// passed to OnRow.
+	SignalTable string `toml:"signal_table"`
+
 	// FillZeroLogPos enables dynamic LogPos calculation for MariaDB.
 	// When enabled, automatically adds BINLOG_SEND_ANNOTATE_ROWS_EVENT flag
 	// to ensure correct position calculation in MariaDB 11.4+.
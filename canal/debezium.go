@@ -0,0 +1,1055 @@
+package canal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/charset"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// DebeziumConfig is the config of DebeziumEncoder.
+type DebeziumConfig struct {
+	// ServerName is the logical name of the server like topic.prefix of Debezium, which
+	// prefixes the topics and the schema names.
+	ServerName string
+	// Version is the version in the source, default "go-mysql".
+	Version string
+	// SkipSchema omits the schema sections, like schemas.enable=false of JsonConverter.
+	SkipSchema bool
+	// Tombstones makes every delete followed by a message without value, like
+	// tombstones.on.delete of Debezium.
+	Tombstones bool
+	// TimestampLocation is the location of the TIMESTAMP strings in the rows, the same as
+	// Config.TimestampStringLocation, default time.Local.
+	TimestampLocation *time.Location
+}
+
+// DebeziumMessage is a message in the format of the Debezium MySQL connector, with
+// decimal.handling.mode=precise and time.precision.mode=adaptive_time_microseconds.
+type DebeziumMessage struct {
+	// Topic is server.db.table for the rows, server for DDL, and __debezium-heartbeat.server
+	// for the heartbeats.
+	Topic string
+	// Key is nil for the tables without primary key.
+	Key []byte
+	// Value is nil for the tombstones.
+	Value []byte
+}
+
+// DebeziumSource is where the event is in the binlog, for the source of the messages.
+type DebeziumSource struct {
+	ServerID uint32
+	File     string
+	Pos      uint32
+	GTID     string
+	// Query is the statement of the rows with binlog_rows_query_log_events=ON.
+	Query string
+	// Timestamp is the seconds when the event is written into the binlog.
+	Timestamp uint32
+	// Snapshot is set for the rows read by the dump, and IncrementalSnapshot for the rows read by
+	// TriggerSnapshot. EncodeRows sets them by the RowsEvent.
+	Snapshot            bool
+	IncrementalSnapshot bool
+}
+
+// DebeziumTableChange is a table changed by DDL, Table is nil for DROP.
+type DebeziumTableChange struct {
+	// Type is CREATE, ALTER or DROP.
+	Type  string
+	DB    string
+	Name  string
+	Table *schema.Table
+}
+
+// DebeziumEncoder encodes the events of Canal as the Debezium messages in JSON.
+type DebeziumEncoder struct {
+	cfg DebeziumConfig
+	now func() time.Time
+}
+
+func NewDebeziumEncoder(cfg DebeziumConfig) *DebeziumEncoder {
+	if cfg.Version == "" {
+		cfg.Version = "go-mysql"
+	}
+	if cfg.TimestampLocation == nil {
+		cfg.TimestampLocation = time.Local
+	}
+	return &DebeziumEncoder{cfg: cfg, now: utils.Now}
+}
+
+// jsonObject is a JSON object keeping the order of the fields, e.g, the columns.
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// debeziumSchema is the schema of a value of Kafka Connect.
+type debeziumSchema struct {
+	Type       string            `json:"type"`
+	Items      *debeziumSchema   `json:"items,omitempty"`
+	Fields     []*debeziumSchema `json:"fields,omitempty"`
+	Optional   bool              `json:"optional"`
+	Name       string            `json:"name,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	Parameters jsonObject        `json:"parameters,omitempty"`
+	Default    interface{}       `json:"default,omitempty"`
+	Field      string            `json:"field,omitempty"`
+}
+
+func newDebeziumField(field string, tp string, optional bool) *debeziumSchema {
+	return &debeziumSchema{Type: tp, Optional: optional, Field: field}
+}
+
+func newDebeziumStruct(field string, name string, optional bool, fields ...*debeziumSchema) *debeziumSchema {
+	return &debeziumSchema{Type: "struct", Fields: fields, Optional: optional, Name: name, Field: field}
+}
+
+// message returns the message of the key and the value with their schemas.
+func (e *DebeziumEncoder) message(topic string, keySchema *debeziumSchema, key interface{}, valueSchema *debeziumSchema, value interface{}) (*DebeziumMessage, error) {
+	m := &DebeziumMessage{Topic: topic}
+	var err error
+	if key != nil {
+		if m.Key, err = e.marshal(keySchema, key); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if value != nil {
+		if m.Value, err = e.marshal(valueSchema, value); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return m, nil
+}
+
+func (e *DebeziumEncoder) marshal(s *debeziumSchema, payload interface{}) ([]byte, error) {
+	if e.cfg.SkipSchema {
+		return json.Marshal(payload)
+	}
+	return json.Marshal(jsonObject{{"schema", s}, {"payload", payload}})
+}
+
+func (e *DebeziumEncoder) sourceSchema() *debeziumSchema {
+	snapshot := &debeziumSchema{
+		Type: "string", Optional: true, Name: "io.debezium.data.Enum", Version: 1,
+		Parameters: jsonObject{{"allowed", "true,last,false,incremental"}}, Default: "false", Field: "snapshot",
+	}
+	return newDebeziumStruct("source", "io.debezium.connector.mysql.Source", false,
+		newDebeziumField("version", "string", false),
+		newDebeziumField("connector", "string", false),
+		newDebeziumField("name", "string", false),
+		newDebeziumField("ts_ms", "int64", false),
+		snapshot,
+		newDebeziumField("db", "string", false),
+		newDebeziumField("sequence", "string", true),
+		newDebeziumField("table", "string", true),
+		newDebeziumField("server_id", "int64", false),
+		newDebeziumField("gtid", "string", true),
+		newDebeziumField("file", "string", false),
+		newDebeziumField("pos", "int64", false),
+		newDebeziumField("row", "int32", false),
+		newDebeziumField("thread", "int64", true),
+		newDebeziumField("query", "string", true),
+	)
+}
+
+func (e *DebeziumEncoder) source(s *DebeziumSource, db string, table string, row int) jsonObject {
+	snapshot := "false"
+	if s.IncrementalSnapshot {
+		snapshot = "incremental"
+	} else if s.Snapshot {
+		snapshot = "true"
+	}
+	ts := int64(s.Timestamp) * 1000
+	if ts == 0 {
+		ts = e.now().UnixMilli()
+	}
+	var tableName, gtid, query interface{}
+	if table != "" {
+		tableName = table
+	}
+	if s.GTID != "" {
+		gtid = s.GTID
+	}
+	if s.Query != "" {
+		query = s.Query
+	}
+	return jsonObject{
+		{"version", e.cfg.Version},
+		{"connector", "mysql"},
+		{"name", e.cfg.ServerName},
+		{"ts_ms", ts},
+		{"snapshot", snapshot},
+		{"db", db},
+		{"sequence", nil},
+		{"table", tableName},
+		{"server_id", s.ServerID},
+		{"gtid", gtid},
+		{"file", s.File},
+		{"pos", s.Pos},
+		{"row", row},
+		{"thread", nil},
+		{"query", query},
+	}
+}
+
+// EncodeRows encodes the rows as the messages of the create, update, delete or read (for the
+// dump and the incremental snapshot) operations. The update changing the primary key is encoded
+// as a delete and a create like Debezium. The rows decoded lazily are encoded one by one.
+func (e *DebeziumEncoder) EncodeRows(re *RowsEvent, source DebeziumSource) ([]*DebeziumMessage, error) {
+	ta := re.Table
+	topic := fmt.Sprintf("%s.%s.%s", e.cfg.ServerName, ta.Schema, ta.Name)
+
+	var keySchema *debeziumSchema
+	if len(ta.PKColumns) > 0 {
+		keySchema = newDebeziumStruct("", topic+".Key", false)
+		for _, index := range ta.PKColumns {
+			keySchema.Fields = append(keySchema.Fields, e.columnSchema(&ta.Columns[index], false))
+		}
+	}
+	rowSchema := func(field string) *debeziumSchema {
+		s := newDebeziumStruct(field, topic+".Value", true)
+		for i := range ta.Columns {
+			s.Fields = append(s.Fields, e.columnSchema(&ta.Columns[i], !ta.IsPrimaryKey(i)))
+		}
+		return s
+	}
+	valueSchema := newDebeziumStruct("", topic+".Envelope", false,
+		rowSchema("before"),
+		rowSchema("after"),
+		e.sourceSchema(),
+		newDebeziumField("op", "string", false),
+		newDebeziumField("ts_ms", "int64", true),
+		&debeziumSchema{
+			Type: "struct", Optional: true, Name: "event.block", Version: 1, Field: "transaction",
+			Fields: []*debeziumSchema{
+				newDebeziumField("id", "string", false),
+				newDebeziumField("total_order", "int64", false),
+				newDebeziumField("data_collection_order", "int64", false),
+			},
+		},
+	)
+
+	var messages []*DebeziumMessage
+	add := func(op string, before []interface{}, after []interface{}, row int) error {
+		var key interface{}
+		var beforeValue, afterValue interface{}
+		var err error
+		if before != nil {
+			if beforeValue, err = e.row(ta, before, nil); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if after != nil {
+			if afterValue, err = e.row(ta, after, nil); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if keySchema != nil {
+			keyRow := after
+			if keyRow == nil {
+				keyRow = before
+			}
+			if key, err = e.row(ta, keyRow, ta.PKColumns); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		value := jsonObject{
+			{"before", beforeValue},
+			{"after", afterValue},
+			{"source", e.source(&source, ta.Schema, ta.Name, row)},
+			{"op", op},
+			{"ts_ms", e.now().UnixMilli()},
+			{"transaction", nil},
+		}
+		m, err := e.message(topic, keySchema, key, valueSchema, value)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		messages = append(messages, m)
+		if op == "d" && e.cfg.Tombstones && key != nil {
+			tombstone, err := e.message(topic, keySchema, key, nil, nil)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			messages = append(messages, tombstone)
+		}
+		return nil
+	}
+
+	i := 0
+	var err error
+	switch re.Action {
+	case InsertAction:
+		op := "c"
+		if re.IncrementalSnapshot() {
+			op = "r"
+			source.IncrementalSnapshot = true
+		} else if re.Header == nil {
+			op = "r"
+			source.Snapshot = true
+		}
+		err = re.ForEachRow(func(row []interface{}) error {
+			i++
+			return add(op, nil, row, i-1)
+		})
+	case DeleteAction:
+		err = re.ForEachRow(func(row []interface{}) error {
+			i++
+			return add("d", row, nil, i-1)
+		})
+	case UpdateAction:
+		// the before image is copied as the row is reused by ForEachRow
+		var before []interface{}
+		err = re.ForEachRow(func(row []interface{}) error {
+			i++
+			if i%2 == 1 {
+				before = slices.Clone(row)
+				return nil
+			}
+			n := i/2 - 1
+			changed, err := pkChanged(ta, before, row)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if !changed {
+				return add("u", before, row, n)
+			}
+			if err = add("d", before, nil, n); err != nil {
+				return err
+			}
+			return add("c", nil, row, n)
+		})
+	default:
+		return nil, errors.Errorf("unknown action %s", re.Action)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return messages, nil
+}
+
+func pkChanged(ta *schema.Table, before []interface{}, after []interface{}) (bool, error) {
+	if len(ta.PKColumns) == 0 {
+		return false, nil
+	}
+	b, err := snapshotRowKey(ta, before)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	a, err := snapshotRowKey(ta, after)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return a != b, nil
+}
+
+// row returns the values of the columns of the row, or only the columns of the indexes.
+func (e *DebeziumEncoder) row(ta *schema.Table, row []interface{}, indexes []int) (jsonObject, error) {
+	if len(row) != len(ta.Columns) {
+		return nil, errors.Errorf("table %s has %d columns, but row data %v len is %d", ta, len(ta.Columns), row, len(row))
+	}
+	if indexes == nil {
+		indexes = make([]int, len(ta.Columns))
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
+
+	o := make(jsonObject, 0, len(indexes))
+	for _, i := range indexes {
+		v, err := e.columnValue(&ta.Columns[i], row[i])
+		if err != nil {
+			return nil, errors.Annotatef(err, "column %s of %s", ta.Columns[i].Name, ta)
+		}
+		o = append(o, jsonField{ta.Columns[i].Name, v})
+	}
+	return o, nil
+}
+
+// debeziumType is how a column is encoded.
+type debeziumType int
+
+const (
+	debeziumString debeziumType = iota
+	debeziumInt16
+	debeziumInt32
+	debeziumInt64
+	debeziumDouble
+	debeziumDecimal
+	debeziumDate
+	debeziumTime
+	debeziumDatetimeMilli
+	debeziumDatetimeMicro
+	debeziumTimestamp
+	debeziumYear
+	debeziumEnum
+	debeziumSet
+	debeziumJSON
+	debeziumBool
+	debeziumBits
+	debeziumBytes
+	debeziumGeometry
+)
+
+// baseType returns the type of the column without the lengths and the attributes, e.g, int for
+// int(11) unsigned.
+func baseType(rawType string) string {
+	tp := strings.ToLower(rawType)
+	if i := strings.IndexAny(tp, "( "); i >= 0 {
+		tp = tp[:i]
+	}
+	return tp
+}
+
+// typeArgs returns the numbers in the parentheses of the type, e.g, 10 and 2 for decimal(10,2).
+func typeArgs(rawType string) []int {
+	start := strings.IndexByte(rawType, '(')
+	end := strings.IndexByte(rawType, ')')
+	if start < 0 || end < start {
+		return nil
+	}
+	var args []int
+	for _, s := range strings.Split(rawType[start+1:end], ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil
+		}
+		args = append(args, n)
+	}
+	return args
+}
+
+func debeziumColumnType(col *schema.TableColumn) debeziumType {
+	unsigned := strings.Contains(strings.ToLower(col.RawType), "unsigned")
+	args := typeArgs(col.RawType)
+	switch baseType(col.RawType) {
+	case "tinyint", "bool", "boolean":
+		return debeziumInt16
+	case "smallint":
+		if unsigned {
+			return debeziumInt32
+		}
+		return debeziumInt16
+	case "mediumint":
+		return debeziumInt32
+	case "int", "integer":
+		if unsigned {
+			return debeziumInt64
+		}
+		return debeziumInt32
+	case "bigint":
+		return debeziumInt64
+	case "float", "double", "real":
+		return debeziumDouble
+	case "decimal", "numeric", "dec", "fixed":
+		return debeziumDecimal
+	case "date":
+		return debeziumDate
+	case "time":
+		return debeziumTime
+	case "datetime":
+		if len(args) > 0 && args[0] > 3 {
+			return debeziumDatetimeMicro
+		}
+		return debeziumDatetimeMilli
+	case "timestamp":
+		return debeziumTimestamp
+	case "year":
+		return debeziumYear
+	case "enum":
+		return debeziumEnum
+	case "set":
+		return debeziumSet
+	case "json":
+		return debeziumJSON
+	case "bit":
+		if len(args) == 0 || args[0] == 1 {
+			return debeziumBool
+		}
+		return debeziumBits
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return debeziumBytes
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return debeziumGeometry
+	}
+	return debeziumString
+}
+
+func (e *DebeziumEncoder) columnSchema(col *schema.TableColumn, optional bool) *debeziumSchema {
+	s := &debeziumSchema{Optional: optional, Field: col.Name}
+	args := typeArgs(col.RawType)
+	switch debeziumColumnType(col) {
+	case debeziumInt16:
+		s.Type = "int16"
+	case debeziumInt32:
+		s.Type = "int32"
+	case debeziumInt64:
+		s.Type = "int64"
+	case debeziumDouble:
+		s.Type = "double"
+	case debeziumDecimal:
+		precision, scale := 10, 0
+		if len(args) > 0 {
+			precision = args[0]
+		}
+		if len(args) > 1 {
+			scale = args[1]
+		}
+		s.Type, s.Name, s.Version = "bytes", "org.apache.kafka.connect.data.Decimal", 1
+		s.Parameters = jsonObject{{"scale", strconv.Itoa(scale)}, {"connect.decimal.precision", strconv.Itoa(precision)}}
+	case debeziumDate:
+		s.Type, s.Name, s.Version = "int32", "io.debezium.time.Date", 1
+	case debeziumTime:
+		s.Type, s.Name, s.Version = "int64", "io.debezium.time.MicroTime", 1
+	case debeziumDatetimeMilli:
+		s.Type, s.Name, s.Version = "int64", "io.debezium.time.Timestamp", 1
+	case debeziumDatetimeMicro:
+		s.Type, s.Name, s.Version = "int64", "io.debezium.time.MicroTimestamp", 1
+	case debeziumTimestamp:
+		s.Type, s.Name, s.Version = "string", "io.debezium.time.ZonedTimestamp", 1
+	case debeziumYear:
+		s.Type, s.Name, s.Version = "int32", "io.debezium.time.Year", 1
+	case debeziumEnum:
+		s.Type, s.Name, s.Version = "string", "io.debezium.data.Enum", 1
+		s.Parameters = jsonObject{{"allowed", strings.Join(col.EnumValues, ",")}}
+	case debeziumSet:
+		s.Type, s.Name, s.Version = "string", "io.debezium.data.EnumSet", 1
+		s.Parameters = jsonObject{{"allowed", strings.Join(col.SetValues, ",")}}
+	case debeziumJSON:
+		s.Type, s.Name, s.Version = "string", "io.debezium.data.Json", 1
+	case debeziumBool:
+		s.Type = "boolean"
+	case debeziumBits:
+		s.Type, s.Name, s.Version = "bytes", "io.debezium.data.Bits", 1
+		s.Parameters = jsonObject{{"length", strconv.Itoa(args[0])}}
+	case debeziumBytes:
+		s.Type = "bytes"
+	case debeziumGeometry:
+		s.Type, s.Name = "struct", "io.debezium.data.geometry.Geometry"
+		s.Fields = []*debeziumSchema{newDebeziumField("wkb", "bytes", false), newDebeziumField("srid", "int32", true)}
+	default:
+		s.Type = "string"
+	}
+	return s
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// parseDatetime parses the DATETIME or TIMESTAMP string of the rows, zero dates are invalid.
+func parseDatetime(v interface{}, loc *time.Location) (time.Time, bool) {
+	if t, ok := v.(time.Time); ok {
+		return t, true
+	}
+	s := toString(v)
+	layout := "2006-01-02 15:04:05"
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		layout += "." + strings.Repeat("0", len(s)-i-1)
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	return t, err == nil
+}
+
+// parseMicroTime returns the microseconds of the TIME string like -838:59:59.000000.
+func parseMicroTime(s string) (int64, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	hours, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	minutes, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	seconds, frac, _ := strings.Cut(parts[2], ".")
+	secs, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	var micros int64
+	if frac != "" {
+		frac = (frac + "000000")[:6]
+		if micros, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return 0, errors.Errorf("invalid time %q", s)
+		}
+	}
+	n := ((hours*60+minutes)*60+secs)*1000000 + micros
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// twosComplement returns the big-endian two's complement of n in the minimal bytes, like
+// BigInteger.toByteArray of Java.
+func twosComplement(n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	abs := new(big.Int).Neg(n)
+	size := new(big.Int).Sub(abs, big.NewInt(1)).BitLen()/8 + 1
+	b := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(size*8)), n).Bytes()
+	return append(bytes.Repeat([]byte{0xff}, size-len(b)), b...)
+}
+
+func toDecimal(v interface{}) (decimal.Decimal, error) {
+	switch d := v.(type) {
+	case decimal.Decimal:
+		return d, nil
+	case float64:
+		return decimal.NewFromFloat(d), nil
+	case float32:
+		return decimal.NewFromFloat32(d), nil
+	}
+	if n, ok := toInt64(v); ok {
+		return decimal.NewFromInt(n), nil
+	}
+	return decimal.NewFromString(toString(v))
+}
+
+// columnValue returns the value of the column in the rows in the type of its schema.
+func (e *DebeziumEncoder) columnValue(col *schema.TableColumn, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch debeziumColumnType(col) {
+	case debeziumInt16, debeziumInt32, debeziumInt64, debeziumYear:
+		// bigint unsigned overflows like bigint.unsigned.handling.mode=long
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+	case debeziumDouble:
+		switch f := v.(type) {
+		case float64:
+			return f, nil
+		case float32:
+			// the shortest decimal of the float
+			return strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+		case decimal.Decimal:
+			n, _ := f.Float64()
+			return n, nil
+		}
+		return strconv.ParseFloat(toString(v), 64)
+	case debeziumDecimal:
+		d, err := toDecimal(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		scale := 0
+		if args := typeArgs(col.RawType); len(args) > 1 {
+			scale = args[1]
+		}
+		return twosComplement(d.Round(int32(scale)).Shift(int32(scale)).BigInt()), nil
+	case debeziumDate:
+		t, ok := v.(time.Time)
+		if !ok {
+			var err error
+			if t, err = time.ParseInLocation("2006-01-02", toString(v), time.UTC); err != nil {
+				// zero dates
+				return nil, nil
+			}
+		}
+		days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+		return int32(days), nil
+	case debeziumTime:
+		if d, ok := v.(time.Duration); ok {
+			return d.Microseconds(), nil
+		}
+		return parseMicroTime(toString(v))
+	case debeziumDatetimeMilli, debeziumDatetimeMicro:
+		t, ok := parseDatetime(v, time.UTC)
+		if !ok {
+			return nil, nil
+		}
+		if debeziumColumnType(col) == debeziumDatetimeMilli {
+			return t.UnixMilli(), nil
+		}
+		return t.UnixMicro(), nil
+	case debeziumTimestamp:
+		t, ok := parseDatetime(v, e.cfg.TimestampLocation)
+		if !ok {
+			return nil, nil
+		}
+		layout := "2006-01-02T15:04:05"
+		if args := typeArgs(col.RawType); len(args) > 0 && args[0] > 0 {
+			layout += "." + strings.Repeat("0", args[0])
+		}
+		return t.UTC().Format(layout) + "Z", nil
+	case debeziumEnum:
+		if n, ok := v.(int64); ok {
+			if n <= 0 || int(n) > len(col.EnumValues) {
+				return "", nil
+			}
+			return col.EnumValues[n-1], nil
+		}
+		return toString(v), nil
+	case debeziumSet:
+		if n, ok := v.(int64); ok {
+			var values []string
+			for i, value := range col.SetValues {
+				if n&(1<<uint(i)) != 0 {
+					values = append(values, value)
+				}
+			}
+			return strings.Join(values, ","), nil
+		}
+		return toString(v), nil
+	case debeziumJSON:
+		return toString(v), nil
+	case debeziumBool:
+		if n, ok := toInt64(v); ok {
+			return n != 0, nil
+		}
+		return toString(v) != "\x00", nil
+	case debeziumBits:
+		// little-endian like java.util.BitSet
+		size := (typeArgs(col.RawType)[0] + 7) / 8
+		b := make([]byte, 8)
+		if n, ok := toInt64(v); ok {
+			binary.LittleEndian.PutUint64(b, uint64(n))
+		} else {
+			s := toString(v)
+			for i := 0; i < len(s) && i < 8; i++ {
+				b[i] = s[len(s)-1-i]
+			}
+		}
+		return b[:size], nil
+	case debeziumBytes:
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+		return []byte(toString(v)), nil
+	case debeziumGeometry:
+		// SRID in 4 bytes and WKB
+		b := []byte(toString(v))
+		if len(b) < 4 {
+			return nil, errors.Errorf("invalid geometry %v", v)
+		}
+		return jsonObject{{"wkb", b[4:]}, {"srid", int32(binary.LittleEndian.Uint32(b))}}, nil
+	default:
+		return toString(v), nil
+	}
+	return nil, errors.Errorf("invalid value %v(%T) of %s", v, v, col.RawType)
+}
+
+// EncodeDDL encodes the DDL as a schema change message, with the tables changed by it.
+func (e *DebeziumEncoder) EncodeDDL(source DebeziumSource, db string, ddl string, changes []DebeziumTableChange) (*DebeziumMessage, error) {
+	keySchema := newDebeziumStruct("", "io.debezium.connector.mysql.SchemaChangeKey", false,
+		newDebeziumField("databaseName", "string", false))
+
+	columnSchema := newDebeziumStruct("", "io.debezium.connector.schema.Column", false,
+		newDebeziumField("name", "string", false),
+		newDebeziumField("typeName", "string", false),
+		newDebeziumField("typeExpression", "string", true),
+		newDebeziumField("charsetName", "string", true),
+		newDebeziumField("length", "int32", true),
+		newDebeziumField("scale", "int32", true),
+		newDebeziumField("position", "int32", false),
+		newDebeziumField("optional", "boolean", true),
+		newDebeziumField("autoIncremented", "boolean", true),
+		newDebeziumField("generated", "boolean", true),
+	)
+	tableSchema := newDebeziumStruct("table", "io.debezium.connector.schema.Table", true,
+		newDebeziumField("defaultCharsetName", "string", true),
+		&debeziumSchema{Type: "array", Items: newDebeziumField("", "string", false), Optional: true, Field: "primaryKeyColumnNames"},
+		&debeziumSchema{Type: "array", Items: columnSchema, Optional: false, Field: "columns"},
+	)
+	changeSchema := newDebeziumStruct("", "io.debezium.connector.schema.Change", false,
+		newDebeziumField("type", "string", false),
+		newDebeziumField("id", "string", false),
+		tableSchema,
+	)
+	valueSchema := newDebeziumStruct("", "io.debezium.connector.mysql.SchemaChangeValue", false,
+		e.sourceSchema(),
+		newDebeziumField("ts_ms", "int64", false),
+		newDebeziumField("databaseName", "string", true),
+		newDebeziumField("schemaName", "string", true),
+		newDebeziumField("ddl", "string", true),
+		&debeziumSchema{Type: "array", Items: changeSchema, Optional: false, Field: "tableChanges"},
+	)
+
+	tableChanges := make([]jsonObject, 0, len(changes))
+	for _, change := range changes {
+		var table interface{}
+		if change.Table != nil {
+			table = debeziumTable(change.Table)
+		}
+		tableChanges = append(tableChanges, jsonObject{
+			{"type", change.Type},
+			{"id", fmt.Sprintf("%q.%q", change.DB, change.Name)},
+			{"table", table},
+		})
+	}
+
+	value := jsonObject{
+		{"source", e.source(&source, db, "", 0)},
+		{"ts_ms", e.now().UnixMilli()},
+		{"databaseName", db},
+		{"schemaName", nil},
+		{"ddl", ddl},
+		{"tableChanges", tableChanges},
+	}
+	return e.message(e.cfg.ServerName, keySchema, jsonObject{{"databaseName", db}}, valueSchema, value)
+}
+
+func debeziumTable(ta *schema.Table) jsonObject {
+	pk := make([]string, len(ta.PKColumns))
+	for i, index := range ta.PKColumns {
+		pk[i] = ta.Columns[index].Name
+	}
+
+	columns := make([]jsonObject, len(ta.Columns))
+	for i, col := range ta.Columns {
+		var charsetName, length, scale interface{}
+		if col.Collation != "" {
+			if c, err := charset.GetCollationByName(col.Collation); err == nil {
+				charsetName = c.CharsetName
+			}
+		}
+		args := typeArgs(col.RawType)
+		if len(args) > 0 {
+			length = args[0]
+		}
+		if len(args) > 1 {
+			scale = args[1]
+		}
+		typeName := strings.ToUpper(baseType(col.RawType))
+		if strings.Contains(strings.ToLower(col.RawType), "unsigned") {
+			typeName += " UNSIGNED"
+		}
+		columns[i] = jsonObject{
+			{"name", col.Name},
+			{"typeName", typeName},
+			{"typeExpression", typeName},
+			{"charsetName", charsetName},
+			{"length", length},
+			{"scale", scale},
+			{"position", i + 1},
+			{"optional", !ta.IsPrimaryKey(i)},
+			{"autoIncremented", col.IsAuto},
+			{"generated", col.IsVirtual || col.IsStored},
+		}
+	}
+	return jsonObject{
+		{"defaultCharsetName", nil},
+		{"primaryKeyColumnNames", pk},
+		{"columns", columns},
+	}
+}
+
+// EncodeHeartbeat encodes a heartbeat message, which is sent periodically to advance the
+// offsets of the consumers like heartbeat.interval.ms of Debezium.
+func (e *DebeziumEncoder) EncodeHeartbeat() (*DebeziumMessage, error) {
+	keySchema := newDebeziumStruct("", "io.debezium.connector.common.ServerNameKey", false,
+		newDebeziumField("serverName", "string", false))
+	valueSchema := newDebeziumStruct("", "io.debezium.connector.common.Heartbeat", false,
+		newDebeziumField("ts_ms", "int64", false))
+	return e.message("__debezium-heartbeat."+e.cfg.ServerName,
+		keySchema, jsonObject{{"serverName", e.cfg.ServerName}},
+		valueSchema, jsonObject{{"ts_ms", e.now().UnixMilli()}})
+}
+
+// DebeziumEventHandler is an EventHandler sending the rows and DDL synced by Canal as the
+// Debezium messages.
+type DebeziumEventHandler struct {
+	DummyEventHandler
+
+	c       *Canal
+	encoder *DebeziumEncoder
+	send    func(m *DebeziumMessage) error
+
+	file    string
+	gtid    string
+	query   string
+	changed []DebeziumTableChange
+}
+
+func NewDebeziumEventHandler(c *Canal, encoder *DebeziumEncoder, send func(m *DebeziumMessage) error) *DebeziumEventHandler {
+	return &DebeziumEventHandler{c: c, encoder: encoder, send: send}
+}
+
+func (h *DebeziumEventHandler) source(header *replication.EventHeader) DebeziumSource {
+	file := h.file
+	if file == "" {
+		file = h.c.SyncedPosition().Name
+	}
+	s := DebeziumSource{File: file, GTID: h.gtid, Query: h.query, Pos: h.c.SyncedPosition().Pos}
+	if header != nil {
+		s.ServerID = header.ServerID
+		s.Timestamp = header.Timestamp
+		// LogPos is 0 for the artificial events, or of MariaDB without FillZeroLogPos
+		if header.LogPos >= header.EventSize {
+			s.Pos = header.LogPos - header.EventSize
+		}
+	}
+	return s
+}
+
+func (h *DebeziumEventHandler) OnRotate(_ *replication.EventHeader, e *replication.RotateEvent) error {
+	h.file = string(e.NextLogName)
+	return nil
+}
+
+func (h *DebeziumEventHandler) OnGTID(_ *replication.EventHeader, e mysql.BinlogGTIDEvent) error {
+	gset, err := e.GTIDNext()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	h.gtid = gset.String()
+	return nil
+}
+
+func (h *DebeziumEventHandler) OnRowsQueryEvent(e *replication.RowsQueryEvent) error {
+	h.query = string(e.Query)
+	return nil
+}
+
+func (h *DebeziumEventHandler) OnXID(*replication.EventHeader, mysql.Position) error {
+	h.query = ""
+	return nil
+}
+
+func (h *DebeziumEventHandler) OnTableChanged(_ *replication.EventHeader, db string, table string) error {
+	h.changed = append(h.changed, DebeziumTableChange{DB: db, Name: table})
+	return nil
+}
+
+func (h *DebeziumEventHandler) OnDDL(header *replication.EventHeader, _ mysql.Position, e *replication.QueryEvent) error {
+	changes := h.changed
+	h.changed = nil
+
+	ddl := string(e.Query)
+	tp := "ALTER"
+	if fields := strings.Fields(ddl); len(fields) > 0 {
+		switch strings.ToUpper(fields[0]) {
+		case "CREATE":
+			tp = "CREATE"
+		case "DROP":
+			tp = "DROP"
+		}
+	}
+	for i := range changes {
+		changes[i].Type = tp
+		if tp == "DROP" {
+			continue
+		}
+		ta, err := h.c.GetTable(changes[i].DB, changes[i].Name)
+		if err == nil {
+			changes[i].Table = ta
+		} else if errors.Cause(err) == schema.ErrTableNotExist {
+			// e.g, the old table of RENAME
+			changes[i].Type = "DROP"
+		} else if errors.Cause(err) != ErrExcludedTable {
+			return errors.Trace(err)
+		}
+	}
+
+	m, err := h.encoder.EncodeDDL(h.source(header), string(e.Schema), ddl, changes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return h.send(m)
+}
+
+func (h *DebeziumEventHandler) OnRow(e *RowsEvent) error {
+	messages, err := h.encoder.EncodeRows(e, h.source(e.Header))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, m := range messages {
+		if err = h.send(m); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (h *DebeziumEventHandler) String() string {
+	return "DebeziumEventHandler"
+}
@@ -0,0 +1,311 @@
+package canal
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+// checkDebeziumGolden compares the messages with testdata/debezium/name.json.
+func checkDebeziumGolden(t *testing.T, name string, messages ...*DebeziumMessage) {
+	t.Helper()
+
+	type goldenMessage struct {
+		Topic string          `json:"topic"`
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	golden := make([]goldenMessage, len(messages))
+	for i, m := range messages {
+		golden[i] = goldenMessage{Topic: m.Topic, Key: m.Key, Value: m.Value}
+	}
+	data, err := json.Marshal(golden)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, json.Indent(&b, data, "", "  "))
+	b.WriteByte('\n')
+
+	path := filepath.Join("testdata", "debezium", name+".json")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, b.Bytes(), 0o644))
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), b.String())
+}
+
+func newTestDebeziumEncoder(cfg DebeziumConfig) *DebeziumEncoder {
+	cfg.ServerName = "dbserver1"
+	cfg.TimestampLocation = time.UTC
+	enc := NewDebeziumEncoder(cfg)
+	enc.now = func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	return enc
+}
+
+// newTestDebeziumTable returns the table of all the types mapped by DebeziumEncoder.
+func newTestDebeziumTable() *schema.Table {
+	ta := &schema.Table{Schema: "inventory", Name: "types"}
+	ta.AddColumn("id", "int(10) unsigned", "", "auto_increment")
+	ta.AddColumn("tiny", "tinyint(4)", "", "")
+	ta.AddColumn("small", "smallint(5) unsigned", "", "")
+	ta.AddColumn("big", "bigint(20) unsigned", "", "")
+	ta.AddColumn("price", "decimal(10,2)", "", "")
+	ta.AddColumn("debt", "decimal(5,2)", "", "")
+	ta.AddColumn("ratio", "float", "", "")
+	ta.AddColumn("score", "double", "", "")
+	ta.AddColumn("day", "date", "", "")
+	ta.AddColumn("elapsed", "time(3)", "", "")
+	ta.AddColumn("created", "datetime", "", "")
+	ta.AddColumn("updated", "datetime(6)", "", "")
+	ta.AddColumn("seen", "timestamp(3)", "", "")
+	ta.AddColumn("born", "year(4)", "", "")
+	ta.AddColumn("state", "enum('new','done')", "utf8mb4_general_ci", "")
+	ta.AddColumn("tags", "set('x','y','z')", "utf8mb4_general_ci", "")
+	ta.AddColumn("doc", "json", "", "")
+	ta.AddColumn("active", "bit(1)", "", "")
+	ta.AddColumn("flags", "bit(10)", "", "")
+	ta.AddColumn("data", "varbinary(4)", "", "")
+	ta.AddColumn("name", "varchar(10)", "utf8mb4_general_ci", "")
+	ta.AddColumn("pos", "point", "", "")
+	ta.AddIndex("PRIMARY").AddColumn("id", 0)
+	ta.PKColumns = []int{0}
+	return ta
+}
+
+func newTestDebeziumRow(id uint32) []interface{} {
+	// SRID 4326 and POINT(1 2) in WKB
+	point := []byte{0xe6, 0x10, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40}
+	return []interface{}{
+		id, int8(-1), uint16(65535), uint64(18446744073709551615), 123.45, -1.5, float32(0.1), 2.5,
+		"2024-01-02", "-01:02:03.500", "2024-01-02 03:04:05", "2024-01-02 03:04:05.123456", "2024-01-02 03:04:05.120",
+		2024, int64(2), int64(5), []byte(`{"a":1}`), int64(1), int64(0x201), []byte{0, 1, 2, 0xff}, "héllo", point,
+	}
+}
+
+func newTestDebeziumRowsEvent(ta *schema.Table, action string, rows ...[]interface{}) *RowsEvent {
+	return &RowsEvent{
+		Table:  ta,
+		Action: action,
+		Rows:   rows,
+		Header: &replication.EventHeader{Timestamp: 1704164645, ServerID: 1, LogPos: 1000, EventSize: 100},
+	}
+}
+
+func newTestDebeziumSource() DebeziumSource {
+	return DebeziumSource{
+		ServerID:  1,
+		File:      "mysql-bin.000003",
+		Pos:       900,
+		GTID:      "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+		Timestamp: 1704164645,
+	}
+}
+
+func TestDebeziumEncodeRows(t *testing.T) {
+	ta := newTestDebeziumTable()
+	enc := newTestDebeziumEncoder(DebeziumConfig{})
+
+	messages, err := enc.EncodeRows(newTestDebeziumRowsEvent(ta, InsertAction, newTestDebeziumRow(1)), newTestDebeziumSource())
+	require.NoError(t, err)
+	checkDebeziumGolden(t, "insert", messages...)
+
+	// zero dates and NULL
+	row := make([]interface{}, len(ta.Columns))
+	row[0] = uint32(2)
+	row[8], row[10], row[12] = "0000-00-00", "0000-00-00 00:00:00", "0000-00-00 00:00:00.000"
+	source := newTestDebeziumSource()
+	source.Query = "INSERT INTO types (id, day, created, seen) VALUES (2, 0, 0, 0)"
+	messages, err = enc.EncodeRows(newTestDebeziumRowsEvent(ta, InsertAction, row), source)
+	require.NoError(t, err)
+	checkDebeziumGolden(t, "insert_null", messages...)
+}
+
+func TestDebeziumEncodeChanges(t *testing.T) {
+	ta := &schema.Table{Schema: "inventory", Name: "customers"}
+	ta.AddColumn("id", "int(11)", "", "")
+	ta.AddColumn("email", "varchar(255)", "utf8mb4_general_ci", "")
+	ta.AddIndex("PRIMARY").AddColumn("id", 0)
+	ta.PKColumns = []int{0}
+
+	enc := newTestDebeziumEncoder(DebeziumConfig{SkipSchema: true, Tombstones: true})
+	var messages []*DebeziumMessage
+	for _, e := range []*RowsEvent{
+		newTestDebeziumRowsEvent(ta, UpdateAction,
+			[]interface{}{int32(1), "a@example.com"}, []interface{}{int32(1), "b@example.com"},
+			// the primary key is changed
+			[]interface{}{int32(2), "c@example.com"}, []interface{}{int32(3), "c@example.com"}),
+		newTestDebeziumRowsEvent(ta, DeleteAction, []interface{}{int32(1), "b@example.com"}),
+		// the rows of the dump
+		{Table: ta, Action: InsertAction, Rows: [][]interface{}{{int64(4), "d@example.com"}}},
+	} {
+		ms, err := enc.EncodeRows(e, newTestDebeziumSource())
+		require.NoError(t, err)
+		messages = append(messages, ms...)
+	}
+	checkDebeziumGolden(t, "changes", messages...)
+
+	// the table without primary key has no keys
+	noPK := &schema.Table{Schema: "inventory", Name: "logs"}
+	noPK.AddColumn("msg", "text", "utf8mb4_general_ci", "")
+	messages, err := enc.EncodeRows(newTestDebeziumRowsEvent(noPK, DeleteAction, []interface{}{"x"}), newTestDebeziumSource())
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Nil(t, messages[0].Key)
+
+	_, err = enc.EncodeRows(newTestDebeziumRowsEvent(ta, InsertAction, []interface{}{int32(1)}), newTestDebeziumSource())
+	require.Error(t, err)
+}
+
+func TestDebeziumEncodeSnapshotAndLazyRows(t *testing.T) {
+	ta := &schema.Table{Schema: "inventory", Name: "customers"}
+	ta.AddColumn("id", "int(11)", "", "")
+	ta.AddColumn("email", "varchar(255)", "utf8mb4_general_ci", "")
+	ta.AddIndex("PRIMARY").AddColumn("id", 0)
+	ta.PKColumns = []int{0}
+	enc := newTestDebeziumEncoder(DebeziumConfig{SkipSchema: true})
+
+	// the rows of the dump and TriggerSnapshot are both read operations
+	opAndSnapshot := func(e *RowsEvent) (string, string) {
+		messages, err := enc.EncodeRows(e, DebeziumSource{})
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		var value struct {
+			Op     string `json:"op"`
+			Source struct {
+				Snapshot string `json:"snapshot"`
+			} `json:"source"`
+		}
+		require.NoError(t, json.Unmarshal(messages[0].Value, &value))
+		return value.Op, value.Source.Snapshot
+	}
+	rows := [][]interface{}{{int32(1), "a@example.com"}}
+	op, snapshot := opAndSnapshot(&RowsEvent{Table: ta, Action: InsertAction, Rows: rows})
+	require.Equal(t, "r", op)
+	require.Equal(t, "true", snapshot)
+	op, snapshot = opAndSnapshot(&RowsEvent{Table: ta, Action: InsertAction, Rows: rows, incrementalSnapshot: true})
+	require.Equal(t, "r", op)
+	require.Equal(t, "incremental", snapshot)
+	op, snapshot = opAndSnapshot(newTestDebeziumRowsEvent(ta, InsertAction, rows...))
+	require.Equal(t, "c", op)
+	require.Equal(t, "false", snapshot)
+
+	// the rows decoded lazily are the same
+	updates := [][]interface{}{
+		{int32(1), "a@example.com"}, {int32(1), "b@example.com"},
+		{int32(2), "c@example.com"}, {int32(3), "c@example.com"},
+	}
+	tableMap := &replication.TableMapEvent{
+		TableID:     1,
+		Schema:      []byte("inventory"),
+		Table:       []byte("customers"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{0, 1020},
+		NullBitmap:  []byte{0x02},
+	}
+	expected, err := enc.EncodeRows(newTestDebeziumRowsEvent(ta, UpdateAction, updates...), newTestDebeziumSource())
+	require.NoError(t, err)
+	require.Len(t, expected, 3)
+	lazy := newTestDebeziumRowsEvent(ta, UpdateAction)
+	lazy.Rows = nil
+	lazy.raw = newTestLazyRowsEvent(t, replication.UPDATE_ROWS_EVENTv2, tableMap, updates...)
+	messages, err := enc.EncodeRows(lazy, newTestDebeziumSource())
+	require.NoError(t, err)
+	require.Equal(t, expected, messages)
+}
+
+func TestDebeziumEventHandlerSource(t *testing.T) {
+	c := &Canal{master: &masterInfo{logger: slog.Default()}}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000003", Pos: 500})
+	h := NewDebeziumEventHandler(c, newTestDebeziumEncoder(DebeziumConfig{}), nil)
+
+	s := h.source(&replication.EventHeader{ServerID: 1, LogPos: 1000, EventSize: 100})
+	require.Equal(t, "mysql-bin.000003", s.File)
+	require.Equal(t, uint32(900), s.Pos)
+	// LogPos is 0 without FillZeroLogPos of MariaDB
+	s = h.source(&replication.EventHeader{ServerID: 1, EventSize: 100})
+	require.Equal(t, uint32(500), s.Pos)
+	s = h.source(nil)
+	require.Equal(t, uint32(500), s.Pos)
+}
+
+func TestDebeziumEncodeDDL(t *testing.T) {
+	ta := &schema.Table{Schema: "inventory", Name: "customers"}
+	ta.AddColumn("id", "int(11)", "", "auto_increment")
+	ta.AddColumn("email", "varchar(255)", "utf8mb4_general_ci", "")
+	ta.AddColumn("balance", "decimal(10,2) unsigned", "", "")
+	ta.AddIndex("PRIMARY").AddColumn("id", 0)
+	ta.PKColumns = []int{0}
+
+	enc := newTestDebeziumEncoder(DebeziumConfig{})
+	m, err := enc.EncodeDDL(newTestDebeziumSource(), "inventory",
+		"RENAME TABLE inventory.users TO inventory.customers", []DebeziumTableChange{
+			{Type: "DROP", DB: "inventory", Name: "users"},
+			{Type: "CREATE", DB: "inventory", Name: "customers", Table: ta},
+		})
+	require.NoError(t, err)
+	checkDebeziumGolden(t, "ddl", m)
+}
+
+func TestDebeziumEncodeHeartbeat(t *testing.T) {
+	enc := newTestDebeziumEncoder(DebeziumConfig{})
+	m, err := enc.EncodeHeartbeat()
+	require.NoError(t, err)
+	checkDebeziumGolden(t, "heartbeat", m)
+}
+
+func TestDebeziumColumnValue(t *testing.T) {
+	enc := newTestDebeziumEncoder(DebeziumConfig{})
+	col := func(rawType string) *schema.TableColumn {
+		ta := &schema.Table{}
+		ta.AddColumn("c", rawType, "", "")
+		return &ta.Columns[0]
+	}
+
+	for _, c := range []struct {
+		rawType  string
+		value    interface{}
+		expected interface{}
+	}{
+		// the unscaled values in the two's complement
+		{"decimal(10,2)", 1.27, []byte{0x7f}},
+		{"decimal(10,2)", 1.28, []byte{0x00, 0x80}},
+		{"decimal(10,2)", -1.28, []byte{0x80}},
+		{"decimal(10,2)", -1.29, []byte{0xff, 0x7f}},
+		{"decimal(10,2)", "0", []byte{0x00}},
+		{"decimal(10,0)", float64(-256), []byte{0xff, 0x00}},
+		{"date", "1969-12-31", int32(-1)},
+		{"date", time.Date(1970, 1, 11, 0, 0, 0, 0, time.UTC), int32(10)},
+		{"time", "838:59:59", int64(3020399000000)},
+		{"datetime(3)", time.Date(1970, 1, 1, 0, 0, 1, 5e6, time.UTC), int64(1005)},
+		{"timestamp", "1970-01-01 00:00:00", "1970-01-01T00:00:00Z"},
+		{"enum('a','b')", int64(0), ""},
+		{"enum('a','b')", "b", "b"},
+		{"set('a','b')", int64(0), ""},
+		{"bit(1)", int64(0), false},
+		{"bit(16)", "\x01\x02", []byte{0x02, 0x01}},
+		{"float", float32(1.1), 1.1},
+		{"int(11)", int32(-5), int64(-5)},
+		{"char(3)", []byte("abc"), "abc"},
+	} {
+		v, err := enc.columnValue(col(c.rawType), c.value)
+		require.NoError(t, err, c.rawType)
+		require.Equal(t, c.expected, v, "%s %v", c.rawType, c.value)
+	}
+}
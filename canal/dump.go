@@ -116,6 +116,10 @@ func (h *dumpParseHandler) Data(db string, table string, values []string) error
 }
 
 func (c *Canal) AddDumpDatabases(dbs ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.AddDatabases(dbs...)
+		return
+	}
 	if c.dumper == nil {
 		return
 	}
@@ -124,6 +128,10 @@ func (c *Canal) AddDumpDatabases(dbs ...string) {
 }
 
 func (c *Canal) AddDumpTables(db string, tables ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.AddTables(db, tables...)
+		return
+	}
 	if c.dumper == nil {
 		return
 	}
@@ -132,6 +140,10 @@ func (c *Canal) AddDumpTables(db string, tables ...string) {
 }
 
 func (c *Canal) AddDumpIgnoreTables(db string, tables ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.AddIgnoreTables(db, tables...)
+		return
+	}
 	if c.dumper == nil {
 		return
 	}
@@ -140,7 +152,7 @@ func (c *Canal) AddDumpIgnoreTables(db string, tables ...string) {
 }
 
 func (c *Canal) dump() error {
-	if c.dumper == nil {
+	if c.dumper == nil && c.snapshotter == nil {
 		return errors.New("mysqldump does not exist")
 	}
 
@@ -171,7 +183,11 @@ func (c *Canal) dump() error {
 
 	start := utils.Now()
 	c.cfg.Logger.Info("try dump MySQL and parse")
-	if err := c.dumper.DumpAndParse(h); err != nil {
+	if c.snapshotter != nil {
+		if err := c.dumpSnapshot(h); err != nil {
+			return errors.Trace(err)
+		}
+	} else if err := c.dumper.DumpAndParse(h); err != nil {
 		return errors.Trace(err)
 	}
 
@@ -181,6 +197,9 @@ func (c *Canal) dump() error {
 	if err := c.eventHandler.OnPosSynced(nil, pos, c.master.GTIDSet(), true); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.saveCheckpoint(pos, uint32(utils.Now().Unix())); err != nil {
+		return errors.Trace(err)
+	}
 	var startPos fmt.Stringer = pos
 	if h.gset != nil {
 		c.master.UpdateGTIDSet(h.gset)
@@ -200,7 +219,7 @@ func (c *Canal) tryDump() error {
 		return nil
 	}
 
-	if c.dumper == nil {
+	if c.dumper == nil && c.snapshotter == nil {
 		c.cfg.Logger.Info("skip dump, no mysqldump")
 		return nil
 	}
@@ -24,6 +24,13 @@ type EventHandler interface {
 	String() string
 }
 
+// XAEventHandler is implemented by the EventHandler which handles the XA transactions.
+type XAEventHandler interface {
+	// OnXA is called when an XA transaction is prepared, committed or rolled back.
+	// The rows of the XA transaction are committed by the XACommitAction.
+	OnXA(header *replication.EventHeader, nextPos mysql.Position, e *XAEvent) error
+}
+
 type DummyEventHandler struct{}
 
 func (h *DummyEventHandler) OnRotate(*replication.EventHeader, *replication.RotateEvent) error {
@@ -0,0 +1,408 @@
+package canal
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// The types of the rows in the signal table.
+const (
+	SignalSnapshotWindowOpen  = "snapshot-window-open"
+	SignalSnapshotWindowClose = "snapshot-window-close"
+	SignalSnapshotProgress    = "snapshot-progress"
+	SignalIncludeTable        = "include-table"
+)
+
+// incrementalSnapshot is a table read by TriggerSnapshot while syncing the binlog, like DBLog.
+//
+// Every chunk is read between the low and high watermarks written into the signal table. The
+// binlog goroutine collects the primary keys of the rows changed in the window between the
+// watermarks, and passes the rows of the chunk except them to OnRow at the high watermark, so
+// the chunk never overwrites the newer changes from the binlog.
+type incrementalSnapshot struct {
+	ta *schema.Table
+
+	// the chunk between the watermarks, the rows are set before the high watermark
+	chunkID string
+	rows    [][]interface{}
+	done    chan struct{}
+
+	// set by the binlog goroutine in the window
+	open    bool
+	changed map[string]struct{}
+}
+
+// snapshotProgress is saved into the signal table after every chunk, to resume the snapshot.
+type snapshotProgress struct {
+	// Last is the literals of the primary key of the last row passed to OnRow.
+	Last []string `json:"last"`
+}
+
+// signalTable returns the quoted name of Config.SignalTable.
+func (c *Canal) signalTable() (string, error) {
+	db, table, ok := strings.Cut(c.cfg.SignalTable, ".")
+	if !ok {
+		return "", errors.Errorf("invalid signal table %q, db.table is required", c.cfg.SignalTable)
+	}
+	return quoteIdentifier(db) + "." + quoteIdentifier(table), nil
+}
+
+// writeSignal inserts or updates the row of the id in the signal table.
+func (c *Canal) writeSignal(conn *client.Conn, id string, tp string, data string) error {
+	table, err := c.signalTable()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, type, data) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE type = VALUES(type), data = VALUES(data)", table)
+	if conn != nil {
+		_, err = conn.Execute(query, id, tp, data)
+	} else {
+		_, err = c.Execute(query, id, tp, data)
+	}
+	return errors.Trace(err)
+}
+
+func snapshotProgressID(key string) string {
+	return "snapshot:" + key
+}
+
+func snapshotWatermarkID(key string) string {
+	return "watermark:" + key
+}
+
+func includeTableID(key string) string {
+	return "include:" + key
+}
+
+// TriggerSnapshot starts to read the table by chunks while syncing the binlog, the rows are
+// passed to OnRow as the InsertAction without the header, between the rows from the binlog.
+// It returns after the snapshot is started, which ends after the table is read or Canal is
+// closed. The progress is saved into Config.SignalTable after every chunk, and the unfinished
+// snapshots are resumed by Run.
+//
+// The table is included even if it's excluded by the regular expressions before, so a new
+// table can be backfilled while syncing. The inclusion is saved into Config.SignalTable too, and
+// loaded by Run after restart, until the row of the table is deleted from Config.SignalTable.
+// The table must have a primary key.
+func (c *Canal) TriggerSnapshot(db string, table string) error {
+	if c.cfg.SignalTable == "" {
+		return errors.New("signal table is required for the incremental snapshot")
+	}
+	key := tableKey(db, table)
+	if err := c.writeSignal(nil, includeTableID(key), SignalIncludeTable, ""); err != nil {
+		return errors.Trace(err)
+	}
+	c.includeTable(key)
+	return errors.Trace(c.startIncrementalSnapshot(db, table, nil, true))
+}
+
+// includeTable makes the table included by the regular expressions.
+func (c *Canal) includeTable(key string) {
+	c.tableLock.Lock()
+	if c.tableMatchCache != nil {
+		c.tableMatchCache[key] = true
+	}
+	c.tableLock.Unlock()
+}
+
+// startIncrementalSnapshot starts the snapshot of the table after the last primary key, the
+// progress is saved before if it's triggered.
+func (c *Canal) startIncrementalSnapshot(db string, table string, last []string, trigger bool) error {
+	ta, err := c.GetTable(db, table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(ta.PKColumns) == 0 {
+		return errors.Errorf("table %s has no primary key for the incremental snapshot", ta)
+	}
+
+	key := tableKey(db, table)
+	s := &incrementalSnapshot{ta: ta}
+	c.snapshotLock.Lock()
+	if c.snapshots[key] != nil {
+		c.snapshotLock.Unlock()
+		return errors.Errorf("snapshot of %s is running", key)
+	}
+	if c.snapshots == nil {
+		c.snapshots = make(map[string]*incrementalSnapshot)
+	}
+	c.snapshots[key] = s
+	c.snapshotLock.Unlock()
+
+	if trigger {
+		if err = c.writeSignal(nil, snapshotProgressID(key), SignalSnapshotProgress, "{}"); err != nil {
+			c.snapshotLock.Lock()
+			delete(c.snapshots, key)
+			c.snapshotLock.Unlock()
+			return errors.Trace(err)
+		}
+	}
+
+	c.cfg.Logger.Info("start incremental snapshot", slog.String("table", key), slog.Any("last", last))
+	go func() {
+		err := c.runIncrementalSnapshot(key, s, last)
+		c.snapshotLock.Lock()
+		delete(c.snapshots, key)
+		c.snapshotLock.Unlock()
+		if err != nil && c.ctx.Err() == nil {
+			c.cfg.Logger.Error("incremental snapshot err", slog.String("table", key), slog.Any("error", err))
+		}
+	}()
+	return nil
+}
+
+// resumeSnapshots includes the tables included by TriggerSnapshot before, and starts the
+// unfinished snapshots saved in the signal table.
+func (c *Canal) resumeSnapshots() error {
+	table, err := c.signalTable()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	res, err := c.Execute(fmt.Sprintf("SELECT id, type, data FROM %s WHERE type IN (?, ?)", table), SignalIncludeTable, SignalSnapshotProgress)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for i := 0; i < res.RowNumber(); i++ {
+		id, _ := res.GetString(i, 0)
+		tp, _ := res.GetString(i, 1)
+		if key, ok := strings.CutPrefix(id, includeTableID("")); ok && tp == SignalIncludeTable {
+			c.includeTable(key)
+		}
+	}
+	for i := 0; i < res.RowNumber(); i++ {
+		id, _ := res.GetString(i, 0)
+		data, _ := res.GetString(i, 2)
+		key, ok := strings.CutPrefix(id, snapshotProgressID(""))
+		if !ok {
+			continue
+		}
+		db, table, _ := strings.Cut(key, ".")
+		var progress snapshotProgress
+		if err = json.Unmarshal([]byte(data), &progress); err != nil {
+			return errors.Annotatef(err, "invalid snapshot progress of %s", key)
+		}
+
+		c.includeTable(key)
+		if err = c.startIncrementalSnapshot(db, table, progress.Last, false); err != nil {
+			// e.g, the table is dropped, it's triggered again to reset the progress
+			c.cfg.Logger.Error("resume incremental snapshot err", slog.String("table", key), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+func (c *Canal) runIncrementalSnapshot(key string, s *incrementalSnapshot, last []string) error {
+	conn, err := c.snapshotConn()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	chunkSize := c.cfg.Dump.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+
+	start := time.Now()
+	total := 0
+	for {
+		chunkID := uuid.NewString()
+		done := make(chan struct{})
+		c.snapshotLock.Lock()
+		s.chunkID = chunkID
+		s.rows = nil
+		s.done = done
+		c.snapshotLock.Unlock()
+
+		if err = c.writeSignal(conn, snapshotWatermarkID(key), SignalSnapshotWindowOpen, chunkID); err != nil {
+			return errors.Trace(err)
+		}
+		res, err := conn.Execute(snapshotQuery(s.ta, "", last, chunkSize))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		rows := make([][]interface{}, len(res.Values))
+		for i, row := range res.Values {
+			if rows[i], err = c.snapshotRow(s.ta, row); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		c.snapshotLock.Lock()
+		s.rows = rows
+		c.snapshotLock.Unlock()
+		if err = c.writeSignal(conn, snapshotWatermarkID(key), SignalSnapshotWindowClose, chunkID); err != nil {
+			return errors.Trace(err)
+		}
+
+		// wait for the rows passed to OnRow at the high watermark
+		select {
+		case <-done:
+		case <-c.ctx.Done():
+			return errors.Trace(c.ctx.Err())
+		}
+		total += len(rows)
+
+		if len(rows) < chunkSize {
+			table, err := c.signalTable()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if _, err = conn.Execute(fmt.Sprintf("DELETE FROM %s WHERE id IN (?, ?)", table), snapshotProgressID(key), snapshotWatermarkID(key)); err != nil {
+				return errors.Trace(err)
+			}
+			c.cfg.Logger.Info("incremental snapshot done", slog.String("table", key), slog.Int("rows", total), slog.Duration("use", time.Since(start)))
+			return nil
+		}
+
+		last = snapshotLast(s.ta, res.Values[len(res.Values)-1])
+		data, err := json.Marshal(snapshotProgress{Last: last})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = c.writeSignal(conn, snapshotProgressID(key), SignalSnapshotProgress, string(data)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// snapshotRowKey returns the key of the primary key of the row, the same for the values from
+// the binlog and the snapshot.
+func snapshotRowKey(ta *schema.Table, row []interface{}) (string, error) {
+	values, err := ta.GetPKValues(row)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if bs, ok := v.([]byte); ok {
+			v = string(bs)
+		}
+		fmt.Fprintf(&b, "%v\x00", v)
+	}
+	return b.String(), nil
+}
+
+// handleSignalRows handles the watermarks in the rows of the signal table, whose first columns
+// are id, type and data.
+func (c *Canal) handleSignalRows(e *replication.BinlogEvent) error {
+	ev := e.Event.(*replication.RowsEvent)
+	update := false
+	switch e.Header.EventType {
+	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2, replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2, replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		update = true
+	default:
+		return nil
+	}
+
+	str := func(v interface{}) string {
+		if bs, ok := v.([]byte); ok {
+			return string(bs)
+		}
+		s, _ := v.(string)
+		return s
+	}
+	i := 0
+	// the signal table has no unsigned columns to convert
+	return (&RowsEvent{Table: &schema.Table{}, raw: ev}).ForEachRow(func(row []interface{}) error {
+		i++
+		if update && i%2 == 1 {
+			// the before image
+			return nil
+		}
+		if len(row) < 3 {
+			return errors.Errorf("signal table %s must have the columns id, type and data", c.cfg.SignalTable)
+		}
+		key, ok := strings.CutPrefix(str(row[0]), snapshotWatermarkID(""))
+		if !ok {
+			return nil
+		}
+		return errors.Trace(c.handleWatermark(key, str(row[1]), str(row[2])))
+	})
+}
+
+func (c *Canal) handleWatermark(key string, tp string, chunkID string) error {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	s := c.snapshots[key]
+	// the watermarks of the finished chunks are synced again after restart
+	if s == nil || s.chunkID != chunkID {
+		return nil
+	}
+
+	switch tp {
+	case SignalSnapshotWindowOpen:
+		s.open = true
+		s.changed = make(map[string]struct{})
+	case SignalSnapshotWindowClose:
+		if !s.open {
+			return nil
+		}
+		rows := make([][]interface{}, 0, len(s.rows))
+		for _, row := range s.rows {
+			k, err := snapshotRowKey(s.ta, row)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if _, ok := s.changed[k]; !ok {
+				rows = append(rows, row)
+			}
+		}
+		s.open = false
+		s.changed = nil
+		s.rows = nil
+		if len(rows) > 0 {
+			e := newRowsEvent(s.ta, InsertAction, rows, nil)
+			e.incrementalSnapshot = true
+			if err := c.eventHandler.OnRow(e); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		close(s.done)
+	}
+	return nil
+}
+
+// trackSnapshotChanges collects the primary keys of the rows changed in the window of the
+// snapshot of the table. The rows decoded lazily are kept in RowsEvent.Rows then, so they are
+// decoded only once for both the keys and OnRow.
+func (c *Canal) trackSnapshotChanges(e *RowsEvent) error {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	s := c.snapshots[tableKey(e.Table.Schema, e.Table.Name)]
+	if s == nil || !s.open {
+		return nil
+	}
+	if e.Rows == nil && e.raw != nil {
+		var rows [][]interface{}
+		if err := e.ForEachRow(func(row []interface{}) error {
+			rows = append(rows, slices.Clone(row))
+			return nil
+		}); err != nil {
+			return errors.Trace(err)
+		}
+		e.Rows = rows
+	}
+	for _, row := range e.Rows {
+		k, err := snapshotRowKey(e.Table, row)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		s.changed[k] = struct{}{}
+	}
+	return nil
+}
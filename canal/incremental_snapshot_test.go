@@ -0,0 +1,173 @@
+package canal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type testSnapshotRowsHandler struct {
+	DummyEventHandler
+	rows [][]interface{}
+	// the number of the binlog events whose rows are decoded before OnRow
+	decoded int
+}
+
+func (h *testSnapshotRowsHandler) OnRow(e *RowsEvent) error {
+	if e.raw != nil && e.Rows != nil {
+		h.decoded++
+	}
+	return e.ForEachRow(func(row []interface{}) error {
+		h.rows = append(h.rows, append([]interface{}{e.Action, e.Header != nil}, row...))
+		return nil
+	})
+}
+
+func TestIncrementalSnapshotWindow(t *testing.T) {
+	ta := &schema.Table{Schema: "test", Name: "t"}
+	ta.AddColumn("id", "int(11)", "", "")
+	ta.AddColumn("name", "varchar(10)", "utf8mb4_general_ci", "")
+	ta.PKColumns = []int{0}
+
+	h := &testSnapshotRowsHandler{}
+	c := &Canal{
+		cfg:          &Config{Logger: slog.Default(), SignalTable: "test.signal"},
+		master:       &masterInfo{logger: slog.Default()},
+		eventHandler: h,
+		tables:       map[string]*schema.Table{"test.t": ta},
+	}
+	s := &incrementalSnapshot{ta: ta, chunkID: "chunk", done: make(chan struct{})}
+	c.snapshots = map[string]*incrementalSnapshot{"test.t": s}
+
+	handle := func(eventType replication.EventType, table string, rows ...[]interface{}) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: eventType},
+			Event: &replication.RowsEvent{
+				Table: &replication.TableMapEvent{Schema: []byte("test"), Table: []byte(table)},
+				Rows:  rows,
+			},
+		}))
+	}
+	watermark := func(tp string, chunkID string) []interface{} {
+		return []interface{}{"watermark:test.t", tp, []byte(chunkID)}
+	}
+
+	// the changes before the window are not collected
+	handle(replication.WRITE_ROWS_EVENTv2, "t", []interface{}{int32(1), "a"})
+	// the watermarks of the other chunks are ignored
+	handle(replication.WRITE_ROWS_EVENTv2, "signal", watermark(SignalSnapshotWindowOpen, "old"))
+	require.False(t, s.open)
+
+	handle(replication.WRITE_ROWS_EVENTv2, "signal", watermark(SignalSnapshotWindowOpen, "chunk"))
+	require.True(t, s.open)
+	handle(replication.UPDATE_ROWS_EVENTv2, "t", []interface{}{int32(2), "b"}, []interface{}{int32(2), "b2"})
+	handle(replication.DELETE_ROWS_EVENTv2, "t", []interface{}{int32(3), "c"})
+
+	// the chunk is read in the window
+	s.rows = [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "d"}}
+	handle(replication.UPDATE_ROWS_EVENTv2, "signal",
+		watermark(SignalSnapshotWindowOpen, "chunk"), watermark(SignalSnapshotWindowClose, "chunk"))
+	require.False(t, s.open)
+
+	select {
+	case <-s.done:
+	default:
+		require.Fail(t, "chunk is not done")
+	}
+	require.Equal(t, [][]interface{}{
+		{InsertAction, true, int32(1), "a"},
+		{UpdateAction, true, int32(2), "b"},
+		{UpdateAction, true, int32(2), "b2"},
+		{DeleteAction, true, int32(3), "c"},
+		// the rows changed in the window are not overwritten by the chunk
+		{InsertAction, false, int64(1), "a"},
+		{InsertAction, false, int64(4), "d"},
+	}, h.rows)
+}
+
+func TestIncrementalSnapshotWindowLazyRows(t *testing.T) {
+	ta := &schema.Table{Schema: "test", Name: "t"}
+	ta.AddColumn("id", "int(11)", "", "")
+	ta.AddColumn("name", "varchar(10)", "utf8mb4_general_ci", "")
+	ta.PKColumns = []int{0}
+
+	h := &testSnapshotRowsHandler{}
+	c := &Canal{
+		cfg:          &Config{Logger: slog.Default(), SignalTable: "test.signal", LazyRowsEvent: true},
+		master:       &masterInfo{logger: slog.Default()},
+		eventHandler: h,
+		tables:       map[string]*schema.Table{"test.t": ta},
+	}
+	s := &incrementalSnapshot{ta: ta, chunkID: "chunk", done: make(chan struct{})}
+	c.snapshots = map[string]*incrementalSnapshot{"test.t": s}
+
+	newTableMap := func(table string, columnType ...byte) *replication.TableMapEvent {
+		meta := make([]uint16, len(columnType))
+		for i, tp := range columnType {
+			if tp == mysql.MYSQL_TYPE_VARCHAR {
+				meta[i] = 400
+			}
+		}
+		return &replication.TableMapEvent{
+			TableID:     1,
+			Schema:      []byte("test"),
+			Table:       []byte(table),
+			ColumnCount: uint64(len(columnType)),
+			ColumnType:  columnType,
+			ColumnMeta:  meta,
+			NullBitmap:  []byte{0},
+		}
+	}
+	signal := newTableMap("signal", mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR)
+	table := newTableMap("t", mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR)
+	handle := func(eventType replication.EventType, tableMap *replication.TableMapEvent, rows ...[]interface{}) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: eventType},
+			Event:  newTestLazyRowsEvent(t, eventType, tableMap, rows...),
+		}))
+	}
+	watermark := func(tp string) []interface{} {
+		return []interface{}{"watermark:test.t", tp, "chunk"}
+	}
+
+	handle(replication.WRITE_ROWS_EVENTv2, signal, watermark(SignalSnapshotWindowOpen))
+	require.True(t, s.open)
+	handle(replication.UPDATE_ROWS_EVENTv2, table, []interface{}{int32(2), "b"}, []interface{}{int32(2), "b2"})
+	// the rows in the window are decoded once for both the keys and OnRow
+	require.Equal(t, 1, h.decoded)
+
+	s.rows = [][]interface{}{{int64(1), "a"}, {int64(2), "b"}}
+	handle(replication.UPDATE_ROWS_EVENTv2, signal, watermark(SignalSnapshotWindowOpen), watermark(SignalSnapshotWindowClose))
+	require.False(t, s.open)
+	require.Equal(t, [][]interface{}{
+		{UpdateAction, true, int32(2), "b"},
+		{UpdateAction, true, int32(2), "b2"},
+		{InsertAction, false, int64(1), "a"},
+	}, h.rows)
+
+	// the rows out of the window stay lazy
+	handle(replication.WRITE_ROWS_EVENTv2, table, []interface{}{int32(3), "c"})
+	require.Equal(t, 1, h.decoded)
+	require.Len(t, h.rows, 4)
+}
+
+func TestSnapshotQuery(t *testing.T) {
+	ta := &schema.Table{Schema: "test", Name: "t"}
+	ta.AddColumn("a", "int(11)", "", "")
+	ta.AddColumn("b", "varchar(10)", "utf8mb4_general_ci", "")
+	ta.AddColumn("c", "text", "utf8mb4_general_ci", "")
+	ta.PKColumns = []int{0, 1}
+
+	require.Equal(t, "SELECT `a`, `b`, `c` FROM `test`.`t` ORDER BY `a`, `b` LIMIT 10",
+		snapshotQuery(ta, "", nil, 10))
+	require.Equal(t, "SELECT `a`, `b`, `c` FROM `test`.`t` WHERE (a > 0) AND (`a`, `b`) > (1, 'x') ORDER BY `a`, `b` LIMIT 10",
+		snapshotQuery(ta, "a > 0", []string{"1", "'x'"}, 10))
+
+	ta.PKColumns = nil
+	require.Equal(t, "SELECT `a`, `b`, `c` FROM `test`.`t`", snapshotQuery(ta, "", nil, 10))
+}
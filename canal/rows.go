@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/errors"
 )
 
 // The action name for sync.
@@ -26,6 +27,11 @@ type RowsEvent struct {
 	Rows [][]interface{}
 	// Header can be used to inspect the event
 	Header *replication.EventHeader
+
+	// the binlog event of the rows, which decodes the rows with Config.LazyRowsEvent
+	raw *replication.RowsEvent
+	// whether the rows are read by TriggerSnapshot
+	incrementalSnapshot bool
 }
 
 func newRowsEvent(table *schema.Table, action string, rows [][]interface{}, header *replication.EventHeader) *RowsEvent {
@@ -41,6 +47,44 @@ func newRowsEvent(table *schema.Table, action string, rows [][]interface{}, head
 	return e
 }
 
+// ForEachRow calls f with every row in order, so the rows decoded lazily with
+// Config.LazyRowsEvent are decoded one by one. The row passed to f is reused by the next row,
+// so copy it if it's kept.
+func (r *RowsEvent) ForEachRow(f func(row []interface{}) error) error {
+	if r.raw == nil || r.Rows != nil {
+		for _, row := range r.Rows {
+			if err := f(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if r.raw.Rows != nil {
+		// the binlog event decoded eagerly
+		for _, row := range r.raw.Rows {
+			r.handleUnsignedRow(row)
+			if err := f(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	it := r.raw.Iterator()
+	for it.Next() {
+		row, err := it.Row()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		r.handleUnsignedRow(row)
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	return errors.Trace(it.Err())
+}
+
 const maxMediumintUnsigned int32 = 16777215
 
 func (r *RowsEvent) handleUnsigned() {
@@ -52,38 +96,48 @@ func (r *RowsEvent) handleUnsigned() {
 	}
 
 	for i := 0; i < len(r.Rows); i++ {
-		for _, columnIdx := range r.Table.UnsignedColumns {
-			// When Canal.delay is big, after call Canal.StartFromGTID(),
-			// we will get the newest table schema (for example, after DDL "alter table add column xxx unsigned..."),
-			// but the binlog data can be very old (before DDL "alter table add column xxx unsigned..."),
-			// results in max(columnIdx) >= len(r.Rows[i]), then r.Rows[i][columnIdx] panic.
-			if columnIdx >= len(r.Rows[i]) {
-				continue
-			}
-			switch value := r.Rows[i][columnIdx].(type) {
-			case int8:
-				r.Rows[i][columnIdx] = uint8(value)
-			case int16:
-				r.Rows[i][columnIdx] = uint16(value)
-			case int32:
-				// problem with mediumint is that it's a 3-byte type. There is no compatible golang type to match that.
-				// So to convert from negative to positive we'd need to convert the value manually
-				if value < 0 && r.Table.Columns[columnIdx].Type == schema.TYPE_MEDIUM_INT {
-					r.Rows[i][columnIdx] = uint32(maxMediumintUnsigned + value + 1)
-				} else {
-					r.Rows[i][columnIdx] = uint32(value)
-				}
-			case int64:
-				r.Rows[i][columnIdx] = uint64(value)
-			case int:
-				r.Rows[i][columnIdx] = uint(value)
-			default:
-				// nothing to do
+		r.handleUnsignedRow(r.Rows[i])
+	}
+}
+
+func (r *RowsEvent) handleUnsignedRow(row []interface{}) {
+	for _, columnIdx := range r.Table.UnsignedColumns {
+		// When Canal.delay is big, after call Canal.StartFromGTID(),
+		// we will get the newest table schema (for example, after DDL "alter table add column xxx unsigned..."),
+		// but the binlog data can be very old (before DDL "alter table add column xxx unsigned..."),
+		// results in max(columnIdx) >= len(row), then row[columnIdx] panic.
+		if columnIdx >= len(row) {
+			continue
+		}
+		switch value := row[columnIdx].(type) {
+		case int8:
+			row[columnIdx] = uint8(value)
+		case int16:
+			row[columnIdx] = uint16(value)
+		case int32:
+			// problem with mediumint is that it's a 3-byte type. There is no compatible golang type to match that.
+			// So to convert from negative to positive we'd need to convert the value manually
+			if value < 0 && r.Table.Columns[columnIdx].Type == schema.TYPE_MEDIUM_INT {
+				row[columnIdx] = uint32(maxMediumintUnsigned + value + 1)
+			} else {
+				row[columnIdx] = uint32(value)
 			}
+		case int64:
+			row[columnIdx] = uint64(value)
+		case int:
+			row[columnIdx] = uint(value)
+		default:
+			// nothing to do
 		}
 	}
 }
 
+// IncrementalSnapshot returns whether the rows are read by TriggerSnapshot, which are inserts
+// without the header like the rows of the dump.
+func (r *RowsEvent) IncrementalSnapshot() bool {
+	return r.incrementalSnapshot
+}
+
 // String implements fmt.Stringer interface.
 func (r *RowsEvent) String() string {
 	return fmt.Sprintf("%s %s %v", r.Action, r.Table, r.Rows)
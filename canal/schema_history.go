@@ -0,0 +1,124 @@
+package canal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// SchemaSnapshot is a version of the schemas of the tables tracked by SchemaTracker.
+type SchemaSnapshot struct {
+	Version uint64 `json:"version"`
+	// Checkpoint is where the schemas take effect, the end of the DDL changing them, or the
+	// start of the replication for the schemas loaded from the server.
+	Checkpoint *replication.Checkpoint `json:"checkpoint"`
+	// DDL is the statement changing the schemas, it's empty for the schemas loaded from the server.
+	DDL    string          `json:"ddl,omitempty"`
+	Tables []*schema.Table `json:"tables"`
+	// Collations are the default collations of the tables by db.table, for the columns added later.
+	Collations map[string]string `json:"collations,omitempty"`
+}
+
+// SchemaHistoryStore saves the versions of the schemas tracked by SchemaTracker.
+type SchemaHistoryStore interface {
+	// Load returns the saved snapshots in the order they're appended.
+	Load() ([]*SchemaSnapshot, error)
+	// Append saves the snapshot durably after the saved ones.
+	Append(s *SchemaSnapshot) error
+}
+
+// MemorySchemaHistoryStore keeps the snapshots in memory, it's useful for tests.
+type MemorySchemaHistoryStore struct {
+	m         sync.Mutex
+	snapshots []*SchemaSnapshot
+}
+
+func NewMemorySchemaHistoryStore() *MemorySchemaHistoryStore {
+	return &MemorySchemaHistoryStore{}
+}
+
+func (s *MemorySchemaHistoryStore) Load() ([]*SchemaSnapshot, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return slices.Clone(s.snapshots), nil
+}
+
+func (s *MemorySchemaHistoryStore) Append(snapshot *SchemaSnapshot) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+// FileSchemaHistoryStore saves every snapshot as JSON into a file in the directory, named by
+// the version. The files are written atomically like replication.FileCheckpointStore.
+type FileSchemaHistoryStore struct {
+	m   sync.Mutex
+	dir string
+}
+
+func NewFileSchemaHistoryStore(dir string) *FileSchemaHistoryStore {
+	return &FileSchemaHistoryStore{dir: dir}
+}
+
+const schemaSnapshotFileSuffix = ".schema.json"
+
+func (s *FileSchemaHistoryStore) Load() ([]*SchemaSnapshot, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+
+	// the names of the files have the same length, so they're sorted by the versions
+	var snapshots []*SchemaSnapshot
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), schemaSnapshotFileSuffix) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		snapshot := new(SchemaSnapshot)
+		if err = json.Unmarshal(data, snapshot); err != nil {
+			return nil, errors.Annotatef(err, "invalid schema snapshot file %s", path)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *FileSchemaHistoryStore) Append(snapshot *SchemaSnapshot) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = os.MkdirAll(s.dir, 0o755); err != nil {
+		return errors.Trace(err)
+	}
+
+	name := fmt.Sprintf("%020d%s", snapshot.Version, schemaSnapshotFileSuffix)
+	return errors.Trace(utils.WriteFileAtomic(filepath.Join(s.dir, name), data))
+}
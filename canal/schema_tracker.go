@@ -0,0 +1,793 @@
+package canal
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/charset"
+	pmysql "github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/parser/types"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// SchemaTracker tracks the schemas of the tables by applying the DDL in the binlog to a
+// snapshot of them, so the rows events are decoded with the schemas in effect when they're
+// written instead of the current schemas on the server. Every change of the schemas is saved
+// as a version into the SchemaHistoryStore, keyed by the checkpoint of the DDL, so the schemas
+// can be restored at any position to replicate from.
+//
+// The tables returned are never changed, a new table is created for the DDL changing it.
+type SchemaTracker struct {
+	m      sync.RWMutex
+	store  SchemaHistoryStore
+	parser *parser.Parser
+
+	tables     map[string]*schema.Table
+	collations map[string]string
+
+	version uint64
+	// the versions saved by the keys of their checkpoints
+	saved map[string]uint64
+}
+
+func NewSchemaTracker(store SchemaHistoryStore) *SchemaTracker {
+	return &SchemaTracker{
+		store:      store,
+		parser:     parser.New(),
+		tables:     make(map[string]*schema.Table),
+		collations: make(map[string]string),
+		saved:      make(map[string]uint64),
+	}
+}
+
+func tableKey(db, table string) string {
+	return fmt.Sprintf("%s.%s", db, table)
+}
+
+func checkpointKey(cp *replication.Checkpoint) string {
+	if cp.GTIDSet == nil {
+		return cp.Position.String()
+	}
+	return fmt.Sprintf("%s %s", cp.Position, cp.GTIDSet)
+}
+
+// checkpointBefore returns true if the checkpoint is at or before the position, or the GTID
+// set if it's not empty.
+func checkpointBefore(cp *replication.Checkpoint, pos mysql.Position, gset mysql.GTIDSet) bool {
+	if gset != nil && gset.String() != "" && cp.GTIDSet != nil {
+		return gset.Contain(cp.GTIDSet)
+	}
+	return cp.Position.Compare(pos) <= 0
+}
+
+// Restore loads the latest version of the schemas saved at or before the position, or the GTID
+// set if it's not empty. It returns false if there is no such version, the schemas are empty then.
+func (t *SchemaTracker) Restore(pos mysql.Position, gset mysql.GTIDSet) (bool, error) {
+	snapshots, err := t.store.Load()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.version = 0
+	t.saved = make(map[string]uint64, len(snapshots))
+	var found *SchemaSnapshot
+	for _, s := range snapshots {
+		if s.Checkpoint == nil {
+			return false, errors.Errorf("schema version %d has no checkpoint", s.Version)
+		}
+		t.saved[checkpointKey(s.Checkpoint)] = s.Version
+		t.version = max(t.version, s.Version)
+		if checkpointBefore(s.Checkpoint, pos, gset) {
+			found = s
+		}
+	}
+
+	t.tables = make(map[string]*schema.Table)
+	t.collations = make(map[string]string)
+	if found == nil {
+		return false, nil
+	}
+	for _, ta := range found.Tables {
+		t.tables[tableKey(ta.Schema, ta.Name)] = ta
+	}
+	for key, collation := range found.Collations {
+		t.collations[key] = collation
+	}
+	return true, nil
+}
+
+// AddTable adds the table loaded from the server, e.g, by schema.NewTable, collation is the
+// default collation of the table, which is used for the columns added later.
+func (t *SchemaTracker) AddTable(ta *schema.Table, collation string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	key := tableKey(ta.Schema, ta.Name)
+	t.tables[key] = ta
+	t.setCollation(key, collation)
+}
+
+func (t *SchemaTracker) setCollation(key string, collation string) {
+	if collation == "" {
+		delete(t.collations, key)
+	} else {
+		t.collations[key] = collation
+	}
+}
+
+// Table returns the schema of the table, or schema.ErrTableNotExist if it's not tracked.
+func (t *SchemaTracker) Table(db string, table string) (*schema.Table, error) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	ta, ok := t.tables[tableKey(db, table)]
+	if !ok {
+		return nil, schema.ErrTableNotExist
+	}
+	return ta, nil
+}
+
+// ExecDDL applies the DDL statements in the query to the schemas, db is the default database
+// of the query. It returns true if any schema is changed. The statements not changing the
+// tables and the changes of the tables not tracked are ignored.
+func (t *SchemaTracker) ExecDDL(db string, query string) (bool, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	stmts, _, err := t.parser.Parse(query, "", "")
+	if err != nil {
+		return false, errors.Annotatef(err, "parse %s", query)
+	}
+	changed := false
+	for _, stmt := range stmts {
+		ok, err := t.execStmt(db, stmt)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		changed = changed || ok
+	}
+	return changed, nil
+}
+
+// exec applies the parsed DDL statement like ExecDDL.
+func (t *SchemaTracker) exec(db string, stmt ast.StmtNode) (bool, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return t.execStmt(db, stmt)
+}
+
+// Save saves the schemas as a new version in effect from the checkpoint, ddl is the statement
+// changing them. Nothing is saved if there is a version at the same checkpoint, which is saved
+// when the same binlog was replicated before.
+func (t *SchemaTracker) Save(cp *replication.Checkpoint, ddl string) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	key := checkpointKey(cp)
+	if _, ok := t.saved[key]; ok {
+		return nil
+	}
+
+	s := &SchemaSnapshot{
+		Version:    t.version + 1,
+		Checkpoint: cp.Clone(),
+		DDL:        ddl,
+		Tables:     make([]*schema.Table, 0, len(t.tables)),
+		Collations: make(map[string]string, len(t.collations)),
+	}
+	for _, ta := range t.tables {
+		s.Tables = append(s.Tables, ta)
+	}
+	sort.Slice(s.Tables, func(i, j int) bool {
+		return tableKey(s.Tables[i].Schema, s.Tables[i].Name) < tableKey(s.Tables[j].Schema, s.Tables[j].Name)
+	})
+	for key, collation := range t.collations {
+		s.Collations[key] = collation
+	}
+
+	if err := t.store.Append(s); err != nil {
+		return errors.Trace(err)
+	}
+	t.version = s.Version
+	t.saved[key] = s.Version
+	return nil
+}
+
+func tableName(db string, table *ast.TableName) (string, string) {
+	if table.Schema.O != "" {
+		db = table.Schema.O
+	}
+	return db, table.Name.O
+}
+
+func (t *SchemaTracker) execStmt(db string, stmt ast.StmtNode) (bool, error) {
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		// the temporary tables are not replicated by rows
+		if s.TemporaryKeyword != ast.TemporaryNone {
+			return false, nil
+		}
+		schemaName, name := tableName(db, s.Table)
+		key := tableKey(schemaName, name)
+		if _, ok := t.tables[key]; ok && s.IfNotExists {
+			return false, nil
+		}
+
+		if s.ReferTable != nil {
+			src, ok := t.tables[tableKey(tableName(db, s.ReferTable))]
+			if !ok {
+				delete(t.tables, key)
+				return true, nil
+			}
+			ta := cloneTable(src)
+			ta.Schema, ta.Name = schemaName, name
+			t.tables[key] = ta
+			t.setCollation(key, t.collations[tableKey(src.Schema, src.Name)])
+			return true, nil
+		}
+
+		// CREATE TABLE ... SELECT is written as CREATE TABLE with all the columns in the binlog
+		// of rows, so the columns of the SELECT are not needed
+		ta, collation, err := newTrackedTable(schemaName, name, s)
+		if err != nil {
+			return false, errors.Annotatef(err, "create table %s", key)
+		}
+		t.tables[key] = ta
+		t.setCollation(key, collation)
+		return true, nil
+	case *ast.AlterTableStmt:
+		schemaName, name := tableName(db, s.Table)
+		key := tableKey(schemaName, name)
+		src, ok := t.tables[key]
+		if !ok {
+			return false, nil
+		}
+		ta := cloneTable(src)
+		collation := t.collations[key]
+		for _, spec := range s.Specs {
+			if err := alterTable(ta, &collation, spec, db); err != nil {
+				return false, errors.Annotatef(err, "alter table %s", key)
+			}
+		}
+		refreshTable(ta)
+		delete(t.tables, key)
+		delete(t.collations, key)
+		key = tableKey(ta.Schema, ta.Name)
+		t.tables[key] = ta
+		t.setCollation(key, collation)
+		return true, nil
+	case *ast.RenameTableStmt:
+		changed := false
+		for _, tt := range s.TableToTables {
+			key := tableKey(tableName(db, tt.OldTable))
+			src, ok := t.tables[key]
+			if !ok {
+				continue
+			}
+			ta := cloneTable(src)
+			ta.Schema, ta.Name = tableName(db, tt.NewTable)
+			newKey := tableKey(ta.Schema, ta.Name)
+			t.tables[newKey] = ta
+			t.setCollation(newKey, t.collations[key])
+			delete(t.tables, key)
+			delete(t.collations, key)
+			changed = true
+		}
+		return changed, nil
+	case *ast.DropTableStmt:
+		if s.IsView || s.TemporaryKeyword != ast.TemporaryNone {
+			return false, nil
+		}
+		changed := false
+		for _, table := range s.Tables {
+			key := tableKey(tableName(db, table))
+			if _, ok := t.tables[key]; ok {
+				delete(t.tables, key)
+				delete(t.collations, key)
+				changed = true
+			}
+		}
+		return changed, nil
+	case *ast.DropDatabaseStmt:
+		changed := false
+		for key, ta := range t.tables {
+			if ta.Schema == s.Name.O {
+				delete(t.tables, key)
+				delete(t.collations, key)
+				changed = true
+			}
+		}
+		return changed, nil
+	case *ast.CreateIndexStmt:
+		key := tableKey(tableName(db, s.Table))
+		src, ok := t.tables[key]
+		if !ok {
+			return false, nil
+		}
+		if s.IfNotExists && findIndex(src, s.IndexName) >= 0 {
+			return false, nil
+		}
+		switch s.KeyType {
+		case ast.IndexKeyTypeNone, ast.IndexKeyTypeUnique, ast.IndexKeyTypeFullText:
+		default:
+			// the spatial indexes and the indexes of TiDB
+			return false, nil
+		}
+		ta := cloneTable(src)
+		visible := s.IndexOption == nil || s.IndexOption.Visibility != ast.IndexVisibilityInvisible
+		if err := addIndex(ta, s.IndexName, s.KeyType == ast.IndexKeyTypeUnique, s.IndexPartSpecifications, visible); err != nil {
+			return false, errors.Annotatef(err, "create index on %s", key)
+		}
+		refreshTable(ta)
+		t.tables[key] = ta
+		return true, nil
+	case *ast.DropIndexStmt:
+		key := tableKey(tableName(db, s.Table))
+		src, ok := t.tables[key]
+		if !ok {
+			return false, nil
+		}
+		if findIndex(src, s.IndexName) < 0 && s.IfExists {
+			return false, nil
+		}
+		ta := cloneTable(src)
+		if err := dropIndex(ta, s.IndexName); err != nil {
+			return false, errors.Annotatef(err, "drop index on %s", key)
+		}
+		refreshTable(ta)
+		t.tables[key] = ta
+		return true, nil
+	}
+	return false, nil
+}
+
+func cloneTable(src *schema.Table) *schema.Table {
+	ta := *src
+	ta.Columns = slices.Clone(src.Columns)
+	ta.Indexes = make([]*schema.Index, len(src.Indexes))
+	for i, index := range src.Indexes {
+		idx := *index
+		idx.Columns = slices.Clone(index.Columns)
+		idx.Cardinality = slices.Clone(index.Cardinality)
+		ta.Indexes[i] = &idx
+	}
+	ta.PKColumns = slices.Clone(src.PKColumns)
+	ta.UnsignedColumns = slices.Clone(src.UnsignedColumns)
+	return &ta
+}
+
+// refreshTable updates the primary key and the unsigned columns after the columns or the
+// indexes are changed.
+func refreshTable(ta *schema.Table) {
+	ta.UnsignedColumns = nil
+	for i, col := range ta.Columns {
+		if col.IsUnsigned {
+			ta.UnsignedColumns = append(ta.UnsignedColumns, i)
+		}
+	}
+
+	ta.PKColumns = nil
+	if len(ta.Indexes) > 0 && ta.Indexes[0].Name == "PRIMARY" {
+		ta.PKColumns = make([]int, len(ta.Indexes[0].Columns))
+		for i, name := range ta.Indexes[0].Columns {
+			ta.PKColumns[i] = ta.FindColumn(name)
+		}
+	}
+}
+
+func newTrackedTable(db string, name string, s *ast.CreateTableStmt) (*schema.Table, string, error) {
+	ta := &schema.Table{
+		Schema:  db,
+		Name:    name,
+		Columns: make([]schema.TableColumn, 0, len(s.Cols)),
+		Indexes: make([]*schema.Index, 0),
+	}
+
+	collation := ""
+	for _, opt := range s.Options {
+		if opt.Tp == ast.TableOptionCollate {
+			collation = opt.StrValue
+		}
+	}
+
+	for _, def := range s.Cols {
+		ta.Columns = append(ta.Columns, newColumn(def, collation))
+	}
+	for _, def := range s.Cols {
+		if err := addColumnIndexes(ta, def); err != nil {
+			return nil, "", errors.Trace(err)
+		}
+	}
+	for _, c := range s.Constraints {
+		if err := addConstraint(ta, c); err != nil {
+			return nil, "", errors.Trace(err)
+		}
+	}
+	refreshTable(ta)
+	return ta, collation, nil
+}
+
+// columnType returns the type of the column like SHOW COLUMNS.
+func columnType(tp *types.FieldType) string {
+	if tp.GetType() == pmysql.TypeYear {
+		return "year"
+	}
+	s := tp.InfoSchemaStr()
+	if pmysql.HasZerofillFlag(tp.GetFlag()) {
+		s += " zerofill"
+	}
+	return s
+}
+
+// newColumn returns the column of the definition, the collation of the table is used for the
+// string columns without a charset or a collation. The collation is empty if it's unknown, e.g,
+// the default collation of a charset depends on the server.
+func newColumn(def *ast.ColumnDef, tableCollation string) schema.TableColumn {
+	tp := def.Tp
+	collation := tp.GetCollate()
+	extra := ""
+	for _, opt := range def.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionCollate:
+			collation = opt.StrValue
+		case ast.ColumnOptionAutoIncrement:
+			extra = "auto_increment"
+		case ast.ColumnOptionGenerated:
+			if opt.Stored {
+				extra = "STORED GENERATED"
+			} else {
+				extra = "VIRTUAL GENERATED"
+			}
+		}
+	}
+
+	switch {
+	case tp.GetCharset() == charset.CharsetBin:
+		collation = ""
+	case types.IsTypeChar(tp.GetType()) || types.IsTypeBlob(tp.GetType()) || tp.GetType() == pmysql.TypeVarString ||
+		tp.GetType() == pmysql.TypeEnum || tp.GetType() == pmysql.TypeSet:
+		if collation == "" && tp.GetCharset() == "" {
+			collation = tableCollation
+		}
+	default:
+		collation = ""
+	}
+
+	var ta schema.Table
+	ta.AddColumn(def.Name.Name.O, columnType(tp), collation, extra)
+	return ta.Columns[0]
+}
+
+// findColumn returns the index of the column, the names of the columns are case-insensitive.
+func findColumn(ta *schema.Table, name string) int {
+	return slices.IndexFunc(ta.Columns, func(col schema.TableColumn) bool {
+		return strings.EqualFold(col.Name, name)
+	})
+}
+
+func findIndex(ta *schema.Table, name string) int {
+	return slices.IndexFunc(ta.Indexes, func(index *schema.Index) bool {
+		return strings.EqualFold(index.Name, name)
+	})
+}
+
+// addIndex adds the index, the primary key is always the first index like SHOW INDEX, and the
+// index without a name is named by its first column like MySQL.
+func addIndex(ta *schema.Table, name string, unique bool, parts []*ast.IndexPartSpecification, visible bool) error {
+	if len(parts) == 0 {
+		return errors.Errorf("index %s has no column", name)
+	}
+	if name == "" && parts[0].Column != nil {
+		name = parts[0].Column.Name.O
+		for i := 2; findIndex(ta, name) >= 0 || strings.EqualFold(name, "PRIMARY"); i++ {
+			name = fmt.Sprintf("%s_%d", parts[0].Column.Name.O, i)
+		}
+	}
+	if findIndex(ta, name) >= 0 {
+		return errors.Errorf("duplicate index %s", name)
+	}
+
+	index := schema.NewIndex(name)
+	for _, part := range parts {
+		// the functional key parts have no column
+		col := ""
+		if part.Column != nil {
+			i := findColumn(ta, part.Column.Name.O)
+			if i < 0 {
+				return errors.Errorf("index %s has unknown column %s", name, part.Column.Name.O)
+			}
+			col = ta.Columns[i].Name
+		}
+		index.AddColumn(col, 0)
+	}
+	if !unique {
+		index.NoneUnique = 1
+	}
+	index.Visible = visible
+
+	if name == "PRIMARY" {
+		ta.Indexes = slices.Insert(ta.Indexes, 0, index)
+	} else {
+		ta.Indexes = append(ta.Indexes, index)
+	}
+	return nil
+}
+
+func dropIndex(ta *schema.Table, name string) error {
+	i := findIndex(ta, name)
+	if i < 0 {
+		return errors.Errorf("unknown index %s", name)
+	}
+	ta.Indexes = slices.Delete(ta.Indexes, i, i+1)
+	return nil
+}
+
+// addConstraint adds the index of the constraint, the foreign keys and the checks are ignored.
+func addConstraint(ta *schema.Table, c *ast.Constraint) error {
+	name := c.Name
+	unique := false
+	switch c.Tp {
+	case ast.ConstraintPrimaryKey:
+		name = "PRIMARY"
+		unique = true
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		unique = true
+	case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintFulltext:
+	default:
+		return nil
+	}
+	if c.IfNotExists && findIndex(ta, name) >= 0 {
+		return nil
+	}
+
+	visible := c.Option == nil || c.Option.Visibility != ast.IndexVisibilityInvisible
+	return errors.Trace(addIndex(ta, name, unique, c.Keys, visible))
+}
+
+// addColumnIndexes adds the indexes of the PRIMARY KEY and UNIQUE options of the column.
+func addColumnIndexes(ta *schema.Table, def *ast.ColumnDef) error {
+	for _, opt := range def.Options {
+		parts := []*ast.IndexPartSpecification{{Column: def.Name}}
+		switch opt.Tp {
+		case ast.ColumnOptionPrimaryKey:
+			if err := addIndex(ta, "PRIMARY", true, parts, true); err != nil {
+				return errors.Trace(err)
+			}
+		case ast.ColumnOptionUniqKey:
+			if err := addIndex(ta, "", true, parts, true); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// columnPosition returns where the column is added or moved to, it's at by default.
+func columnPosition(ta *schema.Table, pos *ast.ColumnPosition, at int) (int, error) {
+	if pos == nil {
+		return at, nil
+	}
+	switch pos.Tp {
+	case ast.ColumnPositionFirst:
+		return 0, nil
+	case ast.ColumnPositionAfter:
+		i := findColumn(ta, pos.RelativeColumn.Name.O)
+		if i < 0 {
+			return 0, errors.Errorf("unknown column %s", pos.RelativeColumn.Name.O)
+		}
+		return i + 1, nil
+	}
+	return at, nil
+}
+
+// renameIndexColumn renames the column in the indexes, or removes it if the name is empty,
+// the indexes without any column are dropped like MySQL.
+func renameIndexColumn(ta *schema.Table, name string, newName string) {
+	ta.Indexes = slices.DeleteFunc(ta.Indexes, func(index *schema.Index) bool {
+		for i := len(index.Columns) - 1; i >= 0; i-- {
+			if !strings.EqualFold(index.Columns[i], name) {
+				continue
+			}
+			if newName != "" {
+				index.Columns[i] = newName
+				continue
+			}
+			index.Columns = slices.Delete(index.Columns, i, i+1)
+			index.Cardinality = slices.Delete(index.Cardinality, i, i+1)
+		}
+		return len(index.Columns) == 0
+	})
+}
+
+func alterTable(ta *schema.Table, collation *string, spec *ast.AlterTableSpec, db string) error {
+	switch spec.Tp {
+	case ast.AlterTableOption:
+		changed, convert := false, false
+		newCollation := ""
+		for _, opt := range spec.Options {
+			switch opt.Tp {
+			case ast.TableOptionCharset:
+				// the default collation of the charset depends on the server
+				changed = true
+				convert = convert || opt.UintValue == ast.TableOptionCharsetWithConvertTo
+			case ast.TableOptionCollate:
+				changed = true
+				newCollation = opt.StrValue
+			}
+		}
+		if !changed {
+			return nil
+		}
+		*collation = newCollation
+		if convert {
+			// CONVERT TO CHARACTER SET changes the text columns, which have collations
+			for i := range ta.Columns {
+				if ta.Columns[i].Type != schema.TYPE_BINARY && ta.Columns[i].Collation != "" {
+					ta.Columns[i].Collation = newCollation
+				}
+			}
+		}
+	case ast.AlterTableAddColumns:
+		at, err := columnPosition(ta, spec.Position, len(ta.Columns))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, def := range spec.NewColumns {
+			if findColumn(ta, def.Name.Name.O) >= 0 {
+				if spec.IfNotExists {
+					continue
+				}
+				return errors.Errorf("duplicate column %s", def.Name.Name.O)
+			}
+			ta.Columns = slices.Insert(ta.Columns, at, newColumn(def, *collation))
+			at++
+			if err = addColumnIndexes(ta, def); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		for _, c := range spec.NewConstraints {
+			if err = addConstraint(ta, c); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	case ast.AlterTableAddConstraint:
+		return errors.Trace(addConstraint(ta, spec.Constraint))
+	case ast.AlterTableDropColumn:
+		name := spec.OldColumnName.Name.O
+		i := findColumn(ta, name)
+		if i < 0 {
+			if spec.IfExists {
+				return nil
+			}
+			return errors.Errorf("unknown column %s", name)
+		}
+		renameIndexColumn(ta, ta.Columns[i].Name, "")
+		ta.Columns = slices.Delete(ta.Columns, i, i+1)
+	case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+		def := spec.NewColumns[0]
+		name := def.Name.Name.O
+		if spec.Tp == ast.AlterTableChangeColumn {
+			name = spec.OldColumnName.Name.O
+		}
+		i := findColumn(ta, name)
+		if i < 0 {
+			if spec.IfExists {
+				return nil
+			}
+			return errors.Errorf("unknown column %s", name)
+		}
+		oldName := ta.Columns[i].Name
+		ta.Columns = slices.Delete(ta.Columns, i, i+1)
+		if j := findColumn(ta, def.Name.Name.O); j >= 0 {
+			return errors.Errorf("duplicate column %s", def.Name.Name.O)
+		}
+		at, err := columnPosition(ta, spec.Position, i)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		ta.Columns = slices.Insert(ta.Columns, at, newColumn(def, *collation))
+		renameIndexColumn(ta, oldName, def.Name.Name.O)
+		return errors.Trace(addColumnIndexes(ta, def))
+	case ast.AlterTableRenameColumn:
+		name, newName := spec.OldColumnName.Name.O, spec.NewColumnName.Name.O
+		i := findColumn(ta, name)
+		if i < 0 {
+			return errors.Errorf("unknown column %s", name)
+		}
+		if j := findColumn(ta, newName); j >= 0 && j != i {
+			return errors.Errorf("duplicate column %s", newName)
+		}
+		renameIndexColumn(ta, ta.Columns[i].Name, newName)
+		ta.Columns[i].Name = newName
+	case ast.AlterTableDropPrimaryKey:
+		return errors.Trace(dropIndex(ta, "PRIMARY"))
+	case ast.AlterTableDropIndex:
+		if spec.IfExists && findIndex(ta, spec.Name) < 0 {
+			return nil
+		}
+		return errors.Trace(dropIndex(ta, spec.Name))
+	case ast.AlterTableRenameIndex:
+		i := findIndex(ta, spec.FromKey.O)
+		if i < 0 {
+			return errors.Errorf("unknown index %s", spec.FromKey.O)
+		}
+		ta.Indexes[i].Name = spec.ToKey.O
+	case ast.AlterTableIndexInvisible:
+		i := findIndex(ta, spec.IndexName.O)
+		if i < 0 {
+			return errors.Errorf("unknown index %s", spec.IndexName.O)
+		}
+		ta.Indexes[i].Visible = spec.Visibility != ast.IndexVisibilityInvisible
+	case ast.AlterTableRenameTable:
+		ta.Schema, ta.Name = tableName(db, spec.NewTable)
+	}
+	return nil
+}
+
+// loadSchemaTracker restores the schemas tracked at the position to sync from, or loads the
+// current schemas of the tables from the server if there is no version saved before it,
+// e.g, at the first run.
+func (c *Canal) loadSchemaTracker() error {
+	tracker := NewSchemaTracker(c.cfg.SchemaHistory)
+	pos, gset := c.master.Position(), c.master.GTIDSet()
+	ok, err := tracker.Restore(pos, gset)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if !ok {
+		c.cfg.Logger.Info("no schema history before the position, load the schemas from the server",
+			slog.Any("pos", pos), slog.Any("gset", gset))
+		if err = c.loadServerSchemas(tracker); err != nil {
+			return errors.Trace(err)
+		}
+		cp := &replication.Checkpoint{Position: pos, GTIDSet: gset, Timestamp: c.master.Timestamp()}
+		if err = tracker.Save(cp, ""); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// the tables cached by the dump are fetched from the server
+	c.tableLock.Lock()
+	c.schemaTracker = tracker
+	clear(c.tables)
+	c.tableLock.Unlock()
+	return nil
+}
+
+func (c *Canal) loadServerSchemas(tracker *SchemaTracker) error {
+	r, err := c.Execute(`SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_COLLATION FROM information_schema.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')`)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for i := 0; i < r.RowNumber(); i++ {
+		db, _ := r.GetString(i, 0)
+		name, _ := r.GetString(i, 1)
+		collation, _ := r.GetString(i, 2)
+		if !c.checkTableMatch(tableKey(db, name)) {
+			continue
+		}
+		ta, err := schema.NewTable(c, db, name)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tracker.AddTable(ta, collation)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package canal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func trackedColumns(ta *schema.Table) []string {
+	names := make([]string, len(ta.Columns))
+	for i, col := range ta.Columns {
+		names[i] = col.Name + " " + col.RawType
+	}
+	return names
+}
+
+func TestSchemaTracker(t *testing.T) {
+	tracker := NewSchemaTracker(NewMemorySchemaHistoryStore())
+	exec := func(db, query string, changed bool) {
+		ok, err := tracker.ExecDDL(db, query)
+		require.NoError(t, err, query)
+		require.Equal(t, changed, ok, query)
+	}
+
+	exec("test", "CREATE TABLE t1 (id bigint unsigned NOT NULL AUTO_INCREMENT, "+
+		"name varchar(32) COLLATE utf8mb4_general_ci, v enum('a','b'), data blob, n int zerofill, "+
+		"g int AS (id + 1) STORED, u int UNIQUE, "+
+		"PRIMARY KEY (id), KEY (name, v), UNIQUE KEY uk (n) INVISIBLE) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin", true)
+	ta, err := tracker.Table("test", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"id bigint(20) unsigned", "name varchar(32)", "v enum('a','b')", "data blob",
+		"n int(11) unsigned zerofill", "g int(11)", "u int(11)",
+	}, trackedColumns(ta))
+	require.True(t, ta.Columns[0].IsAuto)
+	require.Equal(t, "utf8mb4_general_ci", ta.Columns[1].Collation)
+	require.Equal(t, schema.TYPE_ENUM, ta.Columns[2].Type)
+	require.Equal(t, []string{"a", "b"}, ta.Columns[2].EnumValues)
+	require.Equal(t, "utf8mb4_bin", ta.Columns[2].Collation)
+	require.Equal(t, "", ta.Columns[3].Collation)
+	require.True(t, ta.Columns[5].IsStored)
+	require.Equal(t, []int{0, 4}, ta.UnsignedColumns)
+	require.Equal(t, []int{0}, ta.PKColumns)
+	require.Len(t, ta.Indexes, 4)
+	require.Equal(t, &schema.Index{Name: "name", Columns: []string{"name", "v"}, Cardinality: []uint64{1, 2}, NoneUnique: 1, Visible: true}, ta.Indexes[2])
+	require.Equal(t, "u", ta.Indexes[1].Name)
+	require.Equal(t, &schema.Index{Name: "uk", Columns: []string{"n"}, Cardinality: []uint64{1}, Visible: false}, ta.Indexes[3])
+
+	// the tables returned are never changed
+	exec("", "ALTER TABLE test.t1 ADD COLUMN c1 varchar(8) FIRST, ADD COLUMN c2 int AFTER name, "+
+		"DROP COLUMN data, DROP COLUMN v, CHANGE name full_name varchar(64), MODIFY u bigint unsigned AFTER id, "+
+		"RENAME COLUMN n TO num, DROP PRIMARY KEY, ADD PRIMARY KEY (id, c1), RENAME INDEX uk TO uk_num, "+
+		"ALTER INDEX uk_num VISIBLE", true)
+	require.Len(t, ta.Columns, 7)
+	altered, err := tracker.Table("test", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"c1 varchar(8)", "id bigint(20) unsigned", "u bigint(20) unsigned", "full_name varchar(64)",
+		"c2 int(11)", "num int(11) unsigned zerofill", "g int(11)",
+	}, trackedColumns(altered))
+	require.Equal(t, "utf8mb4_bin", altered.Columns[0].Collation)
+	require.Equal(t, []int{1, 0}, altered.PKColumns)
+	require.Equal(t, []int{1, 2, 5}, altered.UnsignedColumns)
+	require.Equal(t, "PRIMARY", altered.Indexes[0].Name)
+	require.Equal(t, []string{"full_name"}, altered.Indexes[2].Columns)
+	require.Equal(t, &schema.Index{Name: "uk_num", Columns: []string{"num"}, Cardinality: []uint64{1}, Visible: true}, altered.Indexes[3])
+
+	exec("test", "CREATE INDEX idx ON t1 (c2, num); DROP INDEX u ON t1", true)
+	altered, err = tracker.Table("test", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"PRIMARY", "name", "uk_num", "idx"}, []string{
+		altered.Indexes[0].Name, altered.Indexes[1].Name, altered.Indexes[2].Name, altered.Indexes[3].Name,
+	})
+
+	exec("test", "CREATE TABLE t2 LIKE t1", true)
+	exec("test", "RENAME TABLE t2 TO other.t3", true)
+	_, err = tracker.Table("test", "t2")
+	require.ErrorIs(t, err, schema.ErrTableNotExist)
+	t3, err := tracker.Table("other", "t3")
+	require.NoError(t, err)
+	require.Equal(t, trackedColumns(altered), trackedColumns(t3))
+	exec("other", "ALTER TABLE t3 RENAME TO t4, CONVERT TO CHARACTER SET latin1 COLLATE latin1_bin", true)
+	t4, err := tracker.Table("other", "t4")
+	require.NoError(t, err)
+	require.Equal(t, "latin1_bin", t4.Columns[0].Collation)
+	require.Equal(t, "", t4.Columns[1].Collation)
+
+	exec("test", "CREATE TABLE IF NOT EXISTS t1 (id int)", false)
+	exec("test", "DROP TABLE IF EXISTS t1, t5", true)
+	exec("test", "ALTER TABLE unknown ADD COLUMN c int", false)
+	exec("test", "CREATE TEMPORARY TABLE tmp (id int)", false)
+	exec("test", "INSERT INTO t1 VALUES (1)", false)
+	exec("test", "DROP DATABASE other", true)
+	_, err = tracker.Table("other", "t4")
+	require.ErrorIs(t, err, schema.ErrTableNotExist)
+
+	exec("test", "CREATE TABLE t6 (id int PRIMARY KEY)", true)
+	for _, query := range []string{
+		"ALTER TABLE t6 ADD COLUMN id int",
+		"ALTER TABLE t6 DROP COLUMN c",
+		"ALTER TABLE t6 ADD PRIMARY KEY (id)",
+		"ALTER TABLE t6 ADD KEY (c)",
+		"ALTER TABLE t6 DROP INDEX idx",
+		"ALTER TABLE t6 ADD COLUMN c int AFTER x",
+	} {
+		_, err = tracker.ExecDDL("test", query)
+		require.Error(t, err, query)
+	}
+	exec("test", "ALTER TABLE t6 DROP COLUMN IF EXISTS c, ADD COLUMN IF NOT EXISTS id int", true)
+	exec("test", "ALTER TABLE t6 DROP COLUMN id", true)
+	t6, err := tracker.Table("test", "t6")
+	require.NoError(t, err)
+	require.Empty(t, t6.Columns)
+	require.Empty(t, t6.Indexes)
+	require.Nil(t, t6.PKColumns)
+}
+
+func TestSchemaTrackerHistory(t *testing.T) {
+	for _, store := range []SchemaHistoryStore{NewMemorySchemaHistoryStore(), NewFileSchemaHistoryStore(t.TempDir())} {
+		gset := func(s string) mysql.GTIDSet {
+			gset, err := mysql.ParseMysqlGTIDSet(s)
+			require.NoError(t, err)
+			return gset
+		}
+		pos := func(p uint32) mysql.Position {
+			return mysql.Position{Name: "mysql-bin.000001", Pos: p}
+		}
+		const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+		tracker := NewSchemaTracker(store)
+		ok, err := tracker.Restore(pos(4), nil)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ta := &schema.Table{Schema: "test", Name: "t"}
+		ta.AddColumn("id", "int(11)", "", "")
+		tracker.AddTable(ta, "utf8mb4_bin")
+		require.NoError(t, tracker.Save(&replication.Checkpoint{Position: pos(100), GTIDSet: gset(sid + ":1-10")}, ""))
+
+		ddl := "ALTER TABLE t ADD COLUMN name varchar(8)"
+		_, err = tracker.ExecDDL("test", ddl)
+		require.NoError(t, err)
+		require.NoError(t, tracker.Save(&replication.Checkpoint{Position: pos(200), GTIDSet: gset(sid + ":1-11"), Timestamp: 1700000000}, ddl))
+
+		snapshots, err := store.Load()
+		require.NoError(t, err)
+		require.Len(t, snapshots, 2)
+		require.Equal(t, uint64(2), snapshots[1].Version)
+		require.Equal(t, ddl, snapshots[1].DDL)
+		require.Equal(t, uint32(1700000000), snapshots[1].Checkpoint.Timestamp)
+		require.Equal(t, map[string]string{"test.t": "utf8mb4_bin"}, snapshots[1].Collations)
+
+		// the schemas at the positions
+		tracker = NewSchemaTracker(store)
+		ok, err = tracker.Restore(pos(150), nil)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ta, err = tracker.Table("test", "t")
+		require.NoError(t, err)
+		require.Equal(t, []string{"id int(11)"}, trackedColumns(ta))
+
+		ok, err = tracker.Restore(mysql.Position{}, gset(sid+":1-11"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		ta, err = tracker.Table("test", "t")
+		require.NoError(t, err)
+		require.Equal(t, []string{"id int(11)", "name varchar(8)"}, trackedColumns(ta))
+		require.Equal(t, "utf8mb4_bin", ta.Columns[1].Collation)
+
+		ok, err = tracker.Restore(pos(50), gset(sid+":1-5"))
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		// replaying the binlog saves no version again
+		ok, err = tracker.Restore(pos(150), gset(sid+":1-10"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		_, err = tracker.ExecDDL("test", ddl)
+		require.NoError(t, err)
+		require.NoError(t, tracker.Save(&replication.Checkpoint{Position: pos(200), GTIDSet: gset(sid + ":1-11")}, ddl))
+		require.NoError(t, tracker.Save(&replication.Checkpoint{Position: pos(300), GTIDSet: gset(sid + ":1-12")}, "DROP TABLE t"))
+		snapshots, err = store.Load()
+		require.NoError(t, err)
+		require.Len(t, snapshots, 3)
+		require.Equal(t, uint64(3), snapshots[2].Version)
+	}
+}
+
+type testSchemaEventHandler struct {
+	DummyEventHandler
+	columns [][]string
+}
+
+func (h *testSchemaEventHandler) OnRow(e *RowsEvent) error {
+	h.columns = append(h.columns, trackedColumns(e.Table))
+	return nil
+}
+
+func TestHandleEventSchemaTracker(t *testing.T) {
+	h := &testSchemaEventHandler{}
+	store := NewMemorySchemaHistoryStore()
+	c := &Canal{
+		cfg:           &Config{Logger: slog.Default(), SchemaHistory: store},
+		master:        &masterInfo{logger: slog.Default()},
+		eventHandler:  h,
+		parser:        parser.New(),
+		tables:        make(map[string]*schema.Table),
+		schemaTracker: NewSchemaTracker(store),
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+
+	handle := func(h replication.EventHeader, e replication.Event) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{Header: &h, Event: e}))
+	}
+	insert := func() {
+		handle(replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2}, &replication.RowsEvent{
+			Table: &replication.TableMapEvent{Schema: []byte("test"), Table: []byte("t")},
+		})
+	}
+
+	insert()
+	handle(replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 100}, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("CREATE TABLE t (id int)")})
+	insert()
+	handle(replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 200}, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("ALTER TABLE t ADD COLUMN name text")})
+	insert()
+	require.Equal(t, [][]string{{"id int(11)"}, {"id int(11)", "name text"}}, h.columns)
+
+	snapshots, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 200}, snapshots[1].Checkpoint.Position)
+	require.Equal(t, "ALTER TABLE t ADD COLUMN name text", snapshots[1].DDL)
+}
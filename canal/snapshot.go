@@ -0,0 +1,422 @@
+package canal
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+const (
+	defaultSnapshotParallel  = 4
+	defaultSnapshotChunkSize = 1000
+)
+
+// snapshotter selects the tables to read in a consistent snapshot for DumpConfig.Native, like
+// dump.Dumper selects them for mysqldump.
+type snapshotter struct {
+	Databases    []string
+	TableDB      string
+	Tables       []string
+	IgnoreTables map[string][]string
+}
+
+func newSnapshotter(cfg *DumpConfig) *snapshotter {
+	s := &snapshotter{IgnoreTables: make(map[string][]string)}
+	if len(cfg.Tables) == 0 {
+		s.AddDatabases(cfg.Databases...)
+	} else {
+		s.AddTables(cfg.TableDB, cfg.Tables...)
+	}
+	for _, ignoreTable := range cfg.IgnoreTables {
+		if seps := strings.Split(ignoreTable, ","); len(seps) == 2 {
+			s.AddIgnoreTables(seps[0], seps[1])
+		}
+	}
+	return s
+}
+
+func (s *snapshotter) AddDatabases(dbs ...string) {
+	s.Databases = append(s.Databases, dbs...)
+}
+
+func (s *snapshotter) AddTables(db string, tables ...string) {
+	if s.TableDB != db {
+		s.TableDB = db
+		s.Tables = s.Tables[0:0]
+	}
+
+	s.Tables = append(s.Tables, tables...)
+}
+
+func (s *snapshotter) AddIgnoreTables(db string, tables ...string) {
+	s.IgnoreTables[db] = append(s.IgnoreTables[db], tables...)
+}
+
+// query returns the query of the tables to read, all the tables out of the system databases if
+// no database or table is added.
+func (s *snapshotter) query() (string, []interface{}) {
+	query := `SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE'`
+	var args []interface{}
+	in := func(column string, values []string) {
+		query += fmt.Sprintf(" AND %s IN (%s)", column, strings.TrimSuffix(strings.Repeat("?,", len(values)), ","))
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+
+	switch {
+	case len(s.Tables) > 0:
+		in("TABLE_SCHEMA", []string{s.TableDB})
+		in("TABLE_NAME", s.Tables)
+	case len(s.Databases) > 0:
+		in("TABLE_SCHEMA", s.Databases)
+	default:
+		query += ` AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')`
+	}
+	return query + ` ORDER BY TABLE_SCHEMA, TABLE_NAME`, args
+}
+
+// snapshotTables returns the tables to read in the snapshot as db.table.
+func (c *Canal) snapshotTables() ([][2]string, error) {
+	query, args := c.snapshotter.query()
+	res, err := c.Execute(query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tables := make([][2]string, 0, res.RowNumber())
+	for i := 0; i < res.RowNumber(); i++ {
+		db, _ := res.GetString(i, 0)
+		table, _ := res.GetString(i, 1)
+		if slices.Contains(c.snapshotter.IgnoreTables[db], table) || !c.checkTableMatch(tableKey(db, table)) {
+			continue
+		}
+		tables = append(tables, [2]string{db, table})
+	}
+	return tables, nil
+}
+
+// dumpSnapshot reads the tables in a consistent snapshot and passes the rows to OnRow as the
+// InsertAction, then sets the position of the snapshot into h.
+//
+// All the connections start the transactions WITH CONSISTENT SNAPSHOT under FLUSH TABLES WITH
+// READ LOCK to read the same snapshot at the position. The position is got before the snapshot
+// without the lock if DumpConfig.SkipMasterData is set, so the rows changed in between are
+// synced again from the binlog.
+func (c *Canal) dumpSnapshot(h *dumpParseHandler) error {
+	tables, err := c.snapshotTables()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	parallel := c.cfg.Dump.Parallel
+	if parallel <= 0 {
+		parallel = defaultSnapshotParallel
+	}
+	conns := make([]*client.Conn, max(min(parallel, len(tables)), 1))
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	for i := range conns {
+		if conns[i], err = c.snapshotConn(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	var lock *client.Conn
+	if !c.cfg.Dump.SkipMasterData {
+		if lock, err = c.connect(c.connOptions()...); err != nil {
+			return errors.Trace(err)
+		}
+		defer lock.Close()
+
+		if _, err = lock.Execute("FLUSH TABLES WITH READ LOCK"); err != nil {
+			return errors.Trace(err)
+		}
+		pos, err := c.GetMasterPos()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		h.name = pos.Name
+		h.pos = uint64(pos.Pos)
+		if h.gset != nil {
+			if h.gset, err = c.GetMasterGTIDSet(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	for _, conn := range conns {
+		if _, err = conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if lock != nil {
+		// not to block the writes until all the tables are read
+		if _, err = lock.Execute("UNLOCK TABLES"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	c.cfg.Logger.Info("start consistent snapshot", slog.String("file", h.name), slog.Uint64("position", h.pos), slog.Int("tables", len(tables)), slog.Int("parallel", len(conns)))
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	ch := make(chan [2]string)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		rowLock  sync.Mutex
+	)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *client.Conn) {
+			defer wg.Done()
+			for t := range ch {
+				if err := c.readSnapshotTable(ctx, conn, &rowLock, t[0], t[1]); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}(conn)
+	}
+
+loop:
+	for _, t := range tables {
+		select {
+		case ch <- t:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if firstErr != nil {
+		return errors.Trace(firstErr)
+	}
+	return errors.Trace(c.ctx.Err())
+}
+
+// snapshotConn returns a connection to read the rows like the binlog, in UTC and without
+// PAD_CHAR_TO_FULL_LENGTH.
+func (c *Canal) snapshotConn() (*client.Conn, error) {
+	conn, err := c.connect(c.connOptions()...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, query := range []string{
+		"SET SESSION sql_mode = ''",
+		"SET SESSION time_zone = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+	} {
+		if _, err = conn.Execute(query); err != nil {
+			conn.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	return conn, nil
+}
+
+// snapshotQuery returns the query of the rows of the table, after the primary key of the last
+// row if it's not nil, in the chunk of limit rows ordered by the primary key.
+func snapshotQuery(ta *schema.Table, where string, last []string, limit int) string {
+	columns := make([]string, len(ta.Columns))
+	for i, col := range ta.Columns {
+		columns[i] = quoteIdentifier(col.Name)
+	}
+	pk := make([]string, len(ta.PKColumns))
+	for i, index := range ta.PKColumns {
+		pk[i] = quoteIdentifier(ta.Columns[index].Name)
+	}
+
+	var conds []string
+	if where != "" {
+		conds = append(conds, "("+where+")")
+	}
+	if last != nil {
+		conds = append(conds, fmt.Sprintf("(%s) > (%s)", strings.Join(pk, ", "), strings.Join(last, ", ")))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s.%s", strings.Join(columns, ", "), quoteIdentifier(ta.Schema), quoteIdentifier(ta.Name))
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(pk) > 0 {
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(pk, ", "), limit)
+	}
+	return query
+}
+
+// snapshotRow returns the values of the row read by snapshotQuery.
+func (c *Canal) snapshotRow(ta *schema.Table, row []mysql.FieldValue) ([]interface{}, error) {
+	values := make([]interface{}, len(row))
+	for i := range row {
+		var err error
+		if values[i], err = c.snapshotValue(&ta.Columns[i], &row[i]); err != nil {
+			return nil, errors.Annotatef(err, "column %s of %s", ta.Columns[i].Name, ta)
+		}
+	}
+	return values, nil
+}
+
+// snapshotLast returns the literals of the primary key of the row read by snapshotQuery.
+func snapshotLast(ta *schema.Table, row []mysql.FieldValue) []string {
+	last := make([]string, len(ta.PKColumns))
+	for i, index := range ta.PKColumns {
+		last[i] = snapshotLiteral(&ta.Columns[index], &row[index])
+	}
+	return last
+}
+
+// readSnapshotTable reads the table in the chunks of DumpConfig.ChunkSize rows ordered by the
+// primary key, every chunk is passed to OnRow as a RowsEvent. The table without primary key is
+// read by one query, but still passed by chunks.
+func (c *Canal) readSnapshotTable(ctx context.Context, conn *client.Conn, rowLock *sync.Mutex, db string, table string) error {
+	ta, err := c.GetTable(db, table)
+	if err != nil {
+		e := errors.Cause(err)
+		if e == ErrExcludedTable || e == schema.ErrTableNotExist || e == schema.ErrMissingTableMeta {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+
+	chunkSize := c.cfg.Dump.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+
+	start := time.Now()
+	var total int
+	var last []string
+	rows := make([][]interface{}, 0, chunkSize)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		rowLock.Lock()
+		defer rowLock.Unlock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		total += len(rows)
+		err := c.eventHandler.OnRow(newRowsEvent(ta, InsertAction, rows, nil))
+		rows = make([][]interface{}, 0, chunkSize)
+		return errors.Trace(err)
+	}
+
+	hasPK := len(ta.PKColumns) > 0
+	for {
+		n := 0
+		var result mysql.Result
+		err := conn.ExecuteSelectStreaming(snapshotQuery(ta, c.cfg.Dump.Where, last, chunkSize), &result, func(row []mysql.FieldValue) error {
+			values, err := c.snapshotRow(ta, row)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			rows = append(rows, values)
+			n++
+			if n == chunkSize && hasPK {
+				last = snapshotLast(ta, row)
+			}
+			if len(rows) == chunkSize {
+				return flush()
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if n < chunkSize || !hasPK {
+			break
+		}
+	}
+	if err = flush(); err != nil {
+		return errors.Trace(err)
+	}
+
+	c.cfg.Logger.Info("read table in snapshot", slog.String("table", ta.String()), slog.Int("rows", total), slog.Duration("use", time.Since(start)))
+	return nil
+}
+
+// snapshotValue returns the value of the column read by the text protocol in the type of the
+// dumped rows, e.g, int64 or uint64 for the integers, decimal.Decimal for DECIMAL if
+// UseDecimal is set. BIT is int64 and the temporal types are like the binlog rows.
+func (c *Canal) snapshotValue(col *schema.TableColumn, v *mysql.FieldValue) (interface{}, error) {
+	if v.Type != mysql.FieldValueTypeString {
+		return v.Value(), nil
+	}
+
+	s := string(v.AsString())
+	switch col.Type {
+	case schema.TYPE_DECIMAL:
+		if c.cfg.UseDecimal {
+			return decimal.NewFromString(s)
+		}
+		return strconv.ParseFloat(s, 64)
+	case schema.TYPE_BIT:
+		var n int64
+		for _, b := range v.AsString() {
+			n = n<<8 | int64(b)
+		}
+		return n, nil
+	case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP:
+		layout := "2006-01-02 15:04:05"
+		if i := strings.IndexByte(s, '.'); i >= 0 {
+			layout += "." + strings.Repeat("0", len(s)-i-1)
+		}
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err != nil {
+			// zero dates are kept as the strings, like the binlog rows
+			return s, nil
+		}
+		if col.Type == schema.TYPE_TIMESTAMP {
+			// the session is in UTC, but the binlog rows are in the local time
+			t = t.In(time.Local)
+			if c.cfg.TimestampStringLocation != nil && !c.cfg.ParseTime {
+				t = t.In(c.cfg.TimestampStringLocation)
+			}
+		}
+		if c.cfg.ParseTime {
+			return t, nil
+		}
+		return t.Format(layout), nil
+	}
+	return s, nil
+}
+
+// snapshotLiteral returns the literal of the value to compare with the column, the binary
+// strings are in hex not to be converted to the charset of the connection.
+func snapshotLiteral(col *schema.TableColumn, v *mysql.FieldValue) string {
+	if v.Type != mysql.FieldValueTypeString {
+		return v.String()
+	}
+	if col.Type == schema.TYPE_BINARY || col.Type == schema.TYPE_BIT || strings.Contains(col.RawType, "blob") {
+		return "X'" + hex.EncodeToString(v.AsString()) + "'"
+	}
+	return "'" + mysql.Escape(string(v.AsString())) + "'"
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,84 @@
+package canal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func TestSnapshotterQuery(t *testing.T) {
+	s := newSnapshotter(&DumpConfig{Databases: []string{"a", "b"}, IgnoreTables: []string{"a,t", "invalid"}})
+	query, args := s.query()
+	require.Equal(t, "SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA IN (?,?) ORDER BY TABLE_SCHEMA, TABLE_NAME", query)
+	require.Equal(t, []interface{}{"a", "b"}, args)
+	require.Equal(t, map[string][]string{"a": {"t"}}, s.IgnoreTables)
+
+	// the tables override the databases
+	s.AddTables("c", "t1", "t2")
+	query, args = s.query()
+	require.Equal(t, "SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA IN (?) AND TABLE_NAME IN (?,?) ORDER BY TABLE_SCHEMA, TABLE_NAME", query)
+	require.Equal(t, []interface{}{"c", "t1", "t2"}, args)
+
+	s = newSnapshotter(&DumpConfig{})
+	query, args = s.query()
+	require.Contains(t, query, "TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')")
+	require.Empty(t, args)
+}
+
+func TestSnapshotValue(t *testing.T) {
+	ta := &schema.Table{Schema: "test", Name: "t"}
+	ta.AddColumn("i", "int(11) unsigned", "", "")
+	ta.AddColumn("d", "decimal(10,2)", "", "")
+	ta.AddColumn("b", "bit(16)", "", "")
+	ta.AddColumn("dt", "datetime(3)", "", "")
+	ta.AddColumn("ts", "timestamp", "", "")
+	ta.AddColumn("s", "varchar(10)", "utf8mb4_general_ci", "")
+
+	str := func(s string) *mysql.FieldValue {
+		v := mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte(s))
+		return &v
+	}
+	value := func(c *Canal, i int, v *mysql.FieldValue) interface{} {
+		ret, err := c.snapshotValue(&ta.Columns[i], v)
+		require.NoError(t, err)
+		return ret
+	}
+
+	c := &Canal{cfg: &Config{TimestampStringLocation: time.FixedZone("UTC+8", 8*3600)}}
+	unsigned := mysql.NewFieldValue(mysql.FieldValueTypeUnsigned, 10, nil)
+	require.Equal(t, uint64(10), value(c, 0, &unsigned))
+	null := mysql.NewFieldValue(mysql.FieldValueTypeNull, 0, nil)
+	require.Nil(t, value(c, 0, &null))
+	require.Equal(t, 12.5, value(c, 1, str("12.50")))
+	require.Equal(t, int64(0x0102), value(c, 2, str("\x01\x02")))
+	require.Equal(t, "2024-01-02 03:04:05.600", value(c, 3, str("2024-01-02 03:04:05.600")))
+	require.Equal(t, "2024-01-02 11:04:05", value(c, 4, str("2024-01-02 03:04:05")))
+	require.Equal(t, "0000-00-00 00:00:00", value(c, 4, str("0000-00-00 00:00:00")))
+	require.Equal(t, "abc", value(c, 5, str("abc")))
+
+	c = &Canal{cfg: &Config{UseDecimal: true, ParseTime: true}}
+	require.Equal(t, decimal.RequireFromString("12.50"), value(c, 1, str("12.50")))
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC), value(c, 3, str("2024-01-02 03:04:05.600")))
+	require.True(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Equal(value(c, 4, str("2024-01-02 03:04:05")).(time.Time)))
+}
+
+func TestSnapshotLiteral(t *testing.T) {
+	ta := &schema.Table{Schema: "test", Name: "t"}
+	ta.AddColumn("i", "bigint(20)", "", "")
+	ta.AddColumn("s", "varchar(10)", "utf8mb4_general_ci", "")
+	ta.AddColumn("b", "varbinary(10)", "", "")
+
+	signed := mysql.NewFieldValue(mysql.FieldValueTypeSigned, uint64(0xFFFFFFFFFFFFFFFF), nil)
+	require.Equal(t, "-1", snapshotLiteral(&ta.Columns[0], &signed))
+	s := mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte(`a'b\`))
+	require.Equal(t, `'a\'b\\'`, snapshotLiteral(&ta.Columns[1], &s))
+	b := mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte{0, 0xff})
+	require.Equal(t, "X'00ff'", snapshotLiteral(&ta.Columns[2], &b))
+
+	require.Equal(t, "`a``b`", quoteIdentifier("a`b"))
+}
@@ -77,6 +77,8 @@ func (c *Canal) runSyncBinlog() error {
 func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 	savePos := false
 	force := false
+	// commit the checkpoint at the end of transactions
+	commit := false
 	pos := c.master.Position()
 	var err error
 
@@ -96,6 +98,7 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		c.cfg.Logger.Info("rotate binlog", slog.Any("pos", pos))
 		savePos = true
 		force = true
+		commit = true
 		if err = c.eventHandler.OnRotate(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
@@ -119,6 +122,8 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		return nil
 	case *replication.XIDEvent:
 		savePos = true
+		commit = true
+		c.inBlock = false
 		// try to save the position later
 		if err := c.eventHandler.OnXID(ev.Header, pos); err != nil {
 			return errors.Trace(err)
@@ -126,11 +131,23 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		if e.GSet != nil {
 			c.master.UpdateGTIDSet(e.GSet)
 		}
+	case *replication.XAPrepareEvent:
+		savePos = true
+		commit = true
+		c.inBlock = false
+		if err := c.handleXA(ev.Header, pos, newXAPrepareEvent(e, ev.Header)); err != nil {
+			return errors.Trace(err)
+		}
+		if e.GSet != nil {
+			c.master.UpdateGTIDSet(e.GSet)
+		}
 	case *replication.MariadbGTIDEvent:
+		c.inBlock = !e.IsStandalone()
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
 	case *replication.GTIDEvent:
+		c.inBlock = false
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
@@ -139,6 +156,21 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 			return errors.Trace(err)
 		}
 	case *replication.QueryEvent:
+		if xa, ok := parseXAQuery(e.Query, ev.Header); ok {
+			// the parser doesn't understand XA statements
+			if xa == nil {
+				return nil
+			}
+			savePos = true
+			commit = true
+			if err := c.handleXA(ev.Header, pos, xa); err != nil {
+				return errors.Trace(err)
+			}
+			if e.GSet != nil {
+				c.master.UpdateGTIDSet(e.GSet)
+			}
+			break
+		}
 		stmts, _, err := c.parser.Parse(string(e.Query), "", "")
 		if err != nil {
 			// The parser does not understand all syntax.
@@ -149,7 +181,32 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		if len(stmts) > 0 {
 			savePos = true
 		}
+		schemaChanged := false
 		for _, stmt := range stmts {
+			switch st := stmt.(type) {
+			case *ast.BeginStmt:
+				c.inBlock = true
+			case *ast.CommitStmt:
+				commit = true
+				c.inBlock = false
+			case *ast.RollbackStmt:
+				if st.SavepointName == "" {
+					commit = true
+					c.inBlock = false
+				}
+			default:
+				// a DDL, or a standalone statement, SAVEPOINT and the statements inside
+				// a block are not the end of the transaction
+				commit = commit || !c.inBlock
+			}
+			if c.schemaTracker != nil {
+				// track the schemas before the handler gets the changed tables
+				changed, err := c.schemaTracker.exec(string(e.Schema), stmt)
+				if err != nil {
+					return errors.Annotatef(err, "track schema change %s", e.Query)
+				}
+				schemaChanged = schemaChanged || changed
+			}
 			nodes := parseStmt(stmt)
 			for _, node := range nodes {
 				if node.db == "" {
@@ -167,6 +224,16 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 				}
 			}
 		}
+		if schemaChanged {
+			gset := c.master.GTIDSet()
+			if e.GSet != nil {
+				gset = e.GSet
+			}
+			cp := &replication.Checkpoint{Position: pos, GTIDSet: gset, Timestamp: ev.Header.Timestamp}
+			if err = c.schemaTracker.Save(cp, string(e.Query)); err != nil {
+				return errors.Trace(err)
+			}
+		}
 		if savePos && e.GSet != nil {
 			c.master.UpdateGTIDSet(e.GSet)
 		}
@@ -181,6 +248,12 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		if err := c.eventHandler.OnPosSynced(ev.Header, pos, c.master.GTIDSet(), force); err != nil {
 			return errors.Trace(err)
 		}
+
+		if commit {
+			if err := c.saveCheckpoint(pos, ev.Header.Timestamp); err != nil {
+				return errors.Trace(err)
+			}
+		}
 	}
 
 	return nil
@@ -268,7 +341,17 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 	schemaName := string(ev.Table.Schema)
 	tableName := string(ev.Table.Table)
 
-	t, err := c.GetTable(schemaName, tableName)
+	if c.cfg.SignalTable != "" && tableKey(schemaName, tableName) == c.cfg.SignalTable {
+		return c.handleSignalRows(e)
+	}
+
+	var t *schema.Table
+	var err error
+	if c.cfg.TableMapSchema {
+		t, err = c.getTableFromTableMap(ev.Table)
+	} else {
+		t, err = c.GetTable(schemaName, tableName)
+	}
 	if err != nil {
 		e := errors.Cause(err)
 		// ignore errors below
@@ -286,10 +369,23 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 		action = DeleteAction
 	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2, replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
 		action = UpdateAction
+	case replication.PARTIAL_UPDATE_ROWS_EVENT:
+		action = UpdateAction
+		if c.cfg.ApplyJsonDiffs {
+			if err = ev.ApplyJsonDiffs(); err != nil {
+				return errors.Trace(err)
+			}
+		}
 	default:
 		return errors.Errorf("%s not supported now", e.Header.EventType)
 	}
 	events := newRowsEvent(t, action, ev.Rows, e.Header)
+	events.raw = ev
+	if c.cfg.SignalTable != "" {
+		if err = c.trackSnapshotChanges(events); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	return c.eventHandler.OnRow(events)
 }
 
@@ -1,9 +1,15 @@
 package canal
 
 import (
+	"log/slog"
 	"testing"
 
+	"github.com/pingcap/tidb/pkg/parser"
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
 )
 
 func TestGetShowBinaryLogQuery(t *testing.T) {
@@ -29,3 +35,164 @@ func TestGetShowBinaryLogQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleEventSaveCheckpoint(t *testing.T) {
+	store := replication.NewMemoryCheckpointStore()
+	c := &Canal{
+		cfg:             &Config{Logger: slog.Default()},
+		master:          &masterInfo{logger: slog.Default()},
+		eventHandler:    &DummyEventHandler{},
+		parser:          parser.New(),
+		tables:          make(map[string]*schema.Table),
+		checkpointStore: store,
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+
+	handle := func(h replication.EventHeader, e replication.Event) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{Header: &h, Event: e}))
+	}
+
+	handle(replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 100}, &replication.QueryEvent{Query: []byte("BEGIN")})
+	cp, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	require.NoError(t, err)
+	handle(replication.EventHeader{EventType: replication.XID_EVENT, LogPos: 200, Timestamp: 1700000000}, &replication.XIDEvent{GSet: gset})
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 200}, cp.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", cp.GTIDSet.String())
+	require.Equal(t, uint32(1700000000), cp.Timestamp)
+
+	handle(replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 300, Timestamp: 1700000001}, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("CREATE TABLE t (id int)")})
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 300}, cp.Position)
+
+	handle(replication.EventHeader{EventType: replication.ROTATE_EVENT, Timestamp: 1700000002}, &replication.RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")})
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 4}, cp.Position)
+}
+
+func TestHandleEventSaveCheckpointInBlock(t *testing.T) {
+	store := replication.NewMemoryCheckpointStore()
+	c := &Canal{
+		cfg:             &Config{Logger: slog.Default()},
+		master:          &masterInfo{logger: slog.Default()},
+		eventHandler:    &DummyEventHandler{},
+		parser:          parser.New(),
+		tables:          make(map[string]*schema.Table),
+		checkpointStore: store,
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+
+	handle := func(logPos uint32, e replication.Event) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{Header: &replication.EventHeader{LogPos: logPos}, Event: e}))
+	}
+	query := func(q string) *replication.QueryEvent {
+		return &replication.QueryEvent{Schema: []byte("test"), Query: []byte(q)}
+	}
+
+	handle(100, query("BEGIN"))
+	handle(200, query("SAVEPOINT sp1"))
+	handle(300, query("INSERT INTO t VALUES (1)"))
+	handle(400, query("ROLLBACK TO sp1"))
+	cp, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	handle(500, query("COMMIT"))
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 500}, cp.Position)
+
+	// a MariaDB group without FL_STANDALONE is ended by COMMIT
+	handle(600, &replication.MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 1}})
+	handle(700, query("INSERT INTO t VALUES (2)"))
+	handle(800, query("INSERT INTO t VALUES (3)"))
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint32(500), cp.Position.Pos)
+
+	handle(900, query("COMMIT"))
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint32(900), cp.Position.Pos)
+
+	// a standalone DDL
+	handle(1000, &replication.MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 2}, Flags: replication.BINLOG_MARIADB_FL_STANDALONE})
+	handle(1100, query("CREATE TABLE t2 (id int)"))
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1100), cp.Position.Pos)
+}
+
+type testXAEventHandler struct {
+	DummyEventHandler
+	events []string
+}
+
+func (h *testXAEventHandler) OnXA(_ *replication.EventHeader, nextPos mysql.Position, e *XAEvent) error {
+	h.events = append(h.events, e.String())
+	return nil
+}
+
+func TestHandleEventXA(t *testing.T) {
+	store := replication.NewMemoryCheckpointStore()
+	h := &testXAEventHandler{}
+	c := &Canal{
+		cfg:             &Config{Logger: slog.Default()},
+		master:          &masterInfo{logger: slog.Default()},
+		eventHandler:    h,
+		parser:          parser.New(),
+		tables:          make(map[string]*schema.Table),
+		checkpointStore: store,
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+
+	handle := func(logPos uint32, e replication.Event) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{Header: &replication.EventHeader{LogPos: logPos}, Event: e}))
+	}
+	gset := func(s string) mysql.GTIDSet {
+		gset, err := mysql.ParseMysqlGTIDSet(s)
+		require.NoError(t, err)
+		return gset
+	}
+
+	handle(100, &replication.QueryEvent{Query: []byte("XA START X'6162',X'',1")})
+	handle(200, &replication.QueryEvent{Query: []byte("XA END X'6162',X'',1")})
+	cp, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	handle(300, &replication.XAPrepareEvent{FormatID: 1, GTRID: []byte("ab"), GSet: gset("3e11fa47-71ca-11e1-9e33-c80aa9429562:1")})
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 300}, cp.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1", cp.GTIDSet.String())
+
+	handle(400, &replication.QueryEvent{Query: []byte("XA COMMIT X'6162',X'',1"), GSet: gset("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-2")})
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 400}, cp.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-2", cp.GTIDSet.String())
+
+	handle(500, &replication.QueryEvent{Query: []byte("xa rollback X'6364',X'',1")})
+	handle(600, &replication.XAPrepareEvent{OnePhase: true, FormatID: 1, GTRID: []byte("ef")})
+
+	require.Equal(t, []string{
+		"XA prepare X'6162',X'',1",
+		"XA commit X'6162',X'',1",
+		"XA rollback X'6364',X'',1",
+		"XA commit X'6566',X'',1",
+	}, h.events)
+
+	xa, ok := parseXAQuery([]byte("XA COMMIT X'6162',X'',1 ONE PHASE"), nil)
+	require.True(t, ok)
+	require.Equal(t, &XAEvent{Action: XACommitAction, XID: "X'6162',X'',1", OnePhase: true}, xa)
+	_, ok = parseXAQuery([]byte("INSERT INTO xa VALUES (1)"), nil)
+	require.False(t, ok)
+}
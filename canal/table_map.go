@@ -0,0 +1,273 @@
+package canal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/charset"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// geometryTypeNames are the names of the geometry types in the optional metadata.
+var geometryTypeNames = []string{
+	"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection",
+}
+
+// NewTableFromTableMap creates the table schema from the optional metadata of the table map
+// event without querying the server, it requires binlog_row_metadata=FULL to have the column
+// names. The types of the columns are like SHOW COLUMNS of MySQL 8.0, without the display
+// widths of the integers, and the columns have no auto_increment or generated extras, which
+// are not in the binlog. Only the primary key is in the indexes.
+func NewTableFromTableMap(e *replication.TableMapEvent) (*schema.Table, error) {
+	if len(e.ColumnName) != int(e.ColumnCount) {
+		return nil, errors.Errorf("table map event of %s.%s has no column names, binlog_row_metadata=FULL is required", e.Schema, e.Table)
+	}
+
+	ta := &schema.Table{
+		Schema:  string(e.Schema),
+		Name:    string(e.Table),
+		Columns: make([]schema.TableColumn, 0, e.ColumnCount),
+		Indexes: make([]*schema.Index, 0, 1),
+	}
+
+	unsigned := e.UnsignedMap()
+	collations := e.CollationMap()
+	for i, id := range e.EnumSetCollationMap() {
+		collations[i] = id
+	}
+	enums := e.EnumStrValueMap()
+	sets := e.SetStrValueMap()
+	geometries := e.GeometryTypeMap()
+
+	for i, name := range e.ColumnNameString() {
+		collation := ""
+		maxLen := 1
+		if id, ok := collations[i]; ok {
+			c, err := charset.GetCollationByID(int(id))
+			if err != nil {
+				return nil, errors.Annotatef(err, "column %s of %s", name, ta)
+			}
+			collation = c.Name
+			if cs, err := charset.GetCharsetInfo(c.CharsetName); err == nil {
+				maxLen = cs.Maxlen
+			}
+		}
+
+		tp := tableMapColumnType(e.ColumnType[i], e.ColumnMeta[i], collation == charset.CollationBin, maxLen,
+			enums[i], sets[i], geometries[i])
+		if unsigned[i] {
+			tp += " unsigned"
+		}
+		if collation == charset.CollationBin {
+			collation = ""
+		}
+		ta.AddColumn(name, tp, collation, "")
+	}
+
+	if len(e.PrimaryKey) > 0 {
+		index := ta.AddIndex("PRIMARY")
+		ta.PKColumns = make([]int, len(e.PrimaryKey))
+		for i, column := range e.PrimaryKey {
+			if column >= e.ColumnCount {
+				return nil, errors.Errorf("invalid primary key column %d of %s", column, ta)
+			}
+			index.AddColumn(ta.Columns[column].Name, 0)
+			ta.PKColumns[i] = int(column)
+		}
+	}
+	return ta, nil
+}
+
+// tableMapColumnType returns the type of the column like SHOW COLUMNS by its type and meta in
+// the table map event. binary is true for the binary strings, and the lengths of the other
+// strings are counted in the characters of maxLen bytes.
+func tableMapColumnType(tp byte, meta uint16, binary bool, maxLen int, enum []string, set []string, geometry uint64) string {
+	if tp == mysql.MYSQL_TYPE_STRING && meta >= 256 {
+		// the real type and the length are in the meta, see realColumnType of replication
+		b0, b1 := byte(meta>>8), uint16(meta&0xFF)
+		if b0&0x30 != 0x30 {
+			tp = b0 | 0x30
+			meta = b1 | (uint16((b0&0x30)^0x30) << 4)
+		} else {
+			tp = b0
+			meta = b1
+		}
+	}
+
+	chars := func(length uint16) int {
+		return int(length) / max(maxLen, 1)
+	}
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return "tinyint"
+	case mysql.MYSQL_TYPE_SHORT:
+		return "smallint"
+	case mysql.MYSQL_TYPE_INT24:
+		return "mediumint"
+	case mysql.MYSQL_TYPE_LONG:
+		return "int"
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "bigint"
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return fmt.Sprintf("decimal(%d,%d)", meta>>8, meta&0xFF)
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "float"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "double"
+	case mysql.MYSQL_TYPE_BIT:
+		return fmt.Sprintf("bit(%d)", (meta>>8)*8+meta&0xFF)
+	case mysql.MYSQL_TYPE_YEAR:
+		return "year"
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "date"
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_TIME2:
+		return withFsp("time", meta)
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_DATETIME2:
+		return withFsp("datetime", meta)
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		return withFsp("timestamp", meta)
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if binary {
+			return fmt.Sprintf("varbinary(%d)", meta)
+		}
+		return fmt.Sprintf("varchar(%d)", chars(meta))
+	case mysql.MYSQL_TYPE_STRING:
+		if binary {
+			return fmt.Sprintf("binary(%d)", meta)
+		}
+		return fmt.Sprintf("char(%d)", chars(meta))
+	case mysql.MYSQL_TYPE_ENUM:
+		return fmt.Sprintf("enum(%s)", quoteValues(enum))
+	case mysql.MYSQL_TYPE_SET:
+		return fmt.Sprintf("set(%s)", quoteValues(set))
+	case mysql.MYSQL_TYPE_BLOB:
+		prefix := []string{"tiny", "", "medium", "long"}[min(max(int(meta), 1), 4)-1]
+		if binary {
+			return prefix + "blob"
+		}
+		return prefix + "text"
+	case mysql.MYSQL_TYPE_JSON:
+		return "json"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		if geometry < uint64(len(geometryTypeNames)) {
+			return geometryTypeNames[geometry]
+		}
+		return "geometry"
+	case mysql.MYSQL_TYPE_VECTOR:
+		return "vector"
+	}
+	return fmt.Sprintf("unknown type %d", tp)
+}
+
+// withFsp returns the temporal type with the fractional seconds precision in the meta.
+func withFsp(tp string, fsp uint16) string {
+	if fsp == 0 {
+		return tp
+	}
+	return fmt.Sprintf("%s(%d)", tp, fsp)
+}
+
+func quoteValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ",")
+}
+
+// tableMapVersion identifies the table map events of the same table definition, the events of
+// every transaction are new ones, so they're compared by the table ID and the metadata.
+type tableMapVersion struct {
+	// the last event, the rows events of a transaction share it
+	event   *replication.TableMapEvent
+	tableID uint64
+	hash    uint64
+}
+
+// newTableMapVersion hashes the metadata of the table map event.
+func newTableMapVersion(e *replication.TableMapEvent) tableMapVersion {
+	h := fnv.New64a()
+	var n [binary.MaxVarintLen64]byte
+	writeInt := func(v uint64) {
+		_, _ = h.Write(n[:binary.PutUvarint(n[:], v)])
+	}
+	writeBytes := func(b []byte) {
+		writeInt(uint64(len(b)))
+		_, _ = h.Write(b)
+	}
+	writeInts := func(s []uint64) {
+		writeInt(uint64(len(s)))
+		for _, v := range s {
+			writeInt(v)
+		}
+	}
+	writeStrings := func(s [][]byte) {
+		writeInt(uint64(len(s)))
+		for _, b := range s {
+			writeBytes(b)
+		}
+	}
+
+	writeBytes(e.Schema)
+	writeBytes(e.Table)
+	writeBytes(e.ColumnType)
+	writeInt(uint64(len(e.ColumnMeta)))
+	for _, m := range e.ColumnMeta {
+		writeInt(uint64(m))
+	}
+	writeBytes(e.NullBitmap)
+	writeBytes(e.SignednessBitmap)
+	writeInts(e.DefaultCharset)
+	writeInts(e.ColumnCharset)
+	for _, values := range [][][][]byte{e.SetStrValue, e.EnumStrValue} {
+		writeInt(uint64(len(values)))
+		for _, v := range values {
+			writeStrings(v)
+		}
+	}
+	writeStrings(e.ColumnName)
+	writeInts(e.GeometryType)
+	writeInts(e.PrimaryKey)
+	writeInts(e.PrimaryKeyPrefix)
+	writeInts(e.EnumSetDefaultCharset)
+	writeInts(e.EnumSetColumnCharset)
+	writeBytes(e.VisibilityBitmap)
+	return tableMapVersion{event: e, tableID: e.TableID, hash: h.Sum64()}
+}
+
+// getTableFromTableMap returns the table built from the table map event, which is cached until
+// a table map event of the table has another table ID or metadata, e.g, after the table is altered.
+func (c *Canal) getTableFromTableMap(e *replication.TableMapEvent) (*schema.Table, error) {
+	key := tableKey(string(e.Schema), string(e.Table))
+	if !c.checkTableMatch(key) {
+		return nil, ErrExcludedTable
+	}
+
+	c.tableLock.RLock()
+	t, ok := c.tables[key]
+	version, cached := c.tableMaps[key]
+	c.tableLock.RUnlock()
+	if ok && cached && version.event == e {
+		return t, nil
+	}
+
+	newVersion := newTableMapVersion(e)
+	if !ok || !cached || version.tableID != newVersion.tableID || version.hash != newVersion.hash {
+		var err error
+		if t, err = NewTableFromTableMap(e); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	c.tableLock.Lock()
+	c.tables[key] = t
+	c.tableMaps[key] = newVersion
+	c.tableLock.Unlock()
+	return t, nil
+}
@@ -0,0 +1,167 @@
+package canal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func byteSlices(values ...string) [][]byte {
+	ret := make([][]byte, len(values))
+	for i, v := range values {
+		ret[i] = []byte(v)
+	}
+	return ret
+}
+
+// newTestTableMapEvent returns the table map event with binlog_row_metadata=FULL of
+//
+//	CREATE TABLE t (
+//		id bigint unsigned NOT NULL,
+//		name varchar(64) COLLATE utf8mb4_general_ci,
+//		code char(3) CHARACTER SET latin1,
+//		data varbinary(16),
+//		big char(100) COLLATE utf8mb4_general_ci,
+//		price decimal(10,2),
+//		flags bit(10),
+//		created datetime(3),
+//		body text COLLATE utf8mb4_general_ci,
+//		state enum('a','b''c') COLLATE utf8mb4_general_ci,
+//		doc json,
+//		pos point,
+//		PRIMARY KEY (code, id)
+//	)
+func newTestTableMapEvent() *replication.TableMapEvent {
+	return &replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 12,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_GEOMETRY,
+		},
+		// char(100) of utf8mb4 has 400 bytes, whose high bits are in the real type
+		ColumnMeta: []uint16{
+			0, 256, uint16(mysql.MYSQL_TYPE_STRING)<<8 | 3, 16,
+			0xee90, 10<<8 | 2, 1<<8 | 2, 3,
+			2, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 4, 4,
+		},
+		SignednessBitmap:      []byte{0x80},
+		DefaultCharset:        []uint64{45, 1, 8, 2, 63},
+		EnumSetDefaultCharset: []uint64{45},
+		ColumnName:            byteSlices("id", "name", "code", "data", "big", "price", "flags", "created", "body", "state", "doc", "pos"),
+		EnumStrValue:          [][][]byte{byteSlices("a", "b'c")},
+		GeometryType:          []uint64{1},
+		PrimaryKey:            []uint64{2, 0},
+	}
+}
+
+func TestNewTableFromTableMap(t *testing.T) {
+	ta, err := NewTableFromTableMap(newTestTableMapEvent())
+	require.NoError(t, err)
+	require.Equal(t, "test", ta.Schema)
+	require.Equal(t, "t", ta.Name)
+	require.Equal(t, []string{
+		"id bigint unsigned",
+		"name varchar(64)",
+		"code char(3)",
+		"data varbinary(16)",
+		"big char(100)",
+		"price decimal(10,2)",
+		"flags bit(10)",
+		"created datetime(3)",
+		"body text",
+		"state enum('a','b''c')",
+		"doc json",
+		"pos point",
+	}, trackedColumns(ta))
+
+	collations := make([]string, len(ta.Columns))
+	for i, col := range ta.Columns {
+		collations[i] = col.Collation
+	}
+	require.Equal(t, []string{
+		"", "utf8mb4_general_ci", "latin1_swedish_ci", "", "utf8mb4_general_ci", "", "", "", "utf8mb4_general_ci", "utf8mb4_general_ci", "", "",
+	}, collations)
+
+	require.Equal(t, []int{0}, ta.UnsignedColumns)
+	require.Equal(t, schema.TYPE_BINARY, ta.Columns[3].Type)
+	require.Equal(t, uint(100), ta.Columns[4].FixedSize)
+	require.Equal(t, schema.TYPE_ENUM, ta.Columns[9].Type)
+	require.Equal(t, schema.TYPE_POINT, ta.Columns[11].Type)
+
+	require.Equal(t, []int{2, 0}, ta.PKColumns)
+	require.Len(t, ta.Indexes, 1)
+	require.Equal(t, "PRIMARY", ta.Indexes[0].Name)
+	require.Equal(t, []string{"code", "id"}, ta.Indexes[0].Columns)
+
+	e := newTestTableMapEvent()
+	e.ColumnName = nil
+	_, err = NewTableFromTableMap(e)
+	require.ErrorContains(t, err, "binlog_row_metadata=FULL is required")
+}
+
+func TestHandleEventTableMapSchema(t *testing.T) {
+	h := &testSchemaEventHandler{}
+	c := &Canal{
+		cfg:          &Config{Logger: slog.Default(), TableMapSchema: true},
+		master:       &masterInfo{logger: slog.Default()},
+		eventHandler: h,
+		tables:       make(map[string]*schema.Table),
+		tableMaps:    make(map[string]tableMapVersion),
+	}
+
+	insert := func(e *replication.TableMapEvent) {
+		require.NoError(t, c.handleEvent(&replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+			Event:  &replication.RowsEvent{Table: e},
+		}))
+	}
+
+	e := &replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("a"),
+		ColumnCount: 1,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG},
+		ColumnMeta:  []uint16{0},
+		ColumnName:  byteSlices("id"),
+	}
+	insert(e)
+	t1, err := c.GetTable("test", "a")
+	require.NoError(t, err)
+
+	// the table is cached for the rows events of the same table map event, and for the table map
+	// events of the next transactions with the same table ID and metadata
+	insert(e)
+	next := *e
+	next.ColumnName = byteSlices("id")
+	insert(&next)
+	t2, err := c.GetTable("test", "a")
+	require.NoError(t, err)
+	require.Same(t, t1, t2)
+
+	// and rebuilt for another table ID
+	altered := next
+	altered.TableID = 2
+	insert(&altered)
+	t3, err := c.GetTable("test", "a")
+	require.NoError(t, err)
+	require.NotSame(t, t1, t3)
+
+	// or other metadata, e.g, after the table is altered
+	insert(&replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("a"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_DOUBLE},
+		ColumnMeta:  []uint16{0, 8},
+		ColumnName:  byteSlices("id", "score"),
+	})
+	require.Equal(t, [][]string{{"id int"}, {"id int"}, {"id int"}, {"id int"}, {"id int", "score double"}}, h.columns)
+}
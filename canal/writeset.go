@@ -0,0 +1,295 @@
+package canal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// WriteSet is the set of the hashed primary key and unique key values written by a transaction.
+// Two transactions without common keys don't conflict, so they can be applied in parallel.
+//
+// The string values of a case-insensitive collation are compared in lower case with the trailing
+// spaces removed, other collation rules like accent insensitivity are not considered. The foreign
+// keys are not considered either.
+type WriteSet struct {
+	keys map[uint64]struct{}
+	// the keys are unknown, e.g, the table has no unique key, so it conflicts with any write-set
+	unknown bool
+}
+
+// NewWriteSet creates an empty WriteSet.
+func NewWriteSet() *WriteSet {
+	return &WriteSet{keys: make(map[uint64]struct{})}
+}
+
+// AddRowsEvent adds the keys of all the rows of the event, including the before images of the
+// updated rows. The rows decoded lazily with Config.LazyRowsEvent are decoded one by one.
+func (s *WriteSet) AddRowsEvent(e *RowsEvent) error {
+	indexes := uniqueIndexes(e.Table)
+	if len(indexes) == 0 {
+		s.unknown = true
+		return nil
+	}
+
+	return errors.Trace(e.ForEachRow(func(row []interface{}) error {
+		if len(row) != len(e.Table.Columns) {
+			// the table schema doesn't match the row
+			s.unknown = true
+			return nil
+		}
+		for _, index := range indexes {
+			if key, ok := hashIndexKey(e.Table, index, row); ok {
+				s.keys[key] = struct{}{}
+			}
+		}
+		return nil
+	}))
+}
+
+// SetUnknown marks the keys unknown, the write-set conflicts with any write-set then. It's used
+// for the transactions whose keys can't be computed, like DDL and statement-based changes.
+func (s *WriteSet) SetUnknown() {
+	s.unknown = true
+}
+
+// Unknown returns whether the keys are unknown.
+func (s *WriteSet) Unknown() bool {
+	return s.unknown
+}
+
+// Keys returns the hashed keys.
+func (s *WriteSet) Keys() []uint64 {
+	keys := make([]uint64, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Len returns the number of the keys.
+func (s *WriteSet) Len() int {
+	return len(s.keys)
+}
+
+// Conflicts returns whether the two write-sets have common keys.
+func (s *WriteSet) Conflicts(o *WriteSet) bool {
+	if s.unknown || o.unknown {
+		return true
+	}
+
+	a, b := s.keys, o.keys
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	for k := range a {
+		if _, ok := b[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type uniqueIndex struct {
+	name    string
+	columns []int
+}
+
+// uniqueIndexes returns the primary key and the unique keys of the table.
+func uniqueIndexes(table *schema.Table) []uniqueIndex {
+	var indexes []uniqueIndex
+	for _, index := range table.Indexes {
+		if index.NoneUnique != 0 || len(index.Columns) == 0 {
+			continue
+		}
+		columns := make([]int, 0, len(index.Columns))
+		for _, name := range index.Columns {
+			i := table.FindColumn(name)
+			if i < 0 {
+				// e.g, a functional key part
+				columns = nil
+				break
+			}
+			columns = append(columns, i)
+		}
+		if columns != nil {
+			indexes = append(indexes, uniqueIndex{name: index.Name, columns: columns})
+		}
+	}
+	if len(indexes) == 0 && len(table.PKColumns) > 0 {
+		indexes = append(indexes, uniqueIndex{name: "PRIMARY", columns: table.PKColumns})
+	}
+	return indexes
+}
+
+// hashIndexKey hashes the index values of the row, it returns false if any value is NULL, the NULL
+// values never conflict in a unique key.
+func hashIndexKey(table *schema.Table, index uniqueIndex, row []interface{}) (uint64, bool) {
+	h := fnv.New64a()
+	writeString := func(s string) {
+		var n [binary.MaxVarintLen64]byte
+		_, _ = h.Write(n[:binary.PutUvarint(n[:], uint64(len(s)))])
+		_, _ = h.Write([]byte(s))
+	}
+
+	writeString(table.Schema)
+	writeString(table.Name)
+	writeString(index.name)
+	for _, i := range index.columns {
+		v := row[i]
+		if v == nil {
+			return 0, false
+		}
+		writeString(keyValueString(&table.Columns[i], v))
+	}
+	return h.Sum64(), true
+}
+
+func keyValueString(column *schema.TableColumn, v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if strings.HasSuffix(column.Collation, "_ci") {
+			return strings.ToLower(strings.TrimRight(v, " "))
+		}
+		return v
+	case []byte:
+		if strings.HasSuffix(column.Collation, "_ci") {
+			return strings.ToLower(strings.TrimRight(string(v), " "))
+		}
+		return string(v)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case decimal.Decimal:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteSetTracker is a replication.DependencyTracker based on the write-sets of the transactions, a
+// transaction depends on the last transaction writing any of its keys. It allows applying the binlog
+// in parallel even if the binlog has no logical clock, e.g, MariaDB or MySQL before 5.7.
+//
+// A transaction depends on all the previous transactions if its write-set is unknown, e.g, it has a
+// DDL or a table without unique key. The tables are from Canal.GetTable, so they may be newer than
+// the binlog, the rows of the excluded tables are ignored.
+type WriteSetTracker struct {
+	c *Canal
+
+	// the number of the last transaction writing the key
+	history    map[uint64]int64
+	maxHistory int
+	// all the transactions depend on the transactions up to it
+	barrier int64
+}
+
+// NewWriteSetTracker creates a WriteSetTracker, the history of the keys is cleared when it has more
+// than maxHistory keys, 0 means 25000 like binlog_transaction_dependency_history_size of MySQL.
+func (c *Canal) NewWriteSetTracker(maxHistory int) *WriteSetTracker {
+	if maxHistory <= 0 {
+		maxHistory = 25000
+	}
+	return &WriteSetTracker{
+		c:          c,
+		history:    make(map[uint64]int64),
+		maxHistory: maxHistory,
+	}
+}
+
+func (t *WriteSetTracker) Track(tx *replication.Transaction, seq int64) (int64, error) {
+	ws, err := t.c.TransactionWriteSet(tx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	if ws.unknown {
+		t.barrier = seq
+		t.history = make(map[uint64]int64)
+		return seq - 1, nil
+	}
+
+	dep := t.barrier
+	for k := range ws.keys {
+		if last, ok := t.history[k]; ok && last > dep {
+			dep = last
+		}
+	}
+
+	for k := range ws.keys {
+		t.history[k] = seq
+	}
+	if len(t.history) > t.maxHistory {
+		// the transaction is the new barrier instead of its keys
+		t.barrier = seq
+		t.history = make(map[uint64]int64)
+	}
+	return dep, nil
+}
+
+// TransactionWriteSet returns the write-set of the transaction from BinlogStreamer.GetTransaction.
+// The write-set is unknown if the transaction has any query other than BEGIN, COMMIT and XA, which
+// are DDL or statement-based changes.
+func (c *Canal) TransactionWriteSet(tx *replication.Transaction) (*WriteSet, error) {
+	ws := NewWriteSet()
+	err := tx.ForEachEvent(func(e *replication.BinlogEvent) error {
+		switch ev := e.Event.(type) {
+		case *replication.QueryEvent:
+			q := strings.ToUpper(strings.TrimSpace(string(ev.Query)))
+			if q != "BEGIN" && q != "COMMIT" && q != "ROLLBACK" && !strings.HasPrefix(q, "XA ") {
+				ws.SetUnknown()
+			}
+		case *replication.RowsEvent:
+			table, err := c.GetTable(string(ev.Table.Schema), string(ev.Table.Table))
+			if err != nil {
+				switch errors.Cause(err) {
+				case ErrExcludedTable:
+					return nil
+				case schema.ErrTableNotExist, schema.ErrMissingTableMeta:
+					ws.SetUnknown()
+					return nil
+				}
+				return errors.Trace(err)
+			}
+			if err := ws.AddRowsEvent(&RowsEvent{Table: table, raw: ev}); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	})
+	return ws, errors.Trace(err)
+}
+
+var _ replication.DependencyTracker = &WriteSetTracker{}
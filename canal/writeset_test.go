@@ -0,0 +1,191 @@
+package canal
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func newTestWriteSetTable(name string) *schema.Table {
+	t := &schema.Table{Schema: "test", Name: name}
+	t.AddColumn("id", "int", "", "")
+	t.AddColumn("email", "varchar(100)", "utf8mb4_general_ci", "")
+	t.AddColumn("name", "varchar(100)", "utf8mb4_bin", "")
+
+	pk := t.AddIndex("PRIMARY")
+	pk.AddColumn("id", 0)
+	uk := t.AddIndex("email")
+	uk.AddColumn("email", 0)
+	k := t.AddIndex("name")
+	k.AddColumn("name", 0)
+	k.NoneUnique = 1
+	t.PKColumns = []int{0}
+	return t
+}
+
+func newTestWriteSet(t *testing.T, table *schema.Table, rows ...[]interface{}) *WriteSet {
+	ws := NewWriteSet()
+	require.NoError(t, ws.AddRowsEvent(&RowsEvent{Table: table, Action: InsertAction, Rows: rows}))
+	return ws
+}
+
+// newTestLazyRowsEvent writes the rows event of the table map event and parses it lazily.
+func newTestLazyRowsEvent(t *testing.T, eventType replication.EventType, tableMap *replication.TableMapEvent, rows ...[]interface{}) *replication.RowsEvent {
+	var buf bytes.Buffer
+	w, err := replication.NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	for _, e := range []struct {
+		eventType replication.EventType
+		event     replication.Event
+	}{
+		{replication.FORMAT_DESCRIPTION_EVENT, replication.NewFormatDescriptionEvent("8.0.36-log", replication.BINLOG_CHECKSUM_ALG_CRC32)},
+		{replication.TABLE_MAP_EVENT, tableMap},
+		{eventType, replication.NewRowsEvent(eventType, tableMap, rows)},
+	} {
+		_, err = w.WriteEvent(replication.EventHeader{EventType: e.eventType, ServerID: 1}, e.event)
+		require.NoError(t, err)
+	}
+
+	p := replication.NewBinlogParser()
+	p.SetLazyRowsEvent(true)
+	var rowsEvent *replication.RowsEvent
+	require.NoError(t, p.ParseReader(bytes.NewReader(buf.Bytes()[4:]), func(e *replication.BinlogEvent) error {
+		if ev, ok := e.Event.(*replication.RowsEvent); ok {
+			rowsEvent = ev
+		}
+		return nil
+	}))
+	require.NotNil(t, rowsEvent)
+	require.Nil(t, rowsEvent.Rows)
+	return rowsEvent
+}
+
+func TestWriteSet(t *testing.T) {
+	t1 := newTestWriteSetTable("t1")
+	t2 := newTestWriteSetTable("t2")
+
+	ws := newTestWriteSet(t, t1, []interface{}{int32(1), "a@example.com", "a"}, []interface{}{int32(2), nil, "b"})
+	// the PK of both rows and the email of the first row
+	require.Equal(t, 3, ws.Len())
+	require.False(t, ws.Unknown())
+
+	for _, tt := range []struct {
+		ws        *WriteSet
+		conflicts bool
+	}{
+		// the same PK
+		{newTestWriteSet(t, t1, []interface{}{int32(2), "c@example.com", "c"}), true},
+		// the same email in case-insensitive collation
+		{newTestWriteSet(t, t1, []interface{}{int32(3), "A@Example.com ", "c"}), true},
+		// NULL values don't conflict
+		{newTestWriteSet(t, t1, []interface{}{int32(3), nil, "c"}), false},
+		// the same name isn't unique
+		{newTestWriteSet(t, t1, []interface{}{int32(3), "c@example.com", "a"}), false},
+		// the same PK in another table
+		{newTestWriteSet(t, t2, []interface{}{int32(1), "a@example.com", "a"}), false},
+		// the same PK with another integer type
+		{newTestWriteSet(t, t1, []interface{}{int64(1), "c@example.com", "c"}), true},
+	} {
+		require.Equal(t, tt.conflicts, ws.Conflicts(tt.ws))
+		require.Equal(t, tt.conflicts, tt.ws.Conflicts(ws))
+	}
+
+	// the table without unique key
+	t3 := &schema.Table{Schema: "test", Name: "t3"}
+	t3.AddColumn("id", "int", "", "")
+	unknown := newTestWriteSet(t, t3, []interface{}{int32(1)})
+	require.True(t, unknown.Unknown())
+	require.True(t, unknown.Conflicts(NewWriteSet()))
+	require.True(t, NewWriteSet().Conflicts(unknown))
+
+	// the rows decoded lazily
+	tableMap := &replication.TableMapEvent{
+		TableID:     1,
+		Schema:      []byte("test"),
+		Table:       []byte("t1"),
+		ColumnCount: 3,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{0, 400, 400},
+		NullBitmap:  []byte{0x06},
+	}
+	lazy := newTestLazyRowsEvent(t, replication.WRITE_ROWS_EVENTv2, tableMap,
+		[]interface{}{int32(1), "a@example.com", "a"}, []interface{}{int32(2), nil, "b"})
+	lazyWS := NewWriteSet()
+	require.NoError(t, lazyWS.AddRowsEvent(&RowsEvent{Table: t1, Action: InsertAction, raw: lazy}))
+	require.ElementsMatch(t, ws.Keys(), lazyWS.Keys())
+
+	// the binlog event decoded eagerly
+	eager := replication.NewRowsEvent(replication.WRITE_ROWS_EVENTv2, tableMap,
+		[][]interface{}{{int32(1), "a@example.com", "a"}, {int32(2), nil, "b"}})
+	lazyWS = NewWriteSet()
+	require.NoError(t, lazyWS.AddRowsEvent(&RowsEvent{Table: t1, raw: eager}))
+	require.ElementsMatch(t, ws.Keys(), lazyWS.Keys())
+}
+
+func newTestWriteSetTransaction(t *testing.T, s *replication.BinlogStreamer, table string, ids ...int32) *replication.Transaction {
+	tableMap := &replication.TableMapEvent{TableID: 1, Schema: []byte("test"), Table: []byte(table)}
+	var rows [][]interface{}
+	for _, id := range ids {
+		rows = append(rows, []interface{}{id, nil, "x"})
+	}
+	for _, e := range []*replication.BinlogEvent{
+		{Header: &replication.EventHeader{EventType: replication.QUERY_EVENT}, Event: &replication.QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &replication.EventHeader{EventType: replication.TABLE_MAP_EVENT}, Event: tableMap},
+		{Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2}, Event: &replication.RowsEvent{Table: tableMap, Rows: rows}},
+		{Header: &replication.EventHeader{EventType: replication.XID_EVENT}, Event: &replication.XIDEvent{}},
+	} {
+		require.NoError(t, s.AddEventToStreamer(e))
+	}
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	return tx
+}
+
+func TestWriteSetTracker(t *testing.T) {
+	c := &Canal{
+		cfg:               &Config{Logger: slog.Default()},
+		tables:            make(map[string]*schema.Table),
+		tableMatchCache:   make(map[string]bool),
+		excludeTableRegex: []*regexp.Regexp{regexp.MustCompile(`test\.excluded`)},
+	}
+	c.SetTableCache([]byte("test"), []byte("t1"), newTestWriteSetTable("t1"))
+	c.SetTableCache([]byte("test"), []byte("t2"), newTestWriteSetTable("t2"))
+
+	s := replication.NewBinlogStreamer()
+	tracker := c.NewWriteSetTracker(5)
+	track := func(tx *replication.Transaction, seq int64) int64 {
+		dep, err := tracker.Track(tx, seq)
+		require.NoError(t, err)
+		return dep
+	}
+
+	require.Equal(t, int64(0), track(newTestWriteSetTransaction(t, s, "t1", 1, 2), 1))
+	require.Equal(t, int64(0), track(newTestWriteSetTransaction(t, s, "t1", 3), 2))
+	require.Equal(t, int64(0), track(newTestWriteSetTransaction(t, s, "t2", 1), 3))
+	require.Equal(t, int64(1), track(newTestWriteSetTransaction(t, s, "t1", 2), 4))
+	require.Equal(t, int64(4), track(newTestWriteSetTransaction(t, s, "t1", 2, 3), 5))
+	require.Equal(t, int64(0), track(newTestWriteSetTransaction(t, s, "excluded", 1), 6))
+
+	// DDL
+	require.NoError(t, s.AddEventToStreamer(&replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.QUERY_EVENT},
+		Event:  &replication.QueryEvent{Query: []byte("ALTER TABLE t1 ADD COLUMN c int")},
+	}))
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(6), track(tx, 7))
+	require.Equal(t, int64(7), track(newTestWriteSetTransaction(t, s, "t1", 4), 8))
+
+	// the history is cleared when it's full
+	require.Equal(t, int64(7), track(newTestWriteSetTransaction(t, s, "t1", 5, 6, 7, 8, 9), 9))
+	require.Equal(t, int64(9), track(newTestWriteSetTransaction(t, s, "t1", 10), 10))
+}
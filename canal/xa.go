@@ -0,0 +1,80 @@
+package canal
+
+import (
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// The action name for XA transactions.
+const (
+	XAPrepareAction  = "prepare"
+	XACommitAction   = "commit"
+	XARollbackAction = "rollback"
+)
+
+// XAEvent is the event for XA transactions.
+//
+// The rows of an XA transaction are passed to OnRow before it's prepared, then it's committed or
+// rolled back later by another binlog transaction with the same XID, so the rows shouldn't be
+// applied until XACommitAction. XA COMMIT ... ONE PHASE is an XACommitAction with OnePhase.
+type XAEvent struct {
+	Action string
+	// XID is written like X'6162',X'',1
+	XID      string
+	OnePhase bool
+	// Header can be used to inspect the event
+	Header *replication.EventHeader
+}
+
+// handleXA calls OnXA if the event handler implements XAEventHandler.
+func (c *Canal) handleXA(header *replication.EventHeader, pos mysql.Position, e *XAEvent) error {
+	h, ok := c.eventHandler.(XAEventHandler)
+	if !ok {
+		return nil
+	}
+	return h.OnXA(header, pos, e)
+}
+
+func newXAPrepareEvent(e *replication.XAPrepareEvent, header *replication.EventHeader) *XAEvent {
+	action := XAPrepareAction
+	if e.OnePhase {
+		action = XACommitAction
+	}
+	return &XAEvent{Action: action, XID: e.XID(), OnePhase: e.OnePhase, Header: header}
+}
+
+// parseXAQuery parses the XA statement of the query event. It returns nil for XA START and XA END,
+// which are inside the XA transaction, and false if the query isn't an XA statement.
+func parseXAQuery(query []byte, header *replication.EventHeader) (*XAEvent, bool) {
+	q := strings.TrimSpace(string(query))
+	if len(q) < 3 || !strings.EqualFold(q[:3], "XA ") {
+		return nil, false
+	}
+
+	verb, xid, _ := strings.Cut(strings.TrimSpace(q[3:]), " ")
+	xid = strings.TrimSpace(xid)
+	switch strings.ToUpper(verb) {
+	case "COMMIT":
+		onePhase := false
+		if upper := strings.ToUpper(xid); strings.HasSuffix(upper, " ONE PHASE") {
+			onePhase = true
+			xid = strings.TrimSpace(xid[:len(xid)-len(" ONE PHASE")])
+		}
+		return &XAEvent{Action: XACommitAction, XID: xid, OnePhase: onePhase, Header: header}, true
+	case "ROLLBACK":
+		return &XAEvent{Action: XARollbackAction, XID: xid, Header: header}, true
+	case "PREPARE":
+		// MySQL writes XA_PREPARE_LOG_EVENT instead
+		return &XAEvent{Action: XAPrepareAction, XID: xid, Header: header}, true
+	default:
+		// XA START, XA BEGIN and XA END
+		return nil, true
+	}
+}
+
+// String implements fmt.Stringer interface.
+func (e *XAEvent) String() string {
+	return "XA " + e.Action + " " + e.XID
+}
@@ -2,14 +2,30 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 )
 
 var (
 	name   = flag.String("name", "", "binlog file name")
 	offset = flag.Int64("offset", 0, "parse start offset")
+
+	sql       = flag.Bool("sql", false, "print the SQL of the row changes and DDL instead of the events")
+	flashback = flag.Bool("flashback", false, "print the SQL undoing the row changes, binlog_row_image=FULL is required")
+
+	startDatetime = flag.String("start-datetime", "", "only the events at or after the local datetime, like 2006-01-02 15:04:05, for -sql and -flashback")
+	stopDatetime  = flag.String("stop-datetime", "", "only the events before the local datetime, for -sql and -flashback")
+	flavor        = flag.String("flavor", mysql.MySQLFlavor, "flavor of -gtid-set, mysql or mariadb")
+	gtidSet       = flag.String("gtid-set", "", "only the transactions in the GTID set, for -sql and -flashback")
+
+	keyFile             = flag.String("key-file", "", "key file of the MariaDB encrypted binlog, like file_key_management_filename")
+	keyFilePassword     = flag.String("key-file-password", "", "password of the encrypted key file, like file_key_management_filekey")
+	encryptionAlgorithm = flag.String("encryption-algorithm", "aes_cbc", "encryption algorithm of the MariaDB encrypted binlog, aes_cbc or aes_ctr")
 )
 
 func main() {
@@ -17,6 +33,20 @@ func main() {
 
 	p := replication.NewBinlogParser()
 
+	if *keyFile != "" {
+		if err := setEncryption(p); err != nil {
+			println(err.Error())
+			return
+		}
+	}
+
+	if *sql || *flashback {
+		if err := parseSQL(p); err != nil {
+			println(err.Error())
+		}
+		return
+	}
+
 	f := func(e *replication.BinlogEvent) error {
 		e.Dump(os.Stdout)
 		return nil
@@ -27,3 +57,61 @@ func main() {
 		println(err.Error())
 	}
 }
+
+func setEncryption(p *replication.BinlogParser) error {
+	keys, err := replication.NewFileKeyProvider(*keyFile, *keyFilePassword)
+	if err != nil {
+		return err
+	}
+
+	var algorithm replication.EncryptionAlgorithm
+	switch strings.ToLower(*encryptionAlgorithm) {
+	case "aes_cbc":
+		algorithm = replication.EncryptionAESCBC
+	case "aes_ctr":
+		algorithm = replication.EncryptionAESCTR
+	default:
+		return fmt.Errorf("invalid encryption algorithm %s", *encryptionAlgorithm)
+	}
+
+	p.SetEncryption(keys, algorithm)
+	return nil
+}
+
+func parseSQL(p *replication.BinlogParser) error {
+	g := &replication.SQLGenerator{Flashback: *flashback}
+
+	var err error
+	if *startDatetime != "" {
+		if g.StartTime, err = time.ParseInLocation(time.DateTime, *startDatetime, time.Local); err != nil {
+			return err
+		}
+	}
+	if *stopDatetime != "" {
+		if g.StopTime, err = time.ParseInLocation(time.DateTime, *stopDatetime, time.Local); err != nil {
+			return err
+		}
+	}
+	if *gtidSet != "" {
+		if g.GTIDSet, err = mysql.ParseGTIDSet(*flavor, *gtidSet); err != nil {
+			return err
+		}
+	}
+
+	err = p.ParseFile(*name, *offset, func(e *replication.BinlogEvent) error {
+		if err := g.HandleEvent(e); err != nil {
+			return err
+		}
+		if !g.Flashback {
+			_, err := g.WriteTo(os.Stdout)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = g.WriteTo(os.Stdout)
+	return err
+}
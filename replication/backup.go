@@ -178,6 +178,7 @@ func processWithHandler(b *BinlogSyncer, s *BinlogStreamer, backupHandler *Backu
 		case err := <-s.ech:
 			return errors.Trace(err)
 		case e := <-s.ch:
+			s.release(e)
 			err := backupHandler.HandleEvent(e)
 			if err != nil {
 				return errors.Trace(err)
@@ -210,6 +211,9 @@ func (h *BackupEventHandler) HandleEvent(e *BinlogEvent) error {
 	offset := e.Header.LogPos
 
 	switch e.Header.EventType {
+	case HEARTBEAT_EVENT, HEARTBEAT_LOG_EVENT_V2:
+		// heartbeats are sent by the server when idle, they are not in the binlog files
+		return nil
 	case ROTATE_EVENT:
 		rotateEvent := e.Event.(*RotateEvent)
 		h.filename = string(rotateEvent.NextLogName)
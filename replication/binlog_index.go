@@ -0,0 +1,218 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// BinlogIndexFileSuffix is appended to the name of a binlog file for the file of its index.
+const BinlogIndexFileSuffix = ".txindex"
+
+// BinlogIndexEntry is a transaction in the index of a binlog file.
+type BinlogIndexEntry struct {
+	// Pos is the position of the first event of the transaction, e.g, the GTID event, which can be
+	// passed to BinlogParser.ParseFile or BinlogSyncer.StartSync to read from the transaction.
+	Pos uint32 `json:"pos"`
+	// Timestamp is the timestamp of the first event.
+	Timestamp uint32 `json:"timestamp"`
+	// GTID is the GTID of the transaction, e.g, "3e11fa47-71ca-11e1-9e33-c80aa9429562:23" or
+	// "0-1-100", it's empty for anonymous transactions.
+	GTID string `json:"gtid,omitempty"`
+}
+
+// BinlogFileIndex is the index of the transactions in a binlog file.
+type BinlogFileIndex struct {
+	// Name is the base name of the binlog file.
+	Name string `json:"name"`
+	// Size is the size of the file indexed, the index is out of date if the file is larger.
+	Size int64 `json:"size"`
+	// Flavor is the flavor of the GTIDs, it's empty if the file has no GTIDs.
+	Flavor string `json:"flavor,omitempty"`
+	// PreviousGTIDs is the GTID set before the file, of the PreviousGTIDsEvent or MariadbGTIDListEvent.
+	PreviousGTIDs string `json:"previous_gtids,omitempty"`
+	// Transactions are the transactions in the file in order.
+	Transactions []BinlogIndexEntry `json:"transactions"`
+}
+
+// BuildBinlogFileIndex reads the binlog file and builds its index. The rows of the rows events
+// are not decoded.
+func BuildBinlogFileIndex(name string) (*BinlogFileIndex, error) {
+	idx := &BinlogFileIndex{Name: filepath.Base(name), Transactions: []BinlogIndexEntry{}}
+
+	p := NewBinlogParser()
+	p.SetRowsEventDecodeFunc(func(*RowsEvent, []byte) error { return nil })
+
+	var boundary transactionBoundary
+	inTransaction := false
+	next := uint32(len(BinLogFileHeader))
+	err := p.ParseFile(name, 0, func(e *BinlogEvent) error {
+		start := next
+		next = p.position
+
+		switch ev := e.Event.(type) {
+		case *PreviousGTIDsEvent:
+			idx.Flavor = mysql.MySQLFlavor
+			idx.PreviousGTIDs = ev.GTIDSets
+			return nil
+		case *MariadbGTIDListEvent:
+			gtids, err := mariadbGTIDListSet(ev)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			idx.Flavor = mysql.MariaDBFlavor
+			idx.PreviousGTIDs = gtids.String()
+			return nil
+		case *FormatDescriptionEvent, *RotateEvent, *HeartbeatEvent, *MariadbBinlogCheckPointEvent,
+			*MariadbStartEncryptionEvent:
+			return nil
+		case *GenericEvent:
+			if !inTransaction {
+				// e.g, STOP_EVENT
+				return nil
+			}
+		}
+
+		gtid, isGTIDEvent, err := transactionGTID(e.Event)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if isGTIDEvent || !inTransaction {
+			inTransaction = true
+			boundary.begin(e.Event)
+			entry := BinlogIndexEntry{Pos: start, Timestamp: e.Header.Timestamp}
+			if gtid != nil {
+				entry.GTID = gtid.String()
+			}
+			idx.Transactions = append(idx.Transactions, entry)
+			if isGTIDEvent {
+				return nil
+			}
+		}
+		if boundary.end(e.Event) {
+			inTransaction = false
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "index %s", name)
+	}
+
+	idx.Size = int64(next)
+	return idx, nil
+}
+
+// LoadBinlogFileIndex loads the index saved by BinlogFileIndex.Save.
+func LoadBinlogFileIndex(path string) (*BinlogFileIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	idx := new(BinlogFileIndex)
+	if err = json.Unmarshal(data, idx); err != nil {
+		return nil, errors.Annotatef(err, "invalid binlog index file %s", path)
+	}
+	return idx, nil
+}
+
+// Save saves the index into the file, which is replaced atomically.
+func (idx *BinlogFileIndex) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(utils.WriteFileAtomic(path, data))
+}
+
+// IndexBinlogFile returns the index of the binlog file, which is loaded from the index file next
+// to it, the name with BinlogIndexFileSuffix. If there is no index file or it's out of date, e.g,
+// the binlog file is still written, the index is built and saved again.
+func IndexBinlogFile(name string) (*BinlogFileIndex, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	path := name + BinlogIndexFileSuffix
+	idx, err := LoadBinlogFileIndex(path)
+	if err == nil && idx.Name == filepath.Base(name) && idx.Size == info.Size() {
+		return idx, nil
+	}
+
+	if idx, err = BuildBinlogFileIndex(name); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = idx.Save(path); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return idx, nil
+}
+
+// BinlogIndex looks up the transactions in the binlog files by their indexes, so the binlog files
+// can be read from the transaction found without scanning them.
+type BinlogIndex struct {
+	// Files are the indexes of the binlog files in order.
+	Files []*BinlogFileIndex
+}
+
+// NewBinlogIndex returns the index of the binlog files in order, by IndexBinlogFile.
+func NewBinlogIndex(files []string) (*BinlogIndex, error) {
+	x := &BinlogIndex{Files: make([]*BinlogFileIndex, 0, len(files))}
+	for _, name := range files {
+		idx, err := IndexBinlogFile(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		x.Files = append(x.Files, idx)
+	}
+	return x, nil
+}
+
+// SearchGTID returns the position of the transaction of the GTID, e.g,
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:23" or "0-1-100", the Name of the position is the base
+// name of the binlog file. It returns false if the transaction is not found.
+func (x *BinlogIndex) SearchGTID(gtid string) (mysql.Position, bool, error) {
+	// the GTIDs of the different forms are compared by the same form
+	normalized := make(map[string]string, 2)
+	for _, idx := range x.Files {
+		if idx.Flavor == "" {
+			continue
+		}
+		s, ok := normalized[idx.Flavor]
+		if !ok {
+			set, err := mysql.ParseGTIDSet(idx.Flavor, gtid)
+			if err != nil {
+				return mysql.Position{}, false, errors.Trace(err)
+			}
+			s = set.String()
+			normalized[idx.Flavor] = s
+		}
+
+		for _, entry := range idx.Transactions {
+			if entry.GTID == s {
+				return mysql.Position{Name: idx.Name, Pos: entry.Pos}, true, nil
+			}
+		}
+	}
+	return mysql.Position{}, false, nil
+}
+
+// SearchTime returns the position of the first transaction at or after t, like the
+// StartDatetime of ReadBounds, the Name of the position is the base name of the binlog file.
+// It returns false if there is no transaction at or after t.
+func (x *BinlogIndex) SearchTime(t time.Time) (mysql.Position, bool) {
+	for _, idx := range x.Files {
+		for _, entry := range idx.Transactions {
+			if int64(entry.Timestamp) >= t.Unix() {
+				return mysql.Position{Name: idx.Name, Pos: entry.Pos}, true
+			}
+		}
+	}
+	return mysql.Position{}, false
+}
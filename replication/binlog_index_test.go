@@ -0,0 +1,91 @@
+package replication
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestBinlogFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "mysql-bin.000001")
+	file2 := filepath.Join(dir, "mysql-bin.000002")
+	writeTestBoundsFile(t, file1, testBoundsStart, 1, 5)
+	writeTestBoundsFile(t, file2, testBoundsStart+55, 6, 10)
+
+	idx, err := BuildBinlogFileIndex(file2)
+	require.NoError(t, err)
+	require.Equal(t, "mysql-bin.000002", idx.Name)
+	require.Equal(t, mysql.MySQLFlavor, idx.Flavor)
+	require.Equal(t, testBoundsSID+":1-5", idx.PreviousGTIDs)
+	info, err := os.Stat(file2)
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), idx.Size)
+	require.Len(t, idx.Transactions, 5)
+
+	// the transactions start at the positions
+	for i, entry := range idx.Transactions {
+		gno := int64(i + 6)
+		require.Equal(t, fmt.Sprintf("%s:%d", testBoundsSID, gno), entry.GTID)
+		require.Equal(t, uint32(testBoundsStart+gno*10), entry.Timestamp)
+
+		p := NewBinlogParser()
+		var first *GTIDEvent
+		err = p.ParseFile(file2, int64(entry.Pos), func(e *BinlogEvent) error {
+			if ge, ok := e.Event.(*GTIDEvent); ok && first == nil {
+				first = ge
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, gno, first.GNO)
+	}
+
+	// the index is saved next to the binlog file, and loaded if it's up to date
+	x, err := NewBinlogIndex([]string{file1, file2})
+	require.NoError(t, err)
+	require.Equal(t, idx, x.Files[1])
+	saved, err := LoadBinlogFileIndex(file2 + BinlogIndexFileSuffix)
+	require.NoError(t, err)
+	require.Equal(t, idx, saved)
+
+	saved.Transactions = saved.Transactions[:1]
+	require.NoError(t, saved.Save(file2+BinlogIndexFileSuffix))
+	loaded, err := IndexBinlogFile(file2)
+	require.NoError(t, err)
+	require.Equal(t, saved, loaded)
+	saved.Size--
+	require.NoError(t, saved.Save(file2+BinlogIndexFileSuffix))
+	loaded, err = IndexBinlogFile(file2)
+	require.NoError(t, err)
+	require.Equal(t, idx, loaded)
+
+	pos, found, err := x.SearchGTID(testBoundsSID + ":3")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: x.Files[0].Transactions[2].Pos}, pos)
+	pos, found, err = x.SearchGTID(testBoundsSID + ":7")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: idx.Transactions[1].Pos}, pos)
+	_, found, err = x.SearchGTID(testBoundsSID + ":11")
+	require.NoError(t, err)
+	require.False(t, found)
+	_, _, err = x.SearchGTID("invalid")
+	require.Error(t, err)
+
+	pos, found = x.SearchTime(time.Unix(testBoundsStart+55, 0))
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: idx.Transactions[0].Pos}, pos)
+	pos, found = x.SearchTime(time.Unix(0, 0))
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: x.Files[0].Transactions[0].Pos}, pos)
+	_, found = x.SearchTime(time.Unix(testBoundsStart+101, 0))
+	require.False(t, found)
+}
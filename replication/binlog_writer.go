@@ -0,0 +1,91 @@
+package replication
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/pingcap/errors"
+)
+
+// BinlogWriter writes events into a binlog file. It writes the binlog file header
+// first, then every event with the right event size, log position and checksum.
+//
+// The first event written must be a FormatDescriptionEvent, its checksum algorithm
+// is used for all the following events.
+type BinlogWriter struct {
+	w   io.Writer
+	pos uint32
+
+	format *FormatDescriptionEvent
+}
+
+// NewBinlogWriter creates a BinlogWriter and writes the binlog file header to w.
+func NewBinlogWriter(w io.Writer) (*BinlogWriter, error) {
+	if _, err := w.Write(BinLogFileHeader); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &BinlogWriter{w: w, pos: uint32(len(BinLogFileHeader))}, nil
+}
+
+// Position returns the position of the next event to write.
+func (w *BinlogWriter) Position() uint32 {
+	return w.pos
+}
+
+// WriteEvent encodes and writes the event. EventSize and LogPos of the header are
+// filled by the writer, the other fields, especially EventType, must be set by the caller.
+func (w *BinlogWriter) WriteEvent(h EventHeader, e Event) (*BinlogEvent, error) {
+	encoder, ok := e.(EventEncoder)
+	if !ok {
+		return nil, errors.Errorf("event %T of %s can not be encoded", e, h.EventType)
+	}
+
+	withChecksum := false
+	if h.EventType == FORMAT_DESCRIPTION_EVENT {
+		format, ok := e.(*FormatDescriptionEvent)
+		if !ok {
+			return nil, errors.Errorf("invalid event %T for %s", e, h.EventType)
+		}
+		w.format = format
+		// the FORMAT_DESCRIPTION_EVENT always has a CRC32 checksum if it has the checksum algorithm
+		withChecksum = hasChecksumAlgorithm(format.ServerVersion)
+	} else {
+		if w.format == nil {
+			return nil, errors.New("the first event must be FORMAT_DESCRIPTION_EVENT")
+		}
+		withChecksum = w.format.ChecksumAlgorithm == BINLOG_CHECKSUM_ALG_CRC32
+	}
+
+	body, err := encoder.Encode()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	size := EventHeaderSize + len(body)
+	if withChecksum {
+		size += BinlogChecksumLength
+	}
+
+	h.EventSize = uint32(size)
+	h.LogPos = w.pos + h.EventSize
+
+	rawData := make([]byte, 0, size)
+	rawData = append(rawData, h.Encode()...)
+	rawData = append(rawData, body...)
+	if withChecksum {
+		rawData = binary.LittleEndian.AppendUint32(rawData, crc32.ChecksumIEEE(rawData))
+	}
+
+	n, err := w.w.Write(rawData)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if n != len(rawData) {
+		return nil, errors.Trace(io.ErrShortWrite)
+	}
+	w.pos = h.LogPos
+
+	return &BinlogEvent{RawData: rawData, Header: &h, Event: e}, nil
+}
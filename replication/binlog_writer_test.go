@@ -0,0 +1,258 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinlogWriterRoundTrip(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "mysql-bin.000001")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+
+	w, err := NewBinlogWriter(f)
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), w.Position())
+
+	sid := uuid.MustParse("3ccc1f06-4b5d-11ee-8b49-0242ac110002")
+	table := &TableMapEvent{
+		TableID:     110,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t1"),
+		ColumnCount: 15,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_TIMESTAMP2,
+			mysql.MYSQL_TYPE_TIME2, mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_YEAR,
+			mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_DOUBLE,
+			mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_VARCHAR,
+		},
+		ColumnMeta: []uint16{
+			0, 0, 1020,
+			10<<8 | 2, 6, 3,
+			2, 0, 0,
+			4, 2, 8,
+			uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 1<<8 | 4, 100,
+		},
+		NullBitmap:       []byte{0xfe, 0x7f},
+		SignednessBitmap: []byte{0x40, 0x00},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("big"), []byte("name"), []byte("price"), []byte("dt"),
+			[]byte("ts"), []byte("tm"), []byte("d"), []byte("y"), []byte("j"),
+			[]byte("b"), []byte("f"), []byte("e"), []byte("bits"), []byte("nullable"),
+		},
+		PrimaryKey:       []uint64{0},
+		PrimaryKeyPrefix: []uint64{0},
+	}
+
+	row := func(id int32, name string) []interface{} {
+		return []interface{}{
+			id, int64(-9000000000), name,
+			"-1234.56", "2024-01-02 03:04:05.123456", time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC),
+			"-01:02:03.45", "2024-02-29", 2024,
+			`{"a":[1,2.5,"x",null,true],"bb":{"c":-70000}}`, []byte{0x00, 0x01, 0xff}, 3.25,
+			int64(2), int64(0xabc), nil,
+		}
+	}
+
+	events := []struct {
+		header EventHeader
+		event  Event
+	}{
+		{EventHeader{Timestamp: 1700000000, EventType: FORMAT_DESCRIPTION_EVENT, ServerID: 1}, NewFormatDescriptionEvent("8.0.36-log", BINLOG_CHECKSUM_ALG_CRC32)},
+		{EventHeader{Timestamp: 1700000000, EventType: PREVIOUS_GTIDS_EVENT, ServerID: 1}, &PreviousGTIDsEvent{GTIDSets: sid.String() + ":1-5"}},
+		{EventHeader{Timestamp: 1700000001, EventType: GTID_EVENT, ServerID: 1}, &GTIDEvent{
+			CommitFlag:               1,
+			SID:                      sid[:],
+			GNO:                      6,
+			LastCommitted:            1,
+			SequenceNumber:           2,
+			ImmediateCommitTimestamp: 1700000001000002,
+			OriginalCommitTimestamp:  1700000001000001,
+			TransactionLength:        1024,
+			ImmediateServerVersion:   80036,
+			OriginalServerVersion:    80036,
+		}},
+		{EventHeader{Timestamp: 1700000001, EventType: QUERY_EVENT, ServerID: 1, Flags: 8}, &QueryEvent{
+			SlaveProxyID: 10,
+			StatusVars:   []byte{0x00, 0x00, 0x00, 0x00, 0x00},
+			Schema:       []byte("test"),
+			Query:        []byte("BEGIN"),
+		}},
+		{EventHeader{Timestamp: 1700000001, EventType: TABLE_MAP_EVENT, ServerID: 1}, table},
+		{EventHeader{Timestamp: 1700000001, EventType: WRITE_ROWS_EVENTv2, ServerID: 1}, NewRowsEvent(WRITE_ROWS_EVENTv2, table, [][]interface{}{row(1, "a"), row(2, "b")})},
+		{EventHeader{Timestamp: 1700000001, EventType: UPDATE_ROWS_EVENTv2, ServerID: 1}, NewRowsEvent(UPDATE_ROWS_EVENTv2, table, [][]interface{}{row(1, "a"), row(1, "c")})},
+		{EventHeader{Timestamp: 1700000001, EventType: DELETE_ROWS_EVENTv2, ServerID: 1}, NewRowsEvent(DELETE_ROWS_EVENTv2, table, [][]interface{}{row(2, "b")})},
+		{EventHeader{Timestamp: 1700000001, EventType: XID_EVENT, ServerID: 1}, &XIDEvent{XID: 42}},
+		{EventHeader{Timestamp: 1700000002, EventType: ROTATE_EVENT, ServerID: 1}, &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")}},
+	}
+
+	var written []*BinlogEvent
+	for _, e := range events {
+		ev, err := w.WriteEvent(e.header, e.event)
+		require.NoError(t, err)
+		written = append(written, ev)
+	}
+	require.NoError(t, f.Close())
+
+	st, err := os.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, int64(w.Position()), st.Size())
+
+	p := NewBinlogParser()
+	p.SetVerifyChecksum(true)
+	p.SetTimestampStringLocation(time.UTC)
+
+	var parsed []*BinlogEvent
+	err = p.ParseFile(name, 0, func(e *BinlogEvent) error {
+		parsed = append(parsed, e)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, parsed, len(events))
+
+	pos := uint32(4)
+	for i, ev := range parsed {
+		require.Equal(t, written[i].RawData, ev.RawData)
+		require.Equal(t, events[i].header.EventType, ev.Header.EventType)
+		require.Equal(t, pos+ev.Header.EventSize, ev.Header.LogPos)
+		pos = ev.Header.LogPos
+	}
+
+	fde := parsed[0].Event.(*FormatDescriptionEvent)
+	require.Equal(t, "8.0.36-log", fde.ServerVersion)
+	require.Equal(t, byte(BINLOG_CHECKSUM_ALG_CRC32), fde.ChecksumAlgorithm)
+
+	require.Equal(t, sid.String()+":1-5", parsed[1].Event.(*PreviousGTIDsEvent).GTIDSets)
+
+	gtid := parsed[2].Event.(*GTIDEvent)
+	require.Equal(t, events[2].event, gtid)
+
+	query := parsed[3].Event.(*QueryEvent)
+	require.Equal(t, "BEGIN", string(query.Query))
+	require.Equal(t, "test", string(query.Schema))
+
+	tableMap := parsed[4].Event.(*TableMapEvent)
+	require.Equal(t, table.ColumnType, tableMap.ColumnType)
+	require.Equal(t, table.ColumnMeta, tableMap.ColumnMeta)
+	require.Equal(t, table.NullBitmap, tableMap.NullBitmap)
+	require.Equal(t, table.ColumnName, tableMap.ColumnName)
+	require.Equal(t, table.PrimaryKey, tableMap.PrimaryKey)
+	require.Equal(t, map[int]bool{0: false, 1: true, 3: false, 11: false}, tableMap.UnsignedMap())
+
+	expected := func(id int32, name string) []interface{} {
+		r := row(id, name)
+		r[5] = "2024-01-02 03:04:05.123"
+		return r
+	}
+
+	rows := parsed[5].Event.(*RowsEvent)
+	require.Equal(t, EnumRowsEventTypeInsert, rows.Type())
+	require.Equal(t, [][]interface{}{expected(1, "a"), expected(2, "b")}, rows.Rows)
+
+	rows = parsed[6].Event.(*RowsEvent)
+	require.Equal(t, EnumRowsEventTypeUpdate, rows.Type())
+	require.Equal(t, [][]interface{}{expected(1, "a"), expected(1, "c")}, rows.Rows)
+
+	rows = parsed[7].Event.(*RowsEvent)
+	require.Equal(t, EnumRowsEventTypeDelete, rows.Type())
+	require.Equal(t, [][]interface{}{expected(2, "b")}, rows.Rows)
+
+	require.Equal(t, uint64(42), parsed[8].Event.(*XIDEvent).XID)
+
+	rotate := parsed[9].Event.(*RotateEvent)
+	require.Equal(t, uint64(4), rotate.Position)
+	require.Equal(t, "mysql-bin.000002", string(rotate.NextLogName))
+}
+
+func TestBinlogWriterNeedFormatDescriptionEvent(t *testing.T) {
+	w, err := NewBinlogWriter(&discardWriter{})
+	require.NoError(t, err)
+
+	_, err = w.WriteEvent(EventHeader{EventType: XID_EVENT}, &XIDEvent{XID: 1})
+	require.Error(t, err)
+}
+
+type discardWriter struct{}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func TestEncodeRowsValue(t *testing.T) {
+	e := &RowsEvent{}
+
+	testcases := []struct {
+		tp    byte
+		meta  uint16
+		value interface{}
+	}{
+		{mysql.MYSQL_TYPE_TINY, 0, int8(-128)},
+		{mysql.MYSQL_TYPE_SHORT, 0, int16(-2)},
+		{mysql.MYSQL_TYPE_INT24, 0, int32(-8388608)},
+		{mysql.MYSQL_TYPE_LONG, 0, int32(2147483647)},
+		{mysql.MYSQL_TYPE_LONGLONG, 0, int64(-1)},
+		{mysql.MYSQL_TYPE_FLOAT, 0, float32(1.5)},
+		{mysql.MYSQL_TYPE_NEWDECIMAL, 10<<8 | 4, "0.0000"},
+		{mysql.MYSQL_TYPE_NEWDECIMAL, 10<<8 | 4, "-0.0100"},
+		{mysql.MYSQL_TYPE_NEWDECIMAL, 30<<8 | 10, "12345678901234567890.0123456789"},
+		{mysql.MYSQL_TYPE_NEWDECIMAL, 30<<8 | 10, "-12345678901234567890.0123456789"},
+		{mysql.MYSQL_TYPE_NEWDECIMAL, 5<<8 | 0, "99999"},
+		{mysql.MYSQL_TYPE_DATETIME, 0, "2001-02-03 04:05:06"},
+		{mysql.MYSQL_TYPE_DATETIME2, 0, "0000-00-00 00:00:00"},
+		{mysql.MYSQL_TYPE_DATETIME2, 0, "2000-00-00 00:00:00"},
+		{mysql.MYSQL_TYPE_DATETIME2, 2, "9999-12-31 23:59:59.99"},
+		{mysql.MYSQL_TYPE_DATETIME2, 4, "1000-01-01 00:00:00.0001"},
+		{mysql.MYSQL_TYPE_TIME, 0, "838:59:59"},
+		{mysql.MYSQL_TYPE_TIME2, 0, "00:00:00"},
+		{mysql.MYSQL_TYPE_TIME2, 0, "-838:59:59"},
+		{mysql.MYSQL_TYPE_TIME2, 1, "-00:00:01.1"},
+		{mysql.MYSQL_TYPE_TIME2, 2, "-00:00:00.01"},
+		{mysql.MYSQL_TYPE_TIME2, 4, "-00:00:01.0001"},
+		{mysql.MYSQL_TYPE_TIME2, 4, "12:34:56.7890"},
+		{mysql.MYSQL_TYPE_TIME2, 6, "-12:34:56.000001"},
+		{mysql.MYSQL_TYPE_DATE, 0, "0000-00-00"},
+		{mysql.MYSQL_TYPE_YEAR, 0, 0},
+		{mysql.MYSQL_TYPE_SET, uint16(mysql.MYSQL_TYPE_SET)<<8 | 8, int64(-1)},
+		{mysql.MYSQL_TYPE_STRING, uint16(mysql.MYSQL_TYPE_SET)<<8 | 2, int64(0x101)},
+		{mysql.MYSQL_TYPE_STRING, 0xfe<<8 | 0x0f, "char"},
+		{mysql.MYSQL_TYPE_STRING, 0xee<<8 | 0xfc, "long char"},
+		{mysql.MYSQL_TYPE_BIT, 0<<8 | 1, int64(1)},
+		{mysql.MYSQL_TYPE_BIT, 8<<8 | 0, int64(-1)},
+		{mysql.MYSQL_TYPE_JSON, 4, `[]`},
+		{mysql.MYSQL_TYPE_JSON, 4, `"string"`},
+		{mysql.MYSQL_TYPE_JSON, 4, `{"k":18446744073709551615}`},
+	}
+
+	for _, tc := range testcases {
+		data, err := e.encodeValue(nil, tc.value, tc.tp, tc.meta)
+		require.NoError(t, err, "type %d value %v", tc.tp, tc.value)
+
+		v, n, err := e.decodeValue(data, tc.tp, tc.meta, false)
+		require.NoError(t, err, "type %d value %v", tc.tp, tc.value)
+		require.Equal(t, len(data), n, "type %d value %v", tc.tp, tc.value)
+		require.Equal(t, tc.value, v, "type %d value %v", tc.tp, tc.value)
+	}
+}
+
+func TestEncodeJsonBinaryLargeObject(t *testing.T) {
+	e := &RowsEvent{}
+
+	value := `{"k":"` + strings.Repeat("x", 70000) + `","n":[-1,65536,3.5]}`
+
+	data, err := encodeJsonBinary([]byte(value))
+	require.NoError(t, err)
+	require.Equal(t, JSONB_LARGE_OBJECT, data[0])
+
+	d, err := e.decodeJsonBinary(data)
+	require.NoError(t, err)
+	require.Equal(t, value, string(d))
+}
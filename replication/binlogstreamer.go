@@ -2,6 +2,7 @@ package replication
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -17,42 +18,61 @@ type BinlogStreamer struct {
 	ch  chan *BinlogEvent
 	ech chan error
 	err error
+
+	// the max total size of the events in ch, 0 means no limit
+	maxBytes int64
+	bytes    atomic.Int64
+	// notified when the events are taken from ch
+	released chan struct{}
+
+	txBuilder transactionBuilder
 }
 
 // GetEvent gets the binlog event one by one, it will block until Syncer receives any events from MySQL
 // or meets a sync error. You can pass a context (like Cancel or Timeout) to break the block.
+// After a stop bound of ReadBounds is reached, it returns the events before the bound and then
+// ErrStopBoundReached.
 func (s *BinlogStreamer) GetEvent(ctx context.Context) (*BinlogEvent, error) {
-	if s.err != nil {
+	if s.err == ErrStopBoundReached {
+		return nil, s.err
+	} else if s.err != nil {
 		return nil, ErrNeedSyncAgain
 	}
 
 	select {
 	case c := <-s.ch:
+		s.release(c)
 		return c, nil
-	case s.err = <-s.ech:
+	case err := <-s.ech:
+		if err == ErrStopBoundReached && len(s.ch) > 0 {
+			// the events before the bound are read first
+			select {
+			case s.ech <- err:
+			default:
+			}
+			c := <-s.ch
+			s.release(c)
+			return c, nil
+		}
+		s.err = err
 		return nil, s.err
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
-// GetEventWithStartTime gets the binlog event with starttime, if current binlog event timestamp smaller than specify starttime
-// return nil event
+// GetEventWithStartTime gets the first binlog event whose timestamp is not smaller than startTime,
+// the events before it are skipped.
 func (s *BinlogStreamer) GetEventWithStartTime(ctx context.Context, startTime time.Time) (*BinlogEvent, error) {
-	if s.err != nil {
-		return nil, ErrNeedSyncAgain
-	}
 	startUnix := startTime.Unix()
-	select {
-	case c := <-s.ch:
+	for {
+		c, err := s.GetEvent(ctx)
+		if err != nil {
+			return nil, err
+		}
 		if int64(c.Header.Timestamp) >= startUnix {
 			return c, nil
 		}
-		return nil, nil
-	case s.err = <-s.ech:
-		return nil, s.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
 	}
 }
 
@@ -62,10 +82,59 @@ func (s *BinlogStreamer) DumpEvents() []*BinlogEvent {
 	events := make([]*BinlogEvent, count)
 	for i := range events {
 		events[i] = <-s.ch
+		s.release(events[i])
 	}
 	return events
 }
 
+// SetMaxBytes limits the total size of the events waiting in the streamer, the syncer stops
+// reading the binlog until the events are taken by GetEvent. An event larger than the limit is
+// still added if the streamer is empty. 0 means no limit, it must be set before any event is added.
+func (s *BinlogStreamer) SetMaxBytes(n int64) {
+	s.maxBytes = n
+}
+
+// put adds the event to the streamer after there is room for it.
+func (s *BinlogStreamer) put(ctx context.Context, e *BinlogEvent) error {
+	if s.maxBytes > 0 {
+		size := int64(e.Header.EventSize)
+		for !s.hasRoom(size) {
+			select {
+			case <-s.released:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		s.bytes.Add(size)
+	}
+
+	select {
+	case s.ch <- e:
+		return nil
+	case <-ctx.Done():
+		s.release(e)
+		return ctx.Err()
+	}
+}
+
+// hasRoom returns whether an event of the size can be added without exceeding maxBytes.
+func (s *BinlogStreamer) hasRoom(size int64) bool {
+	n := s.bytes.Load()
+	return n == 0 || n+size <= s.maxBytes
+}
+
+// release is called after the event is taken from the streamer.
+func (s *BinlogStreamer) release(e *BinlogEvent) {
+	if s.maxBytes <= 0 {
+		return
+	}
+	s.bytes.Add(-int64(e.Header.EventSize))
+	select {
+	case s.released <- struct{}{}:
+	default:
+	}
+}
+
 func (s *BinlogStreamer) close() {
 	s.closeWithError(nil)
 }
@@ -94,17 +163,33 @@ func NewBinlogStreamerWithChanSize(chanSize int) *BinlogStreamer {
 
 	s.ch = make(chan *BinlogEvent, chanSize)
 	s.ech = make(chan error, 4)
+	s.released = make(chan struct{}, 1)
+	s.txBuilder.newParser = NewBinlogParser
 
 	return s
 }
 
 // AddEventToStreamer adds a binlog event to the streamer. You can use it when you want to add an event to the streamer manually.
 // can be used in replication handlers
+// Like the events of the syncer, it waits until there is room for the event if the size of the
+// events is limited by SetMaxBytes, or returns the error added by AddErrorToStreamer meanwhile.
 func (s *BinlogStreamer) AddEventToStreamer(ev *BinlogEvent) error {
+	if s.maxBytes > 0 {
+		size := int64(ev.Header.EventSize)
+		for !s.hasRoom(size) {
+			select {
+			case <-s.released:
+			case err := <-s.ech:
+				return err
+			}
+		}
+		s.bytes.Add(size)
+	}
 	select {
 	case s.ch <- ev:
 		return nil
 	case err := <-s.ech:
+		s.release(ev)
 		return err
 	}
 }
@@ -8,7 +8,6 @@ import (
 	"log/slog"
 	"net"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -39,6 +38,14 @@ type BinlogSyncerConfig struct {
 	// Password is for MySQL password.
 	Password string
 
+	// Candidates are the servers to fail over to when the server of Host and Port is down, e.g,
+	// the replicas of it, with the same User and Password. It only works with StartSyncGTID. On
+	// re-sync, if the current server is down, the syncer switches to the first candidate whose
+	// gtid_executed (gtid_binlog_pos for MariaDB) contains the received transactions. If the
+	// connection was broken in the middle of a transaction, its events delivered before are skipped,
+	// and the stream is closed with an error if the candidate sends a different transaction.
+	Candidates []BinlogSource
+
 	// Localhost is local hostname if register salve.
 	// If not set, use os.Hostname() instead.
 	Localhost string
@@ -89,12 +96,22 @@ type BinlogSyncerConfig struct {
 	ReadTimeout time.Duration
 
 	// maximum number of attempts to re-establish a broken connection, zero or negative number means infinite retry.
-	// this configuration will not work if DisableRetrySync is true
+	// this configuration will not work if DisableRetrySync is true or RetryPolicy is set
 	MaxReconnectAttempts int
 
 	// whether disable re-sync for broken connection
 	DisableRetrySync bool
 
+	// RetryPolicy decides when to re-sync after the connection is broken, default
+	// ConstantRetryPolicy with 1s delay and MaxReconnectAttempts.
+	RetryPolicy RetryPolicy
+
+	// OnReconnect is called after every attempt to re-sync if it's not nil.
+	OnReconnect func(ReconnectInfo)
+
+	// Metrics receives the metrics of the syncer if it's not nil, e.g, PrometheusMetrics.
+	Metrics Metrics
+
 	// Only works when MySQL/MariaDB variable binlog_checksum=CRC32.
 	// For MySQL, binlog_checksum was introduced since 5.6.2, but CRC32 was set as default value since 5.6.6 .
 	// https://dev.mysql.com/doc/refman/5.6/en/replication-options-binary-log.html#option_mysqld_binlog-checksum
@@ -128,6 +145,23 @@ type BinlogSyncerConfig struct {
 
 	EventCacheCount int
 
+	// EventCacheBytes limits the total size of the events waiting in the BinlogStreamer besides
+	// EventCacheCount, so the huge events don't take too much memory. Default 0, no limit.
+	EventCacheBytes int64
+
+	// LazyRowsEvent keeps the raw data of the rows events instead of decoding the rows into
+	// RowsEvent.Rows, the rows are decoded one by one by RowsEvent.Iterator then, or read by the
+	// typed accessors of RowsIterator.TypedRow without allocation.
+	LazyRowsEvent bool
+
+	// Bounds limits the events read like the options of mysqlbinlog, e.g, for the point-in-time
+	// recovery. BinlogStreamer returns ErrStopBoundReached after the events before a stop bound.
+	Bounds ReadBounds
+
+	// Filter drops the events of the unwanted tables or types before they're sent to BinlogStreamer,
+	// the rows of the dropped rows events are not decoded.
+	Filter EventFilter
+
 	// FillZeroLogPos enables dynamic LogPos calculation for MariaDB.
 	// When enabled, automatically adds BINLOG_SEND_ANNOTATE_ROWS_EVENT flag
 	// to ensure correct position calculation in MariaDB 11.4+.
@@ -138,6 +172,21 @@ type BinlogSyncerConfig struct {
 	// Default 0,  this will be set to GOMAXPROCS.
 	PayloadDecoderConcurrency int
 
+	// MaxUncompressedSize limits the uncompressed size of TransactionPayloadEvent, which is checked
+	// by its UncompressedSize before decompressing, and of the MariaDB compressed events. All the
+	// events of a payload are kept in its Events, so it bounds the memory taken by a payload. A
+	// MariaDB compressed event isn't streamed, it's checked by the size in its header and then
+	// decompressed into a buffer of that size at once, so the limit is also the largest buffer
+	// allocated for one event. Default 0, no limit.
+	MaxUncompressedSize int64
+
+	// MaxTransactionMemorySize is the max size in bytes of the events of a transaction kept in
+	// memory by BinlogStreamer.GetTransaction, the events of a larger transaction are spilled into
+	// a temporary file in TransactionSpillDir, or the default directory for temporary files if empty.
+	// Default 0, the transactions are always kept in memory.
+	MaxTransactionMemorySize int64
+	TransactionSpillDir      string
+
 	// SynchronousEventHandler is used for synchronous event handling.
 	// This should not be used together with StartBackupWithHandler.
 	// If this is not nil, GetEvent does not need to be called.
@@ -176,6 +225,15 @@ type BinlogSyncer struct {
 	lastConnectionID uint32
 
 	retryCount int
+
+	// the index of the current server in sources()
+	sourceIndex int
+
+	resume resumeTracker
+	// checks the events with BinlogSyncerConfig.Bounds, nil if there are no bounds
+	bounds *boundsChecker
+	// filters the events with BinlogSyncerConfig.Filter, nil if there is no filter
+	filter *eventFilter
 }
 
 // NewBinlogSyncer creates the BinlogSyncer with the given configuration.
@@ -194,6 +252,9 @@ func NewBinlogSyncer(cfg BinlogSyncerConfig) *BinlogSyncer {
 	if cfg.EventCacheCount == 0 {
 		cfg.EventCacheCount = 10240
 	}
+	if cfg.RetryPolicy == nil {
+		cfg.RetryPolicy = &ConstantRetryPolicy{Delay: time.Second, MaxAttempts: cfg.MaxReconnectAttempts}
+	}
 
 	// Clear the Password to avoid outputting it in logs.
 	pass := cfg.Password
@@ -204,23 +265,30 @@ func NewBinlogSyncer(cfg BinlogSyncerConfig) *BinlogSyncer {
 	b := new(BinlogSyncer)
 
 	b.cfg = cfg
-	b.parser = NewBinlogParser()
-	b.parser.SetFlavor(cfg.Flavor)
-	b.parser.SetRawMode(b.cfg.RawModeEnabled)
-	b.parser.SetParseTime(b.cfg.ParseTime)
-	b.parser.SetTimestampStringLocation(b.cfg.TimestampStringLocation)
-	b.parser.SetUseDecimal(b.cfg.UseDecimal)
-	b.parser.SetUseFloatWithTrailingZero(b.cfg.UseFloatWithTrailingZero)
-	b.parser.SetVerifyChecksum(b.cfg.VerifyChecksum)
-	b.parser.SetPayloadDecoderConcurrency(cfg.PayloadDecoderConcurrency)
-	b.parser.SetRowsEventDecodeFunc(b.cfg.RowsEventDecodeFunc)
-	b.parser.SetTableMapOptionalMetaDecodeFunc(b.cfg.TableMapOptionalMetaDecodeFunc)
+	b.parser = b.newParser()
 	b.running = false
 	b.ctx, b.cancel = context.WithCancel(context.Background())
 
 	return b
 }
 
+func (b *BinlogSyncer) newParser() *BinlogParser {
+	p := NewBinlogParser()
+	p.SetFlavor(b.cfg.Flavor)
+	p.SetRawMode(b.cfg.RawModeEnabled)
+	p.SetParseTime(b.cfg.ParseTime)
+	p.SetTimestampStringLocation(b.cfg.TimestampStringLocation)
+	p.SetUseDecimal(b.cfg.UseDecimal)
+	p.SetUseFloatWithTrailingZero(b.cfg.UseFloatWithTrailingZero)
+	p.SetLazyRowsEvent(b.cfg.LazyRowsEvent)
+	p.SetVerifyChecksum(b.cfg.VerifyChecksum)
+	p.SetPayloadDecoderConcurrency(b.cfg.PayloadDecoderConcurrency)
+	p.SetMaxUncompressedSize(b.cfg.MaxUncompressedSize)
+	p.SetRowsEventDecodeFunc(b.cfg.RowsEventDecodeFunc)
+	p.SetTableMapOptionalMetaDecodeFunc(b.cfg.TableMapOptionalMetaDecodeFunc)
+	return p
+}
+
 // Close closes the BinlogSyncer.
 func (b *BinlogSyncer) Close() {
 	b.m.Lock()
@@ -332,8 +400,16 @@ func (b *BinlogSyncer) registerSlave() error {
 			// is checksum-aware. It does not need the first fake Rotate
 			// necessary checksummed.
 			// That preference is specified below.
+			checksum := "NONE"
+			if b.parser.rawMode && strings.EqualFold(s, "CRC32") {
+				// the raw events are saved as they are in the binlog files, e.g, by the
+				// backups, so they must keep their checksums even if the server strips them
+				// for NONE. The fake rotate event has a checksum then too.
+				checksum = "CRC32"
+				b.parser.format = &FormatDescriptionEvent{ChecksumAlgorithm: BINLOG_CHECKSUM_ALG_CRC32}
+			}
 
-			if _, err = b.c.Execute(`SET @master_binlog_checksum='NONE', @source_binlog_checksum='NONE'`); err != nil {
+			if _, err = b.c.Execute(fmt.Sprintf(`SET @master_binlog_checksum='%s', @source_binlog_checksum='%s'`, checksum, checksum)); err != nil {
 				return errors.Trace(err)
 			}
 		}
@@ -426,12 +502,67 @@ func (b *BinlogSyncer) startDumpStream() *BinlogStreamer {
 	b.running = true
 
 	s := NewBinlogStreamerWithChanSize(b.cfg.EventCacheCount)
+	s.SetMaxBytes(b.cfg.EventCacheBytes)
+	s.txBuilder.maxMemorySize = b.cfg.MaxTransactionMemorySize
+	s.txBuilder.spillDir = b.cfg.TransactionSpillDir
+	s.txBuilder.newParser = b.newParser
+	s.txBuilder.newFilter = b.newFilter
 
 	b.wg.Add(1)
 	go b.onStream(s)
 	return s
 }
 
+func (b *BinlogSyncer) resetBounds(file string, executed mysql.GTIDSet) {
+	b.bounds = nil
+	if !b.cfg.Bounds.isZero() {
+		b.bounds = newBoundsChecker(b.cfg.Bounds, file, executed)
+	}
+}
+
+func (b *BinlogSyncer) resetFilter() error {
+	b.filter = nil
+	if b.parser.rawMode {
+		return nil
+	}
+
+	filter, err := newEventFilter(b.cfg.Filter)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if filter != nil {
+		b.filter = filter
+		b.parser.SetRowsEventDecodeFunc(b.decodeRowsEvent)
+	}
+	return nil
+}
+
+// newFilter compiles the filter again for the events decoded again, e.g, the events of the
+// spilled transactions. It returns nil if nothing is filtered, the filter is already checked
+// by resetFilter.
+func (b *BinlogSyncer) newFilter() *eventFilter {
+	filter, err := newEventFilter(b.cfg.Filter)
+	if err != nil {
+		return nil
+	}
+	return filter
+}
+
+// decodeRowsEvent decodes the rows of the rows event only if it's kept by the filter.
+func (b *BinlogSyncer) decodeRowsEvent(e *RowsEvent, data []byte) error {
+	pos, err := e.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+	if !b.filter.keepRows(e) {
+		return nil
+	}
+	if b.cfg.RowsEventDecodeFunc != nil {
+		return b.cfg.RowsEventDecodeFunc(e, data)
+	}
+	return e.DecodeData(pos, data)
+}
+
 // GetNextPosition returns the next position of the syncer
 func (b *BinlogSyncer) GetNextPosition() mysql.Position {
 	return b.nextPos
@@ -459,6 +590,15 @@ func (b *BinlogSyncer) StartSync(pos mysql.Position) (*BinlogStreamer, error) {
 		return nil, errors.Trace(errSyncRunning)
 	}
 
+	if err := b.resetFilter(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	b.resetBounds(pos.Name, nil)
+	if b.bounds != nil {
+		if err := b.bounds.checkStartPos(int64(pos.Pos)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
 	if err := b.prepareSyncPos(pos); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -482,6 +622,12 @@ func (b *BinlogSyncer) StartSyncGTID(gset mysql.GTIDSet) (*BinlogStreamer, error
 		return nil, errors.Trace(errSyncRunning)
 	}
 
+	if err := b.resetFilter(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	b.resume.reset()
+	b.resetBounds("", gset)
+
 	// establishing network connection here and will start getting binlog events from "gset + 1", thus until first
 	// MariadbGTIDEvent/GTIDEvent event is received - we effectively do not have a "current GTID"
 	b.currGset = nil
@@ -654,6 +800,12 @@ func (b *BinlogSyncer) writeRegisterSlaveCommand() error {
 }
 
 func (b *BinlogSyncer) replySemiSyncACK(p mysql.Position) error {
+	if b.cfg.Metrics != nil {
+		defer func(start time.Time) {
+			b.cfg.Metrics.ObserveSemiSyncACK(utils.Now().Sub(start))
+		}(utils.Now())
+	}
+
 	b.c.ResetSequence()
 
 	data := make([]byte, 4+1+8+len(p.Name))
@@ -689,7 +841,29 @@ func (b *BinlogSyncer) retrySync() error {
 		}
 		b.cfg.Logger.Info("begin to re-sync", extra...)
 
-		if err := b.prepareSyncGTID(b.prevGset); err != nil {
+		// the source must have the last received transaction, even if it's not completely received
+		required := b.prevGset
+		if b.currGset != nil {
+			required = b.currGset
+		}
+		if b.resume.inTransaction() {
+			// re-sync the interrupted transaction, and skip the events of it received before
+			b.resume.resume()
+		} else if b.currGset != nil {
+			// the last transaction is done, re-sync after it
+			b.prevGset = b.currGset.Clone()
+		}
+
+		err := b.prepareSyncGTID(b.prevGset)
+		if err != nil && len(b.cfg.Candidates) > 0 && !b.isClosed() {
+			b.cfg.Logger.Error("re-sync err, try to fail over", slog.String("source", b.sources()[b.sourceIndex].String()), slog.Any("error", err))
+			if err = b.failover(required); err == nil {
+				err = b.prepareSyncGTID(b.prevGset)
+			}
+		}
+		if err != nil {
+			// prepareSyncGTID resets currGset, keep it for the next retry
+			b.currGset = required
 			return errors.Trace(err)
 		}
 	} else {
@@ -777,32 +951,37 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 				return
 			}
 
+			broken := utils.Now()
+			lastErr := err
 			for {
+				b.retryCount++
+				delay, ok := b.cfg.RetryPolicy.NextDelay(b.retryCount, utils.Now().Sub(broken))
+				if !ok {
+					b.cfg.Logger.Error(
+						"retry sync err, exceeded max retries",
+						slog.Any("error", lastErr), slog.Int("retryCount", b.retryCount-1),
+					)
+					s.closeWithError(lastErr)
+					return
+				}
+
 				select {
 				case <-b.ctx.Done():
 					s.close()
 					return
-				case <-time.After(time.Second):
-					b.retryCount++
-					if err = b.retrySync(); err != nil {
-						if b.cfg.MaxReconnectAttempts > 0 && b.retryCount >= b.cfg.MaxReconnectAttempts {
-							b.cfg.Logger.Error(
-								"retry sync err, exceeded max retries",
-								slog.Any("error", err), slog.Int("maxAttempts", b.cfg.MaxReconnectAttempts),
-							)
-							s.closeWithError(err)
-							return
-						}
-
-						b.cfg.Logger.Error(
-							"retry sync err, wait 1s and retry again",
-							slog.Any("error", err), slog.Int("retryCount", b.retryCount), slog.Int("maxAttempts", b.cfg.MaxReconnectAttempts),
-						)
-						continue
-					}
+				case <-time.After(delay):
 				}
 
-				break
+				err = b.retrySync()
+				b.onReconnect(lastErr, err)
+				if err == nil {
+					break
+				}
+				b.cfg.Logger.Error(
+					"retry sync err, wait and retry again",
+					slog.Any("error", err), slog.Int("retryCount", b.retryCount),
+				)
+				lastErr = err
 			}
 
 			// we connect the server and begin to re-sync again.
@@ -819,6 +998,11 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 
 		switch data[0] {
 		case mysql.OK_HEADER:
+			var start time.Time
+			if b.cfg.Metrics != nil {
+				start = utils.Now()
+			}
+
 			// Parse the event
 			e, needACK, err := b.parseEvent(data)
 			if err != nil {
@@ -826,9 +1010,19 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 				return
 			}
 
+			if b.cfg.Metrics != nil {
+				now := utils.Now()
+				b.cfg.Metrics.ObserveEvent(e.Header.EventType, e.Header.EventSize, now.Sub(start))
+				observeEventLag(b.cfg.Metrics, e, now)
+			}
+
 			// Handle the event and send ACK if necessary
 			err = b.handleEventAndACK(s, e, needACK)
-			if err != nil {
+			if err == ErrStopBoundReached {
+				b.cfg.Logger.Info("stop bound reached", slog.Any("position", b.nextPos))
+				s.closeWithError(err)
+				return
+			} else if err != nil {
 				s.closeWithError(err)
 				return
 			}
@@ -849,6 +1043,27 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 	}
 }
 
+func (b *BinlogSyncer) onReconnect(lastErr, err error) {
+	if b.cfg.Metrics != nil {
+		b.cfg.Metrics.ObserveReconnect(err)
+	}
+	if b.cfg.OnReconnect == nil {
+		return
+	}
+
+	info := ReconnectInfo{
+		Attempt:   b.retryCount,
+		LastError: lastErr,
+		Err:       err,
+		Source:    b.CurrentSource(),
+		Position:  b.nextPos,
+	}
+	if b.prevGset != nil {
+		info.GTIDSet = b.prevGset.Clone()
+	}
+	b.cfg.OnReconnect(info)
+}
+
 // parseEvent parses the raw data into a BinlogEvent.
 // It only handles parsing and does not perform any side effects.
 // Returns the parsed BinlogEvent, a boolean indicating if an ACK is needed, and an error if the
@@ -942,6 +1157,58 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 		if !b.cfg.DiscardGTIDSet {
 			event.GSet = b.getCurrentGtidSet()
 		}
+
+	case *XAPrepareEvent:
+		if !b.cfg.DiscardGTIDSet {
+			event.GSet = b.getCurrentGtidSet()
+		}
+	}
+
+	if b.prevGset != nil {
+		skip, err := b.resume.track(e)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if skip {
+			// the event was delivered before the re-sync
+			if needACK {
+				return errors.Trace(b.replySemiSyncACK(b.nextPos))
+			}
+			return nil
+		}
+	}
+
+	stop := false
+	if b.bounds != nil {
+		var (
+			read bool
+			err  error
+		)
+		read, stop, err = b.bounds.check(e)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !read {
+			if stop {
+				return ErrStopBoundReached
+			}
+			if needACK {
+				return errors.Trace(b.replySemiSyncACK(b.nextPos))
+			}
+			return nil
+		}
+	}
+
+	if b.filter != nil && !b.filter.keep(e) {
+		if needACK {
+			if err := b.replySemiSyncACK(b.nextPos); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if stop {
+			return ErrStopBoundReached
+		}
+		return nil
 	}
 
 	// Use SynchronousEventHandler if it's set
@@ -952,11 +1219,12 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 		}
 	} else {
 		// Asynchronous mode: send the event to the streamer channel
-		select {
-		case s.ch <- e:
-		case <-b.ctx.Done():
+		if err := s.put(b.ctx, e); err != nil {
 			return errors.New("sync is being closed...")
 		}
+		if b.cfg.Metrics != nil {
+			b.cfg.Metrics.ObserveStreamerLength(len(s.ch))
+		}
 	}
 
 	if needACK {
@@ -965,6 +1233,9 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 			return errors.Trace(err)
 		}
 	}
+	if stop {
+		return ErrStopBoundReached
+	}
 
 	return nil
 }
@@ -996,12 +1267,11 @@ func (b *BinlogSyncer) LastConnectionID() uint32 {
 }
 
 func (b *BinlogSyncer) newConnection(ctx context.Context) (*client.Conn, error) {
-	var addr string
-	if b.cfg.Port != 0 {
-		addr = net.JoinHostPort(b.cfg.Host, strconv.Itoa(int(b.cfg.Port)))
-	} else {
-		addr = b.cfg.Host
-	}
+	return b.connect(ctx, b.sources()[b.sourceIndex])
+}
+
+func (b *BinlogSyncer) connect(ctx context.Context, source BinlogSource) (*client.Conn, error) {
+	addr := source.addr()
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
@@ -0,0 +1,251 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// ErrStopBoundReached is returned by BinlogStreamer after the events before the stop bound of
+// ReadBounds are read.
+var ErrStopBoundReached = errors.New("the stop bound of the binlog is reached")
+
+// ReadBounds limits the events read by BinlogSyncer or BinlogParser, like the options of mysqlbinlog.
+// The bounds are checked at the start of every transaction, so a transaction is read entirely or not
+// at all, and the events between the transactions like FormatDescriptionEvent are always read.
+// The zero values mean no bound.
+type ReadBounds struct {
+	// StartDatetime skips the transactions before the first one at or after it, like --start-datetime.
+	StartDatetime time.Time
+	// StopDatetime stops before the first transaction at or after it, like --stop-datetime.
+	StopDatetime time.Time
+	// StopPosition stops before the first transaction at or after it, like --stop-position. If the
+	// Name is empty, only the Pos is compared in any file.
+	StopPosition mysql.Position
+	// StopGTIDSet stops after all the transactions in it are read, e.g, the gtid_executed of the
+	// point to recover to. The GTIDs before the start are counted in by the PreviousGTIDsEvent, or
+	// the GTID set of BinlogSyncer.StartSyncGTID. So the reading must start by GTID set or at the
+	// start of a binlog file, otherwise it returns an error.
+	StopGTIDSet mysql.GTIDSet
+	// ExcludeGTIDs skips the transactions in it, like --exclude-gtids.
+	ExcludeGTIDs mysql.GTIDSet
+}
+
+func (b *ReadBounds) isZero() bool {
+	return b.StartDatetime.IsZero() && b.StopDatetime.IsZero() && b.StopPosition.Pos == 0 &&
+		b.StopGTIDSet == nil && b.ExcludeGTIDs == nil
+}
+
+// boundsChecker checks the events with ReadBounds.
+type boundsChecker struct {
+	bounds   ReadBounds
+	boundary transactionBoundary
+
+	// whether a transaction is in progress, and whether it's skipped
+	inTransaction bool
+	skip          bool
+	// whether the transaction at or after StartDatetime is read
+	started bool
+	stopped bool
+
+	// the current binlog file
+	file string
+	// the GTIDs read, nil if unknown
+	executed mysql.GTIDSet
+}
+
+func newBoundsChecker(bounds ReadBounds, file string, executed mysql.GTIDSet) *boundsChecker {
+	c := &boundsChecker{bounds: bounds, file: file}
+	if executed != nil {
+		c.executed = executed.Clone()
+	}
+	return c
+}
+
+// checkStartPos returns an error if the GTIDs before the start position are unknown with
+// StopGTIDSet, because the PreviousGTIDsEvent at the start of the binlog file isn't read.
+func (c *boundsChecker) checkStartPos(pos int64) error {
+	if c.bounds.StopGTIDSet != nil && c.executed == nil && pos > int64(len(BinLogFileHeader)) {
+		return errors.Errorf("StopGTIDSet requires reading from the start of the binlog file or by GTID set, but the position is %d", pos)
+	}
+	return nil
+}
+
+// check returns whether the event should be read, and whether the reading should stop after the
+// event is read, or instead of it if it isn't.
+func (c *boundsChecker) check(e *BinlogEvent) (read bool, stop bool, err error) {
+	if c.stopped {
+		return false, true, nil
+	}
+
+	switch ev := e.Event.(type) {
+	case *RotateEvent:
+		c.file = string(ev.NextLogName)
+		return true, false, nil
+	case *PreviousGTIDsEvent:
+		gtids, err := mysql.ParseMysqlGTIDSet(ev.GTIDSets)
+		if err != nil {
+			return false, false, errors.Trace(err)
+		}
+		return true, false, errors.Trace(c.addExecuted(gtids))
+	case *MariadbGTIDListEvent:
+		gtids, err := mariadbGTIDListSet(ev)
+		if err != nil {
+			return false, false, errors.Trace(err)
+		}
+		return true, false, errors.Trace(c.addExecuted(gtids))
+	case *FormatDescriptionEvent, *HeartbeatEvent, *MariadbBinlogCheckPointEvent:
+		return true, false, nil
+	case *GenericEvent:
+		if !c.inTransaction {
+			// e.g, STOP_EVENT
+			return true, false, nil
+		}
+	}
+
+	gtid, isGTIDEvent, err := transactionGTID(e.Event)
+	if err != nil {
+		return false, false, errors.Trace(err)
+	}
+	if isGTIDEvent || !c.inTransaction {
+		// the first event of a transaction
+		if c.stopBefore(e) {
+			c.stopped = true
+			return false, true, nil
+		}
+		c.inTransaction = true
+		c.boundary.begin(e.Event)
+		c.skip = c.skipTransaction(e, gtid)
+		if gtid != nil {
+			if err = c.addExecuted(gtid); err != nil {
+				return false, false, errors.Trace(err)
+			}
+		}
+		if isGTIDEvent {
+			return !c.skip, false, nil
+		}
+	}
+
+	if c.boundary.end(e.Event) {
+		c.inTransaction = false
+		if c.bounds.StopGTIDSet != nil && c.executed != nil && c.executed.Contain(c.bounds.StopGTIDSet) {
+			c.stopped = true
+			return !c.skip, true, nil
+		}
+	}
+	return !c.skip, false, nil
+}
+
+// stopBefore returns whether to stop before the transaction started by the event.
+func (c *boundsChecker) stopBefore(e *BinlogEvent) bool {
+	if c.bounds.StopGTIDSet != nil && c.executed != nil && c.executed.Contain(c.bounds.StopGTIDSet) {
+		return true
+	}
+	if !c.bounds.StopDatetime.IsZero() && int64(e.Header.Timestamp) >= c.bounds.StopDatetime.Unix() {
+		return true
+	}
+	if c.bounds.StopPosition.Pos > 0 && e.Header.LogPos >= e.Header.EventSize {
+		pos := mysql.Position{Name: c.file, Pos: e.Header.LogPos - e.Header.EventSize}
+		if c.bounds.StopPosition.Name == "" {
+			return pos.Pos >= c.bounds.StopPosition.Pos
+		}
+		return pos.Name != "" && pos.Compare(c.bounds.StopPosition) >= 0
+	}
+	return false
+}
+
+// skipTransaction returns whether to skip the transaction started by the event.
+func (c *boundsChecker) skipTransaction(e *BinlogEvent, gtid mysql.GTIDSet) bool {
+	if !c.started && !c.bounds.StartDatetime.IsZero() {
+		if int64(e.Header.Timestamp) < c.bounds.StartDatetime.Unix() {
+			return true
+		}
+		c.started = true
+	}
+	return gtid != nil && c.bounds.ExcludeGTIDs != nil && c.bounds.ExcludeGTIDs.Contain(gtid)
+}
+
+// addExecuted adds the GTIDs to the read ones.
+func (c *boundsChecker) addExecuted(gtids mysql.GTIDSet) error {
+	if c.executed == nil {
+		c.executed = gtids.Clone()
+		return nil
+	}
+	return c.executed.Update(gtids.String())
+}
+
+// transactionGTID returns the GTID of the transaction started by the event, and whether the event
+// is a GTID event. The GTID is nil for an anonymous transaction.
+func transactionGTID(e Event) (mysql.GTIDSet, bool, error) {
+	switch ev := e.(type) {
+	case *GTIDEvent:
+		if ev.GNO == 0 {
+			return nil, true, nil
+		}
+		gtid, err := ev.GTIDNext()
+		return gtid, true, err
+	case *GtidTaggedLogEvent:
+		gtid, err := ev.GTIDNext()
+		return gtid, true, err
+	case *MariadbGTIDEvent:
+		gtid, err := ev.GTIDNext()
+		return gtid, true, err
+	}
+	return nil, false, nil
+}
+
+// mariadbGTIDListSet returns the GTID set of the MariadbGTIDListEvent.
+func mariadbGTIDListSet(e *MariadbGTIDListEvent) (mysql.GTIDSet, error) {
+	gtids, _ := mysql.ParseMariadbGTIDSet("")
+	for i := range e.GTIDs {
+		if err := gtids.(*mysql.MariadbGTIDSet).AddSet(&e.GTIDs[i]); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return gtids, nil
+}
+
+// SearchBinlogFileByTime binary searches the binlog files, which are sorted in order, for the first
+// file to read the events at or after t, by the timestamp of the FormatDescriptionEvent at the
+// start of every file. It returns the index of the last file starting at or before t, or 0 if t is
+// before all the files.
+func SearchBinlogFileByTime(files []string, t time.Time) (int, error) {
+	i, j := 0, len(files)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		start, err := binlogFileStartTime(files[h])
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if start.After(t) {
+			j = h
+		} else {
+			i = h + 1
+		}
+	}
+	return max(i-1, 0), nil
+}
+
+// binlogFileStartTime returns the timestamp of the first event of the binlog file.
+func binlogFileStartTime(name string) (time.Time, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return time.Time{}, errors.Trace(err)
+	}
+	defer f.Close()
+
+	data := make([]byte, len(BinLogFileHeader)+EventHeaderSize)
+	if _, err = io.ReadFull(f, data); err != nil {
+		return time.Time{}, errors.Annotatef(err, "read the first event of %s", name)
+	}
+	if !bytes.Equal(data[:len(BinLogFileHeader)], BinLogFileHeader) {
+		return time.Time{}, errors.Errorf("%s is not a valid binlog file, head 4 bytes must fe'bin' ", name)
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint32(data[len(BinLogFileHeader):])), 0), nil
+}
@@ -0,0 +1,204 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	testBoundsSID   = "3ccc1f06-4b5d-11ee-8b49-0242ac110002"
+	testBoundsStart = int64(1700000000)
+)
+
+// writeTestBoundsFile writes a binlog file created at start with the transactions from the GTID
+// first to last, the transaction gno is committed at testBoundsStart+gno*10s.
+func writeTestBoundsFile(t *testing.T, name string, start int64, first, last int64) {
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	w, err := NewBinlogWriter(f)
+	require.NoError(t, err)
+	write := func(timestamp int64, eventType EventType, e Event) {
+		_, err := w.WriteEvent(EventHeader{Timestamp: uint32(timestamp), EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+	}
+
+	write(start, FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_CRC32))
+	previous := ""
+	if first > 1 {
+		previous = fmt.Sprintf("%s:1-%d", testBoundsSID, first-1)
+	}
+	write(start, PREVIOUS_GTIDS_EVENT, &PreviousGTIDsEvent{GTIDSets: previous})
+
+	sid := uuid.MustParse(testBoundsSID)
+	for gno := first; gno <= last; gno++ {
+		ts := testBoundsStart + gno*10
+		write(ts, GTID_EVENT, &GTIDEvent{SID: sid[:], GNO: gno, LastCommitted: gno - 1, SequenceNumber: gno})
+		write(ts, QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")})
+		write(ts, XID_EVENT, &XIDEvent{XID: uint64(gno)})
+	}
+}
+
+// parseTestBoundsFiles parses the files with the bounds, and returns the GNOs of the read
+// transactions, the transactions must be read entirely.
+func parseTestBoundsFiles(t *testing.T, bounds ReadBounds, files ...string) ([]int64, bool) {
+	p := NewBinlogParser()
+	p.SetReadBounds(bounds)
+
+	var gnos []int64
+	var types []EventType
+	for _, name := range files {
+		err := p.ParseFile(name, 0, func(e *BinlogEvent) error {
+			switch ev := e.Event.(type) {
+			case *FormatDescriptionEvent, *PreviousGTIDsEvent:
+				return nil
+			case *GTIDEvent:
+				gnos = append(gnos, ev.GNO)
+			}
+			types = append(types, e.Header.EventType)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	for i := range gnos {
+		require.Equal(t, []EventType{GTID_EVENT, QUERY_EVENT, XID_EVENT}, types[i*3:i*3+3])
+	}
+	require.Len(t, types, len(gnos)*3)
+	return gnos, p.StopBoundReached()
+}
+
+func TestParseFileWithReadBounds(t *testing.T) {
+	dir := t.TempDir()
+	start := testBoundsStart
+	file1 := filepath.Join(dir, "mysql-bin.000001")
+	file2 := filepath.Join(dir, "mysql-bin.000002")
+	writeTestBoundsFile(t, file1, start, 1, 5)
+	writeTestBoundsFile(t, file2, start+55, 6, 10)
+
+	gtids := func(s string) mysql.GTIDSet {
+		set, err := mysql.ParseMysqlGTIDSet(testBoundsSID + ":" + s)
+		require.NoError(t, err)
+		return set
+	}
+
+	testcases := []struct {
+		name     string
+		bounds   ReadBounds
+		expected []int64
+		stopped  bool
+	}{
+		{"no bounds", ReadBounds{}, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, false},
+		{"start datetime", ReadBounds{StartDatetime: time.Unix(start+35, 0)}, []int64{4, 5, 6, 7, 8, 9, 10}, false},
+		{"stop datetime", ReadBounds{StopDatetime: time.Unix(start+70, 0)}, []int64{1, 2, 3, 4, 5, 6}, true},
+		{
+			"datetime range",
+			ReadBounds{StartDatetime: time.Unix(start+20, 0), StopDatetime: time.Unix(start+41, 0)},
+			[]int64{2, 3, 4},
+			true,
+		},
+		{"stop GTID set", ReadBounds{StopGTIDSet: gtids("1-7")}, []int64{1, 2, 3, 4, 5, 6, 7}, true},
+		{"stop GTID set in the first file", ReadBounds{StopGTIDSet: gtids("1-3")}, []int64{1, 2, 3}, true},
+		{"exclude GTIDs", ReadBounds{ExcludeGTIDs: gtids("2-3:7-10")}, []int64{1, 4, 5, 6}, false},
+		{"stop position in the second file", ReadBounds{StopPosition: mysql.Position{Name: "mysql-bin.000002", Pos: 4}}, []int64{1, 2, 3, 4, 5}, true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gnos, stopped := parseTestBoundsFiles(t, tc.bounds, file1, file2)
+			require.Equal(t, tc.expected, gnos)
+			require.Equal(t, tc.stopped, stopped)
+		})
+	}
+
+	// the stop position without the file name stops in the first file
+	p := NewBinlogParser()
+	var stopPos uint32
+	err := p.ParseFile(file1, 0, func(e *BinlogEvent) error {
+		if ev, ok := e.Event.(*GTIDEvent); ok && ev.GNO == 5 {
+			stopPos = e.Header.LogPos - e.Header.EventSize
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	gnos, stopped := parseTestBoundsFiles(t, ReadBounds{StopPosition: mysql.Position{Pos: stopPos}}, file1, file2)
+	require.Equal(t, []int64{1, 2, 3, 4}, gnos)
+	require.True(t, stopped)
+
+	// the GTIDs before the offset are unknown
+	p = NewBinlogParser()
+	p.SetReadBounds(ReadBounds{StopGTIDSet: gtids("1-7")})
+	err = p.ParseFile(file1, int64(stopPos), func(*BinlogEvent) error { return nil })
+	require.ErrorContains(t, err, "StopGTIDSet requires reading from the start")
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 100, Bounds: ReadBounds{StopGTIDSet: gtids("1-7")}})
+	_, err = b.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: stopPos})
+	require.ErrorContains(t, err, "StopGTIDSet requires reading from the start")
+
+	// the stop GTID set from the syncer
+	c := newBoundsChecker(ReadBounds{StopGTIDSet: gtids("1-3")}, "", gtids("1-3"))
+	read, stop, err := c.check(&BinlogEvent{Header: &EventHeader{}, Event: &GTIDEvent{GNO: 0}})
+	require.NoError(t, err)
+	require.False(t, read)
+	require.True(t, stop)
+}
+
+func TestSearchBinlogFileByTime(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("mysql-bin.%06d", i+1))
+		writeTestBoundsFile(t, name, 1700000000+int64(i)*100, int64(i)+1, int64(i)+1)
+		files = append(files, name)
+	}
+
+	for _, tc := range []struct {
+		t        int64
+		expected int
+	}{
+		{1600000000, 0},
+		{1700000000, 0},
+		{1700000099, 0},
+		{1700000100, 1},
+		{1700000250, 2},
+		{1700000400, 4},
+		{1800000000, 4},
+	} {
+		i, err := SearchBinlogFileByTime(files, time.Unix(tc.t, 0))
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, i, tc.t)
+	}
+
+	_, err := SearchBinlogFileByTime([]string{filepath.Join(dir, "none")}, time.Now())
+	require.Error(t, err)
+}
+
+func TestBinlogStreamerStopBoundReached(t *testing.T) {
+	s := NewBinlogStreamer()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.AddEventToStreamer(&BinlogEvent{Header: &EventHeader{Timestamp: uint32(i)}}))
+	}
+	s.closeWithError(ErrStopBoundReached)
+
+	ctx := context.Background()
+	e, err := s.GetEventWithStartTime(ctx, time.Unix(1, 0))
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), e.Header.Timestamp)
+	e, err = s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), e.Header.Timestamp)
+
+	for i := 0; i < 2; i++ {
+		_, err = s.GetEvent(ctx)
+		require.ErrorIs(t, err, ErrStopBoundReached)
+	}
+}
@@ -0,0 +1,310 @@
+package replication
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// Checkpoint is the durable replication progress. It's the end of the last committed
+// transaction, so replicating from the checkpoint doesn't miss or repeat any transaction.
+type Checkpoint struct {
+	Position mysql.Position
+	// GTIDSet is nil if the replication is not based on GTID.
+	GTIDSet mysql.GTIDSet
+	// Timestamp is the timestamp of the event committing the checkpoint.
+	Timestamp uint32
+}
+
+// Clone returns a copy of the checkpoint, the GTID set is cloned too.
+func (c *Checkpoint) Clone() *Checkpoint {
+	clone := *c
+	if c.GTIDSet != nil {
+		clone.GTIDSet = c.GTIDSet.Clone()
+	}
+	return &clone
+}
+
+type checkpointJSON struct {
+	Name      string `json:"name"`
+	Pos       uint32 `json:"pos"`
+	Flavor    string `json:"flavor,omitempty"`
+	GTIDSet   string `json:"gtid_set,omitempty"`
+	Timestamp uint32 `json:"timestamp"`
+}
+
+func (c *Checkpoint) MarshalJSON() ([]byte, error) {
+	v := checkpointJSON{
+		Name:      c.Position.Name,
+		Pos:       c.Position.Pos,
+		Timestamp: c.Timestamp,
+	}
+	switch c.GTIDSet.(type) {
+	case nil:
+	case *mysql.MysqlGTIDSet:
+		v.Flavor = mysql.MySQLFlavor
+		v.GTIDSet = c.GTIDSet.String()
+	case *mysql.MariadbGTIDSet:
+		v.Flavor = mysql.MariaDBFlavor
+		v.GTIDSet = c.GTIDSet.String()
+	default:
+		return nil, errors.Errorf("unsupported GTID set %T", c.GTIDSet)
+	}
+
+	return json.Marshal(v)
+}
+
+func (c *Checkpoint) UnmarshalJSON(data []byte) error {
+	var v checkpointJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Trace(err)
+	}
+
+	c.Position = mysql.Position{Name: v.Name, Pos: v.Pos}
+	c.Timestamp = v.Timestamp
+	c.GTIDSet = nil
+	if v.Flavor != "" {
+		gset, err := mysql.ParseGTIDSet(v.Flavor, v.GTIDSet)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.GTIDSet = gset
+	}
+
+	return nil
+}
+
+// CheckpointStore saves and loads the checkpoint.
+type CheckpointStore interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load() (*Checkpoint, error)
+	// Save saves the checkpoint durably, the previous one is replaced.
+	Save(c *Checkpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory, it's useful for tests or
+// when the progress is persisted together with the replicated data.
+type MemoryCheckpointStore struct {
+	m sync.Mutex
+	c *Checkpoint
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{}
+}
+
+func (s *MemoryCheckpointStore) Load() (*Checkpoint, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.c == nil {
+		return nil, nil
+	}
+	return s.c.Clone(), nil
+}
+
+func (s *MemoryCheckpointStore) Save(c *Checkpoint) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.c = c.Clone()
+	return nil
+}
+
+// FileCheckpointStore saves the checkpoint as JSON into a file. The checkpoint is written
+// into a temporary file, which is synced and then renamed, so the file always has a
+// complete checkpoint even if the process crashes.
+type FileCheckpointStore struct {
+	m    sync.Mutex
+	path string
+}
+
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+func (s *FileCheckpointStore) Load() (*Checkpoint, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+
+	c := new(Checkpoint)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Annotatef(err, "invalid checkpoint file %s", s.path)
+	}
+	return c, nil
+}
+
+func (s *FileCheckpointStore) Save(c *Checkpoint) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(utils.WriteFileAtomic(s.path, data))
+}
+
+// CheckpointTracker tracks the checkpoint of the processed events. Call Track after an
+// event is processed, the checkpoint is saved to the store at the end of every transaction,
+// which is an XID event, a DDL, a COMMIT or ROLLBACK ending a BEGIN block, or an XA_PREPARE
+// event, and at the rotate events. The statements inside a block, e.g. SAVEPOINT, and the
+// statements of a MariaDB group without FL_STANDALONE don't commit the checkpoint.
+//
+// The GTID set is tracked only if the tracker starts with a GTID set.
+type CheckpointTracker struct {
+	store CheckpointStore
+
+	c *Checkpoint
+
+	// the GTID of the transaction in progress
+	gtid mysql.GTIDSet
+
+	// whether a transaction is in progress
+	inTransaction bool
+	boundary      transactionBoundary
+}
+
+// NewCheckpointTracker creates a CheckpointTracker from the checkpoint c.
+func NewCheckpointTracker(store CheckpointStore, c *Checkpoint) *CheckpointTracker {
+	return &CheckpointTracker{store: store, c: c.Clone()}
+}
+
+// Checkpoint returns the last committed checkpoint.
+func (t *CheckpointTracker) Checkpoint() *Checkpoint {
+	return t.c.Clone()
+}
+
+// Track updates the checkpoint with the processed event, it returns true if the
+// checkpoint is committed to the store.
+func (t *CheckpointTracker) Track(ev *BinlogEvent) (bool, error) {
+	switch e := ev.Event.(type) {
+	case *RotateEvent:
+		if ev.Header.Timestamp == 0 && string(e.NextLogName) == t.c.Position.Name {
+			// the fake rotate event of the current file
+			return false, nil
+		}
+		t.c.Position = mysql.Position{Name: string(e.NextLogName), Pos: uint32(e.Position)}
+		return true, t.commit(ev.Header)
+	case mysql.BinlogGTIDEvent:
+		gtid, err := e.GTIDNext()
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		t.gtid = gtid
+		t.inTransaction = true
+		t.boundary.begin(ev.Event)
+		return false, nil
+	case *FormatDescriptionEvent, *PreviousGTIDsEvent, *HeartbeatEvent, *MariadbGTIDListEvent,
+		*MariadbBinlogCheckPointEvent:
+		// sent on every connection, or between the transactions
+		return false, nil
+	case *TransactionPayloadEvent:
+		for _, sub := range e.Events {
+			if ge, ok := sub.Event.(mysql.BinlogGTIDEvent); ok {
+				gtid, err := ge.GTIDNext()
+				if err != nil {
+					return false, errors.Trace(err)
+				}
+				t.gtid = gtid
+			}
+		}
+	}
+
+	if !t.inTransaction {
+		// the first event of a transaction on a server without GTIDs
+		t.inTransaction = true
+		t.boundary.begin(ev.Event)
+	}
+	if !t.boundary.end(ev.Event) {
+		return false, nil
+	}
+	t.inTransaction = false
+	return t.commitAt(ev.Header)
+}
+
+func (t *CheckpointTracker) commitAt(h *EventHeader) (bool, error) {
+	if h.LogPos > 0 {
+		t.c.Position.Pos = h.LogPos
+	}
+	if t.gtid != nil && t.c.GTIDSet != nil {
+		if err := t.c.GTIDSet.Update(t.gtid.String()); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	t.gtid = nil
+
+	return true, t.commit(h)
+}
+
+func (t *CheckpointTracker) commit(h *EventHeader) error {
+	t.c.Timestamp = h.Timestamp
+	return errors.Trace(t.store.Save(t.c))
+}
+
+// TrackTransaction updates the checkpoint to the end of the transaction and commits it to the
+// store, it's used instead of Track when the events are grouped by BinlogStreamer.GetTransaction.
+func (t *CheckpointTracker) TrackTransaction(tx *Transaction) error {
+	if tx.EndPos.Name != "" {
+		t.c.Position.Name = tx.EndPos.Name
+	}
+	if tx.EndPos.Pos > 0 {
+		t.c.Position.Pos = tx.EndPos.Pos
+	}
+	if tx.GTID != nil && t.c.GTIDSet != nil {
+		if err := t.c.GTIDSet.Update(tx.GTID.String()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	t.gtid = nil
+	t.inTransaction = false
+
+	return t.commit(&EventHeader{Timestamp: tx.Timestamp})
+}
+
+// StartSyncFromCheckpoint starts syncing from the checkpoint saved in the store, or
+// from initial if there is no checkpoint. The sync is based on GTID if the checkpoint
+// has a GTID set. The returned CheckpointTracker must be called with every processed
+// event to save the progress.
+func (b *BinlogSyncer) StartSyncFromCheckpoint(store CheckpointStore, initial *Checkpoint) (*BinlogStreamer, *CheckpointTracker, error) {
+	c, err := store.Load()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if c == nil {
+		c = initial
+		if c == nil {
+			c = &Checkpoint{}
+		}
+	}
+
+	var s *BinlogStreamer
+	if c.GTIDSet != nil {
+		s, err = b.StartSyncGTID(c.GTIDSet.Clone())
+	} else {
+		s, err = b.StartSync(c.Position)
+	}
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	return s, NewCheckpointTracker(store, c), nil
+}
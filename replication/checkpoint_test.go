@@ -0,0 +1,191 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileCheckpointStore(filepath.Join(dir, "checkpoint.json"))
+
+	c, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	mysqlGTIDSet, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23")
+	require.NoError(t, err)
+	mariadbGTIDSet, err := mysql.ParseMariadbGTIDSet("0-1-100,1-2-200")
+	require.NoError(t, err)
+
+	for _, expected := range []*Checkpoint{
+		{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 1234}, Timestamp: 1700000000},
+		{Position: mysql.Position{Name: "mysql-bin.000002", Pos: 4}, GTIDSet: mysqlGTIDSet, Timestamp: 1700000001},
+		{Position: mysql.Position{Name: "mariadb-bin.000003", Pos: 567}, GTIDSet: mariadbGTIDSet, Timestamp: 1700000002},
+	} {
+		require.NoError(t, store.Save(expected))
+
+		c, err = NewFileCheckpointStore(filepath.Join(dir, "checkpoint.json")).Load()
+		require.NoError(t, err)
+		require.Equal(t, expected.Position, c.Position)
+		require.Equal(t, expected.Timestamp, c.Timestamp)
+		if expected.GTIDSet == nil {
+			require.Nil(t, c.GTIDSet)
+		} else {
+			require.True(t, expected.GTIDSet.Equal(c.GTIDSet))
+		}
+	}
+
+	// no temporary file is left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "checkpoint.json"), []byte("{"), 0o644))
+	_, err = store.Load()
+	require.Error(t, err)
+}
+
+func TestMemoryCheckpointStore(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+
+	c, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(&Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, GTIDSet: gset}))
+
+	// the saved checkpoint is not changed by the caller
+	require.NoError(t, gset.Update("3e11fa47-71ca-11e1-9e33-c80aa9429562:24"))
+	c, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", c.GTIDSet.String())
+}
+
+func TestCheckpointTracker(t *testing.T) {
+	sid := uuid.MustParse("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+
+	store := NewMemoryCheckpointStore()
+	tracker := NewCheckpointTracker(store, &Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, GTIDSet: gset})
+
+	track := func(h EventHeader, e Event) bool {
+		committed, err := tracker.Track(&BinlogEvent{Header: &h, Event: e})
+		require.NoError(t, err)
+		return committed
+	}
+
+	// the fake rotate event of the current file
+	require.False(t, track(EventHeader{EventType: ROTATE_EVENT}, &RotateEvent{Position: 100, NextLogName: []byte("mysql-bin.000001")}))
+
+	require.False(t, track(EventHeader{EventType: GTID_EVENT, LogPos: 200}, &GTIDEvent{SID: sid[:], GNO: 11}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 300}, &QueryEvent{Query: []byte("BEGIN")}))
+	require.False(t, track(EventHeader{EventType: WRITE_ROWS_EVENTv2, LogPos: 400}, &RowsEvent{}))
+
+	c, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	require.True(t, track(EventHeader{EventType: XID_EVENT, LogPos: 500, Timestamp: 1700000000}, &XIDEvent{XID: 1}))
+	c, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 500}, c.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11", c.GTIDSet.String())
+	require.Equal(t, uint32(1700000000), c.Timestamp)
+
+	// DDL
+	require.False(t, track(EventHeader{EventType: GTID_EVENT, LogPos: 600}, &GTIDEvent{SID: sid[:], GNO: 12}))
+	require.True(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 700, Timestamp: 1700000001}, &QueryEvent{Query: []byte("CREATE TABLE t (id int)")}))
+	c = tracker.Checkpoint()
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 700}, c.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-12", c.GTIDSet.String())
+
+	// XA transaction is committed at the XA_PREPARE event
+	require.False(t, track(EventHeader{EventType: GTID_EVENT, LogPos: 800}, &GTIDEvent{SID: sid[:], GNO: 13}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 900}, &QueryEvent{Query: []byte("XA START X'01',X'',1")}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 1000}, &QueryEvent{Query: []byte("XA END X'01',X'',1")}))
+	require.True(t, track(EventHeader{EventType: XA_PREPARE_LOG_EVENT, LogPos: 1100}, &XAPrepareEvent{}))
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-13", tracker.Checkpoint().GTIDSet.String())
+
+	// rotate
+	require.True(t, track(EventHeader{EventType: ROTATE_EVENT, LogPos: 1200, Timestamp: 1700000002}, &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")}))
+	c, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 4}, c.Position)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-13", c.GTIDSet.String())
+}
+
+func TestCheckpointTrackerStatementsInTransaction(t *testing.T) {
+	sid := uuid.MustParse("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+
+	tracker := NewCheckpointTracker(NewMemoryCheckpointStore(), &Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, GTIDSet: gset})
+
+	track := func(h EventHeader, e Event) bool {
+		committed, err := tracker.Track(&BinlogEvent{Header: &h, Event: e})
+		require.NoError(t, err)
+		return committed
+	}
+
+	// BEGIN; SAVEPOINT; rows; ROLLBACK TO SAVEPOINT; XID
+	require.False(t, track(EventHeader{EventType: GTID_EVENT, LogPos: 200}, &GTIDEvent{SID: sid[:], GNO: 11}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 300}, &QueryEvent{Query: []byte("BEGIN")}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 400}, &QueryEvent{Query: []byte("SAVEPOINT `sp1`")}))
+	require.False(t, track(EventHeader{EventType: WRITE_ROWS_EVENTv2, LogPos: 500}, &RowsEvent{}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 600}, &QueryEvent{Query: []byte("ROLLBACK TO `sp1`")}))
+	require.Equal(t, uint32(100), tracker.Checkpoint().Position.Pos)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10", tracker.Checkpoint().GTIDSet.String())
+
+	require.True(t, track(EventHeader{EventType: XID_EVENT, LogPos: 700}, &XIDEvent{XID: 1}))
+	require.Equal(t, uint32(700), tracker.Checkpoint().Position.Pos)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11", tracker.Checkpoint().GTIDSet.String())
+
+	// statement based DML without GTIDs
+	tracker = NewCheckpointTracker(NewMemoryCheckpointStore(), &Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 100}})
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 200}, &QueryEvent{Query: []byte("BEGIN")}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 300}, &QueryEvent{Query: []byte("INSERT INTO t VALUES (1)")}))
+	require.True(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 400}, &QueryEvent{Query: []byte("COMMIT")}))
+	require.Equal(t, uint32(400), tracker.Checkpoint().Position.Pos)
+	require.True(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 500}, &QueryEvent{Query: []byte("DROP TABLE t")}))
+	require.Equal(t, uint32(500), tracker.Checkpoint().Position.Pos)
+}
+
+func TestCheckpointTrackerMariadbGroup(t *testing.T) {
+	gset, err := mysql.ParseMariadbGTIDSet("0-1-10")
+	require.NoError(t, err)
+
+	tracker := NewCheckpointTracker(NewMemoryCheckpointStore(), &Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, GTIDSet: gset})
+
+	track := func(h EventHeader, e Event) bool {
+		committed, err := tracker.Track(&BinlogEvent{Header: &h, Event: e})
+		require.NoError(t, err)
+		return committed
+	}
+
+	// a group without FL_STANDALONE, e.g. the statements of a non-transactional engine
+	require.False(t, track(EventHeader{EventType: MARIADB_GTID_EVENT, LogPos: 200},
+		&MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 11}}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 300}, &QueryEvent{Query: []byte("INSERT INTO t VALUES (1)")}))
+	require.False(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 400}, &QueryEvent{Query: []byte("INSERT INTO t VALUES (2)")}))
+	require.Equal(t, "0-1-10", tracker.Checkpoint().GTIDSet.String())
+
+	require.True(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 500}, &QueryEvent{Query: []byte("COMMIT")}))
+	require.Equal(t, uint32(500), tracker.Checkpoint().Position.Pos)
+	require.Equal(t, "0-1-11", tracker.Checkpoint().GTIDSet.String())
+
+	// a standalone DDL is ended by its query
+	require.False(t, track(EventHeader{EventType: MARIADB_GTID_EVENT, LogPos: 600},
+		&MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 12}, Flags: BINLOG_MARIADB_FL_STANDALONE}))
+	require.True(t, track(EventHeader{EventType: QUERY_EVENT, LogPos: 700}, &QueryEvent{Query: []byte("CREATE TABLE t2 (id int)")}))
+	require.Equal(t, "0-1-12", tracker.Checkpoint().GTIDSet.String())
+}
@@ -257,6 +257,27 @@ const (
 	INSERT_ID
 )
 
+// UserVarType is the type of the value in USER_VAR_EVENT, Item_result of MySQL
+type UserVarType byte
+
+const (
+	STRING_RESULT UserVarType = iota
+	REAL_RESULT
+	INT_RESULT
+	ROW_RESULT
+	DECIMAL_RESULT
+)
+
+// the flag of the unsigned integer in USER_VAR_EVENT
+const USER_VAR_UNSIGNED_F = 1
+
+type IncidentType uint16
+
+const (
+	INCIDENT_NONE IncidentType = iota
+	INCIDENT_LOST_EVENTS
+)
+
 const (
 	ENUM_EXTRA_ROW_INFO_TYPECODE_NDB byte = iota
 	ENUM_EXTRA_ROW_INFO_TYPECODE_PARTITION
@@ -0,0 +1,224 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// the key id of the binlog, ENCRYPTION_KEY_SYSTEM_DATA of MariaDB
+const binlogEncryptionKeyID = 1
+
+const (
+	binlogNonceLength = 12
+	binlogIVLength    = 16
+)
+
+// EncryptionAlgorithm is the algorithm of the MariaDB encrypted binlog, like
+// file_key_management_encryption_algorithm.
+type EncryptionAlgorithm int
+
+const (
+	// EncryptionAESCBC is AES in CBC mode without padding, the last partial block is XORed with the
+	// encrypted IV. It's the default algorithm of file_key_management.
+	EncryptionAESCBC EncryptionAlgorithm = iota
+	// EncryptionAESCTR is AES in CTR mode.
+	EncryptionAESCTR
+)
+
+func (a EncryptionAlgorithm) String() string {
+	switch a {
+	case EncryptionAESCBC:
+		return "AES_CBC"
+	case EncryptionAESCTR:
+		return "AES_CTR"
+	default:
+		return "EncryptionAlgorithm(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
+// EncryptionKeyProvider provides the keys to decrypt the MariaDB binlog files encrypted at rest
+// (encrypt_binlog=ON), like the key management plugin of the server.
+type EncryptionKeyProvider interface {
+	// GetKey returns the key of the key id and version, the binlog always uses the key id 1 and
+	// the key version in MARIADB_START_ENCRYPTION_EVENT.
+	GetKey(keyID uint32, keyVersion uint32) ([]byte, error)
+}
+
+// FileKeyProvider is an EncryptionKeyProvider reading the key file of the file_key_management
+// plugin. Every line of the file is "<key id>;<hex key>", the lines starting with '#' are comments.
+// The keys have only one version.
+type FileKeyProvider struct {
+	keys map[uint32][]byte
+}
+
+// NewFileKeyProvider reads the key file like file_key_management_filename. If password is not
+// empty, the file is encrypted with it like file_key_management_filekey, e.g, by
+// "openssl enc -aes-256-cbc -md sha1".
+func NewFileKeyProvider(name string, password string) (*FileKeyProvider, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if password != "" {
+		if data, err = decryptKeyFile(data, password); err != nil {
+			return nil, errors.Annotatef(err, "decrypt key file %s", name)
+		}
+	}
+
+	keys, err := parseKeyFile(data)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse key file %s", name)
+	}
+	return &FileKeyProvider{keys: keys}, nil
+}
+
+func (p *FileKeyProvider) GetKey(keyID uint32, keyVersion uint32) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("key %d not found", keyID)
+	}
+	if keyVersion != 1 {
+		return nil, errors.Errorf("version %d of key %d not found", keyVersion, keyID)
+	}
+	return key, nil
+}
+
+func parseKeyFile(data []byte) (map[uint32][]byte, error) {
+	keys := make(map[uint32][]byte)
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		id, key, ok := strings.Cut(text, ";")
+		if !ok {
+			return nil, errors.Errorf("line %d: the key id and the key must be separated by ';'", line)
+		}
+		keyID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil || keyID == 0 {
+			return nil, errors.Errorf("line %d: invalid key id %q", line, id)
+		}
+		b, err := hex.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, errors.Errorf("line %d: invalid hex key: %v", line, err)
+		}
+		if len(b) != 16 && len(b) != 24 && len(b) != 32 {
+			return nil, errors.Errorf("line %d: invalid key length %d, must be 16, 24 or 32 bytes", line, len(b))
+		}
+		keys[uint32(keyID)] = b
+	}
+	return keys, errors.Trace(s.Err())
+}
+
+// decryptKeyFile decrypts the key file encrypted by "openssl enc -aes-256-cbc -md sha1", which is
+// "Salted__", the 8 bytes salt, and the data with PKCS#7 padding.
+func decryptKeyFile(data []byte, password string) ([]byte, error) {
+	const magic = "Salted__"
+	if len(data) < len(magic)+8+aes.BlockSize || string(data[:len(magic)]) != magic {
+		return nil, errors.New("invalid encrypted key file")
+	}
+	salt := data[len(magic) : len(magic)+8]
+	data = data[len(magic)+8:]
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted key file size")
+	}
+
+	// EVP_BytesToKey with SHA1 and 1 iteration
+	var derived, d []byte
+	for len(derived) < 32+aes.BlockSize {
+		h := sha1.New()
+		h.Write(d)
+		h.Write([]byte(password))
+		h.Write(salt)
+		d = h.Sum(nil)
+		derived = append(derived, d...)
+	}
+
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, derived[32:32+aes.BlockSize]).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("invalid password or encrypted key file")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// binlogDecrypter decrypts the events following the MARIADB_START_ENCRYPTION_EVENT.
+type binlogDecrypter struct {
+	algorithm EncryptionAlgorithm
+	block     cipher.Block
+	nonce     []byte
+}
+
+func newBinlogDecrypter(e *MariadbStartEncryptionEvent, keys EncryptionKeyProvider, algorithm EncryptionAlgorithm) (*binlogDecrypter, error) {
+	if keys == nil {
+		return nil, errors.New("the binlog is encrypted, but no encryption key provider is set")
+	}
+	if e.CryptoScheme != 1 {
+		return nil, errors.Errorf("unsupported binlog crypto scheme %d", e.CryptoScheme)
+	}
+	if algorithm != EncryptionAESCBC && algorithm != EncryptionAESCTR {
+		return nil, errors.Errorf("unsupported encryption algorithm %s", algorithm)
+	}
+
+	key, err := keys.GetKey(binlogEncryptionKeyID, e.KeyVersion)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get binlog key version %d", e.KeyVersion)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &binlogDecrypter{algorithm: algorithm, block: block, nonce: e.Nonce}, nil
+}
+
+// decrypt decrypts the raw event at the position of the binlog file in place.
+//
+// The server encrypts the event from the 5th byte with the timestamp moved into the event size
+// field, then puts the encrypted bytes of the event size field in the place of the timestamp and
+// the plain event size back, so the event can be read without decrypting.
+func (d *binlogDecrypter) decrypt(data []byte, pos uint32) {
+	iv := make([]byte, binlogIVLength)
+	copy(iv, d.nonce)
+	binary.LittleEndian.PutUint32(iv[binlogNonceLength:], pos)
+
+	copy(data[9:13], data[0:4])
+	src := data[4:]
+
+	switch d.algorithm {
+	case EncryptionAESCTR:
+		cipher.NewCTR(d.block, iv).XORKeyStream(src, src)
+	default:
+		n := len(src) / aes.BlockSize * aes.BlockSize
+		cipher.NewCBCDecrypter(d.block, iv).CryptBlocks(src[:n], src[:n])
+		if n < len(src) {
+			mask := make([]byte, aes.BlockSize)
+			d.block.Encrypt(mask, iv)
+			for i := n; i < len(src); i++ {
+				src[i] ^= mask[i-n]
+			}
+		}
+	}
+
+	copy(data[0:4], data[9:13])
+	binary.LittleEndian.PutUint32(data[9:13], uint32(len(data)))
+}
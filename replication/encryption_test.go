@@ -0,0 +1,239 @@
+package replication
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyFile = `# binlog key
+1;a7addd9adea9978fda19f21e6be987880e68ac92632ca052e5bb42b1a506939a
+2;49c16acc2dffe616710c9ba9a10b94944a737de1beccb52dc1560abfdd67388b
+`
+
+// testKeyFile encrypted by "openssl enc -aes-256-cbc -md sha1 -pass pass:secret"
+const testEncryptedKeyFile = "U2FsdGVkX19rFgUtFN4PocxYffrA4jvA+m23NlARrMv7jOEBn59V/u+bq8cLaBJI8179i8qUABCXoHMfL/pv5Xx/81jBmXh7nYE/mY/D3OCzkhSRxlUrtp1jEdfve1Z6uevPXQ0HMaYWuTT6H8rp6U5tw/zyvBZdZSvMFPWs/QlKiHD+4a3lG5lm0jp5yYgRZE0ZppFgu00g8zhdwu63dcG585zXOsBkDjKhDMCOzsI="
+
+func TestFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "keys.txt")
+	require.NoError(t, os.WriteFile(name, []byte(testKeyFile), 0o600))
+	encrypted, err := base64.StdEncoding.DecodeString(testEncryptedKeyFile)
+	require.NoError(t, err)
+	encryptedName := filepath.Join(dir, "keys.enc")
+	require.NoError(t, os.WriteFile(encryptedName, encrypted, 0o600))
+
+	key, err := hex.DecodeString("a7addd9adea9978fda19f21e6be987880e68ac92632ca052e5bb42b1a506939a")
+	require.NoError(t, err)
+
+	keys, err := NewFileKeyProvider(name, "")
+	require.NoError(t, err)
+	k, err := keys.GetKey(1, 1)
+	require.NoError(t, err)
+	require.Equal(t, key, k)
+	_, err = keys.GetKey(1, 2)
+	require.Error(t, err)
+	_, err = keys.GetKey(3, 1)
+	require.Error(t, err)
+
+	keys, err = NewFileKeyProvider(encryptedName, "secret")
+	require.NoError(t, err)
+	k, err = keys.GetKey(1, 1)
+	require.NoError(t, err)
+	require.Equal(t, key, k)
+
+	_, err = NewFileKeyProvider(encryptedName, "wrong")
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(name, []byte("1;abcd\n"), 0o600))
+	_, err = NewFileKeyProvider(name, "")
+	require.ErrorContains(t, err, "invalid key length")
+}
+
+// encryptTestEvent encrypts the raw event at the position like the MariaDB server.
+func encryptTestEvent(block cipher.Block, algorithm EncryptionAlgorithm, nonce []byte, data []byte, pos uint32) {
+	iv := make([]byte, binlogIVLength)
+	copy(iv, nonce)
+	binary.LittleEndian.PutUint32(iv[binlogNonceLength:], pos)
+
+	copy(data[9:13], data[0:4])
+	src := data[4:]
+	if algorithm == EncryptionAESCTR {
+		cipher.NewCTR(block, iv).XORKeyStream(src, src)
+	} else {
+		n := len(src) / aes.BlockSize * aes.BlockSize
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(src[:n], src[:n])
+		mask := make([]byte, aes.BlockSize)
+		block.Encrypt(mask, iv)
+		for i := n; i < len(src); i++ {
+			src[i] ^= mask[i-n]
+		}
+	}
+	copy(data[0:4], data[9:13])
+	binary.LittleEndian.PutUint32(data[9:13], uint32(len(data)))
+}
+
+// writeTestEncryptedBinlog writes an encrypted binlog file and returns the positions of the events.
+func writeTestEncryptedBinlog(t *testing.T, name string, algorithm EncryptionAlgorithm, queries []string) []uint32 {
+	keys, err := NewFileKeyProvider(writeTestKeyFile(t), "")
+	require.NoError(t, err)
+	key, err := keys.GetKey(1, 1)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	nonce := []byte("0123456789ab")
+
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+
+	var positions []uint32
+	write := func(eventType EventType, e Event) {
+		pos := w.Position()
+		ev, err := w.WriteEvent(EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+		if eventType != FORMAT_DESCRIPTION_EVENT && eventType != MARIADB_START_ENCRYPTION_EVENT {
+			encryptTestEvent(block, algorithm, nonce, buf.Bytes()[pos:], pos)
+			require.NotEqual(t, ev.RawData, buf.Bytes()[pos:])
+		}
+		positions = append(positions, pos)
+	}
+
+	write(FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("10.11.6-MariaDB-log", BINLOG_CHECKSUM_ALG_CRC32))
+	write(MARIADB_START_ENCRYPTION_EVENT, &MariadbStartEncryptionEvent{CryptoScheme: 1, KeyVersion: 1, Nonce: nonce})
+	for i, query := range queries {
+		write(QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte(query)})
+		write(XID_EVENT, &XIDEvent{XID: uint64(i)})
+	}
+
+	require.NoError(t, os.WriteFile(name, buf.Bytes(), 0o600))
+	return positions
+}
+
+func writeTestKeyFile(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "keys.txt")
+	require.NoError(t, os.WriteFile(name, []byte(testKeyFile), 0o600))
+	return name
+}
+
+func TestParseEncryptedBinlog(t *testing.T) {
+	// queries of various lengths for the partial last block
+	queries := []string{"BEGIN", "INSERT INTO t VALUES (1)", "UPDATE t SET a = 'abcdefghijklmnopqrstuvwxyz' WHERE id = 2", "COMMIT"}
+
+	for _, algorithm := range []EncryptionAlgorithm{EncryptionAESCBC, EncryptionAESCTR} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "mysql-bin.000001")
+			positions := writeTestEncryptedBinlog(t, name, algorithm, queries)
+
+			keys, err := NewFileKeyProvider(writeTestKeyFile(t), "")
+			require.NoError(t, err)
+
+			parse := func(offset int64) []*BinlogEvent {
+				p := NewBinlogParser()
+				p.SetFlavor("mariadb")
+				p.SetVerifyChecksum(true)
+				p.SetEncryption(keys, algorithm)
+
+				var events []*BinlogEvent
+				require.NoError(t, p.ParseFile(name, offset, func(e *BinlogEvent) error {
+					events = append(events, e)
+					return nil
+				}))
+				return events
+			}
+
+			events := parse(4)
+			require.Len(t, events, 2+2*len(queries))
+			require.IsType(t, &MariadbStartEncryptionEvent{}, events[1].Event)
+			require.Equal(t, uint32(1), events[1].Event.(*MariadbStartEncryptionEvent).KeyVersion)
+			for i, query := range queries {
+				e := events[2+2*i]
+				require.Equal(t, QUERY_EVENT, e.Header.EventType)
+				require.Equal(t, uint32(1700000000), e.Header.Timestamp)
+				require.Equal(t, positions[3+2*i], e.Header.LogPos)
+				require.Equal(t, query, string(e.Event.(*QueryEvent).Query))
+				require.Equal(t, uint64(i), events[3+2*i].Event.(*XIDEvent).XID)
+			}
+
+			// start from the middle of the file
+			events = parse(int64(positions[4]))
+			require.Len(t, events, 2+2*len(queries)-2)
+			require.Equal(t, FORMAT_DESCRIPTION_EVENT, events[0].Header.EventType)
+			require.Equal(t, MARIADB_START_ENCRYPTION_EVENT, events[1].Header.EventType)
+			require.Equal(t, queries[1], string(events[2].Event.(*QueryEvent).Query))
+		})
+	}
+
+	name := filepath.Join(t.TempDir(), "mysql-bin.000001")
+	writeTestEncryptedBinlog(t, name, EncryptionAESCBC, queries)
+	onEvent := func(e *BinlogEvent) error { return nil }
+
+	// no key provider
+	p := NewBinlogParser()
+	require.ErrorContains(t, p.ParseFile(name, 4, onEvent), "no encryption key provider")
+
+	// the wrong algorithm
+	keys, err := NewFileKeyProvider(writeTestKeyFile(t), "")
+	require.NoError(t, err)
+	p = NewBinlogParser()
+	p.SetVerifyChecksum(true)
+	p.SetEncryption(keys, EncryptionAESCTR)
+	require.ErrorContains(t, p.ParseFile(name, 4, onEvent), ErrChecksumMismatch.Error())
+}
+
+func TestParseEncryptedBinlogFixture(t *testing.T) {
+	// generated by testdata/mariadb_encrypted/generate.py like the MariaDB server
+	keys, err := NewFileKeyProvider(filepath.Join("testdata", "mariadb_encrypted", "keys.txt"), "")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		algorithm EncryptionAlgorithm
+	}{
+		{"mysql-bin-aes-cbc.000001", EncryptionAESCBC},
+		{"mysql-bin-aes-ctr.000001", EncryptionAESCTR},
+	} {
+		t.Run(tc.algorithm.String(), func(t *testing.T) {
+			p := NewBinlogParser()
+			p.SetFlavor("mariadb")
+			p.SetVerifyChecksum(true)
+			p.SetEncryption(keys, tc.algorithm)
+
+			var events []*BinlogEvent
+			require.NoError(t, p.ParseFile(filepath.Join("testdata", "mariadb_encrypted", tc.name), 4, func(e *BinlogEvent) error {
+				events = append(events, e)
+				return nil
+			}))
+
+			var types []EventType
+			for _, e := range events {
+				types = append(types, e.Header.EventType)
+				require.Equal(t, uint32(1700000000), e.Header.Timestamp)
+			}
+			require.Equal(t, []EventType{
+				FORMAT_DESCRIPTION_EVENT, MARIADB_START_ENCRYPTION_EVENT,
+				MARIADB_GTID_EVENT, QUERY_EVENT,
+				MARIADB_GTID_EVENT, QUERY_EVENT, QUERY_EVENT, XID_EVENT,
+				ROTATE_EVENT,
+			}, types)
+
+			require.Equal(t, "0-1-1", events[2].Event.(*MariadbGTIDEvent).GTID.String())
+			require.True(t, events[2].Event.(*MariadbGTIDEvent).IsStandalone())
+			require.Equal(t, "CREATE TABLE t (id int PRIMARY KEY, name varchar(64))", string(events[3].Event.(*QueryEvent).Query))
+			require.Equal(t, "test", string(events[3].Event.(*QueryEvent).Schema))
+			require.Equal(t, "0-1-2", events[4].Event.(*MariadbGTIDEvent).GTID.String())
+			require.Equal(t, "INSERT INTO t VALUES (1, 'a')", string(events[5].Event.(*QueryEvent).Query))
+			require.Equal(t, "UPDATE t SET name = 'abcdefghijklmnopqrstuvwxyz' WHERE id = 1", string(events[6].Event.(*QueryEvent).Query))
+			require.Equal(t, uint64(2), events[7].Event.(*XIDEvent).XID)
+			require.Equal(t, "mysql-bin.000002", string(events[8].Event.(*RotateEvent).NextLogName))
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -181,12 +183,8 @@ func (e *FormatDescriptionEvent) Decode(data []byte) error {
 	} else {
 		e.ServerVersion = string(serverVersionRaw[:serverVersionLength])
 	}
-	checksumProduct := checksumVersionProductMysql
-	if strings.Contains(strings.ToLower(e.ServerVersion), "mariadb") {
-		checksumProduct = checksumVersionProductMariaDB
-	}
 
-	if calcVersionProduct(e.ServerVersion) >= checksumProduct {
+	if hasChecksumAlgorithm(e.ServerVersion) {
 		// here, the last 5 bytes is 1 byte check sum alg type and 4 byte checksum if exists
 		e.ChecksumAlgorithm = data[len(data)-5]
 		e.EventTypeHeaderLengths = data[pos : len(data)-5]
@@ -360,7 +358,8 @@ type QueryEvent struct {
 	Query         []byte
 
 	// for mariadb QUERY_COMPRESSED_EVENT
-	compressed bool
+	compressed          bool
+	maxUncompressedSize int64
 
 	// in fact QueryEvent dosen't have the GTIDSet information, just for beneficial to use
 	GSet mysql.GTIDSet
@@ -394,7 +393,7 @@ func (e *QueryEvent) Decode(data []byte) error {
 	pos++
 
 	if e.compressed {
-		decompressedQuery, err := mysql.DecompressMariadbData(data[pos:])
+		decompressedQuery, err := decompressMariadbData(data[pos:], e.maxUncompressedSize)
 		if err != nil {
 			return err
 		}
@@ -405,6 +404,21 @@ func (e *QueryEvent) Decode(data []byte) error {
 	return nil
 }
 
+// decompressMariadbData decompresses the data of a MariaDB compressed event, which is always
+// compressed by zlib, if its uncompressed size is not larger than maxSize, 0 means no limit. It
+// isn't streamed, the size in the header is checked before decompressing into a buffer of it.
+func decompressMariadbData(data []byte, maxSize int64) ([]byte, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]&0x07) {
+		return nil, errors.Errorf("invalid compressed data of %d bytes", len(data))
+	}
+	headerSize := int(data[0] & 0x07)
+	size := mysql.BFixedLengthInt(data[1 : 1+headerSize])
+	if maxSize > 0 && size > uint64(maxSize) {
+		return nil, errors.Errorf("uncompressed size %d exceeds the max uncompressed size %d", size, maxSize)
+	}
+	return mysql.DecompressMariadbData(data)
+}
+
 func (e *QueryEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Slave proxy ID: %d\n", e.SlaveProxyID)
 	fmt.Fprintf(w, "Execution time: %d\n", e.ExecutionTime)
@@ -855,6 +869,32 @@ func (e *MariadbBinlogCheckPointEvent) Dump(w io.Writer) {
 	fmt.Fprintln(w)
 }
 
+// MariadbStartEncryptionEvent is the first event of a MariaDB binlog file encrypted at rest, the
+// following events are encrypted with the key of KeyVersion and the IV from Nonce and the event position.
+// https://mariadb.com/kb/en/start_encryption_event/
+type MariadbStartEncryptionEvent struct {
+	CryptoScheme byte
+	KeyVersion   uint32
+	Nonce        []byte
+}
+
+func (e *MariadbStartEncryptionEvent) Decode(data []byte) error {
+	if len(data) < 1+4+binlogNonceLength {
+		return errors.Errorf("invalid start encryption event size %d", len(data))
+	}
+	e.CryptoScheme = data[0]
+	e.KeyVersion = binary.LittleEndian.Uint32(data[1:])
+	e.Nonce = data[5 : 5+binlogNonceLength]
+	return nil
+}
+
+func (e *MariadbStartEncryptionEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Crypto scheme: %d\n", e.CryptoScheme)
+	fmt.Fprintf(w, "Key version: %d\n", e.KeyVersion)
+	fmt.Fprintf(w, "Nonce: %s\n", hex.EncodeToString(e.Nonce))
+	fmt.Fprintln(w)
+}
+
 type MariadbGTIDEvent struct {
 	GTID     mysql.MariadbGTID
 	Flags    byte
@@ -946,6 +986,331 @@ func (i *IntVarEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Value: %d\n", i.Value)
 }
 
+type RandEvent struct {
+	Seed1 uint64
+	Seed2 uint64
+}
+
+func (e *RandEvent) Decode(data []byte) error {
+	if len(data) < 16 {
+		return errors.Errorf("invalid rand event size %d", len(data))
+	}
+	e.Seed1 = binary.LittleEndian.Uint64(data)
+	e.Seed2 = binary.LittleEndian.Uint64(data[8:])
+	return nil
+}
+
+func (e *RandEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Seed1: %d\n", e.Seed1)
+	fmt.Fprintf(w, "Seed2: %d\n", e.Seed2)
+	fmt.Fprintln(w)
+}
+
+// UserVarEvent is the user variable used by the following statement in the statement-based binlog.
+type UserVarEvent struct {
+	Name   []byte
+	IsNull bool
+
+	Type    UserVarType
+	Charset uint32
+	// []byte for STRING_RESULT, float64 for REAL_RESULT, int64 or uint64 for INT_RESULT,
+	// string or decimal.Decimal (SetUseDecimal) for DECIMAL_RESULT
+	Value interface{}
+	Flags uint8
+
+	useDecimal bool
+}
+
+func (e *UserVarEvent) Decode(data []byte) error {
+	if len(data) < 5 {
+		return errors.Errorf("invalid user var event size %d", len(data))
+	}
+	pos := 0
+	nameLength := int(binary.LittleEndian.Uint32(data))
+	pos += 4
+	if len(data) < pos+nameLength+1 {
+		return errors.Errorf("invalid user var event size %d, name length %d", len(data), nameLength)
+	}
+	e.Name = data[pos : pos+nameLength]
+	pos += nameLength
+	e.IsNull = data[pos] != 0
+	pos++
+	if e.IsNull {
+		return nil
+	}
+
+	if len(data) < pos+9 {
+		return errors.Errorf("invalid user var event size %d", len(data))
+	}
+	e.Type = UserVarType(data[pos])
+	pos++
+	e.Charset = binary.LittleEndian.Uint32(data[pos:])
+	pos += 4
+	valueLength := int(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+	if len(data) < pos+valueLength {
+		return errors.Errorf("invalid user var event size %d, value length %d", len(data), valueLength)
+	}
+	value := data[pos : pos+valueLength]
+	pos += valueLength
+	if pos < len(data) {
+		e.Flags = data[pos]
+	}
+
+	switch e.Type {
+	case STRING_RESULT:
+		e.Value = value
+	case REAL_RESULT:
+		if len(value) != 8 {
+			return errors.Errorf("invalid real user var length %d", len(value))
+		}
+		e.Value = math.Float64frombits(binary.LittleEndian.Uint64(value))
+	case INT_RESULT:
+		if len(value) != 8 {
+			return errors.Errorf("invalid int user var length %d", len(value))
+		}
+		if e.Flags&USER_VAR_UNSIGNED_F != 0 {
+			e.Value = binary.LittleEndian.Uint64(value)
+		} else {
+			e.Value = int64(binary.LittleEndian.Uint64(value))
+		}
+	case DECIMAL_RESULT:
+		if len(value) < 2 {
+			return errors.Errorf("invalid decimal user var length %d", len(value))
+		}
+		v, _, err := decodeDecimal(value[2:], int(value[0]), int(value[1]), e.useDecimal)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		e.Value = v
+	default:
+		return errors.Errorf("unsupported user var type %d", e.Type)
+	}
+	return nil
+}
+
+func (e *UserVarEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Name: %s\n", e.Name)
+	if e.IsNull {
+		fmt.Fprintf(w, "Value: NULL\n")
+	} else {
+		fmt.Fprintf(w, "Type: %d\n", e.Type)
+		fmt.Fprintf(w, "Charset: %d\n", e.Charset)
+		if v, ok := e.Value.([]byte); ok {
+			fmt.Fprintf(w, "Value: %q\n", v)
+		} else {
+			fmt.Fprintf(w, "Value: %v\n", e.Value)
+		}
+		fmt.Fprintf(w, "Flags: %d\n", e.Flags)
+	}
+	fmt.Fprintln(w)
+}
+
+// IncidentEvent tells the replicas something happened on the source that might cause data
+// inconsistency, e.g, some events are lost.
+type IncidentEvent struct {
+	Type    IncidentType
+	Message []byte
+}
+
+func (e *IncidentEvent) Decode(data []byte) error {
+	if len(data) < 2 {
+		return errors.Errorf("invalid incident event size %d", len(data))
+	}
+	e.Type = IncidentType(binary.LittleEndian.Uint16(data))
+	if len(data) > 2 {
+		n := int(data[2])
+		if len(data) < 3+n {
+			return errors.Errorf("invalid incident event size %d, message length %d", len(data), n)
+		}
+		e.Message = data[3 : 3+n]
+	}
+	return nil
+}
+
+func (e *IncidentEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Type: %d\n", e.Type)
+	fmt.Fprintf(w, "Message: %s\n", e.Message)
+	fmt.Fprintln(w)
+}
+
+// XAPrepareEvent ends the binlog of an XA transaction prepared by XA PREPARE, or committed by
+// XA COMMIT ... ONE PHASE. The prepared XA transaction is committed or rolled back by a following
+// XA COMMIT or XA ROLLBACK query event.
+type XAPrepareEvent struct {
+	OnePhase bool
+	FormatID int32
+	GTRID    []byte
+	BQUAL    []byte
+
+	// in fact XAPrepareEvent doesn't have the GTIDSet information, just for beneficial to use
+	GSet mysql.GTIDSet
+}
+
+func (e *XAPrepareEvent) Decode(data []byte) error {
+	if len(data) < 13 {
+		return errors.Errorf("invalid XA prepare event size %d", len(data))
+	}
+	e.OnePhase = data[0] != 0
+	e.FormatID = int32(binary.LittleEndian.Uint32(data[1:]))
+	gtridLength := int(binary.LittleEndian.Uint32(data[5:]))
+	bqualLength := int(binary.LittleEndian.Uint32(data[9:]))
+	if len(data) < 13+gtridLength+bqualLength {
+		return errors.Errorf("invalid XA prepare event size %d, gtrid length %d, bqual length %d", len(data), gtridLength, bqualLength)
+	}
+	e.GTRID = data[13 : 13+gtridLength]
+	e.BQUAL = data[13+gtridLength : 13+gtridLength+bqualLength]
+	return nil
+}
+
+// XID returns the XID like it's written in the XA statements of the binlog, e.g,
+// X'6162',X'63',1, so it can be matched with the XID of the following XA COMMIT.
+func (e *XAPrepareEvent) XID() string {
+	return fmt.Sprintf("X'%x',X'%x',%d", e.GTRID, e.BQUAL, e.FormatID)
+}
+
+func (e *XAPrepareEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "XID: %s\n", e.XID())
+	fmt.Fprintf(w, "One phase: %v\n", e.OnePhase)
+	if e.GSet != nil {
+		fmt.Fprintf(w, "GTIDSet: %s\n", e.GSet.String())
+	}
+	fmt.Fprintln(w)
+}
+
+// ViewChangeEvent is written by the group replication when the membership of the group changes.
+type ViewChangeEvent struct {
+	ViewID    string
+	SeqNumber int64
+	// the certification info, the GTID sets of the written keys
+	CertInfo map[string][]byte
+}
+
+func (e *ViewChangeEvent) Decode(data []byte) error {
+	if len(data) < 52 {
+		return errors.Errorf("invalid view change event size %d", len(data))
+	}
+	e.ViewID = string(bytes.TrimRight(data[:40], "\x00"))
+	e.SeqNumber = int64(binary.LittleEndian.Uint64(data[40:]))
+	count := binary.LittleEndian.Uint32(data[48:])
+	pos := 52
+
+	e.CertInfo = make(map[string][]byte, min(int(count), 1024))
+	for i := uint32(0); i < count; i++ {
+		if len(data) < pos+2 {
+			return errors.Errorf("invalid view change event size %d", len(data))
+		}
+		keyLength := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+keyLength+4 {
+			return errors.Errorf("invalid view change event size %d", len(data))
+		}
+		key := string(data[pos : pos+keyLength])
+		pos += keyLength
+		valueLength := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if len(data) < pos+valueLength {
+			return errors.Errorf("invalid view change event size %d", len(data))
+		}
+		e.CertInfo[key] = data[pos : pos+valueLength]
+		pos += valueLength
+	}
+	return nil
+}
+
+func (e *ViewChangeEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "View ID: %s\n", e.ViewID)
+	fmt.Fprintf(w, "Seq number: %d\n", e.SeqNumber)
+	keys := make([]string, 0, len(e.CertInfo))
+	for k := range e.CertInfo {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "Cert info: %s = %s\n", k, e.CertInfo[k])
+	}
+	fmt.Fprintln(w)
+}
+
+// TransactionContextEvent is written by the group replication for the certification of a transaction.
+type TransactionContextEvent struct {
+	ServerUUID    string
+	ThreadID      uint32
+	GTIDSpecified bool
+	// the GTID set executed when the transaction started
+	SnapshotVersion string
+	WriteSet        [][]byte
+	ReadSet         [][]byte
+}
+
+func (e *TransactionContextEvent) Decode(data []byte) error {
+	if len(data) < 18 {
+		return errors.Errorf("invalid transaction context event size %d", len(data))
+	}
+	serverUUIDLength := int(data[0])
+	e.ThreadID = binary.LittleEndian.Uint32(data[1:])
+	e.GTIDSpecified = data[5] != 0
+	snapshotVersionLength := int(binary.LittleEndian.Uint32(data[6:]))
+	writeSetCount := binary.LittleEndian.Uint32(data[10:])
+	readSetCount := binary.LittleEndian.Uint32(data[14:])
+	pos := 18
+
+	if len(data) < pos+serverUUIDLength+snapshotVersionLength {
+		return errors.Errorf("invalid transaction context event size %d", len(data))
+	}
+	e.ServerUUID = string(data[pos : pos+serverUUIDLength])
+	pos += serverUUIDLength
+	if snapshotVersionLength > 0 {
+		// encoded like the PREVIOUS_GTIDS_EVENT
+		gtids := &PreviousGTIDsEvent{}
+		if err := gtids.Decode(data[pos : pos+snapshotVersionLength]); err != nil {
+			return errors.Annotate(err, "decode snapshot version")
+		}
+		e.SnapshotVersion = gtids.GTIDSets
+	}
+	pos += snapshotVersionLength
+
+	var err error
+	if e.WriteSet, pos, err = decodeTransactionContextSet(data, pos, writeSetCount); err != nil {
+		return errors.Annotate(err, "decode write set")
+	}
+	if e.ReadSet, _, err = decodeTransactionContextSet(data, pos, readSetCount); err != nil {
+		return errors.Annotate(err, "decode read set")
+	}
+	return nil
+}
+
+func decodeTransactionContextSet(data []byte, pos int, count uint32) ([][]byte, int, error) {
+	set := make([][]byte, 0, min(int(count), 1024))
+	for i := uint32(0); i < count; i++ {
+		if len(data) < pos+2 {
+			return nil, pos, errors.Errorf("invalid size %d", len(data))
+		}
+		n := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+n {
+			return nil, pos, errors.Errorf("invalid size %d", len(data))
+		}
+		set = append(set, data[pos:pos+n])
+		pos += n
+	}
+	return set, pos, nil
+}
+
+func (e *TransactionContextEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Server UUID: %s\n", e.ServerUUID)
+	fmt.Fprintf(w, "Thread ID: %d\n", e.ThreadID)
+	fmt.Fprintf(w, "GTID specified: %v\n", e.GTIDSpecified)
+	fmt.Fprintf(w, "Snapshot version: %s\n", e.SnapshotVersion)
+	for _, item := range e.WriteSet {
+		fmt.Fprintf(w, "Write set item: %s\n", item)
+	}
+	for _, item := range e.ReadSet {
+		fmt.Fprintf(w, "Read set item: %s\n", item)
+	}
+	fmt.Fprintln(w)
+}
+
 // HeartbeatEvent is a HEARTBEAT_EVENT or HEARTBEAT_LOG_EVENT_V2
 // https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_replication_binlog_event.html#sect_protocol_replication_event_heartbeat
 type HeartbeatEvent struct {
@@ -0,0 +1,243 @@
+package replication
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/errors"
+)
+
+// EventEncoder is implemented by the events which can be serialized back into
+// the binlog format. Encode returns the event body (post-header and payload),
+// without the common event header and the checksum.
+type EventEncoder interface {
+	Encode() ([]byte, error)
+}
+
+// Encode encodes the common event header.
+func (h *EventHeader) Encode() []byte {
+	data := make([]byte, EventHeaderSize)
+
+	binary.LittleEndian.PutUint32(data[0:], h.Timestamp)
+	data[4] = byte(h.EventType)
+	binary.LittleEndian.PutUint32(data[5:], h.ServerID)
+	binary.LittleEndian.PutUint32(data[9:], h.EventSize)
+	binary.LittleEndian.PutUint32(data[13:], h.LogPos)
+	binary.LittleEndian.PutUint16(data[17:], h.Flags)
+
+	return data
+}
+
+// mysql80EventTypeHeaderLengths is the post-header length of every event type
+// written by MySQL 8.0, indexed by EventType - 1.
+var mysql80EventTypeHeaderLengths = []byte{
+	0x38, 0x0d, 0x00, 0x08, 0x00, 0x12, 0x00, 0x04, 0x04, 0x04,
+	0x04, 0x12, 0x00, 0x00, 0x5c, 0x00, 0x04, 0x1a, 0x08, 0x00,
+	0x00, 0x00, 0x08, 0x08, 0x08, 0x02, 0x00, 0x00, 0x00, 0x0a,
+	0x0a, 0x0a, 0x19, 0x19, 0x00, 0x12, 0x34, 0x00, 0x0a, 0x28,
+	0x00,
+}
+
+// NewFormatDescriptionEvent returns a binlog v4 FormatDescriptionEvent using the
+// MySQL 8.0 post-header lengths, it is usually the first event written by a BinlogWriter.
+func NewFormatDescriptionEvent(serverVersion string, checksumAlgorithm byte) *FormatDescriptionEvent {
+	return &FormatDescriptionEvent{
+		Version:                4,
+		ServerVersion:          serverVersion,
+		EventHeaderLength:      EventHeaderSize,
+		EventTypeHeaderLengths: append([]byte(nil), mysql80EventTypeHeaderLengths...),
+		ChecksumAlgorithm:      checksumAlgorithm,
+	}
+}
+
+// hasChecksumAlgorithm reports whether the FORMAT_DESCRIPTION_EVENT written by
+// a server of this version carries the checksum algorithm.
+func hasChecksumAlgorithm(serverVersion string) bool {
+	checksumProduct := checksumVersionProductMysql
+	if strings.Contains(strings.ToLower(serverVersion), "mariadb") {
+		checksumProduct = checksumVersionProductMariaDB
+	}
+
+	return calcVersionProduct(serverVersion) >= checksumProduct
+}
+
+// Encode encodes the FormatDescriptionEvent. The checksum algorithm is included
+// if the server version supports it, the trailing checksum is added by the BinlogWriter.
+func (e *FormatDescriptionEvent) Encode() ([]byte, error) {
+	if len(e.ServerVersion) >= 50 {
+		return nil, errors.Errorf("server version %q is too long", e.ServerVersion)
+	}
+
+	data := make([]byte, 0, 2+50+4+1+len(e.EventTypeHeaderLengths)+1)
+	data = binary.LittleEndian.AppendUint16(data, e.Version)
+
+	serverVersion := make([]byte, 50)
+	copy(serverVersion, e.ServerVersion)
+	data = append(data, serverVersion...)
+
+	data = binary.LittleEndian.AppendUint32(data, e.CreateTimestamp)
+
+	headerLength := e.EventHeaderLength
+	if headerLength == 0 {
+		headerLength = EventHeaderSize
+	}
+	data = append(data, headerLength)
+	data = append(data, e.EventTypeHeaderLengths...)
+
+	if hasChecksumAlgorithm(e.ServerVersion) {
+		data = append(data, e.ChecksumAlgorithm)
+	}
+
+	return data, nil
+}
+
+func (e *RotateEvent) Encode() ([]byte, error) {
+	data := make([]byte, 0, 8+len(e.NextLogName))
+	data = binary.LittleEndian.AppendUint64(data, e.Position)
+	data = append(data, e.NextLogName...)
+
+	return data, nil
+}
+
+// Encode encodes the PreviousGTIDsEvent. Only the classic (non-tagged) format is supported,
+// the UUID sets are written in ascending order.
+func (e *PreviousGTIDsEvent) Encode() ([]byte, error) {
+	gset, err := mysql.ParseMysqlGTIDSet(e.GTIDSets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	sets := gset.(*mysql.MysqlGTIDSet).Sets
+	sids := make([]string, 0, len(sets))
+	for sid := range sets {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(sids)))
+	for _, sid := range sids {
+		data = append(data, sets[sid].Encode()...)
+	}
+
+	return data, nil
+}
+
+func (e *XIDEvent) Encode() ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(nil, e.XID), nil
+}
+
+func (e *QueryEvent) Encode() ([]byte, error) {
+	if e.compressed {
+		return nil, errors.New("encoding MariaDB compressed query event is not supported")
+	}
+	if len(e.Schema) > 255 {
+		return nil, errors.Errorf("schema %q is too long", e.Schema)
+	}
+	if len(e.StatusVars) > 0xffff {
+		return nil, errors.Errorf("status vars length %d is too long", len(e.StatusVars))
+	}
+
+	data := make([]byte, 0, 13+len(e.StatusVars)+len(e.Schema)+1+len(e.Query))
+	data = binary.LittleEndian.AppendUint32(data, e.SlaveProxyID)
+	data = binary.LittleEndian.AppendUint32(data, e.ExecutionTime)
+	data = append(data, byte(len(e.Schema)))
+	data = binary.LittleEndian.AppendUint16(data, e.ErrorCode)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(e.StatusVars)))
+	data = append(data, e.StatusVars...)
+	data = append(data, e.Schema...)
+	data = append(data, 0x00)
+	data = append(data, e.Query...)
+
+	return data, nil
+}
+
+// Encode encodes the GTIDEvent. The logical timestamps are always written, while the
+// commit timestamps, transaction length and server versions introduced in MySQL 8.0 are
+// only written if the ImmediateCommitTimestamp is set.
+func (e *GTIDEvent) Encode() ([]byte, error) {
+	if len(e.SID) != SidLength {
+		return nil, errors.Errorf("invalid SID length %d, must %d", len(e.SID), SidLength)
+	}
+	if e.Tag != "" {
+		return nil, errors.New("encoding tagged GTID event is not supported")
+	}
+
+	data := make([]byte, 0, 1+SidLength+8+1+16+14+9+8)
+	data = append(data, e.CommitFlag)
+	data = append(data, e.SID...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.GNO))
+
+	data = append(data, LogicalTimestampTypeCode)
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.LastCommitted))
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.SequenceNumber))
+
+	if e.ImmediateCommitTimestamp == 0 {
+		return data, nil
+	}
+
+	if e.OriginalCommitTimestamp != e.ImmediateCommitTimestamp {
+		data = appendUint56(data, e.ImmediateCommitTimestamp|uint64(1)<<55)
+		data = appendUint56(data, e.OriginalCommitTimestamp)
+	} else {
+		data = appendUint56(data, e.ImmediateCommitTimestamp)
+	}
+
+	data = mysql.AppendLengthEncodedInteger(data, e.TransactionLength)
+
+	immediateServerVersion := e.ImmediateServerVersion
+	originalServerVersion := e.OriginalServerVersion
+	if immediateServerVersion == 0 {
+		immediateServerVersion = UndefinedServerVer
+	}
+	if originalServerVersion == 0 {
+		originalServerVersion = immediateServerVersion
+	}
+	if originalServerVersion != immediateServerVersion {
+		data = binary.LittleEndian.AppendUint32(data, immediateServerVersion|uint32(1)<<31)
+		data = binary.LittleEndian.AppendUint32(data, originalServerVersion)
+	} else {
+		data = binary.LittleEndian.AppendUint32(data, immediateServerVersion)
+	}
+
+	return data, nil
+}
+
+func appendUint56(data []byte, v uint64) []byte {
+	return append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40), byte(v>>48))
+}
+
+func (i *IntVarEvent) Encode() ([]byte, error) {
+	data := []byte{byte(i.Type)}
+	return binary.LittleEndian.AppendUint64(data, i.Value), nil
+}
+
+// Encode encodes the MariadbGTIDEvent, the server id of the GTID is in the event header.
+func (e *MariadbGTIDEvent) Encode() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint64(nil, e.GTID.SequenceNumber)
+	data = binary.LittleEndian.AppendUint32(data, e.GTID.DomainID)
+	data = append(data, e.Flags)
+	if e.Flags&BINLOG_MARIADB_FL_GROUP_COMMIT_ID != 0 {
+		return binary.LittleEndian.AppendUint64(data, e.CommitID), nil
+	}
+	// the unused commit id
+	return append(data, make([]byte, 6)...), nil
+}
+
+func (e *MariadbAnnotateRowsEvent) Encode() ([]byte, error) {
+	return append([]byte(nil), e.Query...), nil
+}
+
+func (e *GenericEvent) Encode() ([]byte, error) {
+	return append([]byte(nil), e.Data...), nil
+}
+
+func (e *MariadbStartEncryptionEvent) Encode() ([]byte, error) {
+	if len(e.Nonce) != binlogNonceLength {
+		return nil, errors.Errorf("invalid nonce length %d, must be %d", len(e.Nonce), binlogNonceLength)
+	}
+	data := []byte{e.CryptoScheme}
+	data = binary.LittleEndian.AppendUint32(data, e.KeyVersion)
+	return append(data, e.Nonce...), nil
+}
@@ -1,9 +1,12 @@
 package replication
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"testing"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -253,3 +256,128 @@ func TestHeartbeatEvent(t *testing.T) {
 		}
 	}
 }
+
+func TestRandEvent(t *testing.T) {
+	ev := RandEvent{}
+	require.NoError(t, ev.Decode([]byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}))
+	require.Equal(t, uint64(1), ev.Seed1)
+	require.Equal(t, uint64(2), ev.Seed2)
+	require.Error(t, ev.Decode([]byte{1, 0, 0, 0}))
+}
+
+func TestUserVarEvent(t *testing.T) {
+	userVar := func(name string, isNull bool, typ UserVarType, value []byte, flags ...byte) []byte {
+		data := binary.LittleEndian.AppendUint32(nil, uint32(len(name)))
+		data = append(data, name...)
+		if isNull {
+			return append(data, 1)
+		}
+		data = append(data, 0, byte(typ))
+		data = binary.LittleEndian.AppendUint32(data, 45) // utf8mb4_general_ci
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+		data = append(data, value...)
+		return append(data, flags...)
+	}
+
+	testcases := []struct {
+		data  []byte
+		value interface{}
+	}{
+		{userVar("a", true, 0, nil), nil},
+		{userVar("s", false, STRING_RESULT, []byte("abc")), []byte("abc")},
+		{userVar("r", false, REAL_RESULT, binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5))), 1.5},
+		{userVar("i", false, INT_RESULT, binary.LittleEndian.AppendUint64(nil, uint64(1<<64-1))), int64(-1)},
+		{userVar("u", false, INT_RESULT, binary.LittleEndian.AppendUint64(nil, uint64(1<<64-1)), USER_VAR_UNSIGNED_F), uint64(1<<64 - 1)},
+		// DECIMAL(4,2) 12.34
+		{userVar("d", false, DECIMAL_RESULT, []byte{4, 2, 0x80 | 12, 34}), "12.34"},
+	}
+	for _, tc := range testcases {
+		ev := UserVarEvent{}
+		require.NoError(t, ev.Decode(tc.data))
+		require.Equal(t, tc.value == nil, ev.IsNull)
+		require.Equal(t, tc.value, ev.Value, string(ev.Name))
+	}
+
+	ev := UserVarEvent{useDecimal: true}
+	require.NoError(t, ev.Decode(userVar("d", false, DECIMAL_RESULT, []byte{4, 2, 0x80 | 12, 34})))
+	require.Equal(t, "12.34", ev.Value.(decimal.Decimal).String())
+
+	require.Error(t, ev.Decode(userVar("d", false, INT_RESULT, []byte{1})))
+}
+
+func TestIncidentEvent(t *testing.T) {
+	ev := IncidentEvent{}
+	require.NoError(t, ev.Decode([]byte{1, 0, 4, 'l', 'o', 's', 't'}))
+	require.Equal(t, INCIDENT_LOST_EVENTS, ev.Type)
+	require.Equal(t, []byte("lost"), ev.Message)
+	require.Error(t, ev.Decode([]byte{1, 0, 5, 'l', 'o', 's', 't'}))
+}
+
+func TestXAPrepareEvent(t *testing.T) {
+	// XA PREPARE 'ab', 'c', 1
+	data := []byte{0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 'a', 'b', 'c'}
+	ev := XAPrepareEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.False(t, ev.OnePhase)
+	require.Equal(t, int32(1), ev.FormatID)
+	require.Equal(t, []byte("ab"), ev.GTRID)
+	require.Equal(t, []byte("c"), ev.BQUAL)
+	require.Equal(t, "X'6162',X'63',1", ev.XID())
+
+	// XA COMMIT 'ab' ONE PHASE
+	data = []byte{1, 1, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 'a', 'b'}
+	ev = XAPrepareEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.True(t, ev.OnePhase)
+	require.Equal(t, "X'6162',X'',1", ev.XID())
+
+	require.Error(t, ev.Decode(data[:14]))
+}
+
+func TestViewChangeEvent(t *testing.T) {
+	data := make([]byte, 40)
+	copy(data, "17123456789012345:1")
+	data = binary.LittleEndian.AppendUint64(data, 5)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 3)
+	data = append(data, "key"...)
+	data = binary.LittleEndian.AppendUint32(data, 5)
+	data = append(data, "value"...)
+
+	ev := ViewChangeEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, "17123456789012345:1", ev.ViewID)
+	require.Equal(t, int64(5), ev.SeqNumber)
+	require.Equal(t, map[string][]byte{"key": []byte("value")}, ev.CertInfo)
+
+	require.Error(t, ev.Decode(data[:len(data)-1]))
+}
+
+func TestTransactionContextEvent(t *testing.T) {
+	serverUUID := "896e7882-18fe-11ef-ab88-22222d34d411"
+	snapshot := []byte{0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x89, 0x6e, 0x78, 0x82, 0x18, 0xfe, 0x11, 0xef, 0xab, 0x88, 0x22, 0x22, 0x2d, 0x34, 0xd4, 0x11, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+
+	data := []byte{byte(len(serverUUID))}
+	data = binary.LittleEndian.AppendUint32(data, 12)
+	data = append(data, 1)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(snapshot)))
+	data = binary.LittleEndian.AppendUint32(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, serverUUID...)
+	data = append(data, snapshot...)
+	for _, item := range []string{"w1", "w2"} {
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(item)))
+		data = append(data, item...)
+	}
+
+	ev := TransactionContextEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, serverUUID, ev.ServerUUID)
+	require.Equal(t, uint32(12), ev.ThreadID)
+	require.True(t, ev.GTIDSpecified)
+	require.Equal(t, "896e7882-18fe-11ef-ab88-22222d34d411:1-3", ev.SnapshotVersion)
+	require.Equal(t, [][]byte{[]byte("w1"), []byte("w2")}, ev.WriteSet)
+	require.Empty(t, ev.ReadSet)
+
+	require.Error(t, ev.Decode(data[:len(data)-1]))
+}
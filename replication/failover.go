@@ -0,0 +1,206 @@
+package replication
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// BinlogSource is the address of a server to sync the binlog from.
+type BinlogSource struct {
+	Host string
+	Port uint16
+}
+
+func (s BinlogSource) addr() string {
+	if s.Port != 0 {
+		return net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
+	}
+	return s.Host
+}
+
+// String implements fmt.Stringer interface.
+func (s BinlogSource) String() string {
+	return s.addr()
+}
+
+// sources returns the server of Host and Port, and the candidates to fail over to.
+func (b *BinlogSyncer) sources() []BinlogSource {
+	return append([]BinlogSource{{Host: b.cfg.Host, Port: b.cfg.Port}}, b.cfg.Candidates...)
+}
+
+// CurrentSource returns the server the syncer syncs from, which is changed by failover.
+func (b *BinlogSyncer) CurrentSource() BinlogSource {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	return b.sources()[b.sourceIndex]
+}
+
+// failover switches to the first available candidate which has all the transactions of gset.
+func (b *BinlogSyncer) failover(gset mysql.GTIDSet) error {
+	sources := b.sources()
+	for i := 1; i < len(sources); i++ {
+		index := (b.sourceIndex + i) % len(sources)
+		if err := b.checkSource(sources[index], gset); err != nil {
+			b.cfg.Logger.Warn("skip the unavailable binlog source", slog.String("source", sources[index].String()), slog.Any("error", err))
+			continue
+		}
+
+		b.cfg.Logger.Info("fail over to binlog source", slog.String("from", sources[b.sourceIndex].String()), slog.String("to", sources[index].String()))
+		b.sourceIndex = index
+		// the last connection is on the old source
+		b.lastConnectionID = 0
+		return nil
+	}
+	return errors.Errorf("no available binlog source has the GTID set %s", gset)
+}
+
+// checkSource returns an error if the source is down, or doesn't have all the transactions of gset.
+func (b *BinlogSyncer) checkSource(source BinlogSource, gset mysql.GTIDSet) error {
+	c, err := b.connect(b.ctx, source)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer c.Close()
+
+	query := "SELECT @@GLOBAL.gtid_executed"
+	flavor := mysql.MySQLFlavor
+	if b.cfg.Flavor == mysql.MariaDBFlavor {
+		query = "SELECT @@GLOBAL.gtid_binlog_pos"
+		flavor = mysql.MariaDBFlavor
+	}
+	r, err := c.Execute(query)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s, err := r.GetString(0, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	executed, err := mysql.ParseGTIDSet(flavor, s)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if !containGTIDSet(executed, gset) {
+		return errors.Errorf("the executed GTID set %s doesn't contain %s", executed, gset)
+	}
+	return nil
+}
+
+// containGTIDSet returns whether the executed GTID set of a server contains gset. The
+// gtid_binlog_pos of MariaDB only has the last GTID of every domain, so the sequence numbers are
+// compared per domain.
+func containGTIDSet(executed, gset mysql.GTIDSet) bool {
+	e, ok := executed.(*mysql.MariadbGTIDSet)
+	if !ok {
+		return executed.Contain(gset)
+	}
+	g, ok := gset.(*mysql.MariadbGTIDSet)
+	if !ok {
+		return false
+	}
+
+	lastSequenceNumber := func(s *mysql.MariadbGTIDSet, domainID uint32) (seq uint64) {
+		for _, gtid := range s.Sets[domainID] {
+			seq = max(seq, gtid.SequenceNumber)
+		}
+		return seq
+	}
+	for domainID := range g.Sets {
+		if lastSequenceNumber(e, domainID) < lastSequenceNumber(g, domainID) {
+			return false
+		}
+	}
+	return true
+}
+
+// resumeTracker tracks the delivered events of the transaction in progress. If the connection is
+// broken in the middle of a transaction, the syncer re-syncs from the GTID set before it, and the
+// events of it delivered before are skipped after verified, otherwise the syncer re-syncs from the
+// GTID set after it, so no event is lost or delivered twice.
+type resumeTracker struct {
+	boundary transactionBoundary
+	// the GTID event of the transaction in progress, nil if there is none
+	gtid Event
+	// the types of the delivered events of the transaction in progress
+	events []EventType
+	// the number of the events to skip after the re-sync
+	skip int
+}
+
+// inTransaction returns whether a transaction is in progress.
+func (t *resumeTracker) inTransaction() bool {
+	return t.gtid != nil
+}
+
+// resume is called before re-syncing from the GTID set before the transaction in progress.
+func (t *resumeTracker) resume() {
+	t.skip = len(t.events)
+}
+
+// reset is called before syncing from a new GTID set.
+func (t *resumeTracker) reset() {
+	t.gtid = nil
+	t.events = t.events[:0]
+	t.skip = 0
+}
+
+// track tracks the event, and returns true if it was delivered before and should be skipped.
+func (t *resumeTracker) track(e *BinlogEvent) (bool, error) {
+	switch e.Event.(type) {
+	case *FormatDescriptionEvent, *RotateEvent, *PreviousGTIDsEvent, *HeartbeatEvent,
+		*MariadbGTIDListEvent, *MariadbBinlogCheckPointEvent:
+		// sent on every connection, or between the transactions
+		return false, nil
+	}
+
+	if t.skip > 0 {
+		i := len(t.events) - t.skip
+		if e.Header.EventType != t.events[i] || (i == 0 && !sameGTIDEvent(t.gtid, e.Event)) {
+			return false, errors.Errorf("the interrupted transaction is different after re-sync, expect %s, got %s",
+				t.events[i], e.Header.EventType)
+		}
+		t.skip--
+		return true, nil
+	}
+
+	switch e.Event.(type) {
+	case *GTIDEvent, *GtidTaggedLogEvent, *MariadbGTIDEvent:
+		t.gtid = e.Event
+		t.events = append(t.events[:0], e.Header.EventType)
+		t.boundary.begin(e.Event)
+		return false, nil
+	}
+	if t.gtid == nil {
+		return false, nil
+	}
+
+	t.events = append(t.events, e.Header.EventType)
+	if t.boundary.end(e.Event) {
+		t.gtid = nil
+		t.events = t.events[:0]
+	}
+	return false, nil
+}
+
+func sameGTIDEvent(a, b Event) bool {
+	switch a := a.(type) {
+	case *GTIDEvent:
+		b, ok := b.(*GTIDEvent)
+		return ok && a.GNO == b.GNO && bytes.Equal(a.SID, b.SID)
+	case *GtidTaggedLogEvent:
+		b, ok := b.(*GtidTaggedLogEvent)
+		return ok && a.GNO == b.GNO && a.Tag == b.Tag && bytes.Equal(a.SID, b.SID)
+	case *MariadbGTIDEvent:
+		b, ok := b.(*MariadbGTIDEvent)
+		return ok && a.GTID == b.GTID
+	}
+	return false
+}
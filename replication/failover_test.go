@@ -0,0 +1,90 @@
+package replication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestResumeTracker(t *testing.T) {
+	gtid := func(gno int64) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: GTID_EVENT}, Event: &GTIDEvent{SID: testTransactionSID[:], GNO: gno}}
+	}
+	query := func(q string) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte(q)}}
+	}
+	rows := &BinlogEvent{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2}, Event: &RowsEvent{}}
+	xid := &BinlogEvent{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{}}
+	rotate := &BinlogEvent{Header: &EventHeader{EventType: ROTATE_EVENT}, Event: &RotateEvent{}}
+
+	track := func(tr *resumeTracker, e *BinlogEvent) bool {
+		skip, err := tr.track(e)
+		require.NoError(t, err)
+		return skip
+	}
+
+	var tr resumeTracker
+	for _, e := range []*BinlogEvent{gtid(1), query("BEGIN"), rows, xid} {
+		require.False(t, track(&tr, e))
+	}
+	require.False(t, tr.inTransaction())
+
+	// a DDL ends the transaction
+	require.False(t, track(&tr, gtid(2)))
+	require.False(t, track(&tr, query("CREATE TABLE t (id int)")))
+	require.False(t, tr.inTransaction())
+
+	// interrupted after the rows event
+	for _, e := range []*BinlogEvent{gtid(3), query("BEGIN"), rows} {
+		require.False(t, track(&tr, e))
+	}
+	require.True(t, tr.inTransaction())
+	tr.resume()
+	// interrupted again while skipping
+	require.False(t, track(&tr, rotate))
+	require.True(t, track(&tr, gtid(3)))
+	tr.resume()
+	for _, e := range []*BinlogEvent{gtid(3), query("BEGIN"), rows} {
+		require.True(t, track(&tr, e))
+	}
+	require.False(t, track(&tr, rows))
+	require.False(t, track(&tr, xid))
+	require.False(t, tr.inTransaction())
+
+	// a different transaction is sent after re-sync
+	for _, e := range []*BinlogEvent{gtid(4), query("BEGIN")} {
+		require.False(t, track(&tr, e))
+	}
+	tr.resume()
+	_, err := tr.track(gtid(5))
+	require.ErrorContains(t, err, "the interrupted transaction is different")
+
+	// the same GTID with different events
+	tr.reset()
+	for _, e := range []*BinlogEvent{gtid(4), query("BEGIN")} {
+		require.False(t, track(&tr, e))
+	}
+	tr.resume()
+	require.True(t, track(&tr, gtid(4)))
+	_, err = tr.track(rows)
+	require.ErrorContains(t, err, "expect QueryEvent, got WriteRowsEventV2")
+}
+
+func TestContainGTIDSet(t *testing.T) {
+	parse := func(flavor, s string) mysql.GTIDSet {
+		gset, err := mysql.ParseGTIDSet(flavor, s)
+		require.NoError(t, err)
+		return gset
+	}
+
+	sid := testTransactionSID.String()
+	require.True(t, containGTIDSet(parse(mysql.MySQLFlavor, sid+":1-10"), parse(mysql.MySQLFlavor, sid+":1-5")))
+	require.False(t, containGTIDSet(parse(mysql.MySQLFlavor, sid+":1-4"), parse(mysql.MySQLFlavor, sid+":1-5")))
+
+	// the sequence numbers of the domain are compared regardless of the server id
+	require.True(t, containGTIDSet(parse(mysql.MariaDBFlavor, "0-2-10,1-1-3"), parse(mysql.MariaDBFlavor, "0-1-8")))
+	require.False(t, containGTIDSet(parse(mysql.MariaDBFlavor, "0-2-10"), parse(mysql.MariaDBFlavor, "0-1-8,1-1-3")))
+	require.False(t, containGTIDSet(parse(mysql.MariaDBFlavor, "0-2-7"), parse(mysql.MariaDBFlavor, "0-1-8")))
+}
@@ -0,0 +1,179 @@
+package replication
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/pingcap/errors"
+)
+
+// EventFilter drops the events in BinlogSyncer before they're sent to BinlogStreamer. The rows of
+// the rows events of the dropped tables are not decoded at all, the table is known by the cached
+// TableMapEvent, which saves the CPU if only a few tables of many are needed.
+//
+// The events starting or ending the transactions, like GTIDEvent, XIDEvent and the QueryEvent of
+// BEGIN, COMMIT or DDL, and the events between the transactions, like RotateEvent, are never
+// dropped, so the transactions are still complete and the positions and GTID sets are right.
+// The filter is not used in the raw mode, e.g, StartBackup.
+type EventFilter struct {
+	// IncludeTableRegex and ExcludeTableRegex filter the TableMapEvent and the rows events by the
+	// table name "schema.table" like the table filter of canal. A table is kept if it matches any of
+	// IncludeTableRegex, or IncludeTableRegex is empty, and it matches none of ExcludeTableRegex.
+	IncludeTableRegex []string
+	ExcludeTableRegex []string
+
+	// IncludeEventTypes keeps only the events of the types if it's not empty, and ExcludeEventTypes
+	// drops the events of the types.
+	IncludeEventTypes []EventType
+	ExcludeEventTypes []EventType
+}
+
+func (f *EventFilter) isZero() bool {
+	return len(f.IncludeTableRegex) == 0 && len(f.ExcludeTableRegex) == 0 &&
+		len(f.IncludeEventTypes) == 0 && len(f.ExcludeEventTypes) == 0
+}
+
+// eventFilter is the compiled EventFilter.
+type eventFilter struct {
+	include, exclude []*regexp.Regexp
+	// the table names matched, nil if the tables are not filtered
+	tables map[string]bool
+	// the buffer of the table name
+	key []byte
+
+	// the dropped event types, typesFiltered is false if no type is dropped
+	dropTypes     [256]bool
+	typesFiltered bool
+	boundary      transactionBoundary
+}
+
+// newEventFilter compiles the filter, it returns nil if nothing is filtered.
+func newEventFilter(cfg EventFilter) (*eventFilter, error) {
+	if cfg.isZero() {
+		return nil, nil
+	}
+
+	f := &eventFilter{}
+	var err error
+	if f.include, err = compileRegexps(cfg.IncludeTableRegex); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if f.exclude, err = compileRegexps(cfg.ExcludeTableRegex); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if f.include != nil || f.exclude != nil {
+		f.tables = make(map[string]bool)
+	}
+
+	if len(cfg.IncludeEventTypes) > 0 {
+		for i := range f.dropTypes {
+			f.dropTypes[i] = true
+		}
+		for _, t := range cfg.IncludeEventTypes {
+			f.dropTypes[t] = false
+		}
+	}
+	for _, t := range cfg.ExcludeEventTypes {
+		f.dropTypes[t] = true
+	}
+	f.typesFiltered = slices.Contains(f.dropTypes[:], true)
+	return f, nil
+}
+
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	regs := make([]*regexp.Regexp, len(exprs))
+	for i, expr := range exprs {
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		regs[i] = reg
+	}
+	return regs, nil
+}
+
+// keep returns whether the event is kept. It must be called for every event in order, to find
+// the boundaries of the transactions. The events in a TransactionPayloadEvent are filtered too.
+func (f *eventFilter) keep(e *BinlogEvent) bool {
+	var table *TableMapEvent
+	switch ev := e.Event.(type) {
+	case *FormatDescriptionEvent, *RotateEvent, *PreviousGTIDsEvent, *MariadbGTIDListEvent,
+		*MariadbBinlogCheckPointEvent, *HeartbeatEvent:
+		return true
+	case *GTIDEvent, *GtidTaggedLogEvent, *MariadbGTIDEvent, *XIDEvent, *XAPrepareEvent:
+		f.boundary.begin(ev)
+		return true
+	case *TransactionPayloadEvent:
+		ev.Events = slices.DeleteFunc(ev.Events, func(pe *BinlogEvent) bool {
+			return !f.keep(pe)
+		})
+		f.boundary.begin(ev)
+		return true
+	case *QueryEvent:
+		if !f.typesFiltered {
+			return true
+		}
+		if f.boundary.end(ev) {
+			// COMMIT, ROLLBACK or DDL
+			f.boundary.begin(ev)
+			return true
+		}
+		if isBlockStart(ev.Query) {
+			// BEGIN or XA START
+			return true
+		}
+	case *TableMapEvent:
+		table = ev
+	case *RowsEvent:
+		table = ev.Table
+	}
+
+	if f.dropTypes[e.Header.EventType] {
+		return false
+	}
+	return table == nil || f.keepTable(table)
+}
+
+// keepTable returns whether the events of the table are kept.
+func (f *eventFilter) keepTable(table *TableMapEvent) bool {
+	if f.tables == nil {
+		return true
+	}
+
+	f.key = append(f.key[:0], table.Schema...)
+	f.key = append(f.key, '.')
+	f.key = append(f.key, table.Table...)
+	if matched, ok := f.tables[string(f.key)]; ok {
+		return matched
+	}
+
+	key := string(f.key)
+	matched := f.include == nil
+	for _, reg := range f.include {
+		if reg.MatchString(key) {
+			matched = true
+			break
+		}
+	}
+	if matched {
+		for _, reg := range f.exclude {
+			if reg.MatchString(key) {
+				matched = false
+				break
+			}
+		}
+	}
+	f.tables[key] = matched
+	return matched
+}
+
+// keepRows returns whether the rows of the rows event are decoded, the header must be decoded.
+func (f *eventFilter) keepRows(e *RowsEvent) bool {
+	if f.dropTypes[e.eventType] {
+		return false
+	}
+	return e.Table == nil || f.keepTable(e.Table)
+}
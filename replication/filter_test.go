@@ -0,0 +1,178 @@
+package replication
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// writeTestFilterBinlog writes a transaction for every table of test.t1, test.t2 and other.t1,
+// and a DDL of test.t2.
+func writeTestFilterBinlog(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	write := func(eventType EventType, e Event) {
+		_, err := w.WriteEvent(EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+	}
+
+	write(FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_CRC32))
+	write(PREVIOUS_GTIDS_EVENT, &PreviousGTIDsEvent{})
+
+	sid := uuid.MustParse("3ccc1f06-4b5d-11ee-8b49-0242ac110002")
+	gno := int64(0)
+	for i, name := range []string{"test.t1", "test.t2", "other.t1"} {
+		schema, table, _ := bytes.Cut([]byte(name), []byte("."))
+		tableMap := &TableMapEvent{
+			TableID:     uint64(100 + i),
+			Schema:      schema,
+			Table:       table,
+			ColumnCount: 2,
+			ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR},
+			ColumnMeta:  []uint16{0, 255},
+			NullBitmap:  []byte{0x02},
+		}
+
+		gno++
+		write(GTID_EVENT, &GTIDEvent{SID: sid[:], GNO: gno, LastCommitted: gno - 1, SequenceNumber: gno})
+		write(QUERY_EVENT, &QueryEvent{Schema: schema, Query: []byte("BEGIN")})
+		write(TABLE_MAP_EVENT, tableMap)
+		write(WRITE_ROWS_EVENTv2, NewRowsEvent(WRITE_ROWS_EVENTv2, tableMap, [][]interface{}{{int32(i), name}}))
+		write(XID_EVENT, &XIDEvent{XID: uint64(gno)})
+	}
+
+	gno++
+	write(GTID_EVENT, &GTIDEvent{SID: sid[:], GNO: gno, LastCommitted: gno - 1, SequenceNumber: gno})
+	write(QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("ALTER TABLE t2 ADD COLUMN c INT")})
+	return buf.Bytes()
+}
+
+// filterTestBinlog parses the binlog with the filter of the syncer, and returns the kept events.
+func filterTestBinlog(t *testing.T, data []byte, filter EventFilter) []*BinlogEvent {
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 100, Filter: filter})
+	require.NoError(t, b.resetFilter())
+	require.NotNil(t, b.filter)
+
+	var events []*BinlogEvent
+	err := b.parser.ParseReader(bytes.NewReader(data[len(BinLogFileHeader):]), func(e *BinlogEvent) error {
+		if re, ok := e.Event.(*RowsEvent); ok {
+			// the rows are decoded only if the event is kept
+			require.Equal(t, b.filter.keepRows(re), re.Rows != nil)
+		}
+		if b.filter.keep(e) {
+			events = append(events, e)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return events
+}
+
+func TestEventFilter(t *testing.T) {
+	data := writeTestFilterBinlog(t)
+
+	header := []EventType{FORMAT_DESCRIPTION_EVENT, PREVIOUS_GTIDS_EVENT}
+	rowsTransaction := []EventType{GTID_EVENT, QUERY_EVENT, TABLE_MAP_EVENT, WRITE_ROWS_EVENTv2, XID_EVENT}
+	emptyTransaction := []EventType{GTID_EVENT, QUERY_EVENT, XID_EVENT}
+	ddl := []EventType{GTID_EVENT, QUERY_EVENT}
+	concat := func(types ...[]EventType) []EventType {
+		var all []EventType
+		for _, t := range types {
+			all = append(all, t...)
+		}
+		return all
+	}
+
+	testcases := []struct {
+		name     string
+		filter   EventFilter
+		expected []EventType
+		tables   []string
+	}{
+		{
+			"include tables",
+			EventFilter{IncludeTableRegex: []string{`test\..*`}},
+			concat(header, rowsTransaction, rowsTransaction, emptyTransaction, ddl),
+			[]string{"test.t1", "test.t2"},
+		},
+		{
+			"exclude tables",
+			EventFilter{IncludeTableRegex: []string{`test\..*`}, ExcludeTableRegex: []string{`.*\.t2`}},
+			concat(header, rowsTransaction, emptyTransaction, emptyTransaction, ddl),
+			[]string{"test.t1"},
+		},
+		{
+			"exclude types",
+			EventFilter{ExcludeEventTypes: []EventType{QUERY_EVENT, TABLE_MAP_EVENT}},
+			concat(header,
+				emptyTransaction[:2], rowsTransaction[3:], emptyTransaction[:2], rowsTransaction[3:],
+				emptyTransaction[:2], rowsTransaction[3:], ddl),
+			nil,
+		},
+		{
+			"include types",
+			EventFilter{IncludeEventTypes: []EventType{TABLE_MAP_EVENT}, ExcludeTableRegex: []string{`other\..*`}},
+			concat(header,
+				rowsTransaction[:3], emptyTransaction[2:], rowsTransaction[:3], emptyTransaction[2:],
+				emptyTransaction, ddl),
+			[]string{"test.t1", "test.t2"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := filterTestBinlog(t, data, tc.filter)
+			var types []EventType
+			var tables []string
+			for _, e := range events {
+				types = append(types, e.Header.EventType)
+				if re, ok := e.Event.(*RowsEvent); ok {
+					require.Len(t, re.Rows, 1)
+					require.Equal(t, re.Rows[0][1], string(re.Table.Schema)+"."+string(re.Table.Table))
+				}
+				if te, ok := e.Event.(*TableMapEvent); ok {
+					tables = append(tables, string(te.Schema)+"."+string(te.Table))
+				}
+			}
+			require.Equal(t, tc.expected, types)
+			require.Equal(t, tc.tables, tables)
+		})
+	}
+
+	_, err := newEventFilter(EventFilter{IncludeTableRegex: []string{"("}})
+	require.Error(t, err)
+	f, err := newEventFilter(EventFilter{})
+	require.NoError(t, err)
+	require.Nil(t, f)
+}
+
+func TestEventFilterQueries(t *testing.T) {
+	f, err := newEventFilter(EventFilter{ExcludeEventTypes: []EventType{QUERY_EVENT}})
+	require.NoError(t, err)
+
+	query := func(q string) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte(q)}}
+	}
+	// the statements in a transaction are dropped, the ones starting or ending it are kept
+	for _, tc := range []struct {
+		query string
+		keep  bool
+	}{
+		{"BEGIN", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"COMMIT", true},
+		{"CREATE TABLE t2 (id INT)", true},
+		{"XA START 'x'", true},
+		{"UPDATE t SET id = 2", false},
+		{"XA END 'x'", false},
+	} {
+		require.Equal(t, tc.keep, f.keep(query(tc.query)), tc.query)
+	}
+	require.True(t, f.keep(&BinlogEvent{Header: &EventHeader{EventType: XA_PREPARE_LOG_EVENT}, Event: &XAPrepareEvent{}}))
+	require.True(t, f.keep(query("DROP TABLE t2")))
+}
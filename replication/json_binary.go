@@ -1,8 +1,11 @@
 package replication
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
@@ -560,7 +563,22 @@ func (d *jsonBinaryDecoder) decodeVariableLength(data []byte) (int, int) {
 	return 0, 0
 }
 
-func (e *RowsEvent) decodeJsonPartialBinary(data []byte) (*JsonDiff, error) {
+// decodeJsonDiffVector decodes the diffs of a partial JSON update in order.
+func (e *RowsEvent) decodeJsonDiffVector(data []byte) ([]*JsonDiff, error) {
+	var diffs []*JsonDiff
+	for len(data) > 0 {
+		diff, n, err := e.decodeJsonPartialBinary(data)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+		data = data[n:]
+	}
+	return diffs, nil
+}
+
+// decodeJsonPartialBinary decodes a diff, and returns the size of it.
+func (e *RowsEvent) decodeJsonPartialBinary(data []byte) (*JsonDiff, int, error) {
 	// see Json_diff_vector::read_binary() in mysql-server/sql/json_diff.cc
 	operationNumber := JsonDiffOperation(data[0])
 	switch operationNumber {
@@ -568,15 +586,18 @@ func (e *RowsEvent) decodeJsonPartialBinary(data []byte) (*JsonDiff, error) {
 	case JsonDiffOperationInsert:
 	case JsonDiffOperationRemove:
 	default:
-		return nil, ErrCorruptedJSONDiff
+		return nil, 0, ErrCorruptedJSONDiff
 	}
-	data = data[1:]
+	pos := 1
 
-	pathLength, _, n := mysql.LengthEncodedInt(data)
-	data = data[n:]
+	pathLength, _, n := mysql.LengthEncodedInt(data[pos:])
+	pos += n
+	if n == 0 || uint64(len(data)-pos) < pathLength {
+		return nil, 0, ErrCorruptedJSONDiff
+	}
 
-	path := data[:pathLength]
-	data = data[pathLength:]
+	path := data[pos : pos+int(pathLength)]
+	pos += int(pathLength)
 
 	diff := &JsonDiff{
 		Op:   operationNumber,
@@ -585,17 +606,208 @@ func (e *RowsEvent) decodeJsonPartialBinary(data []byte) (*JsonDiff, error) {
 	}
 
 	if operationNumber == JsonDiffOperationRemove {
-		return diff, nil
+		return diff, pos, nil
 	}
 
-	valueLength, _, n := mysql.LengthEncodedInt(data)
-	data = data[n:]
+	valueLength, _, n := mysql.LengthEncodedInt(data[pos:])
+	pos += n
+	if n == 0 || uint64(len(data)-pos) < valueLength {
+		return nil, 0, ErrCorruptedJSONDiff
+	}
 
-	d, err := e.decodeJsonBinary(data[:valueLength])
+	d, err := e.decodeJsonBinary(data[pos : pos+int(valueLength)])
 	if err != nil {
-		return nil, fmt.Errorf("cannot read json diff for field %q: %w", path, err)
+		return nil, 0, fmt.Errorf("cannot read json diff for field %q: %w", path, err)
 	}
 	diff.Value = string(d)
+	pos += int(valueLength)
+
+	return diff, pos, nil
+}
+
+var errJsonbTooLarge = errors.New("json document is too large for the small storage format")
+
+// encodeJsonBinary encodes the common JSON encoding data into the JSON binary
+// encoding, it is the reverse of decodeJsonBinary.
+func encodeJsonBinary(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tp, value, err := encodeJsonbValue(v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return append([]byte{tp}, value...), nil
+}
+
+func encodeJsonbValue(v interface{}) (byte, []byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return JSONB_LITERAL, []byte{JSONB_NULL_LITERAL}, nil
+	case bool:
+		if v {
+			return JSONB_LITERAL, []byte{JSONB_TRUE_LITERAL}, nil
+		}
+		return JSONB_LITERAL, []byte{JSONB_FALSE_LITERAL}, nil
+	case json.Number:
+		return encodeJsonbNumber(string(v))
+	case string:
+		data := appendJsonbVariableLength(nil, len(v))
+		return JSONB_STRING, append(data, v...), nil
+	case []interface{}:
+		return encodeJsonbObjectOrArray(nil, v, false)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// MySQL sorts the keys by length first, then by content
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = v[key]
+		}
+		return encodeJsonbObjectOrArray(keys, values, true)
+	default:
+		return 0, nil, errors.Errorf("unsupported json value %v(%T)", v, v)
+	}
+}
+
+func encodeJsonbNumber(s string) (byte, []byte, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			return JSONB_INT16, binary.LittleEndian.AppendUint16(nil, uint16(i)), nil
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			return JSONB_INT32, binary.LittleEndian.AppendUint32(nil, uint32(i)), nil
+		default:
+			return JSONB_INT64, binary.LittleEndian.AppendUint64(nil, uint64(i)), nil
+		}
+	}
+
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return JSONB_UINT64, binary.LittleEndian.AppendUint64(nil, u), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	return JSONB_DOUBLE, binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+}
+
+func encodeJsonbObjectOrArray(keys []string, values []interface{}, isObject bool) (byte, []byte, error) {
+	tp := JSONB_SMALL_ARRAY
+	if isObject {
+		tp = JSONB_SMALL_OBJECT
+	}
+
+	data, err := encodeJsonbContainer(keys, values, isObject, true)
+	if err == errJsonbTooLarge {
+		// JSONB_LARGE_OBJECT and JSONB_LARGE_ARRAY follow their small counterparts
+		tp++
+		data, err = encodeJsonbContainer(keys, values, isObject, false)
+	}
+
+	return tp, data, err
+}
+
+func encodeJsonbContainer(keys []string, values []interface{}, isObject bool, isSmall bool) ([]byte, error) {
+	offsetSize := jsonbGetOffsetSize(isSmall)
+	keyEntrySize := jsonbGetKeyEntrySize(isSmall)
+	valueEntrySize := jsonbGetValueEntrySize(isSmall)
+
+	count := len(values)
+	headerSize := 2*offsetSize + count*valueEntrySize
+	if isObject {
+		headerSize += count * keyEntrySize
+	}
+
+	data := make([]byte, headerSize)
 
-	return diff, nil
+	putOffset := func(pos int, v int) error {
+		if isSmall {
+			if v > math.MaxUint16 {
+				return errJsonbTooLarge
+			}
+			binary.LittleEndian.PutUint16(data[pos:], uint16(v))
+		} else {
+			if v > math.MaxUint32 {
+				return errors.Errorf("json document size %d is too large", v)
+			}
+			binary.LittleEndian.PutUint32(data[pos:], uint32(v))
+		}
+		return nil
+	}
+
+	valueEntryStart := 2 * offsetSize
+	if isObject {
+		valueEntryStart += count * keyEntrySize
+
+		for i, key := range keys {
+			if len(key) > math.MaxUint16 {
+				return nil, errors.Errorf("json key length %d is too large", len(key))
+			}
+			entryOffset := 2*offsetSize + keyEntrySize*i
+			if err := putOffset(entryOffset, len(data)); err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint16(data[entryOffset+offsetSize:], uint16(len(key)))
+			data = append(data, key...)
+		}
+	}
+
+	for i, v := range values {
+		tp, value, err := encodeJsonbValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		entryOffset := valueEntryStart + valueEntrySize*i
+		data[entryOffset] = tp
+
+		if isInlineValue(tp, isSmall) {
+			copy(data[entryOffset+1:entryOffset+valueEntrySize], value)
+			continue
+		}
+
+		if err = putOffset(entryOffset+1, len(data)); err != nil {
+			return nil, err
+		}
+		data = append(data, value...)
+	}
+
+	if err := putOffset(0, count); err != nil {
+		return nil, err
+	}
+	if err := putOffset(offsetSize, len(data)); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func appendJsonbVariableLength(data []byte, length int) []byte {
+	for {
+		b := byte(length & 0x7F)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		data = append(data, b)
+		if length == 0 {
+			return data
+		}
+	}
 }
@@ -0,0 +1,284 @@
+package replication
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+)
+
+// jsonPathLeg is a leg of a JSON path without wildcards, a member or an array element.
+type jsonPathLeg struct {
+	member string
+	// the index of the array element, counted from the end for [last-N]
+	index    int
+	fromLast bool
+	isMember bool
+}
+
+// arrayIndex returns the index of the array element in an array of the length.
+func (l *jsonPathLeg) arrayIndex(length int) int {
+	if l.fromLast {
+		return length - 1 - l.index
+	}
+	return l.index
+}
+
+// parseJsonPath parses a JSON path like $.a."b c"[1][last-1], which is the path of JsonDiff.
+func parseJsonPath(path string) ([]jsonPathLeg, error) {
+	s := strings.TrimSpace(path)
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.Errorf("invalid JSON path %q", path)
+	}
+	s = s[1:]
+
+	var legs []jsonPathLeg
+	for {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if s == "" {
+			return legs, nil
+		}
+
+		switch s[0] {
+		case '.':
+			s = strings.TrimLeft(s[1:], " \t\n\r")
+			leg := jsonPathLeg{isMember: true}
+			if strings.HasPrefix(s, `"`) {
+				end := 1
+				for end < len(s) && s[end] != '"' {
+					if s[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(s) {
+					return nil, errors.Errorf("invalid JSON path %q", path)
+				}
+				if err := json.Unmarshal([]byte(s[:end+1]), &leg.member); err != nil {
+					return nil, errors.Annotatef(err, "invalid JSON path %q", path)
+				}
+				s = s[end+1:]
+			} else {
+				end := strings.IndexAny(s, ".[ \t\n\r")
+				if end < 0 {
+					end = len(s)
+				}
+				leg.member = s[:end]
+				s = s[end:]
+				if leg.member == "" || strings.Contains(leg.member, "*") {
+					return nil, errors.Errorf("invalid JSON path %q", path)
+				}
+			}
+			legs = append(legs, leg)
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.Errorf("invalid JSON path %q", path)
+			}
+			leg, err := parseJsonArrayLeg(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, errors.Annotatef(err, "invalid JSON path %q", path)
+			}
+			legs = append(legs, leg)
+			s = s[end+1:]
+		default:
+			return nil, errors.Errorf("invalid JSON path %q", path)
+		}
+	}
+}
+
+// parseJsonArrayLeg parses the array leg in the brackets, N, last or last-N.
+func parseJsonArrayLeg(s string) (jsonPathLeg, error) {
+	leg := jsonPathLeg{}
+	if rest, ok := strings.CutPrefix(s, "last"); ok {
+		leg.fromLast = true
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return leg, nil
+		}
+		if !strings.HasPrefix(rest, "-") {
+			return leg, errors.Errorf("invalid array index %q", s)
+		}
+		s = strings.TrimSpace(rest[1:])
+	}
+
+	index, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return leg, errors.Errorf("invalid array index %q", s)
+	}
+	leg.index = int(index)
+	return leg, nil
+}
+
+// decodeJsonDocument decodes the JSON text, the numbers are kept as they're.
+func decodeJsonDocument(s string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return v, nil
+}
+
+// ApplyJsonDiffs applies the diffs of a partial JSON update in order to the JSON document before
+// the update, and returns the full JSON document after it, in the same format as the JSON values
+// of the full row images decoded by RowsEvent: the keys of the objects are sorted alphabetically,
+// unlike the JSON text of MySQL, which sorts them by length first. An empty document is taken as
+// the JSON null like MySQL.
+func ApplyJsonDiffs(doc string, diffs []*JsonDiff) (string, error) {
+	if doc == "" {
+		doc = "null"
+	}
+	v, err := decodeJsonDocument(doc)
+	if err != nil {
+		return "", errors.Annotate(err, "decode the JSON document")
+	}
+
+	for _, diff := range diffs {
+		legs, err := parseJsonPath(diff.Path)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		var value interface{}
+		if diff.Op != JsonDiffOperationRemove {
+			if value, err = decodeJsonDocument(diff.Value); err != nil {
+				return "", errors.Annotatef(err, "decode the value of %s", diff)
+			}
+		}
+
+		if len(legs) == 0 {
+			if diff.Op != JsonDiffOperationReplace {
+				return "", errors.Errorf("can't apply %s to the whole document", diff)
+			}
+			v = value
+			continue
+		}
+		if v, err = applyJsonDiff(v, legs, diff.Op, value); err != nil {
+			return "", errors.Annotatef(err, "apply %s", diff)
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return string(data), nil
+}
+
+// applyJsonDiff applies the operation at the path under v, and returns the new v.
+func applyJsonDiff(v interface{}, legs []jsonPathLeg, op JsonDiffOperation, value interface{}) (interface{}, error) {
+	leg := legs[0]
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if !leg.isMember {
+			break
+		}
+		child, ok := c[leg.member]
+		if len(legs) > 1 {
+			if !ok {
+				break
+			}
+			child, err := applyJsonDiff(child, legs[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			c[leg.member] = child
+			return c, nil
+		}
+
+		switch op {
+		case JsonDiffOperationReplace:
+			if !ok {
+				return nil, errors.Errorf("member %q not found", leg.member)
+			}
+			c[leg.member] = value
+		case JsonDiffOperationInsert:
+			if ok {
+				return nil, errors.Errorf("member %q already exists", leg.member)
+			}
+			c[leg.member] = value
+		case JsonDiffOperationRemove:
+			if !ok {
+				return nil, errors.Errorf("member %q not found", leg.member)
+			}
+			delete(c, leg.member)
+		}
+		return c, nil
+	case []interface{}:
+		if leg.isMember {
+			break
+		}
+		i := leg.arrayIndex(len(c))
+		if len(legs) > 1 || op != JsonDiffOperationInsert {
+			if i < 0 || i >= len(c) {
+				return nil, errors.Errorf("array index %d out of range", i)
+			}
+		}
+		if len(legs) > 1 {
+			child, err := applyJsonDiff(c[i], legs[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = child
+			return c, nil
+		}
+
+		switch op {
+		case JsonDiffOperationReplace:
+			c[i] = value
+		case JsonDiffOperationInsert:
+			// like JSON_ARRAY_INSERT, the value is appended if the index is past the end
+			return slices.Insert(c, min(max(i, 0), len(c)), value), nil
+		case JsonDiffOperationRemove:
+			return slices.Delete(c, i, i+1), nil
+		}
+		return c, nil
+	}
+	return nil, errors.Errorf("path leg %+v not found", leg)
+}
+
+// ApplyJsonDiffs replaces the partial JSON updates in the after images of a
+// PARTIAL_UPDATE_ROWS_EVENT with the full JSON documents, by applying the diffs to the JSON
+// documents of the before images, which must have the JSON columns, e.g, with the default
+// binlog_row_image=FULL. The rows decoded lazily are decoded into Rows first.
+func (e *RowsEvent) ApplyJsonDiffs() error {
+	if e.eventType != PARTIAL_UPDATE_ROWS_EVENT {
+		return nil
+	}
+	if e.lazy && e.Rows == nil {
+		rows, skipped, err := e.decodedRows()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		e.Rows, e.SkippedColumns = rows, skipped
+	}
+
+	for i := 0; i+1 < len(e.Rows); i += 2 {
+		before, after := e.Rows[i], e.Rows[i+1]
+		for j, v := range after {
+			diffs, ok := v.([]*JsonDiff)
+			if !ok {
+				continue
+			}
+
+			var doc string
+			switch b := before[j].(type) {
+			case string:
+				doc = b
+			case []byte:
+				doc = string(b)
+			default:
+				return errors.Errorf("no JSON document of column %d in the before image to apply the diffs", j)
+			}
+			full, err := ApplyJsonDiffs(doc, diffs)
+			if err != nil {
+				return errors.Annotatef(err, "column %d", j)
+			}
+			after[j] = full
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package replication
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestParseJsonPath(t *testing.T) {
+	legs, err := parseJsonPath(`$.a."b c"[1] [last].d[last - 2]."e\"f"`)
+	require.NoError(t, err)
+	require.Equal(t, []jsonPathLeg{
+		{member: "a", isMember: true},
+		{member: "b c", isMember: true},
+		{index: 1},
+		{fromLast: true},
+		{member: "d", isMember: true},
+		{index: 2, fromLast: true},
+		{member: `e"f`, isMember: true},
+	}, legs)
+
+	legs, err = parseJsonPath("$")
+	require.NoError(t, err)
+	require.Empty(t, legs)
+
+	for _, path := range []string{"", "a", "$.", "$.*", "$[*]", "$**.a", `$."a`, "$[1", "$[-1]", "$[last+1]"} {
+		_, err = parseJsonPath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestApplyJsonDiffs(t *testing.T) {
+	doc := `{"a":1,"b":[1,2,3],"c":{"d":"x","e f":1.5},"g":null}`
+	testcases := []struct {
+		diffs    []*JsonDiff
+		expected string
+	}{
+		{
+			[]*JsonDiff{{Op: JsonDiffOperationReplace, Path: "$.a", Value: `"new"`}},
+			`{"a":"new","b":[1,2,3],"c":{"d":"x","e f":1.5},"g":null}`,
+		},
+		{
+			[]*JsonDiff{{Op: JsonDiffOperationInsert, Path: "$.c.aa", Value: `{"k":[true]}`}},
+			`{"a":1,"b":[1,2,3],"c":{"aa":{"k":[true]},"d":"x","e f":1.5},"g":null}`,
+		},
+		{
+			[]*JsonDiff{{Op: JsonDiffOperationRemove, Path: `$.c."e f"`}},
+			`{"a":1,"b":[1,2,3],"c":{"d":"x"},"g":null}`,
+		},
+		{
+			[]*JsonDiff{
+				{Op: JsonDiffOperationInsert, Path: "$.b[0]", Value: "0"},
+				{Op: JsonDiffOperationInsert, Path: "$.b[10]", Value: "4"},
+				{Op: JsonDiffOperationRemove, Path: "$.b[last-1]"},
+				{Op: JsonDiffOperationReplace, Path: "$.b[last]", Value: `"end"`},
+			},
+			`{"a":1,"b":[0,1,2,"end"],"c":{"d":"x","e f":1.5},"g":null}`,
+		},
+		{
+			[]*JsonDiff{{Op: JsonDiffOperationReplace, Path: "$", Value: "[1]"}},
+			`[1]`,
+		},
+	}
+	for _, tc := range testcases {
+		full, err := ApplyJsonDiffs(doc, tc.diffs)
+		require.NoError(t, err)
+		require.JSONEq(t, tc.expected, full)
+		// the keys are sorted like the JSON documents of the full row images
+		d, err := encodeJsonBinary([]byte(full))
+		require.NoError(t, err)
+		decoded, err := (&RowsEvent{}).decodeJsonBinary(d)
+		require.NoError(t, err)
+		require.Equal(t, string(decoded), full)
+	}
+
+	for _, diff := range []*JsonDiff{
+		{Op: JsonDiffOperationReplace, Path: "$.none", Value: "1"},
+		{Op: JsonDiffOperationInsert, Path: "$.a", Value: "1"},
+		{Op: JsonDiffOperationRemove, Path: "$.b[3]"},
+		{Op: JsonDiffOperationReplace, Path: "$.none.a", Value: "1"},
+		{Op: JsonDiffOperationReplace, Path: "$.a[0]", Value: "1"},
+		{Op: JsonDiffOperationRemove, Path: "$"},
+		{Op: JsonDiffOperationReplace, Path: "$.a", Value: "{"},
+	} {
+		_, err := ApplyJsonDiffs(doc, []*JsonDiff{diff})
+		require.Error(t, err, diff.String())
+	}
+
+	full, err := ApplyJsonDiffs("", []*JsonDiff{{Op: JsonDiffOperationReplace, Path: "$", Value: "1"}})
+	require.NoError(t, err)
+	require.Equal(t, "1", full)
+}
+
+func TestRowsEventApplyJsonDiffs(t *testing.T) {
+	// the binary of a diff vector with two diffs
+	var data []byte
+	for _, diff := range []*JsonDiff{
+		{Op: JsonDiffOperationReplace, Path: "$.a", Value: "2"},
+		{Op: JsonDiffOperationInsert, Path: "$.b", Value: `"x"`},
+	} {
+		value, err := encodeJsonBinary([]byte(diff.Value))
+		require.NoError(t, err)
+		data = append(data, byte(diff.Op))
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(diff.Path)))
+		data = append(data, diff.Path...)
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(value)))
+		data = append(data, value...)
+	}
+	data = append(data, byte(JsonDiffOperationRemove), 3, '$', '.', 'c')
+
+	e := &RowsEvent{eventType: PARTIAL_UPDATE_ROWS_EVENT}
+	diffs, err := e.decodeJsonDiffVector(data)
+	require.NoError(t, err)
+	require.Equal(t, []*JsonDiff{
+		{Op: JsonDiffOperationReplace, Path: "$.a", Value: "2"},
+		{Op: JsonDiffOperationInsert, Path: "$.b", Value: `"x"`},
+		{Op: JsonDiffOperationRemove, Path: "$.c"},
+	}, diffs)
+	_, err = e.decodeJsonDiffVector(data[:len(data)-1])
+	require.ErrorIs(t, err, ErrCorruptedJSONDiff)
+
+	// the column value is the diffs even if there is only one
+	single := []byte{byte(JsonDiffOperationRemove), 3, '$', '.', 'c'}
+	v, _, err := e.decodeValue(append(binary.LittleEndian.AppendUint32(nil, uint32(len(single))), single...), mysql.MYSQL_TYPE_JSON, 4, true)
+	require.NoError(t, err)
+	require.Equal(t, []*JsonDiff{{Op: JsonDiffOperationRemove, Path: "$.c"}}, v)
+
+	// a corrupted diff is an error of the value
+	corrupted := []byte{0xff, 3, '$', '.', 'c'}
+	_, _, err = e.decodeValue(append(binary.LittleEndian.AppendUint32(nil, uint32(len(corrupted))), corrupted...), mysql.MYSQL_TYPE_JSON, 4, true)
+	require.ErrorIs(t, err, ErrCorruptedJSONDiff)
+
+	e.Rows = [][]interface{}{
+		{int32(1), `{"a":1,"c":true}`, `{"k":1}`},
+		{int32(1), diffs, []*JsonDiff{{Op: JsonDiffOperationRemove, Path: "$.k"}}},
+		{int32(2), `[1]`, "full"},
+		{int32(2), `[2]`, "full"},
+	}
+	require.NoError(t, e.ApplyJsonDiffs())
+	require.Equal(t, [][]interface{}{
+		{int32(1), `{"a":1,"c":true}`, `{"k":1}`},
+		{int32(1), `{"a":2,"b":"x"}`, `{}`},
+		{int32(2), `[1]`, "full"},
+		{int32(2), `[2]`, "full"},
+	}, e.Rows)
+
+	// no JSON document in the before image
+	e.Rows = [][]interface{}{{nil}, {[]*JsonDiff{{Op: JsonDiffOperationRemove, Path: "$.k"}}}}
+	require.Error(t, e.ApplyJsonDiffs())
+}
@@ -0,0 +1,220 @@
+package replication
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives the metrics of BinlogSyncer. The methods are called in the goroutine reading
+// the binlog, so they must be fast and safe for concurrent use with the readers of the metrics.
+type Metrics interface {
+	// ObserveEvent is called for every received event with the time to decode it.
+	ObserveEvent(eventType EventType, size uint32, decodeDuration time.Duration)
+	// ObserveStreamerLength is called with the number of the events waiting in the
+	// BinlogStreamer after an event is sent to it.
+	ObserveStreamerLength(n int)
+	// ObserveReconnect is called after every attempt to re-sync, err is nil if it succeeded.
+	ObserveReconnect(err error)
+	// ObserveSemiSyncACK is called with the time to reply every semi-sync ACK.
+	ObserveSemiSyncACK(d time.Duration)
+	// ObserveLag is called with the lag computed from the timestamp of the events, it's 0 for
+	// the heartbeats, which are sent when the replica has received all the events.
+	ObserveLag(lag time.Duration)
+}
+
+// observeEventLag reports the lag of the event, the events sent by the server on connection have
+// the old timestamps, and the artificial ones have no timestamp.
+func observeEventLag(m Metrics, e *BinlogEvent, now time.Time) {
+	switch e.Event.(type) {
+	case *HeartbeatEvent:
+		m.ObserveLag(0)
+	case *FormatDescriptionEvent, *RotateEvent, *PreviousGTIDsEvent, *MariadbGTIDListEvent:
+	default:
+		if e.Header.Timestamp == 0 || e.Header.Flags&LOG_EVENT_ARTIFICIAL_F != 0 {
+			return
+		}
+		m.ObserveLag(max(now.Sub(time.Unix(int64(e.Header.Timestamp), 0)), 0))
+	}
+}
+
+// the upper bounds of the buckets of the latency histograms in seconds
+var metricsLatencyBuckets = []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+type latencyHistogram struct {
+	buckets []atomic.Uint64
+	count   atomic.Uint64
+	// the sum in nanoseconds
+	sum atomic.Int64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]atomic.Uint64, len(metricsLatencyBuckets))}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bound := range metricsLatencyBuckets {
+		if seconds <= bound {
+			h.buckets[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *latencyHistogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range metricsLatencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatMetricValue(bound), h.buckets[i].Load())
+	}
+	count := h.count.Load()
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatMetricValue(time.Duration(h.sum.Load()).Seconds()))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+// eventTypeLabel returns the name of the event type, or the number of an unknown type.
+func eventTypeLabel(t EventType) string {
+	if name := t.String(); t == UNKNOWN_EVENT || name != "UnknownEvent" {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// PrometheusMetrics is a Metrics exposing the metrics in the Prometheus text format by ServeHTTP,
+// so it can be registered to a local HTTP server, like
+//
+//	m := replication.NewPrometheusMetrics("binlog")
+//	cfg.Metrics = m
+//	http.Handle("/metrics", m)
+type PrometheusMetrics struct {
+	namespace string
+
+	events [256]atomic.Uint64
+	bytes  [256]atomic.Uint64
+	decode *latencyHistogram
+
+	streamerLength     atomic.Int64
+	reconnects         atomic.Uint64
+	reconnectFailures  atomic.Uint64
+	semiSyncACK        *latencyHistogram
+	lagNanoseconds     atomic.Int64
+	lastLagObservation atomic.Int64
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics, the names of the metrics start with the namespace.
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		namespace:   namespace,
+		decode:      newLatencyHistogram(),
+		semiSyncACK: newLatencyHistogram(),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveEvent(eventType EventType, size uint32, decodeDuration time.Duration) {
+	m.events[eventType].Add(1)
+	m.bytes[eventType].Add(uint64(size))
+	m.decode.observe(decodeDuration)
+}
+
+func (m *PrometheusMetrics) ObserveStreamerLength(n int) {
+	m.streamerLength.Store(int64(n))
+}
+
+func (m *PrometheusMetrics) ObserveReconnect(err error) {
+	if err != nil {
+		m.reconnectFailures.Add(1)
+		return
+	}
+	m.reconnects.Add(1)
+}
+
+func (m *PrometheusMetrics) ObserveSemiSyncACK(d time.Duration) {
+	m.semiSyncACK.observe(d)
+}
+
+func (m *PrometheusMetrics) ObserveLag(lag time.Duration) {
+	m.lagNanoseconds.Store(int64(lag))
+	m.lastLagObservation.Store(time.Now().UnixNano())
+}
+
+func (m *PrometheusMetrics) name(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+	return m.namespace + "_" + name
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	for _, metric := range []struct {
+		name, help string
+		values     *[256]atomic.Uint64
+	}{
+		{m.name("events_total"), "The number of the received binlog events.", &m.events},
+		{m.name("event_bytes_total"), "The size of the received binlog events in bytes.", &m.bytes},
+	} {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name)
+		for i := range metric.values {
+			if v := metric.values[i].Load(); v > 0 {
+				fmt.Fprintf(cw, "%s{type=%q} %d\n", metric.name, eventTypeLabel(EventType(i)), v)
+			}
+		}
+	}
+	m.decode.write(cw, m.name("event_decode_seconds"), "The time to decode the binlog events.")
+
+	name := m.name("streamer_length")
+	fmt.Fprintf(cw, "# HELP %s The number of the events waiting in the BinlogStreamer.\n# TYPE %s gauge\n%s %d\n",
+		name, name, name, m.streamerLength.Load())
+
+	name = m.name("reconnects_total")
+	fmt.Fprintf(cw, "# HELP %s The number of the attempts to re-sync.\n# TYPE %s counter\n", name, name)
+	fmt.Fprintf(cw, "%s{result=\"success\"} %d\n%s{result=\"failure\"} %d\n",
+		name, m.reconnects.Load(), name, m.reconnectFailures.Load())
+
+	m.semiSyncACK.write(cw, m.name("semi_sync_ack_seconds"), "The time to reply the semi-sync ACKs.")
+
+	name = m.name("lag_seconds")
+	fmt.Fprintf(cw, "# HELP %s The lag of the last received event, 0 after a heartbeat.\n# TYPE %s gauge\n%s %s\n",
+		name, name, name, formatMetricValue(time.Duration(m.lagNanoseconds.Load()).Seconds()))
+
+	if last := m.lastLagObservation.Load(); last > 0 {
+		name = m.name("last_lag_observation_timestamp_seconds")
+		fmt.Fprintf(cw, "# HELP %s The unix time when the lag is updated.\n# TYPE %s gauge\n%s %s\n",
+			name, name, name, formatMetricValue(float64(last)/float64(time.Second)))
+	}
+
+	return cw.n, cw.err
+}
+
+// ServeHTTP implements http.Handler interface.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
@@ -0,0 +1,68 @@
+package replication
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics("binlog")
+	m.ObserveEvent(WRITE_ROWS_EVENTv2, 100, 50*time.Microsecond)
+	m.ObserveEvent(WRITE_ROWS_EVENTv2, 200, 2*time.Millisecond)
+	m.ObserveEvent(XID_EVENT, 31, time.Microsecond)
+	m.ObserveEvent(EventType(0xf0), 10, time.Microsecond)
+	m.ObserveStreamerLength(7)
+	m.ObserveReconnect(errors.New("connection refused"))
+	m.ObserveReconnect(nil)
+	m.ObserveSemiSyncACK(3 * time.Millisecond)
+	m.ObserveLag(1500 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	lines := strings.Split(w.Body.String(), "\n")
+
+	for _, expected := range []string{
+		"# TYPE binlog_events_total counter",
+		`binlog_events_total{type="XIDEvent"} 1`,
+		`binlog_events_total{type="WriteRowsEventV2"} 2`,
+		`binlog_events_total{type="240"} 1`,
+		`binlog_event_bytes_total{type="WriteRowsEventV2"} 300`,
+		"# TYPE binlog_event_decode_seconds histogram",
+		`binlog_event_decode_seconds_bucket{le="1e-05"} 2`,
+		`binlog_event_decode_seconds_bucket{le="0.0001"} 3`,
+		`binlog_event_decode_seconds_bucket{le="0.01"} 4`,
+		`binlog_event_decode_seconds_bucket{le="+Inf"} 4`,
+		"binlog_event_decode_seconds_sum 0.002052",
+		"binlog_event_decode_seconds_count 4",
+		"binlog_streamer_length 7",
+		`binlog_reconnects_total{result="success"} 1`,
+		`binlog_reconnects_total{result="failure"} 1`,
+		`binlog_semi_sync_ack_seconds_bucket{le="0.001"} 0`,
+		`binlog_semi_sync_ack_seconds_bucket{le="0.01"} 1`,
+		"binlog_lag_seconds 1.5",
+	} {
+		require.Contains(t, lines, expected)
+	}
+}
+
+func TestObserveEventLag(t *testing.T) {
+	m := NewPrometheusMetrics("")
+	now := time.Unix(1700000010, 0)
+
+	observeEventLag(m, &BinlogEvent{Header: &EventHeader{Timestamp: 1700000000}, Event: &QueryEvent{}}, now)
+	require.Equal(t, 10*time.Second, time.Duration(m.lagNanoseconds.Load()))
+
+	// the events sent on connection are ignored
+	observeEventLag(m, &BinlogEvent{Header: &EventHeader{Timestamp: 1600000000}, Event: &FormatDescriptionEvent{}}, now)
+	observeEventLag(m, &BinlogEvent{Header: &EventHeader{Flags: LOG_EVENT_ARTIFICIAL_F}, Event: &GenericEvent{}}, now)
+	require.Equal(t, 10*time.Second, time.Duration(m.lagNanoseconds.Load()))
+
+	observeEventLag(m, &BinlogEvent{Header: &EventHeader{}, Event: &HeartbeatEvent{}}, now)
+	require.Zero(t, m.lagNanoseconds.Load())
+}
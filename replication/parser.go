@@ -7,6 +7,7 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -37,20 +38,32 @@ type BinlogParser struct {
 
 	useDecimal               bool
 	useFloatWithTrailingZero bool
+	lazyRowsEvent            bool
 	ignoreJSONDecodeErr      bool
 	verifyChecksum           bool
 
 	payloadDecoderConcurrency int
+	maxUncompressedSize       int64
 
 	rowsEventDecodeFunc func(*RowsEvent, []byte) error
 
 	tableMapOptionalMetaDecodeFunc func([]byte) error
+
+	encryptionKeys      EncryptionKeyProvider
+	encryptionAlgorithm EncryptionAlgorithm
+	// decrypts the events after MARIADB_START_ENCRYPTION_EVENT
+	decrypter *binlogDecrypter
+	// the position of the next event read by ParseReader, the IV of the encrypted events
+	position uint32
+
+	bounds *boundsChecker
 }
 
 func NewBinlogParser() *BinlogParser {
 	p := new(BinlogParser)
 
 	p.tables = make(map[uint64]*TableMapEvent)
+	p.position = uint32(len(BinLogFileHeader))
 
 	return p
 }
@@ -65,6 +78,8 @@ func (p *BinlogParser) Resume() {
 
 func (p *BinlogParser) Reset() {
 	p.format = nil
+	p.decrypter = nil
+	p.position = uint32(len(BinLogFileHeader))
 }
 
 type OnEventFunc func(*BinlogEvent) error
@@ -83,6 +98,12 @@ func (p *BinlogParser) ParseFile(name string, offset int64, onEvent OnEventFunc)
 		return errors.Errorf("%s is not a valid binlog file, head 4 bytes must fe'bin' ", name)
 	}
 
+	p.position = 4
+	if p.bounds != nil {
+		if err = p.bounds.checkStartPos(offset); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	if offset < 4 {
 		offset = 4
 	} else if offset > 4 {
@@ -94,11 +115,22 @@ func (p *BinlogParser) ParseFile(name string, offset int64, onEvent OnEventFunc)
 		if err = p.parseFormatDescriptionEvent(f, onEvent); err != nil {
 			return errors.Annotatef(err, "parse FormatDescriptionEvent")
 		}
+
+		// MARIADB_START_ENCRYPTION_EVENT follows FORMAT_DESCRIPTION event if the binlog file is encrypted
+		if int64(p.position) < offset {
+			if err = p.parseStartEncryptionEvent(f, onEvent); err != nil {
+				return errors.Annotatef(err, "parse MariadbStartEncryptionEvent")
+			}
+		}
 	}
 
 	if _, err = f.Seek(offset, io.SeekStart); err != nil {
 		return errors.Errorf("seek %s to %d error %v", name, offset, err)
 	}
+	p.position = uint32(offset)
+	if p.bounds != nil {
+		p.bounds.file = filepath.Base(name)
+	}
 
 	return p.ParseReader(f, onEvent)
 }
@@ -108,6 +140,20 @@ func (p *BinlogParser) parseFormatDescriptionEvent(r io.Reader, onEvent OnEventF
 	return err
 }
 
+func (p *BinlogParser) parseStartEncryptionEvent(f *os.File, onEvent OnEventFunc) error {
+	header := make([]byte, EventHeaderSize)
+	if _, err := f.ReadAt(header, int64(p.position)); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	if EventType(header[4]) != MARIADB_START_ENCRYPTION_EVENT {
+		return nil
+	}
+	_, err := p.parseSingleEvent(f, onEvent)
+	return err
+}
+
 // ParseSingleEvent parses single binlog event and passes the event to onEvent function.
 func (p *BinlogParser) ParseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool, error) {
 	return p.parseSingleEvent(r, onEvent)
@@ -145,6 +191,19 @@ func (p *BinlogParser) parseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool,
 
 	var rawData []byte
 	rawData = append(rawData, buf.Bytes()...)
+
+	pos := p.position
+	p.position += h.EventSize
+	if h.EventType == FORMAT_DESCRIPTION_EVENT {
+		// a new binlog file, which isn't encrypted until MARIADB_START_ENCRYPTION_EVENT
+		p.decrypter = nil
+	} else if p.decrypter != nil {
+		p.decrypter.decrypt(rawData, pos)
+		if h, err = p.parseHeader(rawData); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+
 	bodyLen := int(h.EventSize) - EventHeaderSize
 	body := rawData[EventHeaderSize:]
 	if len(body) != bodyLen {
@@ -160,11 +219,26 @@ func (p *BinlogParser) parseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool,
 		return false, errors.Trace(err)
 	}
 
-	if err = onEvent(&BinlogEvent{RawData: rawData, Header: h, Event: e}); err != nil {
-		return false, errors.Trace(err)
+	if se, ok := e.(*MariadbStartEncryptionEvent); ok {
+		if p.decrypter, err = newBinlogDecrypter(se, p.encryptionKeys, p.encryptionAlgorithm); err != nil {
+			return false, errors.Trace(err)
+		}
 	}
 
-	return false, nil
+	be := &BinlogEvent{RawData: rawData, Header: h, Event: e}
+	read, stop := true, false
+	if p.bounds != nil {
+		if read, stop, err = p.bounds.check(be); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	if read {
+		if err = onEvent(be); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+
+	return stop, nil
 }
 
 func (p *BinlogParser) ParseReader(r io.Reader, onEvent OnEventFunc) error {
@@ -205,6 +279,27 @@ func (p *BinlogParser) SetUseFloatWithTrailingZero(useFloatWithTrailingZero bool
 	p.useFloatWithTrailingZero = useFloatWithTrailingZero
 }
 
+// SetLazyRowsEvent makes the rows events keep the raw data of the rows instead of decoding them
+// into RowsEvent.Rows, the rows are decoded one by one by RowsEvent.Iterator then.
+func (p *BinlogParser) SetLazyRowsEvent(lazy bool) {
+	p.lazyRowsEvent = lazy
+}
+
+// SetReadBounds limits the events read by ParseFile and ParseReader, the parsing stops without
+// error when a stop bound is reached, and the following calls read nothing until SetReadBounds is
+// called again. The bounds are checked across the calls, so the binlog files can be parsed in turn.
+func (p *BinlogParser) SetReadBounds(bounds ReadBounds) {
+	p.bounds = nil
+	if !bounds.isZero() {
+		p.bounds = newBoundsChecker(bounds, "", nil)
+	}
+}
+
+// StopBoundReached returns whether a stop bound of SetReadBounds is reached.
+func (p *BinlogParser) StopBoundReached() bool {
+	return p.bounds != nil && p.bounds.stopped
+}
+
 func (p *BinlogParser) SetIgnoreJSONDecodeError(ignoreJSONDecodeErr bool) {
 	p.ignoreJSONDecodeErr = ignoreJSONDecodeErr
 }
@@ -221,6 +316,13 @@ func (p *BinlogParser) SetPayloadDecoderConcurrency(concurrency int) {
 	p.payloadDecoderConcurrency = concurrency
 }
 
+// SetMaxUncompressedSize limits the uncompressed size of TransactionPayloadEvent and the MariaDB
+// compressed events, the larger events fail to be decoded. A MariaDB compressed event is
+// decompressed at once after checking the size in its header. Default 0, no limit.
+func (p *BinlogParser) SetMaxUncompressedSize(size int64) {
+	p.maxUncompressedSize = size
+}
+
 func (p *BinlogParser) SetRowsEventDecodeFunc(rowsEventDecodeFunc func(*RowsEvent, []byte) error) {
 	p.rowsEventDecodeFunc = rowsEventDecodeFunc
 }
@@ -229,6 +331,14 @@ func (p *BinlogParser) SetTableMapOptionalMetaDecodeFunc(tableMapOptionalMetaDec
 	p.tableMapOptionalMetaDecodeFunc = tableMapOptionalMetaDecondeFunc
 }
 
+// SetEncryption sets the key provider and the algorithm to decrypt the MariaDB binlog files encrypted
+// at rest. The events are decrypted by ParseFile and ParseReader, the binlog sent by the server
+// is not encrypted.
+func (p *BinlogParser) SetEncryption(keys EncryptionKeyProvider, algorithm EncryptionAlgorithm) {
+	p.encryptionKeys = keys
+	p.encryptionAlgorithm = algorithm
+}
+
 func (p *BinlogParser) parseHeader(data []byte) (*EventHeader, error) {
 	h := new(EventHeader)
 	err := h.Decode(data)
@@ -262,7 +372,8 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 				e = &QueryEvent{}
 			case MARIADB_QUERY_COMPRESSED_EVENT:
 				e = &QueryEvent{
-					compressed: true,
+					compressed:          true,
+					maxUncompressedSize: p.maxUncompressedSize,
 				}
 			case XID_EVENT:
 				e = &XIDEvent{}
@@ -310,6 +421,8 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 				e = &MariadbBinlogCheckPointEvent{}
 			case MARIADB_GTID_LIST_EVENT:
 				e = &MariadbGTIDListEvent{}
+			case MARIADB_START_ENCRYPTION_EVENT:
+				e = &MariadbStartEncryptionEvent{}
 			case MARIADB_GTID_EVENT:
 				ee := &MariadbGTIDEvent{}
 				ee.GTID.ServerID = h.ServerID
@@ -318,6 +431,18 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 				e = &PreviousGTIDsEvent{}
 			case INTVAR_EVENT:
 				e = &IntVarEvent{}
+			case RAND_EVENT:
+				e = &RandEvent{}
+			case USER_VAR_EVENT:
+				e = &UserVarEvent{useDecimal: p.useDecimal}
+			case INCIDENT_EVENT:
+				e = &IncidentEvent{}
+			case XA_PREPARE_LOG_EVENT:
+				e = &XAPrepareEvent{}
+			case VIEW_CHANGE_EVENT:
+				e = &ViewChangeEvent{}
+			case TRANSACTION_CONTEXT_EVENT:
+				e = &TransactionContextEvent{}
 			case TRANSACTION_PAYLOAD_EVENT:
 				e = p.newTransactionPayloadEvent()
 			case HEARTBEAT_EVENT:
@@ -415,50 +540,15 @@ func (p *BinlogParser) newRowsEvent(h *EventHeader) *RowsEvent {
 		e.tableIDSize = 6
 	}
 
-	e.needBitmap2 = false
 	e.tables = p.tables
-	e.eventType = h.EventType
+	e.setEventType(h.EventType)
 	e.parseTime = p.parseTime
 	e.timestampStringLocation = p.timestampStringLocation
 	e.useDecimal = p.useDecimal
 	e.useFloatWithTrailingZero = p.useFloatWithTrailingZero
 	e.ignoreJSONDecodeErr = p.ignoreJSONDecodeErr
-
-	switch h.EventType {
-	case WRITE_ROWS_EVENTv0:
-		e.Version = 0
-	case UPDATE_ROWS_EVENTv0:
-		e.Version = 0
-	case DELETE_ROWS_EVENTv0:
-		e.Version = 0
-	case WRITE_ROWS_EVENTv1:
-		e.Version = 1
-	case DELETE_ROWS_EVENTv1:
-		e.Version = 1
-	case UPDATE_ROWS_EVENTv1:
-		e.Version = 1
-		e.needBitmap2 = true
-	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-		e.needBitmap2 = true
-	case WRITE_ROWS_EVENTv2:
-		e.Version = 2
-	case UPDATE_ROWS_EVENTv2:
-		e.Version = 2
-		e.needBitmap2 = true
-	case DELETE_ROWS_EVENTv2:
-		e.Version = 2
-	case PARTIAL_UPDATE_ROWS_EVENT:
-		e.Version = 2
-		e.needBitmap2 = true
-	}
+	e.lazy = p.lazyRowsEvent
+	e.maxUncompressedSize = p.maxUncompressedSize
 
 	return e
 }
@@ -467,6 +557,25 @@ func (p *BinlogParser) newTransactionPayloadEvent() *TransactionPayloadEvent {
 	e := &TransactionPayloadEvent{}
 	e.format = *p.format
 	e.concurrency = p.payloadDecoderConcurrency
+	e.maxUncompressedSize = p.maxUncompressedSize
+	e.newParser = p.newPayloadParser
 
 	return e
 }
+
+// newPayloadParser returns the parser of the events in a TransactionPayloadEvent, with the same
+// options as p. Its format must be set by the caller.
+func (p *BinlogParser) newPayloadParser() *BinlogParser {
+	np := NewBinlogParser()
+	np.flavor = p.flavor
+	np.parseTime = p.parseTime
+	np.timestampStringLocation = p.timestampStringLocation
+	np.useDecimal = p.useDecimal
+	np.useFloatWithTrailingZero = p.useFloatWithTrailingZero
+	np.lazyRowsEvent = p.lazyRowsEvent
+	np.ignoreJSONDecodeErr = p.ignoreJSONDecodeErr
+	np.maxUncompressedSize = p.maxUncompressedSize
+	np.rowsEventDecodeFunc = p.rowsEventDecodeFunc
+	np.tableMapOptionalMetaDecodeFunc = p.tableMapOptionalMetaDecodeFunc
+	return np
+}
@@ -0,0 +1,98 @@
+package replication
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// RetryPolicy decides when BinlogSyncer attempts to re-sync after the connection is broken.
+type RetryPolicy interface {
+	// NextDelay returns the delay before the attempt, and elapsed is the time since the connection
+	// is broken. It returns false to stop retrying. The attempt starts from 1 and is counted since
+	// the last packet received from the server, so it keeps growing if the connection is broken
+	// again after a re-sync but before any packet arrives.
+	NextDelay(attempt int, elapsed time.Duration) (time.Duration, bool)
+}
+
+// ConstantRetryPolicy retries after the same delay, it's the default policy with 1s delay and
+// MaxReconnectAttempts.
+type ConstantRetryPolicy struct {
+	Delay time.Duration
+	// MaxAttempts is the max number of attempts, zero or negative number means infinite retry.
+	MaxAttempts int
+}
+
+func (p *ConstantRetryPolicy) NextDelay(attempt int, _ time.Duration) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt > p.MaxAttempts {
+		return 0, false
+	}
+	return p.Delay, true
+}
+
+// ExponentialBackoff retries with the delay multiplied after every attempt, and randomized by
+// Jitter, so the replicas broken by the same network failure don't reconnect at the same time.
+type ExponentialBackoff struct {
+	// InitialDelay is the delay before the first attempt, default 1s.
+	InitialDelay time.Duration
+	// MaxDelay is the max delay between the attempts, default 1m.
+	MaxDelay time.Duration
+	// Multiplier is the factor the delay is multiplied by after every attempt, default 2.
+	Multiplier float64
+	// Jitter randomizes the delay in [delay * (1 - Jitter), delay * (1 + Jitter)], it's between 0 and 1.
+	Jitter float64
+	// MaxElapsedTime stops retrying after the time since the connection is broken, zero means no limit.
+	MaxElapsedTime time.Duration
+	// MaxAttempts is the max number of attempts, zero or negative number means infinite retry.
+	MaxAttempts int
+}
+
+func (p *ExponentialBackoff) NextDelay(attempt int, elapsed time.Duration) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt > p.MaxAttempts {
+		return 0, false
+	}
+
+	initial, maxDelay, multiplier := p.InitialDelay, p.MaxDelay, p.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(initial)
+	for i := 1; i < attempt && delay < float64(maxDelay); i++ {
+		delay *= multiplier
+	}
+	delay = min(delay, float64(maxDelay))
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+
+	if p.MaxElapsedTime > 0 && elapsed+time.Duration(delay) > p.MaxElapsedTime {
+		return 0, false
+	}
+	return time.Duration(delay), true
+}
+
+// ReconnectInfo is reported to OnReconnect after every attempt to re-sync.
+type ReconnectInfo struct {
+	// Attempt is the number of the attempt since the last packet received from the server,
+	// starting from 1. It isn't reset by a re-sync until a packet arrives, so the retry limit
+	// also stops a connection broken right after every re-sync.
+	Attempt int
+	// LastError is the error breaking the connection, or failing the previous attempt.
+	LastError error
+	// Err is the error of the attempt, nil if the syncer is reconnected.
+	Err error
+	// Source is the server of the attempt.
+	Source BinlogSource
+	// Position is the position to resume from, and GTIDSet too if the syncer is started by
+	// StartSyncGTID.
+	Position mysql.Position
+	GTIDSet  mysql.GTIDSet
+}
@@ -0,0 +1,59 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstantRetryPolicy(t *testing.T) {
+	p := &ConstantRetryPolicy{Delay: time.Second, MaxAttempts: 2}
+	for attempt := 1; attempt <= 2; attempt++ {
+		delay, ok := p.NextDelay(attempt, time.Hour)
+		require.True(t, ok)
+		require.Equal(t, time.Second, delay)
+	}
+	_, ok := p.NextDelay(3, 0)
+	require.False(t, ok)
+
+	p.MaxAttempts = 0
+	_, ok = p.NextDelay(100, 0)
+	require.True(t, ok)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	p := &ExponentialBackoff{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 3}
+	for i, expected := range []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second, time.Second} {
+		delay, ok := p.NextDelay(i+1, 0)
+		require.True(t, ok)
+		require.Equal(t, expected, delay)
+	}
+
+	// defaults
+	delay, ok := (&ExponentialBackoff{}).NextDelay(3, 0)
+	require.True(t, ok)
+	require.Equal(t, 4*time.Second, delay)
+	delay, ok = (&ExponentialBackoff{}).NextDelay(100, 0)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, delay)
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay, ok = p.NextDelay(2, 0)
+		require.True(t, ok)
+		require.GreaterOrEqual(t, delay, 150*time.Millisecond)
+		require.LessOrEqual(t, delay, 450*time.Millisecond)
+	}
+
+	p.Jitter = 0
+	p.MaxElapsedTime = 2 * time.Second
+	_, ok = p.NextDelay(4, time.Second)
+	require.True(t, ok)
+	_, ok = p.NextDelay(4, 1500*time.Millisecond)
+	require.False(t, ok)
+
+	p.MaxAttempts = 3
+	_, ok = p.NextDelay(4, 0)
+	require.False(t, ok)
+}
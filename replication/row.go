@@ -0,0 +1,224 @@
+package replication
+
+import (
+	"encoding/binary"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// Row reads the columns of the current row of RowsIterator from the raw event data directly, so
+// unlike RowsIterator.Row, it doesn't allocate memory for the values or box them into interface{}.
+// The integers are signed or unsigned by the caller, because the binlog doesn't know it. The values
+// of NULL or skipped columns are zero, check IsNull first if it matters. The slices and strings
+// reference the event data, copy them if they're kept after the event.
+//
+//	it := e.Iterator()
+//	for it.Next() {
+//		row := it.TypedRow()
+//		id, err := row.Int64(0)
+//		...
+//		name, err := row.String(1)
+//		...
+//	}
+type Row struct {
+	it *RowsIterator
+}
+
+// TypedRow returns the Row of the current row, it's valid until the next call of Next.
+func (it *RowsIterator) TypedRow() Row {
+	return Row{it: it}
+}
+
+// Len returns the number of the columns.
+func (r Row) Len() int {
+	return len(r.it.offsets)
+}
+
+// IsNull returns whether the column is NULL or skipped.
+func (r Row) IsNull(i int) bool {
+	return r.it.offsets[i] < 0
+}
+
+// IsSkipped returns whether the column is not in the row image.
+func (r Row) IsSkipped(i int) bool {
+	return r.it.offsets[i] == skippedColumnOffset
+}
+
+// Type returns the real type of the column, ENUM and SET instead of MYSQL_TYPE_STRING.
+func (r Row) Type(i int) byte {
+	tp, _ := realColumnType(r.it.e.Table.ColumnType[i], r.it.e.Table.ColumnMeta[i])
+	return tp
+}
+
+// column returns the real type, meta, max string length and data of the column, data is nil if
+// the column has no value.
+func (r Row) column(i int) (tp byte, meta uint16, length int, data []byte) {
+	meta = r.it.e.Table.ColumnMeta[i]
+	tp, length = realColumnType(r.it.e.Table.ColumnType[i], meta)
+	if offset := r.it.offsets[i]; offset >= 0 {
+		data = r.it.data[offset:]
+	}
+	return tp, meta, length, data
+}
+
+// Int64 returns the value of the integer, YEAR, BIT, ENUM or SET column, the same as the value of
+// RowsEvent.Rows but in int64.
+func (r Row) Int64(i int) (int64, error) {
+	tp, meta, _, data := r.column(i)
+	if data == nil {
+		return 0, r.checkType(i, tp, isIntegerColumnType)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return int64(mysql.ParseBinaryInt8(data)), nil
+	case mysql.MYSQL_TYPE_SHORT:
+		return int64(mysql.ParseBinaryInt16(data)), nil
+	case mysql.MYSQL_TYPE_INT24:
+		return int64(mysql.ParseBinaryInt24(data)), nil
+	case mysql.MYSQL_TYPE_LONG:
+		return int64(mysql.ParseBinaryInt32(data)), nil
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return mysql.ParseBinaryInt64(data), nil
+	case mysql.MYSQL_TYPE_YEAR:
+		if data[0] == 0 {
+			return 0, nil
+		}
+		return int64(data[0]) + 1900, nil
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		return decodeBit(data, int(nbits), int(nbits+7)/8)
+	case mysql.MYSQL_TYPE_ENUM:
+		switch meta & 0xFF {
+		case 1:
+			return int64(data[0]), nil
+		case 2:
+			return int64(binary.LittleEndian.Uint16(data)), nil
+		default:
+			return 0, errors.Errorf("unknown ENUM packlen=%d", meta&0xFF)
+		}
+	case mysql.MYSQL_TYPE_SET:
+		n := int(meta & 0xFF)
+		return littleDecodeBit(data, n*8, n)
+	default:
+		return 0, r.checkType(i, tp, isIntegerColumnType)
+	}
+}
+
+// Uint64 returns the value of the integer column as an unsigned integer, and the other columns
+// accepted by Int64 the same as Int64.
+func (r Row) Uint64(i int) (uint64, error) {
+	tp, _, _, data := r.column(i)
+	if data == nil {
+		return 0, r.checkType(i, tp, isIntegerColumnType)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return uint64(mysql.ParseBinaryUint8(data)), nil
+	case mysql.MYSQL_TYPE_SHORT:
+		return uint64(mysql.ParseBinaryUint16(data)), nil
+	case mysql.MYSQL_TYPE_INT24:
+		return uint64(mysql.ParseBinaryUint24(data)), nil
+	case mysql.MYSQL_TYPE_LONG:
+		return uint64(mysql.ParseBinaryUint32(data)), nil
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return mysql.ParseBinaryUint64(data), nil
+	default:
+		v, err := r.Int64(i)
+		return uint64(v), err
+	}
+}
+
+// Float64 returns the value of the FLOAT or DOUBLE column.
+func (r Row) Float64(i int) (float64, error) {
+	tp, _, _, data := r.column(i)
+	if data == nil {
+		return 0, r.checkType(i, tp, isFloatColumnType)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_FLOAT:
+		return float64(mysql.ParseBinaryFloat32(data)), nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return mysql.ParseBinaryFloat64(data), nil
+	default:
+		return 0, r.checkType(i, tp, isFloatColumnType)
+	}
+}
+
+// Bytes returns the value of the string, BLOB, GEOMETRY or VECTOR column, which references the
+// event data.
+func (r Row) Bytes(i int) ([]byte, error) {
+	tp, meta, length, data := r.column(i)
+	if data == nil {
+		return nil, r.checkType(i, tp, isBytesColumnType)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		length = int(meta)
+		return data[stringLengthSize(length):stringValueLength(data, length)], nil
+	case mysql.MYSQL_TYPE_STRING:
+		return data[stringLengthSize(length):stringValueLength(data, length)], nil
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR:
+		v, _, err := decodeBlob(data, meta)
+		return v, err
+	default:
+		return nil, r.checkType(i, tp, isBytesColumnType)
+	}
+}
+
+// String returns the value of the column accepted by Bytes as a string, which references the
+// event data.
+func (r Row) String(i int) (string, error) {
+	v, err := r.Bytes(i)
+	return utils.ByteSliceToString(v), err
+}
+
+// Value decodes the column like RowsIterator.Column, for the types without a typed accessor.
+func (r Row) Value(i int) (interface{}, error) {
+	return r.it.Column(i)
+}
+
+// checkType returns an error if the column type isn't accepted by the accessor.
+func (r Row) checkType(i int, tp byte, accept func(byte) bool) error {
+	if accept(tp) {
+		return nil
+	}
+	return errors.Errorf("column %d of type %d can't be read by the accessor", i, tp)
+}
+
+// stringLengthSize returns the size of the length of the string like decodeString.
+func stringLengthSize(length int) int {
+	if length < 256 {
+		return 1
+	}
+	return 2
+}
+
+func isIntegerColumnType(tp byte) bool {
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONG,
+		mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_YEAR, mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_ENUM,
+		mysql.MYSQL_TYPE_SET:
+		return true
+	}
+	return false
+}
+
+func isFloatColumnType(tp byte) bool {
+	return tp == mysql.MYSQL_TYPE_FLOAT || tp == mysql.MYSQL_TYPE_DOUBLE
+}
+
+func isBytesColumnType(tp byte) bool {
+	switch tp {
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_STRING,
+		mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR:
+		return true
+	}
+	return false
+}
@@ -891,7 +891,7 @@ const RowsEventStmtEndFlag = 0x01
 // - mysql.MYSQL_TYPE_VARCHAR: string
 // - mysql.MYSQL_TYPE_VAR_STRING: string
 // - mysql.MYSQL_TYPE_STRING: string
-// - mysql.MYSQL_TYPE_JSON: []byte / *replication.JsonDiff
+// - mysql.MYSQL_TYPE_JSON: []byte / *replication.JsonDiff / []*replication.JsonDiff, see ApplyJsonDiffs
 // - mysql.MYSQL_TYPE_GEOMETRY: []byte
 // - mysql.MYSQL_TYPE_VECTOR: []byte
 type RowsEvent struct {
@@ -903,7 +903,8 @@ type RowsEvent struct {
 	needBitmap2 bool
 
 	// for mariadb *_COMPRESSED_EVENT_V1
-	compressed bool
+	compressed          bool
+	maxUncompressedSize int64
 
 	// raw event type associated with a RowsEvent
 	eventType EventType
@@ -942,9 +943,14 @@ type RowsEvent struct {
 	ColumnBitmap2 []byte
 
 	// rows: all return types from RowsEvent.decodeValue()
+	// Rows and SkippedColumns are not set if the rows are decoded lazily, use Iterator then.
 	Rows           [][]interface{}
 	SkippedColumns [][]int
 
+	// the raw data of the rows, decoded by Iterator
+	rowsData []byte
+	lazy     bool
+
 	parseTime                bool
 	timestampStringLocation  *time.Location
 	useDecimal               bool
@@ -1080,13 +1086,19 @@ func (e *RowsEvent) decodeExtraData(data []byte) (err2 error) {
 
 func (e *RowsEvent) DecodeData(pos int, data []byte) (err2 error) {
 	if e.compressed {
-		data, err2 = mysql.DecompressMariadbData(data[pos:])
+		data, err2 = decompressMariadbData(data[pos:], e.maxUncompressedSize)
 		if err2 != nil {
 			return err2
 		}
 		pos = 0
 	}
 
+	e.rowsData = data[pos:]
+	if e.lazy {
+		// decoded by Iterator
+		return nil
+	}
+
 	// Rows_log_event::print_verbose()
 
 	var (
@@ -1108,16 +1120,7 @@ func (e *RowsEvent) DecodeData(pos int, data []byte) (err2 error) {
 	e.SkippedColumns = make([][]int, 0, rowsLen)
 	e.Rows = make([][]interface{}, 0, rowsLen)
 
-	var rowImageType EnumRowImageType
-	switch e.eventType {
-	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
-		rowImageType = EnumRowImageTypeWriteAI
-	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
-		rowImageType = EnumRowImageTypeDeleteBI
-	default:
-		rowImageType = EnumRowImageTypeUpdateBI
-	}
-
+	rowImageType := e.firstImageType()
 	for pos < len(data) {
 		// Parse the first image
 		if n, err = e.decodeImage(data[pos:], e.ColumnBitmap1, rowImageType); err != nil {
@@ -1137,6 +1140,18 @@ func (e *RowsEvent) DecodeData(pos int, data []byte) (err2 error) {
 	return nil
 }
 
+// firstImageType returns the type of the first image of every row.
+func (e *RowsEvent) firstImageType() EnumRowImageType {
+	switch e.eventType {
+	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		return EnumRowImageTypeWriteAI
+	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		return EnumRowImageTypeDeleteBI
+	default:
+		return EnumRowImageTypeUpdateBI
+	}
+}
+
 func (e *RowsEvent) Decode(data []byte) error {
 	pos, err := e.DecodeHeader(data)
 	if err != nil {
@@ -1158,6 +1173,49 @@ func (e *RowsEvent) Type() EnumRowsEventType {
 	}
 }
 
+// setEventType sets the raw event type and the version and layout derived from it.
+func (e *RowsEvent) setEventType(eventType EventType) {
+	e.eventType = eventType
+	e.needBitmap2 = false
+	e.compressed = false
+
+	switch eventType {
+	case WRITE_ROWS_EVENTv0:
+		e.Version = 0
+	case UPDATE_ROWS_EVENTv0:
+		e.Version = 0
+	case DELETE_ROWS_EVENTv0:
+		e.Version = 0
+	case WRITE_ROWS_EVENTv1:
+		e.Version = 1
+	case DELETE_ROWS_EVENTv1:
+		e.Version = 1
+	case UPDATE_ROWS_EVENTv1:
+		e.Version = 1
+		e.needBitmap2 = true
+	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+	case MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+		e.needBitmap2 = true
+	case WRITE_ROWS_EVENTv2:
+		e.Version = 2
+	case UPDATE_ROWS_EVENTv2:
+		e.Version = 2
+		e.needBitmap2 = true
+	case DELETE_ROWS_EVENTv2:
+		e.Version = 2
+	case PARTIAL_UPDATE_ROWS_EVENT:
+		e.Version = 2
+		e.needBitmap2 = true
+	}
+}
+
 func isBitSet(bitmap []byte, i int) bool {
 	return bitmap[i>>3]&(1<<(uint(i)&7)) > 0
 }
@@ -1257,26 +1315,27 @@ func (e *RowsEvent) parseFracTime(t interface{}) interface{} {
 	return v.Time
 }
 
-// see mysql sql/log_event.cc log_event_print_value
-func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial bool) (v interface{}, n int, err error) {
-	length := 0
-
-	if tp == mysql.MYSQL_TYPE_STRING {
-		if meta >= 256 {
-			b0 := uint8(meta >> 8)
-			b1 := uint8(meta & 0xFF)
+// realColumnType returns the real type of MYSQL_TYPE_STRING, which may be ENUM or SET, and
+// the max length of the string.
+func realColumnType(tp byte, meta uint16) (byte, int) {
+	if tp != mysql.MYSQL_TYPE_STRING {
+		return tp, 0
+	}
+	if meta < 256 {
+		return tp, int(meta)
+	}
 
-			if b0&0x30 != 0x30 {
-				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
-				tp = b0 | 0x30
-			} else {
-				length = int(meta & 0xFF)
-				tp = b0
-			}
-		} else {
-			length = int(meta)
-		}
+	b0 := uint8(meta >> 8)
+	b1 := uint8(meta & 0xFF)
+	if b0&0x30 != 0x30 {
+		return b0 | 0x30, int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
 	}
+	return b0, int(meta & 0xFF)
+}
+
+// see mysql sql/log_event.cc log_event_print_value
+func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial bool) (v interface{}, n int, err error) {
+	tp, length := realColumnType(tp, meta)
 
 	switch tp {
 	case mysql.MYSQL_TYPE_NULL:
@@ -1436,12 +1495,10 @@ func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial boo
 			v = []byte{}
 		} else {
 			if isPartial {
-				var diff *JsonDiff
-				diff, err = e.decodeJsonPartialBinary(data[meta:n])
+				var diffs []*JsonDiff
+				diffs, err = e.decodeJsonDiffVector(data[meta:n])
 				if err == nil {
-					v = diff
-				} else {
-					fmt.Printf("decodeJsonPartialBinary(%q) fail: %s\n", data[meta:n], err)
+					v = diffs
 				}
 			} else {
 				var d []byte
@@ -1506,6 +1563,18 @@ func decodeDecimalDecompressValue(compIndx int, data []byte, mask uint8) (size i
 
 var zeros = [digitsPerInteger]byte{48, 48, 48, 48, 48, 48, 48, 48, 48}
 
+// decimalBinSize returns the size of the binary decimal.
+func decimalBinSize(precision int, decimals int) int {
+	integral := precision - decimals
+	uncompIntegral := integral / digitsPerInteger
+	uncompFractional := decimals / digitsPerInteger
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+	compFractional := decimals - (uncompFractional * digitsPerInteger)
+
+	return uncompIntegral*4 + compressedBytes[compIntegral] +
+		uncompFractional*4 + compressedBytes[compFractional]
+}
+
 func decodeDecimal(data []byte, precision int, decimals int, useDecimal bool) (interface{}, int, error) {
 	// see python mysql replication and https://github.com/jeremycole/mysql_binlog
 	integral := precision - decimals
@@ -1514,8 +1583,7 @@ func decodeDecimal(data []byte, precision int, decimals int, useDecimal bool) (i
 	compIntegral := integral - (uncompIntegral * digitsPerInteger)
 	compFractional := decimals - (uncompFractional * digitsPerInteger)
 
-	binSize := uncompIntegral*4 + compressedBytes[compIntegral] +
-		uncompFractional*4 + compressedBytes[compFractional]
+	binSize := decimalBinSize(precision, decimals)
 
 	buf := make([]byte, binSize)
 	copy(buf, data[:binSize])
@@ -1869,22 +1937,41 @@ func (e *RowsEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Event type: %s (%s)", e.Type(), e.eventType)
 
 	fmt.Fprintf(w, "Values:\n")
-	for _, rows := range e.Rows {
-		fmt.Fprintf(w, "--\n")
-		for j, d := range rows {
-			switch dt := d.(type) {
-			case []byte:
-				fmt.Fprintf(w, "%d:%q\n", j, dt)
-			case *JsonDiff:
-				fmt.Fprintf(w, "%d:%s\n", j, dt)
-			default:
-				fmt.Fprintf(w, "%d:%#v\n", j, d)
+	if e.lazy {
+		it := e.Iterator()
+		for it.Next() {
+			row, err := it.Row()
+			if err != nil {
+				fmt.Fprintf(w, "--\nerror: %v\n", err)
+				break
 			}
+			dumpRow(w, row)
+		}
+		if err := it.Err(); err != nil {
+			fmt.Fprintf(w, "--\nerror: %v\n", err)
+		}
+	} else {
+		for _, rows := range e.Rows {
+			dumpRow(w, rows)
 		}
 	}
 	fmt.Fprintln(w)
 }
 
+func dumpRow(w io.Writer, row []interface{}) {
+	fmt.Fprintf(w, "--\n")
+	for j, d := range row {
+		switch dt := d.(type) {
+		case []byte:
+			fmt.Fprintf(w, "%d:%q\n", j, dt)
+		case []*JsonDiff:
+			fmt.Fprintf(w, "%d:%s\n", j, dt)
+		default:
+			fmt.Fprintf(w, "%d:%#v\n", j, d)
+		}
+	}
+}
+
 type RowsQueryEvent struct {
 	Query []byte
 }
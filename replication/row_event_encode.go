@@ -0,0 +1,801 @@
+package replication
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+)
+
+// defaultTableIDSize is the table id size used by the events written with the
+// MySQL 5.6+ post-header lengths.
+const defaultTableIDSize = 6
+
+// NewRowsEvent returns a RowsEvent of the given event type for the table, so that it can be
+// encoded by a BinlogWriter. For update events, rows holds the before image and the after image
+// of every updated row in turn.
+func NewRowsEvent(eventType EventType, table *TableMapEvent, rows [][]interface{}) *RowsEvent {
+	e := &RowsEvent{
+		tableIDSize: table.tableIDSize,
+		Table:       table,
+		TableID:     table.TableID,
+		ColumnCount: table.ColumnCount,
+		Rows:        rows,
+	}
+	e.setEventType(eventType)
+
+	return e
+}
+
+func appendFixedLengthInt(data []byte, v uint64, n int) []byte {
+	for i := 0; i < n; i++ {
+		data = append(data, byte(v>>(uint(i)*8)))
+	}
+	return data
+}
+
+func appendBFixedLengthInt(data []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		data = append(data, byte(v>>(uint(i)*8)))
+	}
+	return data
+}
+
+func (e *TableMapEvent) Encode() ([]byte, error) {
+	columnCount := int(e.ColumnCount)
+	if len(e.ColumnType) != columnCount || len(e.ColumnMeta) != columnCount {
+		return nil, errors.Errorf("expect %d column types and metas, but got %d and %d", columnCount, len(e.ColumnType), len(e.ColumnMeta))
+	}
+	if len(e.Schema) > 255 || len(e.Table) > 255 {
+		return nil, errors.Errorf("schema %q or table %q is too long", e.Schema, e.Table)
+	}
+
+	tableIDSize := e.tableIDSize
+	if tableIDSize == 0 {
+		tableIDSize = defaultTableIDSize
+	}
+
+	data := make([]byte, 0, 64+len(e.Schema)+len(e.Table)+3*columnCount)
+	data = appendFixedLengthInt(data, e.TableID, tableIDSize)
+	data = binary.LittleEndian.AppendUint16(data, e.Flags)
+
+	data = append(data, byte(len(e.Schema)))
+	data = append(data, e.Schema...)
+	data = append(data, 0x00)
+
+	data = append(data, byte(len(e.Table)))
+	data = append(data, e.Table...)
+	data = append(data, 0x00)
+
+	data = mysql.AppendLengthEncodedInteger(data, e.ColumnCount)
+	data = append(data, e.ColumnType...)
+
+	meta, err := e.encodeMeta()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data = mysql.AppendLengthEncodedInteger(data, uint64(len(meta)))
+	data = append(data, meta...)
+
+	nullBitmapSize := bitmapByteSize(columnCount)
+	switch len(e.NullBitmap) {
+	case 0:
+		data = append(data, make([]byte, nullBitmapSize)...)
+	case nullBitmapSize:
+		data = append(data, e.NullBitmap...)
+	default:
+		return nil, errors.Errorf("invalid null bitmap length %d, must %d", len(e.NullBitmap), nullBitmapSize)
+	}
+
+	return e.encodeOptionalMeta(data), nil
+}
+
+// encodeMeta is the reverse of decodeMeta.
+func (e *TableMapEvent) encodeMeta() ([]byte, error) {
+	data := make([]byte, 0, 2*len(e.ColumnType))
+	for i, t := range e.ColumnType {
+		meta := e.ColumnMeta[i]
+		switch t {
+		case mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_NEWDECIMAL:
+			data = append(data, byte(meta>>8), byte(meta))
+		case mysql.MYSQL_TYPE_VAR_STRING,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BIT:
+			data = binary.LittleEndian.AppendUint16(data, meta)
+		case mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_DOUBLE,
+			mysql.MYSQL_TYPE_FLOAT,
+			mysql.MYSQL_TYPE_GEOMETRY,
+			mysql.MYSQL_TYPE_VECTOR,
+			mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_TIME2,
+			mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_TIMESTAMP2:
+			data = append(data, byte(meta))
+		case mysql.MYSQL_TYPE_NEWDATE,
+			mysql.MYSQL_TYPE_ENUM,
+			mysql.MYSQL_TYPE_SET,
+			mysql.MYSQL_TYPE_TINY_BLOB,
+			mysql.MYSQL_TYPE_MEDIUM_BLOB,
+			mysql.MYSQL_TYPE_LONG_BLOB:
+			return nil, errors.Errorf("unsupport type in binlog %d", t)
+		}
+	}
+
+	return data, nil
+}
+
+// encodeOptionalMeta appends the optional metadata fields in the same order as MySQL writes them.
+func (e *TableMapEvent) encodeOptionalMeta(data []byte) []byte {
+	appendField := func(t byte, v []byte) {
+		if len(v) == 0 {
+			return
+		}
+		data = append(data, t)
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(v)))
+		data = append(data, v...)
+	}
+
+	appendField(TABLE_MAP_OPT_META_SIGNEDNESS, e.SignednessBitmap)
+	appendField(TABLE_MAP_OPT_META_DEFAULT_CHARSET, encodeIntSeq(e.DefaultCharset))
+	appendField(TABLE_MAP_OPT_META_COLUMN_CHARSET, encodeIntSeq(e.ColumnCharset))
+	appendField(TABLE_MAP_OPT_META_COLUMN_NAME, encodeStrSeq(e.ColumnName))
+	appendField(TABLE_MAP_OPT_META_SET_STR_VALUE, encodeStrValue(e.SetStrValue))
+	appendField(TABLE_MAP_OPT_META_ENUM_STR_VALUE, encodeStrValue(e.EnumStrValue))
+	appendField(TABLE_MAP_OPT_META_GEOMETRY_TYPE, encodeIntSeq(e.GeometryType))
+
+	simplePrimaryKey := true
+	for _, prefix := range e.PrimaryKeyPrefix {
+		if prefix != 0 {
+			simplePrimaryKey = false
+			break
+		}
+	}
+	if simplePrimaryKey {
+		appendField(TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, encodeIntSeq(e.PrimaryKey))
+	} else {
+		var v []byte
+		for i, column := range e.PrimaryKey {
+			v = mysql.AppendLengthEncodedInteger(v, column)
+			if i < len(e.PrimaryKeyPrefix) {
+				v = mysql.AppendLengthEncodedInteger(v, e.PrimaryKeyPrefix[i])
+			} else {
+				v = mysql.AppendLengthEncodedInteger(v, 0)
+			}
+		}
+		appendField(TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX, v)
+	}
+
+	appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET, encodeIntSeq(e.EnumSetDefaultCharset))
+	appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET, encodeIntSeq(e.EnumSetColumnCharset))
+	appendField(TABLE_MAP_OPT_META_COLUMN_VISIBILITY, e.VisibilityBitmap)
+
+	return data
+}
+
+func encodeIntSeq(seq []uint64) []byte {
+	var data []byte
+	for _, i := range seq {
+		data = mysql.AppendLengthEncodedInteger(data, i)
+	}
+	return data
+}
+
+func encodeStrSeq(seq [][]byte) []byte {
+	var data []byte
+	for _, s := range seq {
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(s)))
+		data = append(data, s...)
+	}
+	return data
+}
+
+func encodeStrValue(values [][][]byte) []byte {
+	var data []byte
+	for _, vals := range values {
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(vals)))
+		data = append(data, encodeStrSeq(vals)...)
+	}
+	return data
+}
+
+// Encode encodes the RowsEvent with the column types of its Table. Every row value must have
+// one of the Go types listed in the RowsEvent doc, partial JSON updates and MariaDB compressed
+// events are not supported.
+func (e *RowsEvent) Encode() ([]byte, error) {
+	if e.Table == nil {
+		return nil, errors.Annotatef(errMissingTableMapEvent, "table id %d", e.TableID)
+	}
+	if e.compressed {
+		return nil, errors.New("encoding MariaDB compressed rows event is not supported")
+	}
+	if e.eventType == PARTIAL_UPDATE_ROWS_EVENT {
+		return nil, errors.New("encoding partial update rows event is not supported")
+	}
+
+	columnCount := int(e.ColumnCount)
+	if columnCount != len(e.Table.ColumnType) {
+		return nil, errors.Errorf("column count %d mismatches table map event column count %d", columnCount, len(e.Table.ColumnType))
+	}
+	rows, _, err := e.decodedRows()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if e.needBitmap2 && len(rows)%2 != 0 {
+		return nil, errors.Errorf("update rows event needs both before and after image, but got %d rows", len(rows))
+	}
+
+	tableIDSize := e.tableIDSize
+	if tableIDSize == 0 {
+		tableIDSize = defaultTableIDSize
+	}
+
+	data := make([]byte, 0, 1024)
+	data = appendFixedLengthInt(data, e.TableID, tableIDSize)
+	data = binary.LittleEndian.AppendUint16(data, e.Flags)
+	if e.Version == 2 {
+		// no extra row info
+		data = binary.LittleEndian.AppendUint16(data, 2)
+	}
+	data = mysql.AppendLengthEncodedInteger(data, e.ColumnCount)
+
+	bitmap1, err := fullBitmapIfEmpty(e.ColumnBitmap1, columnCount)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data = append(data, bitmap1...)
+
+	bitmap2 := bitmap1
+	if e.needBitmap2 {
+		if bitmap2, err = fullBitmapIfEmpty(e.ColumnBitmap2, columnCount); err != nil {
+			return nil, errors.Trace(err)
+		}
+		data = append(data, bitmap2...)
+	}
+
+	for i, row := range rows {
+		bitmap := bitmap1
+		if e.needBitmap2 && i%2 == 1 {
+			bitmap = bitmap2
+		}
+		if data, err = e.encodeImage(data, row, bitmap); err != nil {
+			return nil, errors.Annotatef(err, "row %d", i)
+		}
+	}
+
+	return data, nil
+}
+
+func fullBitmapIfEmpty(bitmap []byte, columnCount int) ([]byte, error) {
+	size := bitmapByteSize(columnCount)
+	if len(bitmap) == 0 {
+		bitmap = make([]byte, size)
+		for i := 0; i < columnCount; i++ {
+			bitmap[i>>3] |= 1 << (uint(i) & 7)
+		}
+		return bitmap, nil
+	}
+	if len(bitmap) != size {
+		return nil, errors.Errorf("invalid column bitmap length %d, must %d", len(bitmap), size)
+	}
+	return bitmap, nil
+}
+
+func (e *RowsEvent) encodeImage(data []byte, row []interface{}, bitmap []byte) ([]byte, error) {
+	columnCount := int(e.ColumnCount)
+	if len(row) < columnCount {
+		return nil, errors.Errorf("expect %d columns, but got %d", columnCount, len(row))
+	}
+
+	count := 0
+	for i := 0; i < columnCount; i++ {
+		if isBitSet(bitmap, i) {
+			count++
+		}
+	}
+
+	nullBitmapPos := len(data)
+	data = append(data, make([]byte, bitmapByteSize(count))...)
+
+	var err error
+	nullBitmapIndex := 0
+	for i := 0; i < columnCount; i++ {
+		if !isBitSet(bitmap, i) {
+			continue
+		}
+
+		if row[i] == nil {
+			data[nullBitmapPos+nullBitmapIndex>>3] |= 1 << (uint(nullBitmapIndex) & 7)
+			nullBitmapIndex++
+			continue
+		}
+		nullBitmapIndex++
+
+		if data, err = e.encodeValue(data, row[i], e.Table.ColumnType[i], e.Table.ColumnMeta[i]); err != nil {
+			return nil, errors.Annotatef(err, "column %d", i)
+		}
+	}
+
+	return data, nil
+}
+
+// encodeValue is the reverse of decodeValue.
+func (e *RowsEvent) encodeValue(data []byte, v interface{}, tp byte, meta uint16) ([]byte, error) {
+	length := 0
+
+	if tp == mysql.MYSQL_TYPE_STRING {
+		if meta >= 256 {
+			b0 := uint8(meta >> 8)
+			b1 := uint8(meta & 0xFF)
+
+			if b0&0x30 != 0x30 {
+				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+				tp = b0 | 0x30
+			} else {
+				length = int(meta & 0xFF)
+				tp = b0
+			}
+		} else {
+			length = int(meta)
+		}
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return data, nil
+	case mysql.MYSQL_TYPE_TINY:
+		return appendIntValue(data, v, 1)
+	case mysql.MYSQL_TYPE_SHORT:
+		return appendIntValue(data, v, 2)
+	case mysql.MYSQL_TYPE_INT24:
+		return appendIntValue(data, v, 3)
+	case mysql.MYSQL_TYPE_LONG:
+		return appendIntValue(data, v, 4)
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return appendIntValue(data, v, 8)
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return appendDecimal(data, v, int(meta>>8), int(meta&0xFF))
+	case mysql.MYSQL_TYPE_FLOAT:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(f))), nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(data, math.Float64bits(f)), nil
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		u, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBFixedLengthInt(data, u, int(nbits+7)/8), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		sec, _, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(data, uint32(sec)), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		sec, usec, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(sec))
+		return appendFrac(data, usec, meta), nil
+	case mysql.MYSQL_TYPE_DATETIME:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		d := uint64(dt.year*10000 + dt.month*100 + dt.day)
+		t := uint64(dt.hour*10000 + dt.minute*100 + dt.second)
+		return binary.LittleEndian.AppendUint64(data, d*1000000+t), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		ymd := int64((dt.year*13+dt.month)<<5 | dt.day)
+		hms := int64(dt.hour<<12 | dt.minute<<6 | dt.second)
+		data = appendBFixedLengthInt(data, uint64((ymd<<17|hms)+DATETIMEF_INT_OFS), 5)
+		return appendFrac(data, dt.usec, meta), nil
+	case mysql.MYSQL_TYPE_TIME:
+		tm, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, uint64(tm.hour*10000+tm.minute*100+tm.second), 3), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		tm, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendTime2(data, tm, meta), nil
+	case mysql.MYSQL_TYPE_DATE:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, uint64(dt.year*16*32+dt.month*32+dt.day), 3), nil
+	case mysql.MYSQL_TYPE_YEAR:
+		year, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		if year != 0 {
+			year -= 1900
+		}
+		return append(data, byte(year)), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		l := int(meta & 0xFF)
+		if l != 1 && l != 2 {
+			return nil, errors.Errorf("unknown ENUM packlen=%d", l)
+		}
+		return appendIntValue(data, v, l)
+	case mysql.MYSQL_TYPE_SET:
+		u, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, u, int(meta&0xFF)), nil
+	case mysql.MYSQL_TYPE_BLOB,
+		mysql.MYSQL_TYPE_GEOMETRY,
+		mysql.MYSQL_TYPE_VECTOR:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBlob(data, b, meta)
+	case mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_VAR_STRING:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(data, b, int(meta)), nil
+	case mysql.MYSQL_TYPE_STRING:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(data, b, length), nil
+	case mysql.MYSQL_TYPE_JSON:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 0 {
+			if b, err = encodeJsonBinary(b); err != nil {
+				return nil, err
+			}
+		}
+		return appendBlob(data, b, meta)
+	default:
+		return nil, errors.Errorf("unsupport type %d in binlog and don't know how to handle", tp)
+	}
+}
+
+// appendIntValue appends the n low bytes of an integer value, both signed and unsigned Go integers are accepted.
+func appendIntValue(data []byte, v interface{}, n int) ([]byte, error) {
+	u, err := toUint64(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendFixedLengthInt(data, u, n), nil
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), nil
+	case int8:
+		return uint64(v), nil
+	case int16:
+		return uint64(v), nil
+	case int32:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case uint:
+		return uint64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	default:
+		return 0, errors.Errorf("invalid integer value %v(%T)", v, v)
+	}
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, errors.Errorf("invalid float value %v(%T)", v, v)
+	}
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.Errorf("invalid string value %v(%T)", v, v)
+	}
+}
+
+func appendString(data []byte, b []byte, length int) []byte {
+	if length < 256 {
+		data = append(data, byte(len(b)))
+	} else {
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(b)))
+	}
+	return append(data, b...)
+}
+
+func appendBlob(data []byte, b []byte, meta uint16) ([]byte, error) {
+	if meta < 1 || meta > 4 {
+		return nil, errors.Errorf("invalid blob packlen = %d", meta)
+	}
+	if uint64(len(b)) >= uint64(1)<<(8*meta) {
+		return nil, errors.Errorf("blob length %d exceeds packlen %d", len(b), meta)
+	}
+	data = appendFixedLengthInt(data, uint64(len(b)), int(meta))
+	return append(data, b...), nil
+}
+
+// appendDecimal is the reverse of decodeDecimal, v can be a string or decimal.Decimal.
+func appendDecimal(data []byte, v interface{}, precision int, decimals int) ([]byte, error) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case decimal.Decimal:
+		s = v.StringFixed(int32(decimals))
+	default:
+		return nil, errors.Errorf("invalid decimal value %v(%T)", v, v)
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	intPart = strings.TrimLeft(intPart, "0")
+
+	integral := precision - decimals
+	if len(intPart) > integral {
+		return nil, errors.Errorf("decimal %q overflows DECIMAL(%d,%d)", v, precision, decimals)
+	}
+	if len(fracPart) > decimals {
+		fracPart = fracPart[:decimals]
+	}
+	intPart = strings.Repeat("0", integral-len(intPart)) + intPart
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+
+	uncompIntegral := integral / digitsPerInteger
+	uncompFractional := decimals / digitsPerInteger
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+
+	start := len(data)
+	appendDigits := func(digits string) error {
+		if len(digits) == 0 {
+			return nil
+		}
+		value, err := strconv.ParseUint(digits, 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid decimal %q", v)
+		}
+		data = appendBFixedLengthInt(data, value, compressedBytes[len(digits)])
+		return nil
+	}
+
+	if err := appendDigits(intPart[:compIntegral]); err != nil {
+		return nil, err
+	}
+	for i := compIntegral; i < integral; i += digitsPerInteger {
+		if err := appendDigits(intPart[i : i+digitsPerInteger]); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < uncompFractional*digitsPerInteger; i += digitsPerInteger {
+		if err := appendDigits(fracPart[i : i+digitsPerInteger]); err != nil {
+			return nil, err
+		}
+	}
+	if err := appendDigits(fracPart[uncompFractional*digitsPerInteger:]); err != nil {
+		return nil, err
+	}
+
+	if negative {
+		for i := start; i < len(data); i++ {
+			data[i] ^= 0xFF
+		}
+	}
+	data[start] ^= 0x80
+
+	return data, nil
+}
+
+// timestampValue returns the seconds since epoch and the microseconds of a TIMESTAMP value.
+func (e *RowsEvent) timestampValue(v interface{}) (sec int64, usec int, err error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Unix(), v.Nanosecond() / 1000, nil
+	case string:
+		dt, err := parseDatetime(v)
+		if err != nil {
+			return 0, 0, err
+		}
+		if dt.year == 0 && dt.month == 0 && dt.day == 0 {
+			return 0, dt.usec, nil
+		}
+		loc := e.timestampStringLocation
+		if loc == nil {
+			loc = time.Local
+		}
+		t := time.Date(dt.year, time.Month(dt.month), dt.day, dt.hour, dt.minute, dt.second, 0, loc)
+		return t.Unix(), dt.usec, nil
+	default:
+		return 0, 0, errors.Errorf("invalid timestamp value %v(%T)", v, v)
+	}
+}
+
+func appendFrac(data []byte, usec int, dec uint16) []byte {
+	switch dec {
+	case 1, 2:
+		data = append(data, byte(usec/10000))
+	case 3, 4:
+		data = binary.BigEndian.AppendUint16(data, uint16(usec/100))
+	case 5, 6:
+		data = appendBFixedLengthInt(data, uint64(usec), 3)
+	}
+	return data
+}
+
+type datetimeValue struct {
+	year, month, day           int
+	hour, minute, second, usec int
+	negative                   bool
+}
+
+func toDatetime(v interface{}) (datetimeValue, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return datetimeValue{
+			year: v.Year(), month: int(v.Month()), day: v.Day(),
+			hour: v.Hour(), minute: v.Minute(), second: v.Second(), usec: v.Nanosecond() / 1000,
+		}, nil
+	case string:
+		return parseDatetime(v)
+	default:
+		return datetimeValue{}, errors.Errorf("invalid datetime value %v(%T)", v, v)
+	}
+}
+
+// parseDatetime parses "YYYY-MM-DD[ HH:MM:SS[.ffffff]]", zero dates are allowed.
+func parseDatetime(s string) (dt datetimeValue, err error) {
+	date, clock, hasClock := strings.Cut(s, " ")
+
+	fields := strings.Split(date, "-")
+	if len(fields) != 3 {
+		return dt, errors.Errorf("invalid datetime %q", s)
+	}
+	if dt.year, err = strconv.Atoi(fields[0]); err != nil {
+		return dt, errors.Errorf("invalid datetime %q", s)
+	}
+	if dt.month, err = strconv.Atoi(fields[1]); err != nil {
+		return dt, errors.Errorf("invalid datetime %q", s)
+	}
+	if dt.day, err = strconv.Atoi(fields[2]); err != nil {
+		return dt, errors.Errorf("invalid datetime %q", s)
+	}
+
+	if hasClock {
+		tm, err := parseTime(clock)
+		if err != nil || tm.negative {
+			return dt, errors.Errorf("invalid datetime %q", s)
+		}
+		dt.hour, dt.minute, dt.second, dt.usec = tm.hour, tm.minute, tm.second, tm.usec
+	}
+
+	return dt, nil
+}
+
+func toTime(v interface{}) (datetimeValue, error) {
+	s, ok := v.(string)
+	if !ok {
+		return datetimeValue{}, errors.Errorf("invalid time value %v(%T)", v, v)
+	}
+	return parseTime(s)
+}
+
+// parseTime parses "[-]HH:MM:SS[.ffffff]".
+func parseTime(s string) (tm datetimeValue, err error) {
+	clock := s
+	if strings.HasPrefix(clock, "-") {
+		tm.negative = true
+		clock = clock[1:]
+	}
+
+	clock, frac, hasFrac := strings.Cut(clock, ".")
+	fields := strings.Split(clock, ":")
+	if len(fields) != 3 {
+		return tm, errors.Errorf("invalid time %q", s)
+	}
+	if tm.hour, err = strconv.Atoi(fields[0]); err != nil {
+		return tm, errors.Errorf("invalid time %q", s)
+	}
+	if tm.minute, err = strconv.Atoi(fields[1]); err != nil {
+		return tm, errors.Errorf("invalid time %q", s)
+	}
+	if tm.second, err = strconv.Atoi(fields[2]); err != nil {
+		return tm, errors.Errorf("invalid time %q", s)
+	}
+
+	if hasFrac {
+		if len(frac) == 0 || len(frac) > 6 {
+			return tm, errors.Errorf("invalid time %q", s)
+		}
+		frac += strings.Repeat("0", 6-len(frac))
+		if tm.usec, err = strconv.Atoi(frac); err != nil {
+			return tm, errors.Errorf("invalid time %q", s)
+		}
+	}
+
+	return tm, nil
+}
+
+// appendTime2 is the reverse of decodeTime2, see my_time_packed_to_binary in MySQL.
+func appendTime2(data []byte, tm datetimeValue, dec uint16) []byte {
+	hms := int64(tm.hour<<12 | tm.minute<<6 | tm.second)
+	packed := hms<<24 + int64(tm.usec)
+	if tm.negative {
+		packed = -packed
+	}
+
+	intPart := packed >> 24
+	frac := packed % (1 << 24)
+
+	switch dec {
+	case 1, 2:
+		data = appendBFixedLengthInt(data, uint64(intPart+TIMEF_INT_OFS), 3)
+		data = append(data, byte(int8(frac/10000)))
+	case 3, 4:
+		data = appendBFixedLengthInt(data, uint64(intPart+TIMEF_INT_OFS), 3)
+		data = binary.BigEndian.AppendUint16(data, uint16(int16(frac/100)))
+	case 5, 6:
+		data = appendBFixedLengthInt(data, uint64(packed+TIMEF_OFS), 6)
+	default:
+		data = appendBFixedLengthInt(data, uint64(intPart+TIMEF_INT_OFS), 3)
+	}
+
+	return data
+}
+
+func (e *RowsQueryEvent) Encode() ([]byte, error) {
+	// the length byte is ignored by readers, MySQL stores the length truncated to one byte
+	data := make([]byte, 0, 1+len(e.Query))
+	data = append(data, byte(min(len(e.Query), 255)))
+	return append(data, e.Query...), nil
+}
@@ -0,0 +1,222 @@
+package replication
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// newTestWideRowsEvent returns a lazy write rows event of a table like
+//
+//	CREATE TABLE t (id BIGINT, k INT, name VARCHAR(64), body BLOB, score DOUBLE, note VARCHAR(64))
+//
+// the note is NULL in the odd rows.
+func newTestWideRowsEvent(rows int) *RowsEvent {
+	table := &TableMapEvent{
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_VARCHAR,
+		},
+		ColumnMeta: []uint16{0, 0, 255, 2, 0, 255},
+	}
+
+	body := strings.Repeat("b", 300)
+	var data []byte
+	for i := 0; i < rows; i++ {
+		var nullBitmap byte
+		if i%2 == 1 {
+			nullBitmap = 1 << 5
+		}
+		data = append(data, nullBitmap)
+		data = binary.LittleEndian.AppendUint64(data, uint64(i))
+		data = binary.LittleEndian.AppendUint32(data, uint32(-i))
+		data = append(data, byte(len("name")))
+		data = append(data, "name"...)
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(body)))
+		data = append(data, body...)
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(float64(i)/2))
+		if i%2 == 0 {
+			data = append(data, byte(len("note")))
+			data = append(data, "note"...)
+		}
+	}
+
+	return &RowsEvent{
+		eventType:     WRITE_ROWS_EVENTv2,
+		Table:         table,
+		ColumnCount:   uint64(len(table.ColumnType)),
+		ColumnBitmap1: []byte{0x3f},
+		rowsData:      data,
+		lazy:          true,
+	}
+}
+
+func TestRowTypedAccess(t *testing.T) {
+	e := newTestWideRowsEvent(4)
+	it := e.Iterator()
+	i := 0
+	for it.Next() {
+		row := it.TypedRow()
+		require.Equal(t, 6, row.Len())
+
+		id, err := row.Int64(0)
+		require.NoError(t, err)
+		require.Equal(t, int64(i), id)
+
+		k, err := row.Int64(1)
+		require.NoError(t, err)
+		require.Equal(t, int64(-i), k)
+		uk, err := row.Uint64(1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(uint32(-i)), uk)
+
+		name, err := row.String(2)
+		require.NoError(t, err)
+		require.Equal(t, "name", name)
+
+		body, err := row.Bytes(3)
+		require.NoError(t, err)
+		require.Equal(t, []byte(strings.Repeat("b", 300)), body)
+
+		score, err := row.Float64(4)
+		require.NoError(t, err)
+		require.Equal(t, float64(i)/2, score)
+
+		note, err := row.String(5)
+		require.NoError(t, err)
+		if i%2 == 1 {
+			require.True(t, row.IsNull(5))
+			require.False(t, row.IsSkipped(5))
+			require.Empty(t, note)
+		} else {
+			require.False(t, row.IsNull(5))
+			require.Equal(t, "note", note)
+		}
+
+		// the values are the same as the decoded ones
+		values, err := it.Row()
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{int64(i), int32(-i), "name", body, float64(i) / 2, values[5]}, values)
+
+		// the wrong types
+		_, err = row.Int64(2)
+		require.Error(t, err)
+		_, err = row.Bytes(0)
+		require.Error(t, err)
+		_, err = row.Float64(5)
+		require.Error(t, err)
+		require.Equal(t, mysql.MYSQL_TYPE_DOUBLE, row.Type(4))
+
+		i++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 4, i)
+}
+
+func TestRowTypedAccessTypes(t *testing.T) {
+	// the table of TestParseRowPanic
+	tableMapEvent := new(TableMapEvent)
+	tableMapEvent.tableIDSize = 6
+	tableMapEvent.TableID = 1810
+	tableMapEvent.ColumnType = []byte{3, 15, 15, 15, 9, 15, 15, 252, 3, 3, 3, 15, 3, 3, 3, 15, 3, 15, 1, 15, 3, 1, 252, 15, 15, 15}
+	tableMapEvent.ColumnMeta = []uint16{0, 108, 60, 765, 0, 765, 765, 4, 0, 0, 0, 765, 0, 0, 0, 3, 0, 3, 0, 765, 0, 0, 2, 108, 108, 108}
+
+	e := new(RowsEvent)
+	e.tableIDSize = 6
+	e.tables = map[uint64]*TableMapEvent{tableMapEvent.TableID: tableMapEvent}
+	e.Version = 2
+	e.eventType = WRITE_ROWS_EVENTv2
+	e.lazy = true
+
+	data := []byte{18, 7, 0, 0, 0, 0, 1, 0, 2, 0, 26, 1, 1, 16, 252, 248, 142, 63, 0, 0, 13, 0, 0, 0, 13, 0, 0, 0}
+	err := e.Decode(data)
+	require.NoError(t, err)
+
+	it := e.Iterator()
+	require.True(t, it.Next())
+	row := it.TypedRow()
+	for i := 0; i < row.Len(); i++ {
+		v, err := row.Value(i)
+		require.NoError(t, err)
+		switch v := v.(type) {
+		case nil:
+			require.True(t, row.IsNull(i))
+		case int8, int16, int32, int64:
+			n, err := row.Int64(i)
+			require.NoError(t, err)
+			require.EqualValues(t, v, n)
+		case string:
+			s, err := row.String(i)
+			require.NoError(t, err)
+			require.Equal(t, v, s)
+		case []byte:
+			b, err := row.Bytes(i)
+			require.NoError(t, err)
+			require.Equal(t, v, b)
+		default:
+			require.FailNow(t, "unexpected type", "%T", v)
+		}
+	}
+}
+
+func BenchmarkRowsEventDecodeRows(b *testing.B) {
+	e := newTestWideRowsEvent(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		e.Rows = nil
+		e.SkippedColumns = nil
+		for pos := 0; pos < len(e.rowsData); {
+			size, err := e.decodeImage(e.rowsData[pos:], e.ColumnBitmap1, EnumRowImageTypeWriteAI)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pos += size
+		}
+
+		var sum int64
+		for _, row := range e.Rows {
+			sum += row[0].(int64) + int64(row[1].(int32)) + int64(len(row[2].(string))+len(row[3].([]byte)))
+		}
+	}
+}
+
+func BenchmarkRowsIteratorRow(b *testing.B) {
+	e := newTestWideRowsEvent(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var sum int64
+		it := e.Iterator()
+		for it.Next() {
+			row, err := it.Row()
+			if err != nil {
+				b.Fatal(err)
+			}
+			sum += row[0].(int64) + int64(row[1].(int32)) + int64(len(row[2].(string))+len(row[3].([]byte)))
+		}
+	}
+}
+
+func BenchmarkRowsIteratorTypedRow(b *testing.B) {
+	e := newTestWideRowsEvent(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var sum int64
+		it := e.Iterator()
+		for it.Next() {
+			row := it.TypedRow()
+			id, _ := row.Int64(0)
+			k, _ := row.Int64(1)
+			name, _ := row.Bytes(2)
+			body, _ := row.Bytes(3)
+			sum += id + k + int64(len(name)+len(body))
+		}
+	}
+}
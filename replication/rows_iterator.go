@@ -0,0 +1,291 @@
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// the offsets of the columns without value in RowsIterator
+const (
+	nullColumnOffset    = -1
+	skippedColumnOffset = -2
+)
+
+// RowsIterator decodes the rows of a RowsEvent one by one from the raw data, so a huge event
+// doesn't take the memory of all its decoded rows. The columns are decoded only when they're
+// read. Like RowsEvent.Rows, the before and after images of an update are two rows in turn.
+//
+//	it := e.Iterator()
+//	for it.Next() {
+//		row, err := it.Row()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RowsIterator struct {
+	e    *RowsEvent
+	data []byte
+	pos  int
+	// the number of the images read
+	images int
+
+	imageType EnumRowImageType
+	// the offsets of the column values in data
+	offsets []int
+	// whether the columns are partial JSON updates
+	partial []bool
+	skipped []int
+	row     []interface{}
+
+	err error
+}
+
+// Iterator returns a RowsIterator of the rows. The rows are decoded again if they're in Rows
+// already.
+func (e *RowsEvent) Iterator() *RowsIterator {
+	return &RowsIterator{
+		e:       e,
+		data:    e.rowsData,
+		offsets: make([]int, e.ColumnCount),
+		partial: make([]bool, e.ColumnCount),
+	}
+}
+
+// decodedRows returns Rows and SkippedColumns, the rows decoded lazily are decoded by an
+// iterator without being kept in the event.
+func (e *RowsEvent) decodedRows() ([][]interface{}, [][]int, error) {
+	if !e.lazy || e.Rows != nil {
+		return e.Rows, e.SkippedColumns, nil
+	}
+
+	var rows [][]interface{}
+	var skipped [][]int
+	it := e.Iterator()
+	for it.Next() {
+		row, err := it.Row()
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		rows = append(rows, slices.Clone(row))
+		// like the rows decoded eagerly, the skipped columns of every image aren't nil
+		skipped = append(skipped, append([]int{}, it.SkippedColumns()...))
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return rows, skipped, nil
+}
+
+// Next moves to the next row, it returns false if there are no more rows or an error occurs.
+func (it *RowsIterator) Next() bool {
+	if it.err != nil || it.pos >= len(it.data) {
+		return false
+	}
+
+	it.imageType = it.e.firstImageType()
+	bitmap := it.e.ColumnBitmap1
+	if it.e.needBitmap2 && it.images%2 == 1 {
+		it.imageType = EnumRowImageTypeUpdateAI
+		bitmap = it.e.ColumnBitmap2
+	}
+
+	n, err := it.scanImage(it.data[it.pos:], bitmap)
+	if err != nil {
+		it.err = errors.Trace(err)
+		return false
+	}
+	it.pos += n
+	it.images++
+	it.row = it.row[:0]
+	return true
+}
+
+// Err returns the error occurred in Next.
+func (it *RowsIterator) Err() error {
+	return it.err
+}
+
+// ImageType returns the image type of the current row.
+func (it *RowsIterator) ImageType() EnumRowImageType {
+	return it.imageType
+}
+
+// SkippedColumns returns the indexes of the columns not in the current row image.
+func (it *RowsIterator) SkippedColumns() []int {
+	return it.skipped
+}
+
+// IsNull returns whether the column of the current row is NULL or skipped.
+func (it *RowsIterator) IsNull(i int) bool {
+	return it.offsets[i] < 0
+}
+
+// Column decodes the column of the current row, the value is the same as RowsEvent.Rows.
+func (it *RowsIterator) Column(i int) (v interface{}, err error) {
+	offset := it.offsets[i]
+	if offset < 0 {
+		return nil, nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("decode column %d panic %v", i, r)
+		}
+	}()
+	v, _, err = it.e.decodeValue(it.data[offset:], it.e.Table.ColumnType[i], it.e.Table.ColumnMeta[i], it.partial[i])
+	return v, errors.Trace(err)
+}
+
+// Row decodes all the columns of the current row. The row is reused by the next row, so copy it
+// if it's kept.
+func (it *RowsIterator) Row() ([]interface{}, error) {
+	if len(it.row) > 0 {
+		return it.row, nil
+	}
+
+	row := it.row[:0]
+	for i := range it.offsets {
+		v, err := it.Column(i)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+	}
+	it.row = row
+	return row, nil
+}
+
+// scanImage finds the offsets of the columns of the row image like RowsEvent.decodeImage, but
+// without decoding them.
+func (it *RowsIterator) scanImage(data []byte, bitmap []byte) (pos int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("scan rows event panic %v, data %q, image %d", r, data, it.images)
+		}
+	}()
+
+	e := it.e
+	columnCount := int(e.ColumnCount)
+
+	var isPartialJsonUpdate bool
+	var partialBitmap []byte
+	if e.eventType == PARTIAL_UPDATE_ROWS_EVENT && it.imageType == EnumRowImageTypeUpdateAI {
+		binlogRowValueOptions, _, n := mysql.LengthEncodedInt(data[pos:])
+		pos += n
+		isPartialJsonUpdate = EnumBinlogRowValueOptions(binlogRowValueOptions)&EnumBinlogRowValueOptionsPartialJsonUpdates != 0
+		if isPartialJsonUpdate {
+			byteCount := bitmapByteSize(int(e.Table.JsonColumnCount()))
+			partialBitmap = data[pos : pos+byteCount]
+			pos += byteCount
+		}
+	}
+
+	count := 0
+	for i := 0; i < columnCount; i += 8 {
+		b := bitmap[i>>3]
+		if columnCount-i < 8 {
+			b &= byte(1<<(columnCount-i)) - 1
+		}
+		count += bits.OnesCount8(b)
+	}
+	count = bitmapByteSize(count)
+	nullBitmap := data[pos : pos+count]
+	pos += count
+
+	it.skipped = it.skipped[:0]
+	partialBitmapIndex := 0
+	nullBitmapIndex := 0
+	for i := 0; i < columnCount; i++ {
+		it.partial[i] = isPartialJsonUpdate &&
+			e.Table.ColumnType[i] == mysql.MYSQL_TYPE_JSON &&
+			isBitSetIncr(partialBitmap, &partialBitmapIndex)
+
+		if !isBitSet(bitmap, i) {
+			it.offsets[i] = skippedColumnOffset
+			it.skipped = append(it.skipped, i)
+			continue
+		}
+		if isBitSetIncr(nullBitmap, &nullBitmapIndex) {
+			it.offsets[i] = nullColumnOffset
+			continue
+		}
+
+		n, err := columnValueLength(data[pos:], e.Table.ColumnType[i], e.Table.ColumnMeta[i])
+		if err != nil {
+			return 0, err
+		}
+		it.offsets[i] = it.pos + pos
+		pos += n
+	}
+	if pos > len(data) {
+		return 0, errors.Errorf("rows event data is too short, need %d but got %d", pos, len(data))
+	}
+	return pos, nil
+}
+
+// columnValueLength returns the length of the column value in the row image, like the length
+// returned by RowsEvent.decodeValue.
+func columnValueLength(data []byte, tp byte, meta uint16) (int, error) {
+	tp, length := realColumnType(tp, meta)
+
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return 0, nil
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_YEAR:
+		return 1, nil
+	case mysql.MYSQL_TYPE_SHORT:
+		return 2, nil
+	case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_DATE:
+		return 3, nil
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_TIMESTAMP:
+		return 4, nil
+	case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_DATETIME:
+		return 8, nil
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return decimalBinSize(int(meta>>8), int(meta&0xFF)), nil
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		return int(nbits+7) / 8, nil
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		return int(4 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		return int(5 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		return int(3 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		if l := meta & 0xFF; l == 1 || l == 2 {
+			return int(l), nil
+		}
+		return 0, fmt.Errorf("unknown ENUM packlen=%d", meta&0xFF)
+	case mysql.MYSQL_TYPE_SET:
+		return int(meta & 0xFF), nil
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR:
+		if meta < 1 || meta > 4 {
+			return 0, fmt.Errorf("invalid blob packlen = %d", meta)
+		}
+		return int(mysql.FixedLengthInt(data[:meta])) + int(meta), nil
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return stringValueLength(data, int(meta)), nil
+	case mysql.MYSQL_TYPE_STRING:
+		return stringValueLength(data, length), nil
+	case mysql.MYSQL_TYPE_JSON:
+		return int(mysql.FixedLengthInt(data[:meta])) + int(meta), nil
+	default:
+		return 0, fmt.Errorf("unsupport type %d in binlog and don't know how to handle", tp)
+	}
+}
+
+// stringValueLength returns the length of the string value like decodeString.
+func stringValueLength(data []byte, length int) int {
+	if length < 256 {
+		return int(data[0]) + 1
+	}
+	return int(binary.LittleEndian.Uint16(data)) + 2
+}
@@ -0,0 +1,223 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireIteratorRows checks the rows decoded by the iterator are the same as RowsEvent.Rows.
+func requireIteratorRows(t *testing.T, e *RowsEvent) {
+	it := e.Iterator()
+	i := 0
+	for it.Next() {
+		require.Less(t, i, len(e.Rows))
+		row, err := it.Row()
+		require.NoError(t, err)
+		require.Equal(t, e.Rows[i], row)
+		if len(e.SkippedColumns[i]) == 0 {
+			require.Empty(t, it.SkippedColumns())
+		} else {
+			require.Equal(t, e.SkippedColumns[i], it.SkippedColumns())
+		}
+		for j := range row {
+			require.Equal(t, row[j] == nil, it.IsNull(j))
+		}
+		i++
+	}
+	require.NoError(t, it.Err())
+	require.Len(t, e.Rows, i)
+}
+
+func newTestRowsEvent(t *testing.T, tableData []byte, eventType EventType) *RowsEvent {
+	tableMapEvent := new(TableMapEvent)
+	tableMapEvent.tableIDSize = 6
+	err := tableMapEvent.Decode(tableData)
+	require.NoError(t, err)
+
+	e := new(RowsEvent)
+	e.tableIDSize = 6
+	e.tables = map[uint64]*TableMapEvent{tableMapEvent.TableID: tableMapEvent}
+	e.Version = 2
+	e.eventType = eventType
+	return e
+}
+
+func TestRowsIterator(t *testing.T) {
+	testcases := []struct {
+		tableData []byte
+		data      []byte
+		eventType EventType
+	}{
+		// the rows with NULL, see TestLastNull
+		{
+			tableData: []byte("\xd3\x01\x00\x00\x00\x00\x01\x00\x04test\x00\nfunnytable\x00\x01\x01\x00\x01"),
+			data:      []byte("\xd3\x01\x00\x00\x00\x00\x01\x00\x02\x00\x01\xff\xfe\x01\xff\xfe\x02"),
+			eventType: WRITE_ROWS_EVENTv2,
+		},
+		{
+			tableData: []byte("\xd3\x01\x00\x00\x00\x00\x01\x00\x04test\x00\nfunnytable\x00\x01\x01\x00\x01"),
+			data:      []byte("\xd3\x01\x00\x00\x00\x00\x01\x00\x02\x00\x01\xff\xfe\x01\xfe\x02\xff"),
+			eventType: DELETE_ROWS_EVENTv2,
+		},
+		// the update with the before and after images, see TestRowsDataExtraData
+		{
+			tableData: []byte("m\x00\x00\x00\x00\x00\x01\x00\x04test\x00\x04test\x00\x01\x03\x00\x01"),
+			data:      []byte("m\x00\x00\x00\x00\x00\x01\x00\x02\x00\x01\xff\xff\xfe\x03\x00\x00\x00\xfe\x01\x00\x00\x00"),
+			eventType: UPDATE_ROWS_EVENTv2,
+		},
+		{
+			tableData: []byte("p\x03\x00\x00\x00\x00\x01\x00\x04test\x00\x04test\x00\x01\x03\x00\x01\x01\x01\x00"),
+			data:      []byte("p\x03\x00\x00\x00\x00\x01\x00\a\x00\x01\x01\x00\x03\x00\x01\xff\xff\x00\x03\x00\x00\x00\x00\x01\x00\x00\x00"),
+			eventType: UPDATE_ROWS_EVENTv2,
+		},
+	}
+
+	for _, tc := range testcases {
+		e := newTestRowsEvent(t, tc.tableData, tc.eventType)
+		err := e.Decode(tc.data)
+		require.NoError(t, err)
+		requireIteratorRows(t, e)
+
+		lazy := newTestRowsEvent(t, tc.tableData, tc.eventType)
+		lazy.lazy = true
+		err = lazy.Decode(tc.data)
+		require.NoError(t, err)
+		require.Nil(t, lazy.Rows)
+		rows, skipped, err := lazy.decodedRows()
+		require.NoError(t, err)
+		require.Equal(t, e.Rows, rows)
+		require.Equal(t, e.SkippedColumns, skipped)
+		lazy.Rows, lazy.SkippedColumns = e.Rows, e.SkippedColumns
+		requireIteratorRows(t, lazy)
+	}
+}
+
+func TestRowsIteratorTypes(t *testing.T) {
+	// the table of TestParseRowPanic with many types
+	tableMapEvent := new(TableMapEvent)
+	tableMapEvent.tableIDSize = 6
+	tableMapEvent.TableID = 1810
+	tableMapEvent.ColumnType = []byte{3, 15, 15, 15, 9, 15, 15, 252, 3, 3, 3, 15, 3, 3, 3, 15, 3, 15, 1, 15, 3, 1, 252, 15, 15, 15}
+	tableMapEvent.ColumnMeta = []uint16{0, 108, 60, 765, 0, 765, 765, 4, 0, 0, 0, 765, 0, 0, 0, 3, 0, 3, 0, 765, 0, 0, 2, 108, 108, 108}
+
+	e := new(RowsEvent)
+	e.tableIDSize = 6
+	e.tables = map[uint64]*TableMapEvent{tableMapEvent.TableID: tableMapEvent}
+	e.Version = 2
+	e.eventType = WRITE_ROWS_EVENTv2
+
+	data := []byte{18, 7, 0, 0, 0, 0, 1, 0, 2, 0, 26, 1, 1, 16, 252, 248, 142, 63, 0, 0, 13, 0, 0, 0, 13, 0, 0, 0}
+	err := e.Decode(data)
+	require.NoError(t, err)
+	requireIteratorRows(t, e)
+
+	it := e.Iterator()
+	require.True(t, it.Next())
+	require.Equal(t, EnumRowImageTypeWriteAI, it.ImageType())
+	v, err := it.Column(0)
+	require.NoError(t, err)
+	require.Equal(t, int32(16270), v)
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	// the truncated data
+	e.rowsData = e.rowsData[:len(e.rowsData)-2]
+	it = e.Iterator()
+	require.False(t, it.Next())
+	require.Error(t, it.Err())
+}
+
+func TestRowsIteratorPartialJSON(t *testing.T) {
+	// the after image of TestRowsEventDecodeImageWithEmptyJSON
+	ai := []byte("\x01\a\x00\xf6+\x0f\x00\xeb\xafP\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x99\xac\xfa\xbeÙ\xaf\xab1\x184\x11\x00\x00")
+	table := TableMapEvent{
+		ColumnType: []byte{3, 3, 245, 245, 245, 18, 18, 3},
+		ColumnMeta: []uint16{0, 0, 4, 4, 4, 0, 0, 0},
+	}
+
+	e := &RowsEvent{
+		eventType:     PARTIAL_UPDATE_ROWS_EVENT,
+		Table:         &table,
+		ColumnCount:   uint64(len(table.ColumnType)),
+		ColumnBitmap1: []byte{255},
+		ColumnBitmap2: []byte{255},
+		needBitmap2:   true,
+	}
+	// the before image with all the columns NULL
+	e.rowsData = append([]byte{255}, ai...)
+	_, err := e.decodeImage(e.rowsData[:1], e.ColumnBitmap1, EnumRowImageTypeUpdateBI)
+	require.NoError(t, err)
+	_, err = e.decodeImage(ai, e.ColumnBitmap2, EnumRowImageTypeUpdateAI)
+	require.NoError(t, err)
+	requireIteratorRows(t, e)
+
+	it := e.Iterator()
+	require.True(t, it.Next())
+	require.Equal(t, EnumRowImageTypeUpdateBI, it.ImageType())
+	require.True(t, it.Next())
+	require.Equal(t, EnumRowImageTypeUpdateAI, it.ImageType())
+	require.False(t, it.IsNull(2))
+	require.False(t, it.Next())
+}
+
+func TestBinlogStreamerMaxBytes(t *testing.T) {
+	s := NewBinlogStreamer()
+	s.SetMaxBytes(100)
+	ctx := context.Background()
+
+	newEvent := func(size uint32) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventSize: size}}
+	}
+	require.NoError(t, s.put(ctx, newEvent(60)))
+	require.NoError(t, s.put(ctx, newEvent(40)))
+
+	// wait until an event is taken
+	done := make(chan error, 1)
+	go func() {
+		done <- s.put(ctx, newEvent(30))
+	}()
+	select {
+	case <-done:
+		require.FailNow(t, "put must wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err := s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	require.Equal(t, int64(70), s.bytes.Load())
+
+	// an event larger than the limit is added to the empty streamer
+	events := s.DumpEvents()
+	require.Len(t, events, 2)
+	require.Zero(t, s.bytes.Load())
+	require.NoError(t, s.put(ctx, newEvent(1000)))
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.put(cancelCtx, newEvent(1)), context.DeadlineExceeded)
+
+	// AddEventToStreamer waits for room too
+	go func() {
+		done <- s.AddEventToStreamer(newEvent(30))
+	}()
+	select {
+	case <-done:
+		require.FailNow(t, "AddEventToStreamer must wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	require.Equal(t, int64(30), s.bytes.Load())
+
+	require.NoError(t, s.AddEventToStreamer(newEvent(70)))
+	go func() {
+		done <- s.AddEventToStreamer(newEvent(30))
+	}()
+	require.True(t, s.AddErrorToStreamer(ErrSyncClosed))
+	require.ErrorIs(t, <-done, ErrSyncClosed)
+	require.Equal(t, int64(100), s.bytes.Load())
+}
@@ -0,0 +1,375 @@
+package replication
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+var ErrSchedulerClosed = errors.New("transaction scheduler is closed")
+
+// DependencyTracker decides which transactions a transaction must wait for before it's applied.
+// The scheduled transactions are numbered from 1 in order, Track is called with every transaction
+// in order and returns the number of the last transaction it depends on. The transaction is applied
+// after all the transactions up to the returned one are committed, 0 means it depends on none.
+type DependencyTracker interface {
+	Track(tx *Transaction, seq int64) (int64, error)
+}
+
+// LogicalClockTracker tracks the dependencies with the logical clocks of the source. For MySQL, a
+// transaction depends on the transactions up to the LastCommitted of its GTID event, which carries
+// the write-set dependencies too if the source uses binlog_transaction_dependency_tracking=WRITESET.
+// For MariaDB, the transactions of the same group commit don't depend on each other.
+//
+// A transaction depends on all the previous transactions if its logical clock isn't comparable with
+// the previous one, e.g, at the start of a binlog file, or it has no logical clock at all.
+type LogicalClockTracker struct {
+	// the scheduled number minus the sequence number of the transactions in the current binlog file
+	base int64
+	// the sequence number of the last transaction, 0 if unknown
+	lastSequence int64
+
+	// the MariaDB group commit id of the last transaction and the first number of the group
+	commitID    uint64
+	groupStart  int64
+	inGroupMode bool
+}
+
+// NewLogicalClockTracker creates a LogicalClockTracker.
+func NewLogicalClockTracker() *LogicalClockTracker {
+	return &LogicalClockTracker{}
+}
+
+func (t *LogicalClockTracker) Track(tx *Transaction, seq int64) (int64, error) {
+	var ev Event
+	if tx.GTIDEvent != nil {
+		ev = tx.GTIDEvent.Event
+	}
+
+	switch e := ev.(type) {
+	case *GTIDEvent:
+		return t.trackLogicalClock(seq, e.LastCommitted, e.SequenceNumber), nil
+	case *GtidTaggedLogEvent:
+		return t.trackLogicalClock(seq, e.LastCommitted, e.SequenceNumber), nil
+	case *MariadbGTIDEvent:
+		return t.trackGroupCommit(seq, e), nil
+	}
+
+	t.lastSequence = 0
+	t.inGroupMode = false
+	return seq - 1, nil
+}
+
+func (t *LogicalClockTracker) trackLogicalClock(seq int64, lastCommitted int64, sequence int64) int64 {
+	if sequence <= 0 || sequence != t.lastSequence+1 || lastCommitted >= sequence {
+		// the logical clock restarts in a new binlog file, or some transactions are missing
+		t.base = seq - sequence
+		if sequence <= 0 {
+			t.lastSequence = 0
+		} else {
+			t.lastSequence = sequence
+		}
+		return seq - 1
+	}
+
+	t.lastSequence = sequence
+	dep := lastCommitted + t.base
+	if dep < 0 {
+		dep = 0
+	}
+	return dep
+}
+
+func (t *LogicalClockTracker) trackGroupCommit(seq int64, e *MariadbGTIDEvent) int64 {
+	if !e.IsGroupCommit() || e.IsDDL() {
+		t.inGroupMode = false
+		return seq - 1
+	}
+
+	if !t.inGroupMode || e.CommitID != t.commitID {
+		t.inGroupMode = true
+		t.commitID = e.CommitID
+		t.groupStart = seq
+	}
+	return t.groupStart - 1
+}
+
+// TransactionSchedulerConfig is the configuration of a TransactionScheduler.
+type TransactionSchedulerConfig struct {
+	// Workers is the number of the goroutines applying the transactions, default 1.
+	Workers int
+
+	// Apply applies the transaction, it's called concurrently by the workers.
+	Apply func(ctx context.Context, tx *Transaction) error
+
+	// OnCommit is called in the scheduled order after the transaction and all the previous ones
+	// are applied, it's never called concurrently. It can be nil.
+	OnCommit func(tx *Transaction) error
+
+	// Checkpoint tracks the checkpoint of the committed transactions if not nil, it's updated
+	// after OnCommit.
+	Checkpoint *CheckpointTracker
+
+	// Dependency tracks the dependencies of the transactions, default LogicalClockTracker.
+	Dependency DependencyTracker
+}
+
+type scheduledTransaction struct {
+	tx  *Transaction
+	seq int64
+}
+
+// TransactionScheduler applies the transactions with multiple workers in parallel. A transaction
+// is dispatched only after the transactions it depends on are committed, and the transactions are
+// committed in the scheduled order, so the checkpoint never passes a transaction not applied yet.
+type TransactionScheduler struct {
+	cfg TransactionSchedulerConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	ch     chan *scheduledTransaction
+
+	m      sync.Mutex
+	err    error
+	closed bool
+	// the number of the last scheduled transaction
+	scheduled int64
+	// the number of the last committed transaction
+	committed int64
+	// the applied transactions waiting for the previous ones
+	applied map[int64]*Transaction
+	// closed and replaced when committed is advanced or err is set
+	changed chan struct{}
+
+	// serializes OnCommit
+	commitLock sync.Mutex
+}
+
+// NewTransactionScheduler creates a TransactionScheduler and starts its workers.
+func NewTransactionScheduler(cfg TransactionSchedulerConfig) *TransactionScheduler {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.Dependency == nil {
+		cfg.Dependency = NewLogicalClockTracker()
+	}
+
+	s := &TransactionScheduler{
+		cfg:     cfg,
+		ch:      make(chan *scheduledTransaction, cfg.Workers),
+		applied: make(map[int64]*Transaction),
+		changed: make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go s.work()
+	}
+
+	return s
+}
+
+// Schedule dispatches the transaction to a worker, it blocks until the transactions the transaction
+// depends on are committed. The scheduler closes the transaction after it's committed. It returns the
+// first error of applying or committing the transactions.
+//
+// Schedule, Run and Close must be called from the same goroutine.
+func (s *TransactionScheduler) Schedule(ctx context.Context, tx *Transaction) error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return ErrSchedulerClosed
+	}
+	if s.err != nil {
+		s.m.Unlock()
+		return s.err
+	}
+	seq := s.scheduled + 1
+	s.m.Unlock()
+
+	dep, err := s.cfg.Dependency.Track(tx, seq)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = s.waitCommitted(ctx, dep); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.scheduled = seq
+	s.m.Unlock()
+
+	select {
+	case s.ch <- &scheduledTransaction{tx: tx, seq: seq}:
+		return nil
+	case <-s.ctx.Done():
+		if err = s.error(); err == nil {
+			err = ErrSchedulerClosed
+		}
+		return err
+	}
+}
+
+// Flush waits until all the scheduled transactions are committed.
+func (s *TransactionScheduler) Flush(ctx context.Context) error {
+	s.m.Lock()
+	scheduled := s.scheduled
+	s.m.Unlock()
+
+	return s.waitCommitted(ctx, scheduled)
+}
+
+// Run schedules the transactions from the streamer until ctx is done or an error occurs.
+func (s *TransactionScheduler) Run(ctx context.Context, streamer *BinlogStreamer) error {
+	for {
+		tx, err := streamer.GetTransaction(ctx)
+		if err != nil {
+			return err
+		}
+		if err = s.Schedule(ctx, tx); err != nil {
+			_ = tx.Close()
+			return err
+		}
+	}
+}
+
+// Close waits for the dispatched transactions and stops the workers, it returns the first error
+// of applying or committing the transactions.
+func (s *TransactionScheduler) Close() error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return s.error()
+	}
+	s.closed = true
+	s.m.Unlock()
+
+	close(s.ch)
+	s.wg.Wait()
+	s.cancel()
+
+	s.m.Lock()
+	for _, tx := range s.applied {
+		_ = tx.Close()
+	}
+	s.applied = nil
+	s.m.Unlock()
+
+	return s.error()
+}
+
+func (s *TransactionScheduler) error() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.err
+}
+
+func (s *TransactionScheduler) waitCommitted(ctx context.Context, seq int64) error {
+	for {
+		s.m.Lock()
+		if s.err != nil {
+			err := s.err
+			s.m.Unlock()
+			return err
+		}
+		if s.committed >= seq {
+			s.m.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.m.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *TransactionScheduler) work() {
+	defer s.wg.Done()
+
+	for st := range s.ch {
+		if s.ctx.Err() != nil {
+			_ = st.tx.Close()
+			continue
+		}
+
+		if err := s.cfg.Apply(s.ctx, st.tx); err != nil {
+			_ = st.tx.Close()
+			s.fail(errors.Trace(err))
+			continue
+		}
+
+		if err := s.commit(st); err != nil {
+			s.fail(err)
+		}
+	}
+}
+
+// commit commits the applied transactions in order.
+func (s *TransactionScheduler) commit(st *scheduledTransaction) error {
+	s.m.Lock()
+	s.applied[st.seq] = st.tx
+	s.m.Unlock()
+
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+
+	for {
+		s.m.Lock()
+		if s.err != nil {
+			s.m.Unlock()
+			return nil
+		}
+		tx, ok := s.applied[s.committed+1]
+		if !ok {
+			s.m.Unlock()
+			return nil
+		}
+		delete(s.applied, s.committed+1)
+		s.m.Unlock()
+
+		err := s.commitTransaction(tx)
+		_ = tx.Close()
+		if err != nil {
+			return err
+		}
+
+		s.m.Lock()
+		s.committed++
+		close(s.changed)
+		s.changed = make(chan struct{})
+		s.m.Unlock()
+	}
+}
+
+func (s *TransactionScheduler) commitTransaction(tx *Transaction) error {
+	if s.cfg.OnCommit != nil {
+		if err := s.cfg.OnCommit(tx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.cfg.Checkpoint != nil {
+		return errors.Trace(s.cfg.Checkpoint.TrackTransaction(tx))
+	}
+	return nil
+}
+
+func (s *TransactionScheduler) fail(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.cancel()
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
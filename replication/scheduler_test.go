@@ -0,0 +1,189 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func newTestClockTransaction(file string, gno int64, lastCommitted int64, sequence int64) *Transaction {
+	gtid, _ := mysql.ParseMysqlGTIDSet(fmt.Sprintf("%s:%d", testTransactionSID, gno))
+	return &Transaction{
+		GTIDEvent: &BinlogEvent{
+			Header: &EventHeader{EventType: GTID_EVENT},
+			Event:  &GTIDEvent{SID: testTransactionSID[:], GNO: gno, LastCommitted: lastCommitted, SequenceNumber: sequence},
+		},
+		GTID:   gtid,
+		EndPos: mysql.Position{Name: file, Pos: uint32(gno * 100)},
+	}
+}
+
+func TestLogicalClockTracker(t *testing.T) {
+	tracker := NewLogicalClockTracker()
+	tests := []struct {
+		lastCommitted int64
+		sequence      int64
+		dep           int64
+	}{
+		// start in the middle of a binlog file
+		{10, 12, 0},
+		{10, 13, 0},
+		{12, 14, 1},
+		{13, 15, 2},
+		// a new binlog file
+		{0, 1, 4},
+		{0, 2, 4},
+		{1, 3, 5},
+		// no logical clock
+		{0, 0, 7},
+		{0, 0, 8},
+		// missing transactions
+		{10, 20, 9},
+		{19, 21, 9},
+		{20, 22, 10},
+	}
+	for i, tt := range tests {
+		dep, err := tracker.Track(newTestClockTransaction("mysql-bin.000001", int64(i+1), tt.lastCommitted, tt.sequence), int64(i+1))
+		require.NoError(t, err)
+		require.Equal(t, tt.dep, dep, "transaction %d", i+1)
+	}
+
+	// MariaDB group commit
+	tracker = NewLogicalClockTracker()
+	mariadbTx := func(flags byte, commitID uint64) *Transaction {
+		return &Transaction{GTIDEvent: &BinlogEvent{
+			Header: &EventHeader{EventType: MARIADB_GTID_EVENT},
+			Event:  &MariadbGTIDEvent{Flags: flags, CommitID: commitID},
+		}}
+	}
+	for i, tt := range []struct {
+		tx  *Transaction
+		dep int64
+	}{
+		{mariadbTx(0, 0), 0},
+		{mariadbTx(BINLOG_MARIADB_FL_GROUP_COMMIT_ID, 5), 1},
+		{mariadbTx(BINLOG_MARIADB_FL_GROUP_COMMIT_ID, 5), 1},
+		{mariadbTx(BINLOG_MARIADB_FL_GROUP_COMMIT_ID, 6), 3},
+		{mariadbTx(BINLOG_MARIADB_FL_GROUP_COMMIT_ID|BINLOG_MARIADB_FL_DDL, 6), 4},
+		{mariadbTx(BINLOG_MARIADB_FL_GROUP_COMMIT_ID, 6), 5},
+		{&Transaction{}, 6},
+	} {
+		dep, err := tracker.Track(tt.tx, int64(i+1))
+		require.NoError(t, err)
+		require.Equal(t, tt.dep, dep, "transaction %d", i+1)
+	}
+}
+
+func TestTransactionScheduler(t *testing.T) {
+	gset, err := mysql.ParseMysqlGTIDSet(testTransactionSID.String() + ":1-100")
+	require.NoError(t, err)
+	store := NewMemoryCheckpointStore()
+	checkpoint := NewCheckpointTracker(store, &Checkpoint{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, GTIDSet: gset})
+
+	var (
+		m         sync.Mutex
+		committed []int64
+		running   int
+		parallel  = make(chan struct{})
+	)
+	deps := map[int64][]int64{}
+	s := NewTransactionScheduler(TransactionSchedulerConfig{
+		Workers: 4,
+		Apply: func(ctx context.Context, tx *Transaction) error {
+			gno := tx.GTIDEvent.Event.(*GTIDEvent).GNO
+
+			m.Lock()
+			for _, dep := range deps[gno] {
+				require.Contains(t, committed, dep, "transaction %d is applied before %d", gno, dep)
+			}
+			running++
+			if running == 3 {
+				close(parallel)
+			}
+			m.Unlock()
+
+			if gno <= 103 {
+				// the first three transactions are applied in parallel
+				select {
+				case <-parallel:
+				case <-time.After(5 * time.Second):
+					return errors.New("transactions are not applied in parallel")
+				}
+			}
+			// the later transaction of the group finishes first
+			time.Sleep(time.Duration(110-gno) * time.Millisecond)
+
+			m.Lock()
+			running--
+			m.Unlock()
+			return nil
+		},
+		OnCommit: func(tx *Transaction) error {
+			m.Lock()
+			defer m.Unlock()
+			committed = append(committed, tx.GTIDEvent.Event.(*GTIDEvent).GNO)
+			return nil
+		},
+		Checkpoint: checkpoint,
+	})
+
+	txs := []*Transaction{
+		newTestClockTransaction("mysql-bin.000001", 101, 0, 1),
+		newTestClockTransaction("mysql-bin.000001", 102, 0, 2),
+		newTestClockTransaction("mysql-bin.000001", 103, 0, 3),
+		newTestClockTransaction("mysql-bin.000001", 104, 2, 4),
+		newTestClockTransaction("mysql-bin.000001", 105, 4, 5),
+		newTestClockTransaction("mysql-bin.000002", 106, 0, 1),
+	}
+	deps[104] = []int64{101, 102}
+	deps[105] = []int64{101, 102, 103, 104}
+	deps[106] = []int64{101, 102, 103, 104, 105}
+
+	for _, tx := range txs {
+		require.NoError(t, s.Schedule(context.Background(), tx))
+	}
+	require.NoError(t, s.Flush(context.Background()))
+	require.Equal(t, []int64{101, 102, 103, 104, 105, 106}, committed)
+
+	c, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 10600}, c.Position)
+	require.Equal(t, testTransactionSID.String()+":1-106", c.GTIDSet.String())
+
+	require.NoError(t, s.Close())
+	require.ErrorIs(t, s.Schedule(context.Background(), txs[0]), ErrSchedulerClosed)
+}
+
+func TestTransactionSchedulerError(t *testing.T) {
+	applyErr := errors.New("apply error")
+	var committed []int64
+	s := NewTransactionScheduler(TransactionSchedulerConfig{
+		Workers: 2,
+		Apply: func(ctx context.Context, tx *Transaction) error {
+			if tx.GTIDEvent.Event.(*GTIDEvent).GNO == 2 {
+				return applyErr
+			}
+			return nil
+		},
+		OnCommit: func(tx *Transaction) error {
+			committed = append(committed, tx.GTIDEvent.Event.(*GTIDEvent).GNO)
+			return nil
+		},
+	})
+
+	require.NoError(t, s.Schedule(context.Background(), newTestClockTransaction("mysql-bin.000001", 1, 0, 1)))
+	require.NoError(t, s.Schedule(context.Background(), newTestClockTransaction("mysql-bin.000001", 2, 0, 2)))
+	// it waits for the failed transaction
+	err := s.Schedule(context.Background(), newTestClockTransaction("mysql-bin.000001", 3, 2, 3))
+	require.ErrorIs(t, err, applyErr)
+	require.ErrorIs(t, s.Close(), applyErr)
+	require.NotContains(t, committed, int64(2))
+	require.NotContains(t, committed, int64(3))
+}
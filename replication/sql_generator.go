@@ -0,0 +1,478 @@
+package replication
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// SQLTable is the table metadata to generate SQL for the row changes.
+type SQLTable struct {
+	Schema  string
+	Name    string
+	Columns []string
+	// PKColumns are the indexes of the primary key columns, the rows are matched by all the
+	// columns if it's empty.
+	PKColumns []int
+	// UnsignedColumns are the indexes of the unsigned integer columns.
+	UnsignedColumns []int
+}
+
+// NewSQLTableFromTableMap creates the SQLTable from the optional metadata of the table map event,
+// it requires binlog_row_metadata=FULL to have the column names.
+func NewSQLTableFromTableMap(e *TableMapEvent) (*SQLTable, error) {
+	if len(e.ColumnName) != int(e.ColumnCount) {
+		return nil, errors.Errorf("table map event of %s.%s has no column names, binlog_row_metadata=FULL is required", e.Schema, e.Table)
+	}
+
+	t := &SQLTable{
+		Schema:  string(e.Schema),
+		Name:    string(e.Table),
+		Columns: e.ColumnNameString(),
+	}
+	for _, i := range e.PrimaryKey {
+		t.PKColumns = append(t.PKColumns, int(i))
+	}
+	for i, unsigned := range e.UnsignedMap() {
+		if unsigned {
+			t.UnsignedColumns = append(t.UnsignedColumns, i)
+		}
+	}
+	return t, nil
+}
+
+// NewSQLTableFromSchema creates the SQLTable from the table schema.
+func NewSQLTableFromSchema(t *schema.Table) *SQLTable {
+	st := &SQLTable{
+		Schema:          t.Schema,
+		Name:            t.Name,
+		PKColumns:       t.PKColumns,
+		UnsignedColumns: t.UnsignedColumns,
+	}
+	for _, c := range t.Columns {
+		st.Columns = append(st.Columns, c.Name)
+	}
+	return st
+}
+
+func (t *SQLTable) isUnsigned(i int) bool {
+	for _, c := range t.UnsignedColumns {
+		if c == i {
+			return true
+		}
+	}
+	return false
+}
+
+// SQLGenerator generates SQL from the row changes in binlog, like binlog2sql. The forward SQL redoes
+// the changes, and the flashback SQL undoes them: a deleted row is inserted, an inserted row is deleted
+// and an updated row is updated back.
+//
+// The flashback SQL requires the full row image, i.e, binlog_row_image=FULL.
+type SQLGenerator struct {
+	// Flashback generates the SQL undoing the changes.
+	Flashback bool
+
+	// StartTime and StopTime limit the events to [StartTime, StopTime) by the event timestamp if
+	// they are not zero.
+	StartTime time.Time
+	StopTime  time.Time
+	// GTIDSet limits the events to the transactions in it if it's not nil.
+	GTIDSet mysql.GTIDSet
+
+	// Table returns the table metadata of the table map event, NewSQLTableFromTableMap is used if nil.
+	Table func(e *TableMapEvent) (*SQLTable, error)
+
+	// the GTID of the current transaction
+	gtid mysql.GTIDSet
+	// the statements of every event
+	statements [][]string
+}
+
+// HandleEvent generates the SQL of the event, the events must be passed in order. The row changes
+// and the DDL, which is only in the forward SQL, in the time and GTID range are handled.
+func (g *SQLGenerator) HandleEvent(e *BinlogEvent) error {
+	if ge, ok := e.Event.(mysql.BinlogGTIDEvent); ok {
+		gtid, err := ge.GTIDNext()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		g.gtid = gtid
+		return nil
+	}
+
+	if !g.inRange(e.Header) {
+		return nil
+	}
+
+	var statements []string
+	switch ev := e.Event.(type) {
+	case *RowsEvent:
+		var err error
+		if statements, err = g.RowsEventSQL(ev); err != nil {
+			return errors.Trace(err)
+		}
+	case *TransactionPayloadEvent:
+		for _, sub := range ev.Events {
+			if err := g.HandleEvent(sub); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	case *QueryEvent:
+		if g.Flashback || !isDDLQuery(ev.Query) {
+			return nil
+		}
+		if len(ev.Schema) > 0 {
+			statements = append(statements, "USE "+quoteSQLName(string(ev.Schema)))
+		}
+		statements = append(statements, string(ev.Query))
+	}
+
+	if len(statements) > 0 {
+		g.statements = append(g.statements, statements)
+	}
+	return nil
+}
+
+func (g *SQLGenerator) inRange(h *EventHeader) bool {
+	if !g.StartTime.IsZero() && int64(h.Timestamp) < g.StartTime.Unix() {
+		return false
+	}
+	if !g.StopTime.IsZero() && int64(h.Timestamp) >= g.StopTime.Unix() {
+		return false
+	}
+	if g.GTIDSet != nil && (g.gtid == nil || !g.GTIDSet.Contain(g.gtid)) {
+		return false
+	}
+	return true
+}
+
+// isDDLQuery returns whether the query isn't a transaction control statement.
+func isDDLQuery(query []byte) bool {
+	q := strings.ToUpper(strings.TrimSpace(string(query)))
+	return q != "BEGIN" && q != "COMMIT" && q != "ROLLBACK" && !strings.HasPrefix(q, "XA ") &&
+		!strings.HasPrefix(q, "SAVEPOINT") && !strings.HasPrefix(q, "ROLLBACK TO")
+}
+
+// WriteTo writes the generated statements to w and clears them, every statement ends with ";\n".
+// The statements of flashback are written in the reverse order of the events, so the later changes
+// are undone first.
+func (g *SQLGenerator) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	write := func(statements []string) error {
+		for _, s := range statements {
+			n, err := io.WriteString(w, s+";\n")
+			written += int64(n)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
+
+	defer func() {
+		g.statements = g.statements[:0]
+	}()
+	if g.Flashback {
+		for i := len(g.statements) - 1; i >= 0; i-- {
+			if err := write(g.statements[i]); err != nil {
+				return written, err
+			}
+		}
+		return written, nil
+	}
+	for _, statements := range g.statements {
+		if err := write(statements); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// RowsEventSQL returns the SQL statements of the rows event without the trailing ";". The flashback
+// statements are in the reverse order of the rows.
+func (g *SQLGenerator) RowsEventSQL(e *RowsEvent) ([]string, error) {
+	tableFunc := g.Table
+	if tableFunc == nil {
+		tableFunc = NewSQLTableFromTableMap
+	}
+	t, err := tableFunc(e.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(t.Columns) != int(e.ColumnCount) {
+		return nil, errors.Errorf("table %s.%s has %d columns, but the rows event has %d", t.Schema, t.Name, len(t.Columns), e.ColumnCount)
+	}
+
+	rows, skipped, err := e.decodedRows()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	b := &sqlBuilder{t: t, e: e, rows: rows, skipped: skipped}
+	var statements []string
+	add := func(s string, err error) error {
+		if err != nil {
+			return err
+		}
+		statements = append(statements, s)
+		return nil
+	}
+
+	switch e.Type() {
+	case EnumRowsEventTypeInsert:
+		for i := range rows {
+			if g.Flashback {
+				err = add(b.delete(i))
+			} else {
+				err = add(b.insert(i))
+			}
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	case EnumRowsEventTypeDelete:
+		for i := range rows {
+			if g.Flashback {
+				err = add(b.insert(i))
+			} else {
+				err = add(b.delete(i))
+			}
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	case EnumRowsEventTypeUpdate:
+		for i := 0; i+1 < len(rows); i += 2 {
+			if g.Flashback {
+				err = add(b.update(i, i+1))
+			} else {
+				err = add(b.update(i+1, i))
+			}
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	default:
+		return nil, errors.Errorf("unsupported rows event type %s", e.Type())
+	}
+
+	if g.Flashback {
+		for _, skips := range skipped {
+			if len(skips) > 0 {
+				return nil, errors.Errorf("flashback of %s.%s requires binlog_row_image=FULL", t.Schema, t.Name)
+			}
+		}
+		for i, j := 0, len(statements)-1; i < j; i, j = i+1, j-1 {
+			statements[i], statements[j] = statements[j], statements[i]
+		}
+	}
+	return statements, nil
+}
+
+type sqlBuilder struct {
+	t *SQLTable
+	e *RowsEvent
+	// the rows and skipped columns of e, decoded if e is decoded lazily
+	rows    [][]interface{}
+	skipped [][]int
+}
+
+func (b *sqlBuilder) tableName() string {
+	return quoteSQLName(b.t.Schema) + "." + quoteSQLName(b.t.Name)
+}
+
+// columns returns the indexes of the columns in the row image.
+func (b *sqlBuilder) columns(row int) []int {
+	var skips []int
+	if row < len(b.skipped) {
+		skips = b.skipped[row]
+	}
+
+	columns := make([]int, 0, len(b.t.Columns))
+	for i := range b.t.Columns {
+		skipped := false
+		for _, s := range skips {
+			if s == i {
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+func (b *sqlBuilder) value(row int, column int) (string, error) {
+	return sqlValue(b.rows[row][column], b.e.Table.ColumnType[column], b.t.isUnsigned(column))
+}
+
+func (b *sqlBuilder) insert(row int) (string, error) {
+	columns := b.columns(row)
+	names := make([]string, 0, len(columns))
+	values := make([]string, 0, len(columns))
+	for _, i := range columns {
+		v, err := b.value(row, i)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, quoteSQLName(b.t.Columns[i]))
+		values = append(values, v)
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s)", b.tableName(), strings.Join(names, ","), strings.Join(values, ",")), nil
+}
+
+func (b *sqlBuilder) delete(row int) (string, error) {
+	where, err := b.where(row)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", b.tableName(), where), nil
+}
+
+// update updates the row matching the image where to the image set.
+func (b *sqlBuilder) update(set int, where int) (string, error) {
+	columns := b.columns(set)
+	assignments := make([]string, 0, len(columns))
+	for _, i := range columns {
+		v, err := b.value(set, i)
+		if err != nil {
+			return "", err
+		}
+		assignments = append(assignments, quoteSQLName(b.t.Columns[i])+"="+v)
+	}
+	cond, err := b.where(where)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.tableName(), strings.Join(assignments, ","), cond), nil
+}
+
+// where returns the condition matching the row image by the primary key, or by all the columns
+// with LIMIT 1 if the image has no primary key. The JSON and geometry columns can't be compared
+// with literals, so they are not in the condition. Neither are the FLOAT and DOUBLE columns of
+// the condition by all the columns, their approximate values may not equal the stored ones.
+func (b *sqlBuilder) where(row int) (string, error) {
+	columns := b.columns(row)
+	limit := " LIMIT 1"
+	if len(b.t.PKColumns) > 0 && containsAllInts(columns, b.t.PKColumns) {
+		columns = b.t.PKColumns
+		limit = ""
+	}
+
+	conds := make([]string, 0, len(columns))
+	for _, i := range columns {
+		tp := b.e.Table.ColumnType[i]
+		if tp == mysql.MYSQL_TYPE_JSON || tp == mysql.MYSQL_TYPE_GEOMETRY {
+			continue
+		}
+		if limit != "" && (tp == mysql.MYSQL_TYPE_FLOAT || tp == mysql.MYSQL_TYPE_DOUBLE) {
+			continue
+		}
+		if b.rows[row][i] == nil {
+			conds = append(conds, quoteSQLName(b.t.Columns[i])+" IS NULL")
+			continue
+		}
+		v, err := b.value(row, i)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, quoteSQLName(b.t.Columns[i])+"="+v)
+	}
+	if len(conds) == 0 {
+		return "", errors.Errorf("no column of %s.%s can match the row", b.t.Schema, b.t.Name)
+	}
+	return strings.Join(conds, " AND ") + limit, nil
+}
+
+func containsAllInts(s []int, sub []int) bool {
+	for _, v := range sub {
+		found := false
+		for _, w := range s {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteSQLName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteSQLString(s string) string {
+	return "'" + mysql.Escape(s) + "'"
+}
+
+// sqlValue returns the SQL literal of the decoded value of the column type.
+func sqlValue(v interface{}, tp byte, unsigned bool) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int8:
+		if unsigned {
+			return strconv.FormatUint(uint64(uint8(v)), 10), nil
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		if unsigned {
+			return strconv.FormatUint(uint64(uint16(v)), 10), nil
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		if unsigned {
+			if tp == mysql.MYSQL_TYPE_INT24 {
+				return strconv.FormatUint(uint64(uint32(v)&0xffffff), 10), nil
+			}
+			return strconv.FormatUint(uint64(uint32(v)), 10), nil
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		if unsigned {
+			return strconv.FormatUint(uint64(v), 10), nil
+		}
+		return strconv.FormatInt(v, 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case uint8, uint16, uint32, uint64, uint:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case decimal.Decimal:
+		return v.String(), nil
+	case string:
+		return quoteSQLString(v), nil
+	case []byte:
+		if tp == mysql.MYSQL_TYPE_JSON {
+			if len(v) == 0 {
+				return "'null'", nil
+			}
+			return quoteSQLString(string(v)), nil
+		}
+		if len(v) == 0 {
+			return "''", nil
+		}
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		return quoteSQLString(v.Format("2006-01-02 15:04:05.999999")), nil
+	default:
+		return "", errors.Errorf("unsupported value %v of type %T", v, v)
+	}
+}
@@ -0,0 +1,175 @@
+package replication
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func newTestSQLTable() *TableMapEvent {
+	return &TableMapEvent{
+		TableID:          120,
+		Flags:            1,
+		Schema:           []byte("test"),
+		Table:            []byte("t1"),
+		ColumnCount:      5,
+		ColumnType:       []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_JSON},
+		ColumnMeta:       []uint16{0, 400, 0, 2, 4},
+		NullBitmap:       []byte{0x1e},
+		SignednessBitmap: []byte{0x40},
+		ColumnName:       [][]byte{[]byte("id"), []byte("name"), []byte("n"), []byte("b"), []byte("j")},
+		PrimaryKey:       []uint64{0},
+		PrimaryKeyPrefix: []uint64{0},
+	}
+}
+
+// writeTestSQLEvents writes two transactions, the second one is 10 seconds later, and parses them
+// with the rows decoded lazily or not.
+func writeTestSQLEvents(t *testing.T, lazy bool) []*BinlogEvent {
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+
+	table := newTestSQLTable()
+	write := func(ts uint32, eventType EventType, e Event) {
+		_, err := w.WriteEvent(EventHeader{Timestamp: ts, EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+	}
+	write(1700000000, FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("8.0.36-log", BINLOG_CHECKSUM_ALG_CRC32))
+
+	write(1700000000, GTID_EVENT, &GTIDEvent{CommitFlag: 1, SID: testTransactionSID[:], GNO: 1})
+	write(1700000000, QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")})
+	write(1700000000, TABLE_MAP_EVENT, table)
+	write(1700000000, WRITE_ROWS_EVENTv2, NewRowsEvent(WRITE_ROWS_EVENTv2, table, [][]interface{}{
+		{int32(1), "it's", int32(-1), []byte{0x00, 0xff}, `{"a": 1}`},
+		{int32(2), "b", nil, nil, nil},
+	}))
+	write(1700000000, XID_EVENT, &XIDEvent{XID: 1})
+
+	write(1700000010, GTID_EVENT, &GTIDEvent{CommitFlag: 1, SID: testTransactionSID[:], GNO: 2})
+	write(1700000010, QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")})
+	write(1700000010, TABLE_MAP_EVENT, table)
+	write(1700000010, UPDATE_ROWS_EVENTv2, NewRowsEvent(UPDATE_ROWS_EVENTv2, table, [][]interface{}{
+		{int32(1), "it's", int32(-1), []byte{0x00, 0xff}, `{"a": 1}`},
+		{int32(1), "a", int32(2), []byte{0x00, 0xff}, `{"a": 1}`},
+	}))
+	write(1700000010, TABLE_MAP_EVENT, table)
+	write(1700000010, DELETE_ROWS_EVENTv2, NewRowsEvent(DELETE_ROWS_EVENTv2, table, [][]interface{}{
+		{int32(2), "b", nil, nil, nil},
+	}))
+	write(1700000010, XID_EVENT, &XIDEvent{XID: 2})
+
+	write(1700000020, GTID_EVENT, &GTIDEvent{CommitFlag: 1, SID: testTransactionSID[:], GNO: 3})
+	write(1700000020, QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("ALTER TABLE t1 ADD COLUMN c int")})
+
+	p := NewBinlogParser()
+	p.SetLazyRowsEvent(lazy)
+	var events []*BinlogEvent
+	require.NoError(t, p.ParseReader(bytes.NewReader(buf.Bytes()[4:]), func(e *BinlogEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	return events
+}
+
+func generateTestSQL(t *testing.T, g *SQLGenerator, events []*BinlogEvent) string {
+	for _, e := range events {
+		require.NoError(t, g.HandleEvent(e))
+	}
+	var buf strings.Builder
+	_, err := g.WriteTo(&buf)
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestSQLGenerator(t *testing.T) {
+	events := writeTestSQLEvents(t, false)
+
+	require.Equal(t, "INSERT INTO `test`.`t1`(`id`,`name`,`n`,`b`,`j`) VALUES (1,'it\\'s',16777215,X'00ff','{\\\"a\\\":1}');\n"+
+		"INSERT INTO `test`.`t1`(`id`,`name`,`n`,`b`,`j`) VALUES (2,'b',NULL,NULL,NULL);\n"+
+		"UPDATE `test`.`t1` SET `id`=1,`name`='a',`n`=2,`b`=X'00ff',`j`='{\\\"a\\\":1}' WHERE `id`=1;\n"+
+		"DELETE FROM `test`.`t1` WHERE `id`=2;\n"+
+		"USE `test`;\n"+
+		"ALTER TABLE t1 ADD COLUMN c int;\n",
+		generateTestSQL(t, &SQLGenerator{}, events))
+
+	require.Equal(t, "INSERT INTO `test`.`t1`(`id`,`name`,`n`,`b`,`j`) VALUES (2,'b',NULL,NULL,NULL);\n"+
+		"UPDATE `test`.`t1` SET `id`=1,`name`='it\\'s',`n`=16777215,`b`=X'00ff',`j`='{\\\"a\\\":1}' WHERE `id`=1;\n"+
+		"DELETE FROM `test`.`t1` WHERE `id`=2;\n"+
+		"DELETE FROM `test`.`t1` WHERE `id`=1;\n",
+		generateTestSQL(t, &SQLGenerator{Flashback: true}, events))
+
+	// time range
+	require.Equal(t, "INSERT INTO `test`.`t1`(`id`,`name`,`n`,`b`,`j`) VALUES (2,'b',NULL,NULL,NULL);\n"+
+		"UPDATE `test`.`t1` SET `id`=1,`name`='it\\'s',`n`=16777215,`b`=X'00ff',`j`='{\\\"a\\\":1}' WHERE `id`=1;\n",
+		generateTestSQL(t, &SQLGenerator{Flashback: true, StartTime: time.Unix(1700000005, 0), StopTime: time.Unix(1700000020, 0)}, events))
+
+	// GTID range
+	gset, err := mysql.ParseMysqlGTIDSet(testTransactionSID.String() + ":1")
+	require.NoError(t, err)
+	require.Equal(t, "DELETE FROM `test`.`t1` WHERE `id`=2;\n"+
+		"DELETE FROM `test`.`t1` WHERE `id`=1;\n",
+		generateTestSQL(t, &SQLGenerator{Flashback: true, GTIDSet: gset}, events))
+
+	// the rows decoded lazily
+	lazyEvents := writeTestSQLEvents(t, true)
+	require.Nil(t, lazyEvents[4].Event.(*RowsEvent).Rows)
+	require.Equal(t, generateTestSQL(t, &SQLGenerator{}, events), generateTestSQL(t, &SQLGenerator{}, lazyEvents))
+	require.Equal(t, generateTestSQL(t, &SQLGenerator{Flashback: true}, events), generateTestSQL(t, &SQLGenerator{Flashback: true}, lazyEvents))
+}
+
+func TestSQLGeneratorTable(t *testing.T) {
+	// the table schema without primary key
+	st := &schema.Table{Schema: "test", Name: "t1"}
+	st.AddColumn("id", "int", "", "")
+	st.AddColumn("name", "varchar(100)", "", "")
+	st.AddColumn("n", "mediumint unsigned", "", "")
+	st.AddColumn("b", "blob", "", "")
+	st.AddColumn("j", "json", "", "")
+
+	table := newTestSQLTable()
+	table.ColumnName = nil
+	e := NewRowsEvent(DELETE_ROWS_EVENTv2, table, [][]interface{}{{int32(1), "a", nil, []byte{}, []byte(`{}`)}})
+
+	_, err := (&SQLGenerator{}).RowsEventSQL(e)
+	require.ErrorContains(t, err, "binlog_row_metadata=FULL")
+
+	g := &SQLGenerator{Table: func(*TableMapEvent) (*SQLTable, error) {
+		return NewSQLTableFromSchema(st), nil
+	}}
+	statements, err := g.RowsEventSQL(e)
+	require.NoError(t, err)
+	require.Equal(t, []string{"DELETE FROM `test`.`t1` WHERE `id`=1 AND `name`='a' AND `n` IS NULL AND `b`='' LIMIT 1"}, statements)
+
+	// the approximate values aren't compared without primary key
+	approx := &TableMapEvent{
+		TableID:     121,
+		Schema:      []byte("test"),
+		Table:       []byte("t2"),
+		ColumnCount: 3,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_DOUBLE},
+		ColumnMeta:  []uint16{0, 4, 8},
+		NullBitmap:  []byte{0x06},
+		ColumnName:  [][]byte{[]byte("id"), []byte("f"), []byte("d")},
+	}
+	statements, err = (&SQLGenerator{}).RowsEventSQL(NewRowsEvent(DELETE_ROWS_EVENTv2, approx, [][]interface{}{{int32(1), float32(0.1), 0.1}}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"DELETE FROM `test`.`t2` WHERE `id`=1 LIMIT 1"}, statements)
+	approx.PrimaryKey = []uint64{1}
+	approx.PrimaryKeyPrefix = []uint64{0}
+	statements, err = (&SQLGenerator{}).RowsEventSQL(NewRowsEvent(DELETE_ROWS_EVENTv2, approx, [][]interface{}{{int32(1), float32(0.5), 0.1}}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"DELETE FROM `test`.`t2` WHERE `f`=0.5"}, statements)
+
+	// flashback requires the full row image
+	e.SkippedColumns = [][]int{{3, 4}}
+	g.Flashback = true
+	_, err = g.RowsEventSQL(e)
+	require.ErrorContains(t, err, "binlog_row_image=FULL")
+}
@@ -0,0 +1,123 @@
+#!/usr/bin/env python3
+"""Generates the MariaDB encrypted binlog files of this directory.
+
+The files are encrypted the way the MariaDB server writes them with encrypt_binlog=ON and
+file_key_management, see Log_event_writer::write_header, encrypt_and_write and
+maybe_write_event_len in sql/log_event_server.cc, and MyCTX_nopad in mysys_ssl/my_crypt.cc.
+The AES operations are done by the openssl command, independently of the decrypter.
+
+    python3 generate.py
+"""
+
+import os
+import struct
+import subprocess
+import zlib
+
+DIR = os.path.dirname(os.path.abspath(__file__))
+
+KEY_ID = 1
+# the key of KEY_ID in keys.txt
+KEY = "a7addd9adea9978fda19f21e6be987880e68ac92632ca052e5bb42b1a506939a"
+NONCE = bytes.fromhex("5c1b6f28d3a94e07b2c8f113")
+SERVER_ID = 1
+TIMESTAMP = 1700000000
+
+FORMAT_DESCRIPTION_EVENT = 15
+QUERY_EVENT = 2
+ROTATE_EVENT = 4
+XID_EVENT = 16
+MARIADB_GTID_EVENT = 162
+MARIADB_START_ENCRYPTION_EVENT = 164
+
+FL_STANDALONE = 1
+FL_TRANSACTIONAL = 4
+FL_DDL = 32
+
+# the post-header lengths of the event types, the same as the ones of BinlogWriter
+POST_HEADER_LENGTHS = bytes.fromhex(
+    "380d0008001200040404"
+    "04120000005c00041a08"
+    "00000008080802000000"
+    "0a0a0a19190012340000"
+    "0a2800"
+)
+
+
+def openssl(mode, key, iv, data):
+    args = ["openssl", "enc", "-" + mode, "-nopad", "-K", key]
+    if iv is not None:
+        args += ["-iv", iv.hex()]
+    return subprocess.run(args, input=data, stdout=subprocess.PIPE, check=True).stdout
+
+
+def event(event_type, body, pos):
+    size = 19 + len(body) + 4
+    header = struct.pack("<IBIIIH", TIMESTAMP, event_type, SERVER_ID, size, pos + size, 0)
+    data = header + body
+    return data + struct.pack("<I", zlib.crc32(data))
+
+
+def encrypt(data, pos, algorithm):
+    """Encrypts the event at pos like Log_event_writer."""
+    iv = NONCE + struct.pack("<I", pos)
+    event_len = struct.unpack_from("<I", data, 9)[0]
+
+    # write_header: the timestamp is encrypted in the place of the event length
+    plain = bytearray(data)
+    plain[9:13] = plain[0:4]
+    plain = bytes(plain[4:])
+
+    if algorithm == "cbc":
+        n = len(plain) // 16 * 16
+        dst = openssl("aes-256-cbc", KEY, iv, plain[:n]) if n else b""
+        if n < len(plain):
+            # MyCTX_nopad::finish: the last partial block is XORed with the encrypted IV
+            mask = openssl("aes-256-ecb", KEY, None, iv)
+            dst += bytes(b ^ m for b, m in zip(plain[n:], mask))
+    else:
+        dst = openssl("aes-256-ctr", KEY, iv, plain)
+    assert len(dst) == len(plain)
+
+    # maybe_write_event_len: the encrypted bytes of the event length are written first, and
+    # the plain event length in their place
+    return dst[5:9] + dst[:5] + struct.pack("<I", event_len) + dst[9:]
+
+
+def query_body(schema, query):
+    return struct.pack("<IIBHH", 7, 0, len(schema), 0, 0) + schema + b"\x00" + query
+
+
+def gtid_body(seq, flags):
+    return struct.pack("<QIB", seq, 0, flags) + b"\x00" * 6
+
+
+def generate(name, algorithm):
+    out = bytearray(b"\xfebin")
+
+    def write(event_type, body, encrypted=True):
+        pos = len(out)
+        data = event(event_type, body, pos)
+        out.extend(encrypt(data, pos, algorithm) if encrypted else data)
+
+    server_version = b"10.11.6-MariaDB-log".ljust(50, b"\x00")
+    # binlog version 4, the checksum algorithm CRC32
+    write(FORMAT_DESCRIPTION_EVENT,
+          struct.pack("<H", 4) + server_version + struct.pack("<IB", 0, 19) + POST_HEADER_LENGTHS + b"\x01",
+          encrypted=False)
+    write(MARIADB_START_ENCRYPTION_EVENT, struct.pack("<BI", 1, 1) + NONCE, encrypted=False)
+
+    write(MARIADB_GTID_EVENT, gtid_body(1, FL_STANDALONE | FL_DDL))
+    write(QUERY_EVENT, query_body(b"test", b"CREATE TABLE t (id int PRIMARY KEY, name varchar(64))"))
+    write(MARIADB_GTID_EVENT, gtid_body(2, FL_TRANSACTIONAL))
+    write(QUERY_EVENT, query_body(b"test", b"INSERT INTO t VALUES (1, 'a')"))
+    write(QUERY_EVENT, query_body(b"test", b"UPDATE t SET name = 'abcdefghijklmnopqrstuvwxyz' WHERE id = 1"))
+    write(XID_EVENT, struct.pack("<Q", 2))
+    write(ROTATE_EVENT, struct.pack("<Q", 4) + b"mysql-bin.000002")
+
+    with open(os.path.join(DIR, name), "wb") as f:
+        f.write(out)
+
+
+generate("mysql-bin-aes-cbc.000001", "cbc")
+generate("mysql-bin-aes-ctr.000001", "ctr")
@@ -0,0 +1,345 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// Transaction is a group of binlog events committed together, see BinlogStreamer.GetTransaction.
+//
+// The events of a transaction larger than BinlogSyncerConfig.MaxTransactionMemorySize are spilled
+// into a temporary file, and decoded again when they are iterated. Call Close to remove the file.
+type Transaction struct {
+	// GTIDEvent is the GTID_EVENT, ANONYMOUS_GTID_EVENT, GTID_TAGGED_LOG_EVENT or MARIADB_GTID_EVENT
+	// starting the transaction, it's nil if the server doesn't write GTID events.
+	GTIDEvent *BinlogEvent
+	// GTID is the GTID of the transaction, it's nil for anonymous transactions.
+	GTID mysql.GTIDSet
+
+	// ImmediateCommitTime and OriginalCommitTime are the commit times in the MySQL GTID event,
+	// they are zero if not available.
+	ImmediateCommitTime time.Time
+	OriginalCommitTime  time.Time
+
+	// Timestamp is the timestamp in the header of the event ending the transaction.
+	Timestamp uint32
+
+	// EndPos is the position after the last event of the transaction. Its Pos is 0 if the
+	// server doesn't fill the LogPos of the events, e.g, MariaDB 11.4+ without FillZeroLogPos.
+	EndPos mysql.Position
+
+	// Size is the total size of the events in the binlog.
+	Size int64
+
+	events []*BinlogEvent
+
+	spill       *os.File
+	spillWriter *bufio.Writer
+	newParser   func() *BinlogParser
+	newFilter   func() *eventFilter
+}
+
+// Spilled returns whether the events are spilled into a temporary file.
+func (t *Transaction) Spilled() bool {
+	return t.spill != nil
+}
+
+// ForEachEvent calls fn with every event of the transaction in order, including the GTID event
+// and the event ending the transaction. The events in a TransactionPayloadEvent are passed
+// instead of the TransactionPayloadEvent itself.
+func (t *Transaction) ForEachEvent(fn OnEventFunc) error {
+	onEvent := func(e *BinlogEvent) error {
+		if pe, ok := e.Event.(*TransactionPayloadEvent); ok {
+			for _, sub := range pe.Events {
+				if err := fn(sub); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return fn(e)
+	}
+
+	if t.spill == nil {
+		for _, e := range t.events {
+			if err := onEvent(e); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
+
+	if _, err := t.spill.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	// the events dropped by the filter of the syncer are still in the raw data of the
+	// TransactionPayloadEvent, so the events decoded again are filtered again
+	var filter *eventFilter
+	if t.newFilter != nil {
+		filter = t.newFilter()
+	}
+	// the file starts with the format description event, which isn't a part of the transaction
+	formatSkipped := false
+	p := t.newParser()
+	return errors.Trace(p.ParseReader(bufio.NewReader(t.spill), func(e *BinlogEvent) error {
+		if !formatSkipped {
+			formatSkipped = true
+			return nil
+		}
+		if filter != nil && !filter.keep(e) {
+			return nil
+		}
+		return onEvent(e)
+	}))
+}
+
+// ForEachRowsEvent calls fn with every rows event of the transaction in order, the Table
+// of the rows events is the table map event of the transaction.
+func (t *Transaction) ForEachRowsEvent(fn func(h *EventHeader, e *RowsEvent) error) error {
+	return t.ForEachEvent(func(e *BinlogEvent) error {
+		if re, ok := e.Event.(*RowsEvent); ok {
+			return fn(e.Header, re)
+		}
+		return nil
+	})
+}
+
+// Events returns all the events of the transaction like ForEachEvent. The events of a spilled
+// transaction are all loaded into memory.
+func (t *Transaction) Events() ([]*BinlogEvent, error) {
+	var events []*BinlogEvent
+	err := t.ForEachEvent(func(e *BinlogEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+// Close removes the temporary file of a spilled transaction.
+func (t *Transaction) Close() error {
+	if t.spill == nil {
+		return nil
+	}
+
+	err := t.spill.Close()
+	if rmErr := os.Remove(t.spill.Name()); err == nil {
+		err = rmErr
+	}
+	return errors.Trace(err)
+}
+
+func (t *Transaction) add(e *BinlogEvent, b *transactionBuilder) error {
+	t.Size += int64(e.Header.EventSize)
+
+	if t.spill == nil {
+		t.events = append(t.events, e)
+		if b.maxMemorySize <= 0 || t.Size <= b.maxMemorySize || b.format == nil {
+			return nil
+		}
+
+		f, err := os.CreateTemp(b.spillDir, "go-mysql-transaction-*")
+		if err != nil {
+			return errors.Trace(err)
+		}
+		t.spill = f
+		t.spillWriter = bufio.NewWriter(f)
+		t.newParser = b.newParser
+		t.newFilter = b.newFilter
+
+		events := t.events
+		t.events = nil
+		if err = t.write(b.format); err != nil {
+			return errors.Trace(err)
+		}
+		for _, e := range events {
+			if err = t.write(e); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
+
+	return t.write(e)
+}
+
+func (t *Transaction) write(e *BinlogEvent) error {
+	_, err := t.spillWriter.Write(e.RawData)
+	return errors.Trace(err)
+}
+
+// transactionBoundary finds the end of the transaction in progress.
+type transactionBoundary struct {
+	// whether the transaction in progress is started by BEGIN or XA START, it's ended by
+	// XID, COMMIT, ROLLBACK or XA_PREPARE then, otherwise the next query ends it.
+	inBlock bool
+}
+
+// begin is called for the first event of a transaction. The group of a MariaDB GTID event
+// without FL_STANDALONE is ended by XID or COMMIT like a BEGIN, e.g, the statements of a
+// non-transactional engine.
+func (t *transactionBoundary) begin(e Event) {
+	ev, ok := e.(*MariadbGTIDEvent)
+	t.inBlock = ok && !ev.IsStandalone()
+}
+
+// isBlockStart returns whether the query starts a block ended by XID, COMMIT or ROLLBACK.
+func isBlockStart(query []byte) bool {
+	q := strings.ToUpper(strings.TrimSpace(string(query)))
+	return q == "BEGIN" || strings.HasPrefix(q, "XA START") || strings.HasPrefix(q, "XA BEGIN")
+}
+
+// end returns whether the event ends the transaction in progress.
+func (t *transactionBoundary) end(e Event) bool {
+	switch ev := e.(type) {
+	case *XIDEvent, *XAPrepareEvent, *TransactionPayloadEvent:
+		return true
+	case *QueryEvent:
+		q := strings.ToUpper(strings.TrimSpace(string(ev.Query)))
+		switch {
+		case isBlockStart(ev.Query):
+			t.inBlock = true
+		case strings.HasPrefix(q, "XA END"):
+		case !t.inBlock:
+			// a DDL, or a standalone statement of MariaDB
+			return true
+		default:
+			// XA COMMIT and XA ROLLBACK of MariaDB are in the groups of their GTID events
+			return q == "COMMIT" || q == "ROLLBACK" || strings.HasPrefix(q, "XA COMMIT") || strings.HasPrefix(q, "XA ROLLBACK")
+		}
+	}
+	return false
+}
+
+// transactionBuilder groups the events into transactions for BinlogStreamer.GetTransaction.
+type transactionBuilder struct {
+	// the transaction in progress
+	tx *Transaction
+	transactionBoundary
+
+	// the current binlog file and format description event
+	file   string
+	format *BinlogEvent
+
+	maxMemorySize int64
+	spillDir      string
+	newParser     func() *BinlogParser
+	// newFilter returns the filter of the syncer for the spilled events, nil if there is none
+	newFilter func() *eventFilter
+}
+
+// add adds the event to the transaction in progress, it returns the transaction if the
+// event ends it.
+func (b *transactionBuilder) add(e *BinlogEvent) (*Transaction, error) {
+	switch ev := e.Event.(type) {
+	case *FormatDescriptionEvent:
+		b.format = e
+		return nil, nil
+	case *RotateEvent:
+		b.file = string(ev.NextLogName)
+		return nil, nil
+	case *PreviousGTIDsEvent, *HeartbeatEvent, *MariadbGTIDListEvent, *MariadbBinlogCheckPointEvent:
+		return nil, nil
+	case *GTIDEvent:
+		return nil, b.begin(e, ev)
+	case *GtidTaggedLogEvent:
+		return nil, b.begin(e, &ev.GTIDEvent)
+	case *MariadbGTIDEvent:
+		return nil, b.begin(e, nil)
+	case *GenericEvent:
+		if b.tx == nil {
+			// e.g, STOP_EVENT
+			return nil, nil
+		}
+	}
+
+	if b.tx == nil {
+		// the server doesn't write GTID events
+		b.tx = &Transaction{}
+		b.transactionBoundary.begin(e.Event)
+	}
+	if err := b.tx.add(e, b); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if !b.end(e.Event) {
+		return nil, nil
+	}
+
+	tx := b.tx
+	b.tx = nil
+	tx.Timestamp = e.Header.Timestamp
+	tx.EndPos = mysql.Position{Name: b.file, Pos: e.Header.LogPos}
+	if tx.spill != nil {
+		if err := tx.spillWriter.Flush(); err != nil {
+			_ = tx.Close()
+			return nil, errors.Trace(err)
+		}
+		tx.spillWriter = nil
+	}
+	return tx, nil
+}
+
+// begin starts a new transaction with the GTID event, the transaction in progress is discarded,
+// e.g, the syncer is reconnected and syncs the transaction again.
+func (b *transactionBuilder) begin(e *BinlogEvent, ge *GTIDEvent) error {
+	b.discard()
+
+	tx := &Transaction{GTIDEvent: e}
+	if e.Header.EventType != ANONYMOUS_GTID_EVENT {
+		gtid, err := e.Event.(mysql.BinlogGTIDEvent).GTIDNext()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tx.GTID = gtid
+	}
+	if ge != nil {
+		tx.ImmediateCommitTime = ge.ImmediateCommitTime()
+		tx.OriginalCommitTime = ge.OriginalCommitTime()
+	}
+
+	b.tx = tx
+	b.transactionBoundary.begin(e.Event)
+	return errors.Trace(tx.add(e, b))
+}
+
+func (b *transactionBuilder) discard() {
+	if b.tx != nil {
+		_ = b.tx.Close()
+		b.tx = nil
+	}
+}
+
+// GetTransaction gets the binlog events one by one like GetEvent, and returns them grouped by
+// transaction. The events outside of transactions, like FormatDescriptionEvent, RotateEvent and
+// HeartbeatEvent, are consumed but not returned. The partial transaction is kept if ctx is done,
+// so GetTransaction can be called again to continue, but GetEvent must not be mixed with it.
+//
+// It requires the events to be decoded, so it can't be used with RawModeEnabled.
+func (s *BinlogStreamer) GetTransaction(ctx context.Context) (*Transaction, error) {
+	for {
+		e, err := s.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.txBuilder.discard()
+			}
+			return nil, err
+		}
+
+		tx, err := s.txBuilder.add(e)
+		if err != nil {
+			s.txBuilder.discard()
+			return nil, errors.Trace(err)
+		}
+		if tx != nil {
+			return tx, nil
+		}
+	}
+}
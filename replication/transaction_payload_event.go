@@ -1,6 +1,7 @@
 package replication
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -27,8 +28,13 @@ const (
 )
 
 type TransactionPayloadEvent struct {
-	format           FormatDescriptionEvent
-	concurrency      int
+	format      FormatDescriptionEvent
+	concurrency int
+	// the max UncompressedSize, 0 means no limit
+	maxUncompressedSize int64
+	// returns the parser of the events in the payload
+	newParser func() *BinlogParser
+
 	Size             uint64
 	UncompressedSize uint64
 	CompressionType  uint64
@@ -99,27 +105,41 @@ func (e *TransactionPayloadEvent) decodeFields(data []byte) error {
 }
 
 func (e *TransactionPayloadEvent) decodePayload() error {
-	if e.CompressionType != ZSTD {
-		return fmt.Errorf("TransactionPayloadEvent has compression type %d (%s)",
-			e.CompressionType, e.compressionType())
-	}
-
-	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(e.concurrency))
-	if err != nil {
-		return err
+	if e.maxUncompressedSize > 0 && e.UncompressedSize > uint64(e.maxUncompressedSize) {
+		return fmt.Errorf("TransactionPayloadEvent has uncompressed size %d larger than the max uncompressed size %d",
+			e.UncompressedSize, e.maxUncompressedSize)
 	}
-	defer decoder.Close()
 
-	payloadUncompressed, err := decoder.DecodeAll(e.Payload, nil)
-	if err != nil {
-		return err
+	var r io.Reader
+	switch e.CompressionType {
+	case ZSTD:
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(e.concurrency)}
+		if e.maxUncompressedSize > 0 {
+			options = append(options, zstd.WithDecoderMaxMemory(uint64(e.maxUncompressedSize)))
+		}
+		decoder, err := zstd.NewReader(bytes.NewReader(e.Payload), options...)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		r = decoder
+	case NONE:
+		r = bytes.NewReader(e.Payload)
+	default:
+		return fmt.Errorf("TransactionPayloadEvent has compression type %d (%s)",
+			e.CompressionType, e.compressionType())
 	}
 
-	// The uncompressed data needs to be split up into individual events for Parse()
-	// to work on them. We can't use e.parser directly as we need to disable checksums
-	// but we still need the initialization from the FormatDescriptionEvent. We can't
-	// modify e.parser as it is used elsewhere.
+	// The uncompressed data is read event by event for Parse() to work on them, without another
+	// buffer of the whole payload. The parsed events are all kept in Events, so the memory taken is
+	// still about the uncompressed size, which is limited by maxUncompressedSize. We can't use the
+	// parser of the event directly as we need to disable checksums but we still need the
+	// initialization from the FormatDescriptionEvent. We can't modify the parser as it is used
+	// elsewhere.
 	parser := NewBinlogParser()
+	if e.newParser != nil {
+		parser = e.newParser()
+	}
 	parser.format = &FormatDescriptionEvent{
 		Version:                e.format.Version,
 		ServerVersion:          e.format.ServerVersion,
@@ -129,18 +149,33 @@ func (e *TransactionPayloadEvent) decodePayload() error {
 		ChecksumAlgorithm:      BINLOG_CHECKSUM_ALG_OFF,
 	}
 
-	offset := uint32(0)
+	maxSize := e.UncompressedSize
+	if maxSize == 0 && e.maxUncompressedSize > 0 {
+		maxSize = uint64(e.maxUncompressedSize)
+	}
+	size := uint64(0)
+	header := make([]byte, EventHeaderSize)
 	for {
-		payloadUncompressedLength := uint32(len(payloadUncompressed))
-		if offset+13 > payloadUncompressedLength {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
 			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read the event header at offset %d of uncompressed payload: %w", size, err)
+		}
+
+		eventLength := binary.LittleEndian.Uint32(header[9:13])
+		if eventLength < EventHeaderSize {
+			return fmt.Errorf("invalid event length %d at offset %d of uncompressed payload", eventLength, size)
 		}
-		eventLength := binary.LittleEndian.Uint32(payloadUncompressed[offset+9 : offset+13])
-		if offset+eventLength > payloadUncompressedLength {
+		if maxSize > 0 && size+uint64(eventLength) > maxSize {
 			return fmt.Errorf("Event length of %d with offset %d in uncompressed payload exceeds payload length of %d",
-				eventLength, offset, payloadUncompressedLength)
+				eventLength, size, maxSize)
+		}
+
+		data := make([]byte, eventLength)
+		copy(data, header)
+		if _, err := io.ReadFull(r, data[EventHeaderSize:]); err != nil {
+			return fmt.Errorf("failed to read the event at offset %d of uncompressed payload: %w", size, err)
 		}
-		data := payloadUncompressed[offset : offset+eventLength]
 
 		pe, err := parser.Parse(data)
 		if err != nil {
@@ -148,7 +183,7 @@ func (e *TransactionPayloadEvent) decodePayload() error {
 		}
 		e.Events = append(e.Events, pe)
 
-		offset += eventLength
+		size += uint64(eventLength)
 	}
 
 	return nil
@@ -1,9 +1,17 @@
 package replication
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 func TestTransactionPayloadEventDecode(t *testing.T) {
@@ -94,3 +102,126 @@ func TestTransactionPayloadEventDecode(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, devent.Type(), EnumRowsEventTypeDelete)
 }
+
+// newTestPayload returns the events of a transaction in a TransactionPayloadEvent without the
+// checksums, and the parser of the binlog.
+func newTestPayload(t *testing.T) ([]byte, *BinlogParser) {
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	format := NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_OFF)
+	_, err = w.WriteEvent(EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, format)
+	require.NoError(t, err)
+	start := buf.Len()
+
+	table := &TableMapEvent{
+		TableID:     100,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_NEWDECIMAL},
+		ColumnMeta:  []uint16{0, 10<<8 | 2},
+		NullBitmap:  []byte{0x02},
+	}
+	for _, ev := range []struct {
+		eventType EventType
+		e         Event
+	}{
+		{QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")}},
+		{TABLE_MAP_EVENT, table},
+		{WRITE_ROWS_EVENTv2, NewRowsEvent(WRITE_ROWS_EVENTv2, table, [][]interface{}{{int32(1), "12.34"}})},
+		{XID_EVENT, &XIDEvent{XID: 1}},
+	} {
+		_, err = w.WriteEvent(EventHeader{Timestamp: 1700000000, EventType: ev.eventType, ServerID: 1}, ev.e)
+		require.NoError(t, err)
+	}
+
+	p := NewBinlogParser()
+	p.format = NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_CRC32)
+	return buf.Bytes()[start:], p
+}
+
+func TestTransactionPayloadEventCompressionTypes(t *testing.T) {
+	payload, p := newTestPayload(t)
+	p.SetUseDecimal(true)
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressed := encoder.EncodeAll(payload, nil)
+	require.NoError(t, encoder.Close())
+
+	for _, tc := range []struct {
+		compressionType uint64
+		payload         []byte
+	}{
+		{NONE, payload},
+		{ZSTD, compressed},
+	} {
+		e := p.newTransactionPayloadEvent()
+		e.CompressionType = tc.compressionType
+		e.UncompressedSize = uint64(len(payload))
+		e.Payload = tc.payload
+		require.NoError(t, e.decodePayload())
+
+		require.Len(t, e.Events, 4)
+		for i, eventType := range []EventType{QUERY_EVENT, TABLE_MAP_EVENT, WRITE_ROWS_EVENTv2, XID_EVENT} {
+			require.Equal(t, eventType, e.Events[i].Header.EventType)
+		}
+		// the events are decoded with the options of the parser
+		rows := e.Events[2].Event.(*RowsEvent)
+		require.Equal(t, decimal.RequireFromString("12.34"), rows.Rows[0][1])
+	}
+
+	// the unknown compression type
+	e := p.newTransactionPayloadEvent()
+	e.CompressionType = 1
+	e.Payload = payload
+	require.Error(t, e.decodePayload())
+}
+
+func TestTransactionPayloadEventMaxUncompressedSize(t *testing.T) {
+	payload, p := newTestPayload(t)
+	newEvent := func(uncompressedSize int, data []byte) *TransactionPayloadEvent {
+		e := p.newTransactionPayloadEvent()
+		e.CompressionType = NONE
+		e.UncompressedSize = uint64(uncompressedSize)
+		e.Payload = data
+		return e
+	}
+
+	p.SetMaxUncompressedSize(int64(len(payload)))
+	require.NoError(t, newEvent(len(payload), payload).decodePayload())
+	// the payload larger than the max
+	p.SetMaxUncompressedSize(int64(len(payload) - 1))
+	require.ErrorContains(t, newEvent(len(payload), payload).decodePayload(), "max uncompressed size")
+	// the payload larger than its UncompressedSize
+	p.SetMaxUncompressedSize(0)
+	require.ErrorContains(t, newEvent(len(payload)-1, payload).decodePayload(), "exceeds payload length")
+	// the truncated payload
+	require.ErrorIs(t, newEvent(len(payload), payload[:len(payload)-1]).decodePayload(), io.ErrUnexpectedEOF)
+}
+
+func TestDecompressMariadbData(t *testing.T) {
+	query := bytes.Repeat([]byte("INSERT INTO t VALUES (1);"), 100)
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(query)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	// the header of 4 bytes with the uncompressed size in big endian
+	data := binary.BigEndian.AppendUint32([]byte{0x84}, uint32(len(query)))
+	data = append(data, buf.Bytes()...)
+
+	decompressed, err := decompressMariadbData(data, 0)
+	require.NoError(t, err)
+	require.Equal(t, query, decompressed)
+	decompressed, err = decompressMariadbData(data, int64(len(query)))
+	require.NoError(t, err)
+	require.Equal(t, query, decompressed)
+
+	_, err = decompressMariadbData(data, int64(len(query)-1))
+	require.ErrorContains(t, err, "max uncompressed size")
+	_, err = decompressMariadbData(data[:3], 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,460 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+var testTransactionSID = uuid.MustParse("3ccc1f06-4b5d-11ee-8b49-0242ac110002")
+
+func newTestTransactionTable() *TableMapEvent {
+	return &TableMapEvent{
+		TableID:     110,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t1"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{0, 1020},
+		NullBitmap:  []byte{0x02},
+	}
+}
+
+// writeTestTransactionEvents writes the events with a BinlogWriter and parses them back, so the
+// events have the raw data like the ones from a BinlogSyncer.
+func writeTestTransactionEvents(t *testing.T, rows int) []*BinlogEvent {
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+
+	table := newTestTransactionTable()
+	write := func(ts uint32, eventType EventType, e Event) {
+		_, err := w.WriteEvent(EventHeader{Timestamp: ts, EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+	}
+	write(1700000000, FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("8.0.36-log", BINLOG_CHECKSUM_ALG_CRC32))
+	write(1700000000, PREVIOUS_GTIDS_EVENT, &PreviousGTIDsEvent{GTIDSets: testTransactionSID.String() + ":1-5"})
+
+	write(1700000001, GTID_EVENT, &GTIDEvent{
+		CommitFlag:               1,
+		SID:                      testTransactionSID[:],
+		GNO:                      6,
+		LastCommitted:            1,
+		SequenceNumber:           2,
+		ImmediateCommitTimestamp: 1700000001000002,
+		OriginalCommitTimestamp:  1700000001000001,
+	})
+	write(1700000001, QUERY_EVENT, &QueryEvent{SlaveProxyID: 1, Schema: []byte("test"), Query: []byte("BEGIN")})
+	write(1700000001, TABLE_MAP_EVENT, table)
+	for i := 0; i < rows; i++ {
+		e := NewRowsEvent(WRITE_ROWS_EVENTv2, table, [][]interface{}{{int32(i), "row"}})
+		if i == rows-1 {
+			e.Flags = RowsEventStmtEndFlag
+		}
+		write(1700000001, WRITE_ROWS_EVENTv2, e)
+	}
+	write(1700000002, XID_EVENT, &XIDEvent{XID: 100})
+
+	write(1700000003, GTID_EVENT, &GTIDEvent{CommitFlag: 1, SID: testTransactionSID[:], GNO: 7})
+	write(1700000003, QUERY_EVENT, &QueryEvent{SlaveProxyID: 1, Schema: []byte("test"), Query: []byte("CREATE TABLE t2 (id int)")})
+
+	write(1700000004, ROTATE_EVENT, &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")})
+
+	var events []*BinlogEvent
+	p := NewBinlogParser()
+	p.SetVerifyChecksum(true)
+	require.NoError(t, p.ParseReader(bytes.NewReader(buf.Bytes()[4:]), func(e *BinlogEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	return events
+}
+
+func newTestTransactionStreamer(t *testing.T, events []*BinlogEvent) *BinlogStreamer {
+	s := NewBinlogStreamer()
+	// the fake rotate event of a BinlogSyncer
+	require.NoError(t, s.AddEventToStreamer(&BinlogEvent{
+		Header: &EventHeader{EventType: ROTATE_EVENT},
+		Event:  &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000001")},
+	}))
+	for _, e := range events {
+		require.NoError(t, s.AddEventToStreamer(e))
+	}
+	return s
+}
+
+func requireTestTransactionRows(t *testing.T, tx *Transaction, rows int) {
+	var ids []int32
+	require.NoError(t, tx.ForEachRowsEvent(func(h *EventHeader, e *RowsEvent) error {
+		require.Equal(t, WRITE_ROWS_EVENTv2, h.EventType)
+		require.Equal(t, []byte("t1"), e.Table.Table)
+		ids = append(ids, e.Rows[0][0].(int32))
+		return nil
+	}))
+	require.Len(t, ids, rows)
+	for i, id := range ids {
+		require.Equal(t, int32(i), id)
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	events := writeTestTransactionEvents(t, 3)
+	s := newTestTransactionStreamer(t, events)
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.False(t, tx.Spilled())
+	require.Equal(t, GTID_EVENT, tx.GTIDEvent.Header.EventType)
+	require.Equal(t, testTransactionSID.String()+":6", tx.GTID.String())
+	require.Equal(t, int64(1700000001000002), tx.ImmediateCommitTime.UnixMicro())
+	require.Equal(t, int64(1700000001000001), tx.OriginalCommitTime.UnixMicro())
+	require.Equal(t, uint32(1700000002), tx.Timestamp)
+	// GTID, BEGIN, TABLE_MAP, 3 rows and XID
+	txEvents, err := tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[2:9], txEvents)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: events[8].Header.LogPos}, tx.EndPos)
+	size := int64(0)
+	for _, e := range txEvents {
+		size += int64(e.Header.EventSize)
+	}
+	require.Equal(t, size, tx.Size)
+	requireTestTransactionRows(t, tx, 3)
+	require.NoError(t, tx.Close())
+
+	tx, err = s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, testTransactionSID.String()+":7", tx.GTID.String())
+	txEvents, err = tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[9:11], txEvents)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: events[10].Header.LogPos}, tx.EndPos)
+
+	// the rotate event is consumed, the partial transaction is kept when the context is done
+	require.NoError(t, s.AddEventToStreamer(events[2]))
+	require.NoError(t, s.AddEventToStreamer(events[3]))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.GetTransaction(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	for _, e := range events[4:9] {
+		require.NoError(t, s.AddEventToStreamer(e))
+	}
+	tx, err = s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	txEvents, err = tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[2:9], txEvents)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: events[8].Header.LogPos}, tx.EndPos)
+
+	// a transaction synced again after reconnecting replaces the partial one
+	require.NoError(t, s.AddEventToStreamer(events[2]))
+	require.NoError(t, s.AddEventToStreamer(events[3]))
+	for _, e := range events[2:9] {
+		require.NoError(t, s.AddEventToStreamer(e))
+	}
+	tx, err = s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	txEvents, err = tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[2:9], txEvents)
+
+	s.close()
+	_, err = s.GetTransaction(context.Background())
+	require.ErrorIs(t, err, ErrSyncClosed)
+}
+
+func TestGetTransactionSpill(t *testing.T) {
+	events := writeTestTransactionEvents(t, 100)
+	dir := t.TempDir()
+
+	s := newTestTransactionStreamer(t, events)
+	s.txBuilder.maxMemorySize = 1024
+	s.txBuilder.spillDir = dir
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.True(t, tx.Spilled())
+	require.Greater(t, tx.Size, int64(1024))
+	require.Equal(t, testTransactionSID.String()+":6", tx.GTID.String())
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: events[105].Header.LogPos}, tx.EndPos)
+
+	// the events can be iterated again
+	for i := 0; i < 2; i++ {
+		txEvents, err := tx.Events()
+		require.NoError(t, err)
+		require.Len(t, txEvents, 106-2)
+		for j, e := range txEvents {
+			require.Equal(t, events[j+2].RawData, e.RawData)
+		}
+		requireTestTransactionRows(t, tx, 100)
+	}
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NoError(t, tx.Close())
+	files, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 0)
+
+	// the small transaction is kept in memory
+	tx, err = s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.False(t, tx.Spilled())
+	require.Equal(t, testTransactionSID.String()+":7", tx.GTID.String())
+}
+
+func TestGetTransactionPayload(t *testing.T) {
+	table := newTestTransactionTable()
+	rows := &RowsEvent{Table: table, Rows: [][]interface{}{{int32(0), "row"}}}
+	rows.setEventType(WRITE_ROWS_EVENTv2)
+	payload := &TransactionPayloadEvent{Events: []*BinlogEvent{
+		{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: TABLE_MAP_EVENT}, Event: table},
+		{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2}, Event: rows},
+		{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{XID: 100}},
+	}}
+
+	s := newTestTransactionStreamer(t, []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT, LogPos: 200}, Event: &GTIDEvent{SID: testTransactionSID[:], GNO: 8}},
+		{Header: &EventHeader{EventType: TRANSACTION_PAYLOAD_EVENT, LogPos: 300, Timestamp: 1700000005}, Event: payload},
+	})
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, testTransactionSID.String()+":8", tx.GTID.String())
+	require.Equal(t, uint32(1700000005), tx.Timestamp)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 300}, tx.EndPos)
+	txEvents, err := tx.Events()
+	require.NoError(t, err)
+	require.Len(t, txEvents, 5)
+	require.Equal(t, payload.Events, txEvents[1:])
+	requireTestTransactionRows(t, tx, 1)
+}
+
+// rawTestEvent is an event written by its encoded body, e.g, the event types without an encoder.
+type rawTestEvent []byte
+
+func (e rawTestEvent) Dump(io.Writer)          {}
+func (e rawTestEvent) Decode([]byte) error     { return nil }
+func (e rawTestEvent) Encode() ([]byte, error) { return e, nil }
+
+func TestGetTransactionPayloadSpillFiltered(t *testing.T) {
+	// the uncompressed events of the payload, without the checksums
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.WriteEvent(EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_OFF))
+	require.NoError(t, err)
+	start := buf.Len()
+
+	t1 := newTestTransactionTable()
+	t2 := newTestTransactionTable()
+	t2.TableID = 111
+	t2.Table = []byte("t2")
+	for _, ev := range []struct {
+		eventType EventType
+		e         Event
+	}{
+		{QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")}},
+		{TABLE_MAP_EVENT, t1},
+		{WRITE_ROWS_EVENTv2, NewRowsEvent(WRITE_ROWS_EVENTv2, t1, [][]interface{}{{int32(0), "row"}})},
+		{TABLE_MAP_EVENT, t2},
+		{WRITE_ROWS_EVENTv2, NewRowsEvent(WRITE_ROWS_EVENTv2, t2, [][]interface{}{{int32(1), "dropped"}})},
+		{XID_EVENT, &XIDEvent{XID: 100}},
+	} {
+		_, err = w.WriteEvent(EventHeader{Timestamp: 1700000005, EventType: ev.eventType, ServerID: 1}, ev.e)
+		require.NoError(t, err)
+	}
+	payload := buf.Bytes()[start:]
+
+	body := []byte{OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, 1, NONE, OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD, 8}
+	body = binary.LittleEndian.AppendUint64(body, uint64(len(payload)))
+	body = append(body, OTW_PAYLOAD_HEADER_END_MARK)
+	body = append(body, payload...)
+
+	buf.Reset()
+	w, err = NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	for _, ev := range []struct {
+		eventType EventType
+		e         Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("8.0.32", BINLOG_CHECKSUM_ALG_CRC32)},
+		{GTID_EVENT, &GTIDEvent{SID: testTransactionSID[:], GNO: 8}},
+		{TRANSACTION_PAYLOAD_EVENT, rawTestEvent(body)},
+	} {
+		_, err = w.WriteEvent(EventHeader{Timestamp: 1700000005, EventType: ev.eventType, ServerID: 1}, ev.e)
+		require.NoError(t, err)
+	}
+
+	// the events of test.t2 in the payload are dropped by the filter of the syncer
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 100, Filter: EventFilter{ExcludeTableRegex: []string{`test\.t2`}}})
+	events := filterTestBinlog(t, buf.Bytes(), b.cfg.Filter)
+	require.Len(t, events, 3)
+	require.Len(t, events[2].Event.(*TransactionPayloadEvent).Events, 4)
+
+	s := newTestTransactionStreamer(t, events)
+	s.txBuilder.maxMemorySize = 1
+	s.txBuilder.spillDir = t.TempDir()
+	s.txBuilder.newParser = b.newParser
+	s.txBuilder.newFilter = b.newFilter
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	defer tx.Close()
+	require.True(t, tx.Spilled())
+
+	// the payload decoded again from the spilled raw data is filtered again
+	txEvents, err := tx.Events()
+	require.NoError(t, err)
+	eventTypes := make([]EventType, 0, len(txEvents))
+	for _, e := range txEvents {
+		eventTypes = append(eventTypes, e.Header.EventType)
+	}
+	require.Equal(t, []EventType{GTID_EVENT, QUERY_EVENT, TABLE_MAP_EVENT, WRITE_ROWS_EVENTv2, XID_EVENT}, eventTypes)
+	requireTestTransactionRows(t, tx, 1)
+}
+
+func TestGetTransactionMariaDB(t *testing.T) {
+	gtidEvent := func(seq uint64, flags byte) *BinlogEvent {
+		return &BinlogEvent{
+			Header: &EventHeader{EventType: MARIADB_GTID_EVENT},
+			Event: &MariadbGTIDEvent{
+				GTID:  mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: seq},
+				Flags: flags,
+			},
+		}
+	}
+	query := func(q string, logPos uint32) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: logPos}, Event: &QueryEvent{Query: []byte(q)}}
+	}
+
+	events := []*BinlogEvent{
+		{Header: &EventHeader{EventType: MARIADB_GTID_LIST_EVENT}, Event: &MariadbGTIDListEvent{}},
+		{Header: &EventHeader{EventType: MARIADB_BINLOG_CHECKPOINT_EVENT}, Event: &MariadbBinlogCheckPointEvent{}},
+		// a transaction of a non-transactional engine ends with COMMIT
+		gtidEvent(10, 0),
+		query("BEGIN", 100),
+		query("INSERT INTO t VALUES (1)", 200),
+		query("INSERT INTO t VALUES (2)", 300),
+		query("COMMIT", 400),
+		// a standalone DDL
+		gtidEvent(11, BINLOG_MARIADB_FL_STANDALONE|BINLOG_MARIADB_FL_DDL),
+		{Header: &EventHeader{EventType: INTVAR_EVENT, LogPos: 500}, Event: &IntVarEvent{}},
+		query("CREATE TABLE t2 (id int)", 600),
+	}
+	s := newTestTransactionStreamer(t, events)
+
+	tx, err := s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "0-1-10", tx.GTID.String())
+	require.True(t, tx.ImmediateCommitTime.IsZero())
+	txEvents, err := tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[2:7], txEvents)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 400}, tx.EndPos)
+
+	tx, err = s.GetTransaction(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "0-1-11", tx.GTID.String())
+	txEvents, err = tx.Events()
+	require.NoError(t, err)
+	require.Equal(t, events[7:], txEvents)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 600}, tx.EndPos)
+}
+
+// writeTestMariaDBStatementBinlog writes the binlog of MariaDB with binlog_format=STATEMENT,
+// whose groups aren't started by BEGIN.
+func writeTestMariaDBStatementBinlog(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := NewBinlogWriter(&buf)
+	require.NoError(t, err)
+	write := func(eventType EventType, e Event) {
+		_, err := w.WriteEvent(EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1}, e)
+		require.NoError(t, err)
+	}
+	query := func(q string) {
+		write(QUERY_EVENT, &QueryEvent{Schema: []byte("test"), Query: []byte(q)})
+	}
+
+	write(FORMAT_DESCRIPTION_EVENT, NewFormatDescriptionEvent("10.11.6-MariaDB-log", BINLOG_CHECKSUM_ALG_CRC32))
+	// the statements of a non-transactional engine ended by COMMIT
+	write(MARIADB_GTID_EVENT, &MariadbGTIDEvent{GTID: mysql.MariadbGTID{SequenceNumber: 1}})
+	query("INSERT INTO t VALUES (1)")
+	query("INSERT INTO t VALUES (2)")
+	query("COMMIT")
+	// a standalone DDL
+	write(MARIADB_GTID_EVENT, &MariadbGTIDEvent{
+		GTID:  mysql.MariadbGTID{SequenceNumber: 2},
+		Flags: BINLOG_MARIADB_FL_STANDALONE | BINLOG_MARIADB_FL_DDL,
+	})
+	query("CREATE TABLE t2 (id int)")
+	// the statements of a transactional engine ended by XID
+	write(MARIADB_GTID_EVENT, &MariadbGTIDEvent{
+		GTID:  mysql.MariadbGTID{SequenceNumber: 3},
+		Flags: BINLOG_MARIADB_FL_GROUP_COMMIT_ID | BINLOG_MARIADB_FL_TRANSACTIONAL,
+	})
+	query("UPDATE t2 SET id = 1")
+	query("UPDATE t2 SET id = 2")
+	write(XID_EVENT, &XIDEvent{XID: 3})
+	return buf.Bytes()
+}
+
+func TestMariaDBStatementTransactions(t *testing.T) {
+	data := writeTestMariaDBStatementBinlog(t)
+
+	var events []*BinlogEvent
+	require.NoError(t, NewBinlogParser().ParseReader(bytes.NewReader(data[len(BinLogFileHeader):]), func(e *BinlogEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	s := newTestTransactionStreamer(t, events)
+	for _, expected := range []struct {
+		gtid   string
+		events []*BinlogEvent
+	}{
+		{"0-1-1", events[1:5]},
+		{"0-1-2", events[5:7]},
+		{"0-1-3", events[7:11]},
+	} {
+		tx, err := s.GetTransaction(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, expected.gtid, tx.GTID.String())
+		txEvents, err := tx.Events()
+		require.NoError(t, err)
+		require.Equal(t, expected.events, txEvents)
+	}
+
+	// the statements in the groups are dropped, the ones ending them are kept
+	var queries []string
+	for _, e := range filterTestBinlog(t, data, EventFilter{ExcludeEventTypes: []EventType{QUERY_EVENT}}) {
+		if qe, ok := e.Event.(*QueryEvent); ok {
+			queries = append(queries, string(qe.Query))
+		}
+	}
+	require.Equal(t, []string{"COMMIT", "CREATE TABLE t2 (id int)"}, queries)
+
+	path := filepath.Join(t.TempDir(), "mysql-bin.000001")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	idx, err := BuildBinlogFileIndex(path)
+	require.NoError(t, err)
+	gtids := make([]string, len(idx.Transactions))
+	for i, entry := range idx.Transactions {
+		gtids[i] = entry.GTID
+	}
+	require.Equal(t, []string{"0-1-1", "0-1-2", "0-1-3"}, gtids)
+}
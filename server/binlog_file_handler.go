@@ -0,0 +1,889 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	defaultBinlogFileServerVersion = "8.0.11"
+	defaultBinlogFilePollInterval  = 100 * time.Millisecond
+)
+
+var errStopParseFile = errors.New("stop parsing binlog file")
+
+// BinlogFileHandlerConfig is the configuration of a BinlogFileHandler.
+type BinlogFileHandlerConfig struct {
+	// Dir is the directory of the binlog files. All the files named like
+	// mysql-bin.000001, which means a base name and a numeric extension, are served
+	// in the order of their extensions.
+	Dir string
+
+	// ServerID is reported as @@server_id and used in the generated events.
+	ServerID uint32
+
+	// ServerUUID is reported as @@server_uuid.
+	ServerUUID string
+
+	// ServerVersion is reported as @@version, default 8.0.11.
+	ServerVersion string
+
+	// HeartbeatPeriod is used when the replica doesn't set @master_heartbeat_period,
+	// 0 means no heartbeat is sent.
+	HeartbeatPeriod time.Duration
+
+	// PollInterval is the interval to check the last binlog file for new events, default 100ms.
+	PollInterval time.Duration
+}
+
+// BinlogFileHandler is a ReplicationHandler which serves COM_BINLOG_DUMP and
+// COM_BINLOG_DUMP_GTID from a directory of binlog files, so a BinlogSyncer or a
+// MySQL replica can replicate from a local binlog archive.
+//
+// It answers the queries sent by the replicas before the dump command, follows the
+// rotations between the binlog files, waits for new events at the end of the last
+// file and sends heartbeats while it is idle. The events are sent with the checksum
+// negotiated by @master_binlog_checksum, whatever the checksum of the binlog files is.
+//
+// A BinlogFileHandler keeps the session variables of the replica, so a new handler
+// must be created for every connection.
+type BinlogFileHandler struct {
+	EmptyHandler
+
+	cfg BinlogFileHandlerConfig
+
+	// user variables set by the replica, like @master_binlog_checksum
+	userVars map[string]string
+
+	// the variables derived from the last binlog file, cached until the file changes
+	last binlogFileVariables
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewBinlogFileHandler creates a BinlogFileHandler for one connection.
+func NewBinlogFileHandler(cfg BinlogFileHandlerConfig) *BinlogFileHandler {
+	if cfg.ServerVersion == "" {
+		cfg.ServerVersion = defaultBinlogFileServerVersion
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultBinlogFilePollInterval
+	}
+
+	return &BinlogFileHandler{
+		cfg:      cfg,
+		userVars: make(map[string]string),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close stops the running binlog dump, it is called when the connection is closed.
+func (h *BinlogFileHandler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+	return nil
+}
+
+func (h *BinlogFileHandler) globalVariables() map[string]interface{} {
+	return map[string]interface{}{
+		"server_id":            h.cfg.ServerID,
+		"server_uuid":          h.cfg.ServerUUID,
+		"version":              h.cfg.ServerVersion,
+		"version_comment":      "go-mysql",
+		"collation_server":     mysql.DEFAULT_COLLATION_NAME,
+		"time_zone":            "SYSTEM",
+		"binlog_format":        "ROW",
+		"log_bin":              "ON",
+		"binlog_row_image":     "FULL",
+		"character_set_server": mysql.DEFAULT_CHARSET,
+		// computed by globalVariable
+		"binlog_checksum": nil,
+		"gtid_mode":       nil,
+		"gtid_executed":   nil,
+	}
+}
+
+// globalVariable returns the value of the global variable. binlog_checksum, gtid_mode and
+// gtid_executed are only computed when they are requested, because the last binlog file is
+// parsed for them.
+func (h *BinlogFileHandler) globalVariable(name string) (interface{}, bool) {
+	switch name {
+	case "binlog_checksum":
+		return h.lastFileVariables().checksum, true
+	case "gtid_mode":
+		return h.lastFileVariables().gtidMode, true
+	case "gtid_executed":
+		return h.lastFileVariables().gtidExecuted, true
+	}
+	v, ok := h.globalVariables()[name]
+	return v, ok
+}
+
+// binlogFileVariables are the global variables derived from the last binlog file.
+type binlogFileVariables struct {
+	// the name and the size of the file when the variables are computed
+	name string
+	size int64
+
+	// binlog_checksum, the checksum algorithm of the format description event
+	checksum string
+	// gtid_mode, ON if the file has GTID events, or has no transactions but previous GTIDs
+	gtidMode string
+	// gtid_executed, the previous GTIDs of the file and the GTIDs in it
+	gtidExecuted string
+}
+
+// defaultBinlogFileVariables are used if there is no binlog file or it can't be read.
+var defaultBinlogFileVariables = binlogFileVariables{checksum: "CRC32", gtidMode: "OFF"}
+
+// lastFileVariables returns the variables derived from the last binlog file, they are cached
+// until the last file is changed or grows.
+func (h *BinlogFileHandler) lastFileVariables() binlogFileVariables {
+	files, err := listBinlogFiles(h.cfg.Dir)
+	if err != nil || len(files) == 0 {
+		return defaultBinlogFileVariables
+	}
+	name := files[len(files)-1]
+	info, err := os.Stat(filepath.Join(h.cfg.Dir, name))
+	if err != nil {
+		return defaultBinlogFileVariables
+	}
+	if name == h.last.name && info.Size() == h.last.size {
+		return h.last
+	}
+
+	v := defaultBinlogFileVariables
+	v.name, v.size = name, info.Size()
+	gset := &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+	gtidMode := ""
+	// the last event may be partially written, keep the variables before it
+	_ = replication.NewBinlogParser().ParseFile(filepath.Join(h.cfg.Dir, name), 4, func(e *replication.BinlogEvent) error {
+		switch ev := e.Event.(type) {
+		case *replication.FormatDescriptionEvent:
+			if ev.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+				v.checksum = "CRC32"
+			} else {
+				v.checksum = "NONE"
+			}
+		case *replication.PreviousGTIDsEvent:
+			set, err := mysql.ParseMysqlGTIDSet(ev.GTIDSets)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			gset = set.(*mysql.MysqlGTIDSet)
+		case *replication.GTIDEvent:
+			if e.Header.EventType == replication.ANONYMOUS_GTID_EVENT {
+				gtidMode = "OFF"
+				return nil
+			}
+			u, err := uuid.FromBytes(ev.SID)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			gset.AddGTID(u, ev.GNO)
+			gtidMode = "ON"
+		case *replication.GtidTaggedLogEvent:
+			gtidMode = "ON"
+		}
+		return nil
+	})
+	v.gtidExecuted = gset.String()
+	v.gtidMode = gtidMode
+	if gtidMode == "" {
+		// no transactions in the file yet
+		v.gtidMode = "OFF"
+		if v.gtidExecuted != "" {
+			v.gtidMode = "ON"
+		}
+	}
+
+	h.last = v
+	return v
+}
+
+// HandleQuery handles the queries sent by the replicas before COM_BINLOG_DUMP, like
+// SET @master_binlog_checksum, SHOW GLOBAL VARIABLES and SELECT @@GLOBAL.SERVER_UUID.
+func (h *BinlogFileHandler) HandleQuery(query string) (*mysql.Result, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return nil, mysql.NewError(mysql.ER_EMPTY_QUERY, "Query was empty")
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "SET":
+		return nil, h.handleSet(strings.TrimSpace(query[len(fields[0]):]))
+	case "SHOW":
+		return h.handleShowVariables(fields[1:])
+	case "SELECT":
+		return h.handleSelect(strings.TrimSpace(query[len(fields[0]):]))
+	case "KILL":
+		return nil, nil
+	}
+
+	return nil, mysql.NewError(mysql.ER_NOT_SUPPORTED_YET, fmt.Sprintf("query %q is not supported", query))
+}
+
+// handleSet saves the user variables, the other variables are ignored.
+func (h *BinlogFileHandler) handleSet(assignments string) error {
+	for _, assignment := range splitOutsideQuotes(assignments, ',') {
+		name, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, "@") || strings.HasPrefix(name, "@@") {
+			continue
+		}
+
+		v := h.evalExpr(strings.TrimSpace(value))
+		if v == nil {
+			delete(h.userVars, strings.ToLower(name[1:]))
+		} else {
+			h.userVars[strings.ToLower(name[1:])] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// handleShowVariables handles SHOW [GLOBAL | SESSION] VARIABLES [LIKE 'pattern'].
+func (h *BinlogFileHandler) handleShowVariables(fields []string) (*mysql.Result, error) {
+	if len(fields) > 0 && (strings.EqualFold(fields[0], "GLOBAL") || strings.EqualFold(fields[0], "SESSION")) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "VARIABLES") {
+		return nil, mysql.NewError(mysql.ER_NOT_SUPPORTED_YET, "only SHOW VARIABLES is supported")
+	}
+
+	var like *regexp.Regexp
+	if len(fields) > 1 {
+		if len(fields) != 3 || !strings.EqualFold(fields[1], "LIKE") {
+			return nil, mysql.NewError(mysql.ER_NOT_SUPPORTED_YET, "only SHOW VARIABLES LIKE is supported")
+		}
+		var err error
+		if like, err = likePatternToRegexp(unquote(fields[2])); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	variables := h.globalVariables()
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		if like == nil || like.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	values := make([][]interface{}, 0, len(names))
+	for _, name := range names {
+		v, _ := h.globalVariable(name)
+		values = append(values, []interface{}{name, fmt.Sprint(v)})
+	}
+
+	r, err := mysql.BuildSimpleTextResultset([]string{"Variable_name", "Value"}, values)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return mysql.NewResult(r), nil
+}
+
+// handleSelect handles the SELECT of variables and UNIX_TIMESTAMP().
+func (h *BinlogFileHandler) handleSelect(exprs string) (*mysql.Result, error) {
+	var names []string
+	var row []interface{}
+	for _, expr := range splitOutsideQuotes(exprs, ',') {
+		expr = strings.TrimSpace(expr)
+		if !strings.HasPrefix(expr, "@") && !strings.EqualFold(expr, "UNIX_TIMESTAMP()") {
+			return nil, mysql.NewError(mysql.ER_NOT_SUPPORTED_YET, fmt.Sprintf("select %q is not supported", expr))
+		}
+		var v interface{}
+		if strings.HasPrefix(expr, "@@") {
+			var ok bool
+			if v, ok = h.globalVariable(variableName(expr)); !ok {
+				return nil, mysql.NewDefaultError(mysql.ER_UNKNOWN_SYSTEM_VARIABLE, variableName(expr))
+			}
+		} else {
+			v = h.evalExpr(expr)
+		}
+		names = append(names, expr)
+		row = append(row, v)
+	}
+
+	r, err := mysql.BuildSimpleTextResultset(names, [][]interface{}{row})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return mysql.NewResult(r), nil
+}
+
+// evalExpr evaluates the simple expressions used by the replicas, the result is nil for NULL.
+func (h *BinlogFileHandler) evalExpr(expr string) interface{} {
+	switch {
+	case strings.EqualFold(expr, "UNIX_TIMESTAMP()"):
+		return time.Now().Unix()
+	case strings.EqualFold(expr, "NULL"):
+		return nil
+	case strings.HasPrefix(expr, "@@"):
+		v, _ := h.globalVariable(variableName(expr))
+		return v
+	case strings.HasPrefix(expr, "@"):
+		v, ok := h.userVars[strings.ToLower(expr[1:])]
+		if !ok {
+			return nil
+		}
+		return v
+	}
+	return unquote(expr)
+}
+
+// variableName returns the lower case name of @@var, @@global.var or @@session.var.
+func variableName(expr string) string {
+	name := strings.ToLower(strings.TrimPrefix(expr, "@@"))
+	name = strings.TrimPrefix(name, "global.")
+	return strings.TrimPrefix(name, "session.")
+}
+
+func (h *BinlogFileHandler) userVar(names ...string) (string, bool) {
+	for _, name := range names {
+		if v, ok := h.userVars[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// HandleRegisterSlave is called for COM_REGISTER_SLAVE, any replica is accepted.
+func (h *BinlogFileHandler) HandleRegisterSlave([]byte) error {
+	return nil
+}
+
+// HandleBinlogDump is called for COM_BINLOG_DUMP, it streams the events from the position,
+// the first binlog file is used if the position has no file name.
+func (h *BinlogFileHandler) HandleBinlogDump(pos mysql.Position) (*replication.BinlogStreamer, error) {
+	files, err := listBinlogFiles(h.cfg.Dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return nil, binlogDumpError("Binary log is not open")
+	}
+
+	if pos.Name == "" {
+		pos.Name = files[0]
+	} else if !containsString(files, pos.Name) {
+		return nil, binlogDumpError("Could not find first log file name in binary log index file")
+	}
+	if pos.Pos < 4 {
+		pos.Pos = 4
+	}
+
+	return h.startDump(pos, nil), nil
+}
+
+// HandleBinlogDumpGTID is called for COM_BINLOG_DUMP_GTID, it streams the events from the
+// newest binlog file whose previous GTIDs are contained in gtidSet, and skips the
+// transactions already in gtidSet.
+func (h *BinlogFileHandler) HandleBinlogDumpGTID(gtidSet *mysql.MysqlGTIDSet) (*replication.BinlogStreamer, error) {
+	files, err := listBinlogFiles(h.cfg.Dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return nil, binlogDumpError("Binary log is not open")
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		previous, err := readPreviousGTIDs(filepath.Join(h.cfg.Dir, files[i]))
+		if err != nil {
+			if i == len(files)-1 {
+				// the last file may be just created, start from the previous one
+				continue
+			}
+			return nil, errors.Trace(err)
+		}
+		if gtidSet.Contain(previous) {
+			return h.startDump(mysql.Position{Name: files[i], Pos: 4}, gtidSet), nil
+		}
+	}
+
+	return nil, binlogDumpError("Cannot replicate because the master purged required binary logs. " +
+		"Replicate the missing transactions from elsewhere, or provision a new slave from backup.")
+}
+
+func binlogDumpError(message string) error {
+	return mysql.NewDefaultError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG, mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG, message)
+}
+
+func (h *BinlogFileHandler) startDump(pos mysql.Position, gtidSet *mysql.MysqlGTIDSet) *replication.BinlogStreamer {
+	d := &binlogFileDumper{
+		h:               h,
+		s:               replication.NewBinlogStreamer(),
+		parser:          replication.NewBinlogParser(),
+		gtidSet:         gtidSet,
+		heartbeatPeriod: h.cfg.HeartbeatPeriod,
+	}
+	d.parser.SetRawMode(true)
+
+	if v, ok := h.userVar("master_binlog_checksum", "source_binlog_checksum"); ok {
+		d.clientChecksum = strings.EqualFold(v, "CRC32")
+	}
+	if v, ok := h.userVar("master_heartbeat_period", "source_heartbeat_period"); ok {
+		// the period is set in nanoseconds
+		if period, err := strconv.ParseUint(v, 10, 64); err == nil {
+			d.heartbeatPeriod = time.Duration(period)
+		}
+	}
+
+	go d.run(pos)
+
+	return d.s
+}
+
+// binlogFileDumper sends the events of the binlog files to the streamer for one dump command.
+type binlogFileDumper struct {
+	h       *BinlogFileHandler
+	s       *replication.BinlogStreamer
+	parser  *replication.BinlogParser
+	gtidSet *mysql.MysqlGTIDSet
+
+	heartbeatPeriod time.Duration
+	// whether the replica negotiated the CRC32 checksum by @master_binlog_checksum, the
+	// checksums of the binlog files are stripped or appended to match it
+	clientChecksum bool
+
+	// the last format description event sent to the replica
+	format *replication.FormatDescriptionEvent
+	// whether the format description event of the current file has been sent
+	formatSent bool
+	// whether the current transaction is skipped because it's in the gtidSet
+	skip bool
+
+	lastSent time.Time
+	sendErr  error
+}
+
+func (d *binlogFileDumper) run(pos mysql.Position) {
+	err := d.dump(pos)
+	if err == nil {
+		err = replication.ErrSyncClosed
+	}
+	// stop writeBinlogEvents, it's ignored if the connection has already stopped.
+	d.s.AddErrorToStreamer(err)
+}
+
+func (d *binlogFileDumper) dump(pos mysql.Position) error {
+	name, offset := pos.Name, int64(pos.Pos)
+	if err := d.sendRotate(name, uint64(offset)); err != nil {
+		return errors.Trace(err)
+	}
+
+	for {
+		next, err := d.dumpFile(name, offset)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		name, offset = next, 4
+	}
+}
+
+// dumpFile sends the events of the file from offset, it waits at the end of the file
+// until the file is rotated, and returns the name of the next file.
+func (d *binlogFileDumper) dumpFile(name string, offset int64) (string, error) {
+	d.formatSent = false
+	path := filepath.Join(d.h.cfg.Dir, name)
+
+	for {
+		if _, err := os.Stat(path); err != nil {
+			if !os.IsNotExist(err) {
+				return "", errors.Trace(err)
+			}
+			// the next file of a rotate event may be not created yet
+			if err = d.wait(name, offset); err != nil {
+				return "", errors.Trace(err)
+			}
+			continue
+		}
+
+		next, err := d.parseFile(name, &offset)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if next != "" {
+			return next, nil
+		}
+
+		files, err := listBinlogFiles(d.h.cfg.Dir)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if i := indexOfString(files, name); i >= 0 && i+1 < len(files) {
+			// the file has no rotate event at the end, e.g, the server crashed. Read
+			// the file again for the events written before the next file is created.
+			if next, err = d.parseFile(name, &offset); err != nil {
+				return "", errors.Trace(err)
+			}
+			if next != "" {
+				return next, nil
+			}
+			if err = d.sendRotate(files[i+1], 4); err != nil {
+				return "", errors.Trace(err)
+			}
+			return files[i+1], nil
+		}
+
+		if err = d.wait(name, offset); err != nil {
+			return "", errors.Trace(err)
+		}
+	}
+}
+
+// parseFile sends the events of the file from offset to the end of the file, offset is
+// moved to the end of the last complete event. It returns the next file name if a
+// rotate event is met.
+func (d *binlogFileDumper) parseFile(name string, offset *int64) (string, error) {
+	var next string
+	err := d.parser.ParseFile(filepath.Join(d.h.cfg.Dir, name), *offset, func(e *replication.BinlogEvent) error {
+		if e.Header.EventType == replication.FORMAT_DESCRIPTION_EVENT && *offset > 4 {
+			// ParseFile always reads the format description event at first.
+			return d.sendFormatDescription(e, true)
+		}
+		*offset += int64(e.Header.EventSize)
+
+		switch e.Header.EventType {
+		case replication.FORMAT_DESCRIPTION_EVENT:
+			d.skip = false
+			return d.sendFormatDescription(e, false)
+		case replication.ROTATE_EVENT:
+			next = string(e.Event.(*replication.RotateEvent).NextLogName)
+			return d.sendFileEvent(e)
+		case replication.GTID_EVENT:
+			d.skip = d.gtidSet != nil && d.containGTID(e)
+		case replication.ANONYMOUS_GTID_EVENT, replication.GTID_TAGGED_LOG_EVENT:
+			d.skip = false
+		case replication.PREVIOUS_GTIDS_EVENT:
+			return d.sendFileEvent(e)
+		}
+
+		if d.skip {
+			return nil
+		}
+		return d.sendFileEvent(e)
+	})
+	if d.sendErr != nil {
+		return "", d.sendErr
+	}
+	if err != nil {
+		// the last event of the file being written may be incomplete, it's read again later.
+		files, lerr := listBinlogFiles(d.h.cfg.Dir)
+		if lerr != nil || len(files) == 0 || files[len(files)-1] != name {
+			return "", errors.Annotatef(err, "parse binlog file %s", name)
+		}
+	}
+
+	return next, nil
+}
+
+func (d *binlogFileDumper) containGTID(e *replication.BinlogEvent) bool {
+	gtid := &replication.GTIDEvent{}
+	if err := gtid.Decode(e.Event.(*replication.GenericEvent).Data); err != nil {
+		return false
+	}
+	sid, err := uuid.FromBytes(gtid.SID)
+	if err != nil {
+		return false
+	}
+
+	return d.gtidSet.Contain(&mysql.MysqlGTIDSet{Sets: map[string]*mysql.UUIDSet{
+		sid.String(): mysql.NewUUIDSet(sid, mysql.Interval{Start: gtid.GNO, Stop: gtid.GNO + 1}),
+	}})
+}
+
+// sendFormatDescription sends the format description event once for every file. The log
+// position is cleared if the event is reread for a dump not starting from the beginning of
+// the file, so that the replica doesn't update its position, like what MySQL does. The
+// checksum algorithm of the event is changed to the one negotiated by the replica.
+func (d *binlogFileDumper) sendFormatDescription(e *replication.BinlogEvent, reread bool) error {
+	format := e.Event.(*replication.FormatDescriptionEvent)
+	d.format = format
+	if d.formatSent {
+		return nil
+	}
+	d.formatSent = true
+
+	sent := *format
+	if format.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_UNDEF {
+		sent.ChecksumAlgorithm = replication.BINLOG_CHECKSUM_ALG_OFF
+		if d.clientChecksum {
+			sent.ChecksumAlgorithm = replication.BINLOG_CHECKSUM_ALG_CRC32
+		}
+	}
+	if !reread && sent.ChecksumAlgorithm == format.ChecksumAlgorithm {
+		return d.send(e)
+	}
+
+	header := *e.Header
+	if reread {
+		header.LogPos = 0
+	}
+	rawData := append([]byte(nil), e.RawData...)
+	copy(rawData, header.Encode())
+	if format.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_UNDEF {
+		// the event is always followed by the algorithm and a checksum, which is ignored
+		// if the algorithm is OFF
+		n := len(rawData) - replication.BinlogChecksumLength
+		rawData[n-1] = sent.ChecksumAlgorithm
+		binary.LittleEndian.PutUint32(rawData[n:], crc32.ChecksumIEEE(rawData[:n]))
+	}
+
+	return d.send(&replication.BinlogEvent{RawData: rawData, Header: &header, Event: &sent})
+}
+
+// sendFileEvent sends an event read from the binlog files, its checksum is stripped or
+// appended if the replica negotiated another checksum than the one of the file.
+func (d *binlogFileDumper) sendFileEvent(e *replication.BinlogEvent) error {
+	if d.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_UNDEF {
+		return d.send(e)
+	}
+	fileChecksum := d.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32
+	if fileChecksum == d.clientChecksum {
+		return d.send(e)
+	}
+
+	body := e.RawData[replication.EventHeaderSize:]
+	if fileChecksum {
+		body = body[:len(body)-replication.BinlogChecksumLength]
+	}
+	return d.send(d.encodeEvent(*e.Header, body, e.Event))
+}
+
+// sendRotate sends a fake rotate event to tell the replica the current file.
+func (d *binlogFileDumper) sendRotate(name string, pos uint64) error {
+	rotate := &replication.RotateEvent{Position: pos, NextLogName: []byte(name)}
+	body, _ := rotate.Encode()
+
+	return d.send(d.newEvent(replication.EventHeader{
+		EventType: replication.ROTATE_EVENT,
+		Flags:     replication.LOG_EVENT_ARTIFICIAL_F,
+	}, body, rotate))
+}
+
+func (d *binlogFileDumper) sendHeartbeat(name string, pos int64) error {
+	return d.send(d.newEvent(replication.EventHeader{
+		EventType: replication.HEARTBEAT_EVENT,
+		LogPos:    uint32(pos),
+	}, []byte(name), &replication.HeartbeatEvent{Version: 1, Filename: name}))
+}
+
+// newEvent builds an event which is not read from the binlog files.
+func (d *binlogFileDumper) newEvent(h replication.EventHeader, body []byte, e replication.Event) *replication.BinlogEvent {
+	h.ServerID = d.h.cfg.ServerID
+	return d.encodeEvent(h, body, e)
+}
+
+// encodeEvent encodes the event with the header and the body, it has a checksum if the replica
+// negotiated one and the current format description event has a checksum algorithm.
+func (d *binlogFileDumper) encodeEvent(h replication.EventHeader, body []byte, e replication.Event) *replication.BinlogEvent {
+	checksum := d.clientChecksum
+	if d.format != nil && d.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_UNDEF {
+		checksum = false
+	}
+
+	h.EventSize = uint32(replication.EventHeaderSize + len(body))
+	if checksum {
+		h.EventSize += replication.BinlogChecksumLength
+	}
+
+	rawData := make([]byte, 0, h.EventSize)
+	rawData = append(rawData, h.Encode()...)
+	rawData = append(rawData, body...)
+	if checksum {
+		rawData = binary.LittleEndian.AppendUint32(rawData, crc32.ChecksumIEEE(rawData))
+	}
+
+	return &replication.BinlogEvent{RawData: rawData, Header: &h, Event: e}
+}
+
+func (d *binlogFileDumper) send(e *replication.BinlogEvent) error {
+	select {
+	case <-d.h.closed:
+		d.sendErr = replication.ErrSyncClosed
+		return d.sendErr
+	default:
+	}
+
+	if err := d.s.AddEventToStreamer(e); err != nil {
+		d.sendErr = err
+		return err
+	}
+	d.lastSent = time.Now()
+	return nil
+}
+
+// wait waits for new events, and sends a heartbeat if nothing is sent for a heartbeat period.
+func (d *binlogFileDumper) wait(name string, pos int64) error {
+	timer := time.NewTimer(d.h.cfg.PollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-d.h.closed:
+		return replication.ErrSyncClosed
+	case <-timer.C:
+	}
+
+	if d.heartbeatPeriod > 0 && time.Since(d.lastSent) >= d.heartbeatPeriod {
+		return d.sendHeartbeat(name, pos)
+	}
+	return nil
+}
+
+// readPreviousGTIDs reads the PREVIOUS_GTIDS_EVENT at the beginning of the file, the
+// set is empty if the file has no such event.
+func readPreviousGTIDs(name string) (*mysql.MysqlGTIDSet, error) {
+	gset := &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+
+	p := replication.NewBinlogParser()
+	err := p.ParseFile(name, 4, func(e *replication.BinlogEvent) error {
+		switch e.Header.EventType {
+		case replication.FORMAT_DESCRIPTION_EVENT:
+			return nil
+		case replication.PREVIOUS_GTIDS_EVENT:
+			set, err := mysql.ParseMysqlGTIDSet(e.Event.(*replication.PreviousGTIDsEvent).GTIDSets)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			gset = set.(*mysql.MysqlGTIDSet)
+		}
+		return errStopParseFile
+	})
+	if err != nil && errors.Cause(err) != errStopParseFile {
+		return nil, errors.Annotatef(err, "read previous gtids of %s", name)
+	}
+
+	return gset, nil
+}
+
+// listBinlogFiles returns the binlog files in dir, sorted by their names and numeric extensions.
+func listBinlogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	type binlogFile struct {
+		name string
+		base string
+		seq  uint64
+	}
+	var files []binlogFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if len(ext) < 2 {
+			continue
+		}
+		seq, err := strconv.ParseUint(ext[1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, binlogFile{name: name, base: strings.TrimSuffix(name, ext), seq: seq})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].base != files[j].base {
+			return files[i].base < files[j].base
+		}
+		return files[i].seq < files[j].seq
+	})
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	return names, nil
+}
+
+func indexOfString(values []string, s string) int {
+	for i, v := range values {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, s string) bool {
+	return indexOfString(values, s) >= 0
+}
+
+// splitOutsideQuotes splits s by sep, but not the sep inside the quoted strings.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// likePatternToRegexp converts a LIKE pattern to a case insensitive regular expression.
+func likePatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
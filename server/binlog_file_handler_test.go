@@ -0,0 +1,615 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const testBinlogFileSID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+// testBinlogFile builds the content of a binlog file with a transaction for every gno.
+type testBinlogFile struct {
+	buf    bytes.Buffer
+	w      *replication.BinlogWriter
+	events []*replication.BinlogEvent
+}
+
+func newTestBinlogFile(t *testing.T, previousGTIDs string) *testBinlogFile {
+	return newTestBinlogFileWithChecksum(t, previousGTIDs, replication.BINLOG_CHECKSUM_ALG_CRC32)
+}
+
+func newTestBinlogFileWithChecksum(t *testing.T, previousGTIDs string, checksumAlgorithm byte) *testBinlogFile {
+	f := &testBinlogFile{}
+	var err error
+	f.w, err = replication.NewBinlogWriter(&f.buf)
+	require.NoError(t, err)
+
+	f.write(t, replication.FORMAT_DESCRIPTION_EVENT, replication.NewFormatDescriptionEvent("8.0.32", checksumAlgorithm))
+	f.write(t, replication.PREVIOUS_GTIDS_EVENT, &replication.PreviousGTIDsEvent{GTIDSets: previousGTIDs})
+	return f
+}
+
+func (f *testBinlogFile) write(t *testing.T, eventType replication.EventType, e replication.Event) {
+	ev, err := f.w.WriteEvent(replication.EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1}, e)
+	require.NoError(t, err)
+	f.events = append(f.events, ev)
+}
+
+func (f *testBinlogFile) writeTransaction(t *testing.T, gno int64) {
+	sid := uuid.MustParse(testBinlogFileSID)
+	f.write(t, replication.GTID_EVENT, &replication.GTIDEvent{SID: sid[:], GNO: gno, LastCommitted: gno - 1, SequenceNumber: gno})
+	f.write(t, replication.QUERY_EVENT, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")})
+	f.write(t, replication.XID_EVENT, &replication.XIDEvent{XID: uint64(gno)})
+}
+
+func (f *testBinlogFile) writeRotate(t *testing.T, next string) {
+	f.write(t, replication.ROTATE_EVENT, &replication.RotateEvent{Position: 4, NextLogName: []byte(next)})
+}
+
+func startTestBinlogFileServer(t *testing.T, dir string) (string, uint16) {
+	host, port, _ := startStoppableTestBinlogFileServer(t, dir)
+	return host, port
+}
+
+// startStoppableTestBinlogFileServer also returns a function to stop the server and close all
+// the connections, like a crashed server.
+func startStoppableTestBinlogFileServer(t *testing.T, dir string) (string, uint16, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	stop := func() {
+		_ = l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	t.Cleanup(stop)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				c, err := NewConn(conn, "root", "", NewBinlogFileHandler(BinlogFileHandlerConfig{
+					Dir:          dir,
+					ServerID:     1,
+					ServerUUID:   testBinlogFileSID,
+					PollInterval: 10 * time.Millisecond,
+				}))
+				if err != nil {
+					return
+				}
+				for c.HandleCommand() == nil {
+				}
+			}()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), uint16(addr.Port), stop
+}
+
+func newTestBinlogFileSyncer(t *testing.T, host string, port uint16) *replication.BinlogSyncer {
+	b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:        100,
+		Flavor:          mysql.MySQLFlavor,
+		Host:            host,
+		Port:            port,
+		User:            "root",
+		HeartbeatPeriod: 50 * time.Millisecond,
+		VerifyChecksum:  true,
+	})
+	t.Cleanup(b.Close)
+	return b
+}
+
+func getTestEvent(t *testing.T, s *replication.BinlogStreamer) *replication.BinlogEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	e, err := s.GetEvent(ctx)
+	require.NoError(t, err)
+	return e
+}
+
+// requireFileEvents checks that the next events are the same as the ones in the file.
+func requireFileEvents(t *testing.T, s *replication.BinlogStreamer, events []*replication.BinlogEvent) {
+	for _, expected := range events {
+		e := getTestEvent(t, s)
+		require.Equal(t, expected.Header.EventType, e.Header.EventType)
+		require.Equal(t, stripTestChecksum(expected.RawData), e.RawData)
+	}
+}
+
+func requireFakeRotate(t *testing.T, s *replication.BinlogStreamer, name string, pos uint64) {
+	e := getTestEvent(t, s)
+	require.Equal(t, replication.ROTATE_EVENT, e.Header.EventType)
+	require.Equal(t, replication.LOG_EVENT_ARTIFICIAL_F, e.Header.Flags)
+	require.Zero(t, e.Header.LogPos)
+	rotate := e.Event.(*replication.RotateEvent)
+	require.Equal(t, name, string(rotate.NextLogName))
+	require.Equal(t, pos, rotate.Position)
+}
+
+// stripTestChecksum returns the raw data of an event of a CRC32 binlog file sent to a replica
+// which negotiated no checksum, like BinlogSyncer does.
+func stripTestChecksum(rawData []byte) []byte {
+	data := append([]byte(nil), rawData...)
+	n := len(data) - replication.BinlogChecksumLength
+	if replication.EventType(data[4]) == replication.FORMAT_DESCRIPTION_EVENT {
+		data[n-1] = replication.BINLOG_CHECKSUM_ALG_OFF
+		binary.LittleEndian.PutUint32(data[n:], crc32.ChecksumIEEE(data[:n]))
+		return data
+	}
+	data = data[:n]
+	binary.LittleEndian.PutUint32(data[9:], uint32(n))
+	return data
+}
+
+// handleTestQuery handles the query and parses the values of the result set.
+func handleTestQuery(t *testing.T, h Handler, query string) *mysql.Result {
+	r, err := h.HandleQuery(query)
+	require.NoError(t, err)
+	if r == nil || r.Resultset == nil {
+		return r
+	}
+
+	r.Values = make([][]mysql.FieldValue, len(r.RowDatas))
+	for i := range r.Values {
+		r.Values[i], err = r.RowDatas[i].Parse(r.Fields, false, r.Values[i])
+		require.NoError(t, err)
+	}
+	return r
+}
+
+func TestBinlogFileHandlerQuery(t *testing.T) {
+	h := NewBinlogFileHandler(BinlogFileHandlerConfig{ServerID: 7, ServerUUID: testBinlogFileSID})
+
+	r := handleTestQuery(t, h, "SHOW GLOBAL VARIABLES LIKE 'BINLOG_CHECKSUM'")
+	s, err := r.GetString(0, 1)
+	require.NoError(t, err)
+	require.Equal(t, "CRC32", s)
+
+	r = handleTestQuery(t, h, "SHOW VARIABLES LIKE 'rpl_semi_sync_master_enabled';")
+	require.Zero(t, r.RowNumber())
+
+	r = handleTestQuery(t, h, "SET @master_binlog_checksum= @@global.binlog_checksum, @master_heartbeat_period = 1000")
+	require.Nil(t, r)
+
+	r = handleTestQuery(t, h, "SELECT @master_binlog_checksum, @@GLOBAL.SERVER_ID, @@GLOBAL.SERVER_UUID, @unknown")
+	s, err = r.GetString(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "CRC32", s)
+	id, err := r.GetUint(0, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), id)
+	s, err = r.GetString(0, 2)
+	require.NoError(t, err)
+	require.Equal(t, testBinlogFileSID, s)
+	isNull, err := r.IsNull(0, 3)
+	require.NoError(t, err)
+	require.True(t, isNull)
+
+	_, err = h.HandleQuery("SELECT @@GLOBAL.UNKNOWN_VARIABLE")
+	require.Error(t, err)
+}
+
+func TestBinlogFileHandlerGTIDExecuted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mysql-bin.000001")
+	file := newTestBinlogFile(t, testBinlogFileSID+":1")
+	file.writeTransaction(t, 2)
+	require.NoError(t, os.WriteFile(path, file.buf.Bytes(), 0o644))
+
+	h := NewBinlogFileHandler(BinlogFileHandlerConfig{Dir: dir, ServerUUID: testBinlogFileSID})
+
+	// the file isn't parsed for the other variables
+	r := handleTestQuery(t, h, "SELECT @@version")
+	s, err := r.GetString(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, defaultBinlogFileServerVersion, s)
+	require.Empty(t, h.last.name)
+
+	gtidExecuted := func() string {
+		r := handleTestQuery(t, h, "SELECT @@GLOBAL.GTID_EXECUTED")
+		s, err := r.GetString(0, 0)
+		require.NoError(t, err)
+		return s
+	}
+	require.Equal(t, testBinlogFileSID+":1-2", gtidExecuted())
+	require.Equal(t, "mysql-bin.000001", h.last.name)
+
+	// cached until the file grows
+	h.last.gtidExecuted = "cached"
+	require.Equal(t, "cached", gtidExecuted())
+
+	file.writeTransaction(t, 3)
+	require.NoError(t, os.WriteFile(path, file.buf.Bytes(), 0o644))
+	require.Equal(t, testBinlogFileSID+":1-3", gtidExecuted())
+
+	r = handleTestQuery(t, h, "SHOW VARIABLES LIKE 'gtid_executed'")
+	s, err = r.GetString(0, 1)
+	require.NoError(t, err)
+	require.Equal(t, testBinlogFileSID+":1-3", s)
+}
+
+func TestBinlogFileHandlerFileVariables(t *testing.T) {
+	dir := t.TempDir()
+	h := NewBinlogFileHandler(BinlogFileHandlerConfig{Dir: dir, ServerUUID: testBinlogFileSID})
+
+	variable := func(name string) string {
+		r := handleTestQuery(t, h, "SELECT @@GLOBAL."+name)
+		s, err := r.GetString(0, 0)
+		require.NoError(t, err)
+		return s
+	}
+
+	// no binlog files
+	require.Equal(t, "CRC32", variable("binlog_checksum"))
+	require.Equal(t, "OFF", variable("gtid_mode"))
+
+	file := newTestBinlogFileWithChecksum(t, "", replication.BINLOG_CHECKSUM_ALG_OFF)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file.buf.Bytes(), 0o644))
+	require.Equal(t, "NONE", variable("binlog_checksum"))
+	require.Equal(t, "OFF", variable("gtid_mode"))
+
+	file.write(t, replication.ANONYMOUS_GTID_EVENT, &replication.GTIDEvent{SID: make([]byte, 16), LastCommitted: 0, SequenceNumber: 1})
+	file.write(t, replication.QUERY_EVENT, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")})
+	file.write(t, replication.XID_EVENT, &replication.XIDEvent{XID: 1})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file.buf.Bytes(), 0o644))
+	require.Equal(t, "OFF", variable("gtid_mode"))
+	require.Empty(t, variable("gtid_executed"))
+
+	// a new file without transactions, but with the previous GTIDs
+	file = newTestBinlogFile(t, testBinlogFileSID+":1-2")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), file.buf.Bytes(), 0o644))
+	require.Equal(t, "CRC32", variable("binlog_checksum"))
+	require.Equal(t, "ON", variable("gtid_mode"))
+
+	r := handleTestQuery(t, h, "SHOW GLOBAL VARIABLES LIKE 'gtid_mode'")
+	s, err := r.GetString(0, 1)
+	require.NoError(t, err)
+	require.Equal(t, "ON", s)
+}
+
+// TestBinlogFileHandlerDumpChecksum checks that the checksums of the events match the one
+// negotiated by the replica, instead of the one of the binlog files.
+func TestBinlogFileHandlerDumpChecksum(t *testing.T) {
+	tests := []struct {
+		fileChecksum   byte
+		clientChecksum string
+	}{
+		{replication.BINLOG_CHECKSUM_ALG_CRC32, "NONE"},
+		{replication.BINLOG_CHECKSUM_ALG_OFF, "CRC32"},
+		{replication.BINLOG_CHECKSUM_ALG_CRC32, "CRC32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientChecksum, func(t *testing.T) {
+			dir := t.TempDir()
+			file := newTestBinlogFileWithChecksum(t, "", tt.fileChecksum)
+			file.writeTransaction(t, 1)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file.buf.Bytes(), 0o644))
+
+			h := NewBinlogFileHandler(BinlogFileHandlerConfig{Dir: dir, ServerID: 1, HeartbeatPeriod: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond})
+			defer h.Close()
+			handleTestQuery(t, h, fmt.Sprintf("SET @master_binlog_checksum = '%s'", tt.clientChecksum))
+			s, err := h.HandleBinlogDump(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+			require.NoError(t, err)
+
+			p := replication.NewBinlogParser()
+			p.SetVerifyChecksum(true)
+			parse := func() *replication.BinlogEvent {
+				e, err := p.Parse(getTestEvent(t, s).RawData)
+				require.NoError(t, err)
+				return e
+			}
+
+			rotate := parse()
+			require.Equal(t, replication.ROTATE_EVENT, rotate.Header.EventType)
+			format := parse()
+			require.Equal(t, replication.FORMAT_DESCRIPTION_EVENT, format.Header.EventType)
+			if tt.clientChecksum == "CRC32" {
+				require.Equal(t, replication.BINLOG_CHECKSUM_ALG_CRC32, format.Event.(*replication.FormatDescriptionEvent).ChecksumAlgorithm)
+			} else {
+				require.Equal(t, replication.BINLOG_CHECKSUM_ALG_OFF, format.Event.(*replication.FormatDescriptionEvent).ChecksumAlgorithm)
+			}
+
+			for _, expected := range file.events[1:] {
+				e := parse()
+				require.Equal(t, expected.Header.EventType, e.Header.EventType)
+				require.Equal(t, expected.Header.LogPos, e.Header.LogPos)
+				require.Equal(t, int(e.Header.EventSize), len(e.RawData))
+				if tt.fileChecksum == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+					if tt.clientChecksum == "CRC32" {
+						require.Equal(t, expected.RawData, e.RawData)
+					} else {
+						require.Equal(t, stripTestChecksum(expected.RawData), e.RawData)
+					}
+				}
+			}
+
+			// heartbeats have the negotiated checksum too
+			e := parse()
+			require.Equal(t, replication.HEARTBEAT_EVENT, e.Header.EventType)
+		})
+	}
+}
+
+func TestBinlogFileHandlerDump(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := newTestBinlogFile(t, "")
+	file1.writeTransaction(t, 1)
+	file1.writeTransaction(t, 2)
+	file1.writeRotate(t, "mysql-bin.000002")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file1.buf.Bytes(), 0o644))
+
+	file2 := newTestBinlogFile(t, testBinlogFileSID+":1-2")
+	file2.writeTransaction(t, 3)
+	written := file2.buf.Len()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), file2.buf.Bytes(), 0o644))
+
+	host, port := startTestBinlogFileServer(t, dir)
+
+	b := newTestBinlogFileSyncer(t, host, port)
+	s, err := b.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+
+	requireFakeRotate(t, s, "mysql-bin.000001", 4)
+	requireFileEvents(t, s, file1.events)
+	requireFileEvents(t, s, file2.events)
+
+	// append a transaction to the last file in two writes, the incomplete event is read again.
+	file2.writeTransaction(t, 4)
+	f, err := os.OpenFile(filepath.Join(dir, "mysql-bin.000002"), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(file2.buf.Bytes()[written : written+10])
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = f.Write(file2.buf.Bytes()[written+10:])
+	require.NoError(t, err)
+
+	for _, expected := range file2.events[len(file2.events)-3:] {
+		e := getTestEvent(t, s)
+		for e.Header.EventType == replication.HEARTBEAT_EVENT {
+			e = getTestEvent(t, s)
+		}
+		require.Equal(t, stripTestChecksum(expected.RawData), e.RawData)
+	}
+
+	// heartbeats are sent at the end of the last file
+	e := getTestEvent(t, s)
+	require.Equal(t, replication.HEARTBEAT_EVENT, e.Header.EventType)
+	require.Equal(t, "mysql-bin.000002", e.Event.(*replication.HeartbeatEvent).Filename)
+	require.Equal(t, uint32(file2.buf.Len()), e.Header.LogPos)
+
+	// resume from the middle of the first file
+	b2 := newTestBinlogFileSyncer(t, host, port)
+	s, err = b2.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: file1.events[4].Header.LogPos})
+	require.NoError(t, err)
+
+	requireFakeRotate(t, s, "mysql-bin.000001", uint64(file1.events[4].Header.LogPos))
+	e = getTestEvent(t, s)
+	require.Equal(t, replication.FORMAT_DESCRIPTION_EVENT, e.Header.EventType)
+	require.Zero(t, e.Header.LogPos)
+	requireFileEvents(t, s, file1.events[5:])
+}
+
+func TestBinlogFileHandlerDumpGTID(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := newTestBinlogFile(t, "")
+	file1.writeTransaction(t, 1)
+	file1.writeTransaction(t, 2)
+	file1.writeRotate(t, "mysql-bin.000002")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file1.buf.Bytes(), 0o644))
+
+	file2 := newTestBinlogFile(t, testBinlogFileSID+":1-2")
+	file2.writeTransaction(t, 3)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), file2.buf.Bytes(), 0o644))
+
+	host, port := startTestBinlogFileServer(t, dir)
+
+	// the transaction 1 is skipped
+	gset, err := mysql.ParseMysqlGTIDSet(testBinlogFileSID + ":1")
+	require.NoError(t, err)
+	s, err := newTestBinlogFileSyncer(t, host, port).StartSyncGTID(gset)
+	require.NoError(t, err)
+
+	requireFakeRotate(t, s, "mysql-bin.000001", 4)
+	requireFileEvents(t, s, file1.events[:2])
+	requireFileEvents(t, s, file1.events[5:])
+	requireFileEvents(t, s, file2.events)
+
+	// start from the second file
+	gset, err = mysql.ParseMysqlGTIDSet(testBinlogFileSID + ":1-2")
+	require.NoError(t, err)
+	s, err = newTestBinlogFileSyncer(t, host, port).StartSyncGTID(gset)
+	require.NoError(t, err)
+
+	requireFakeRotate(t, s, "mysql-bin.000002", 4)
+	requireFileEvents(t, s, file2.events)
+}
+
+func TestBinlogSyncerReadBounds(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := newTestBinlogFile(t, "")
+	file1.writeTransaction(t, 1)
+	file1.writeTransaction(t, 2)
+	file1.writeRotate(t, "mysql-bin.000002")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), file1.buf.Bytes(), 0o644))
+
+	file2 := newTestBinlogFile(t, testBinlogFileSID+":1-2")
+	file2.writeTransaction(t, 3)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), file2.buf.Bytes(), 0o644))
+
+	host, port := startTestBinlogFileServer(t, dir)
+
+	stop, err := mysql.ParseMysqlGTIDSet(testBinlogFileSID + ":1-2")
+	require.NoError(t, err)
+	b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID: 100,
+		Flavor:   mysql.MySQLFlavor,
+		Host:     host,
+		Port:     port,
+		User:     "root",
+		Bounds:   replication.ReadBounds{StopGTIDSet: stop},
+	})
+	t.Cleanup(b.Close)
+
+	gset, err := mysql.ParseMysqlGTIDSet(testBinlogFileSID + ":1")
+	require.NoError(t, err)
+	s, err := b.StartSyncGTID(gset)
+	require.NoError(t, err)
+
+	// the stream stops after the transaction 2
+	requireFakeRotate(t, s, "mysql-bin.000001", 4)
+	requireFileEvents(t, s, file1.events[:2])
+	requireFileEvents(t, s, file1.events[5:8])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = s.GetEvent(ctx)
+	require.ErrorIs(t, err, replication.ErrStopBoundReached)
+}
+
+func TestBinlogSyncerFailover(t *testing.T) {
+	// getEvent returns the next event except the heartbeats
+	getEvent := func(t *testing.T, s *replication.BinlogStreamer) *replication.BinlogEvent {
+		e := getTestEvent(t, s)
+		for e.Header.EventType == replication.HEARTBEAT_EVENT {
+			e = getTestEvent(t, s)
+		}
+		return e
+	}
+
+	// the candidate has the transactions 1, 2 and 3
+	candidate := newTestBinlogFile(t, "")
+	candidate.writeTransaction(t, 1)
+	candidate.writeTransaction(t, 2)
+	candidate.writeTransaction(t, 3)
+
+	for _, test := range []struct {
+		name string
+		// the number of the events of the transaction 2 written on the first server
+		written int
+		// the events of the candidate received after failover
+		expected []*replication.BinlogEvent
+	}{
+		{"between transactions", 0, candidate.events[5:]},
+		{"in transaction", 2, candidate.events[7:]},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f := newTestBinlogFile(t, "")
+			f.writeTransaction(t, 1)
+			f.writeTransaction(t, 2)
+			f.events = f.events[:5+test.written]
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), f.buf.Bytes()[:f.events[len(f.events)-1].Header.LogPos], 0o644))
+			host, port, stop := startStoppableTestBinlogFileServer(t, dir)
+
+			candidateDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(candidateDir, "mysql-bin.000003"), candidate.buf.Bytes(), 0o644))
+			candidateHost, candidatePort := startTestBinlogFileServer(t, candidateDir)
+
+			reconnected := make(chan replication.ReconnectInfo, 10)
+			metrics := replication.NewPrometheusMetrics("binlog")
+			b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+				ServerID:        100,
+				Flavor:          mysql.MySQLFlavor,
+				Host:            host,
+				Port:            port,
+				User:            "root",
+				HeartbeatPeriod: 50 * time.Millisecond,
+				VerifyChecksum:  true,
+				Candidates: []replication.BinlogSource{
+					// down
+					{Host: "127.0.0.1", Port: 1},
+					{Host: candidateHost, Port: candidatePort},
+				},
+				RetryPolicy: &replication.ConstantRetryPolicy{Delay: 10 * time.Millisecond},
+				OnReconnect: func(info replication.ReconnectInfo) {
+					reconnected <- info
+				},
+				Metrics: metrics,
+			})
+			t.Cleanup(b.Close)
+
+			gset, err := mysql.ParseMysqlGTIDSet("")
+			require.NoError(t, err)
+			s, err := b.StartSyncGTID(gset)
+			require.NoError(t, err)
+
+			requireFakeRotate(t, s, "mysql-bin.000001", 4)
+			for _, expected := range f.events {
+				require.Equal(t, stripTestChecksum(expected.RawData), getEvent(t, s).RawData)
+			}
+			stop()
+
+			requireFakeRotate(t, s, "mysql-bin.000003", 4)
+			for _, expected := range candidate.events[:2] {
+				require.Equal(t, stripTestChecksum(expected.RawData), getEvent(t, s).RawData)
+			}
+			for _, expected := range test.expected {
+				require.Equal(t, stripTestChecksum(expected.RawData), getEvent(t, s).RawData)
+			}
+			require.Equal(t, replication.BinlogSource{Host: candidateHost, Port: candidatePort}, b.CurrentSource())
+
+			info := <-reconnected
+			require.Equal(t, 1, info.Attempt)
+			require.Error(t, info.LastError)
+			require.NoError(t, info.Err)
+			require.Equal(t, b.CurrentSource(), info.Source)
+			require.Equal(t, "mysql-bin.000001", info.Position.Name)
+			// after the transaction 1, and before the interrupted transaction 2
+			require.Equal(t, testBinlogFileSID+":1", info.GTIDSet.String())
+			require.Empty(t, reconnected)
+
+			var buf bytes.Buffer
+			_, err = metrics.WriteTo(&buf)
+			require.NoError(t, err)
+			require.Contains(t, buf.String(), `binlog_reconnects_total{result="success"} 1`+"\n")
+			// the GTID event of the interrupted transaction is received twice
+			require.Contains(t, buf.String(), fmt.Sprintf("binlog_events_total{type=\"GTIDEvent\"} %d\n", 3+test.written/2))
+		})
+	}
+}
+
+func TestListBinlogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"mysql-bin.000010", "mysql-bin.index", "mysql-bin.000002", "relay.000001", "mysql-bin.000009"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "backup.000001"), 0o755))
+
+	files, err := listBinlogFiles(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"mysql-bin.000002", "mysql-bin.000009", "mysql-bin.000010", "relay.000001"}, files)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var ErrRelayClosed = errors.New("binlog relay is closed")
+
+// BinlogRelayConfig is the configuration of a BinlogRelay.
+type BinlogRelayConfig struct {
+	// Dir is the directory to save the binlog files pulled from upstream, the
+	// downstream replicas are served from it.
+	Dir string
+
+	// Upstream is the configuration of the BinlogSyncer pulling the binlog from upstream.
+	Upstream replication.BinlogSyncerConfig
+
+	// Downstream is the configuration of the handlers serving the downstream replicas,
+	// its Dir is always the relay Dir.
+	Downstream BinlogFileHandlerConfig
+
+	// User and Password authenticate the downstream replicas.
+	User     string
+	Password string
+
+	// Server creates the downstream connections, the default server is used if nil.
+	Server *Server
+}
+
+// BinlogRelay pulls the binlog of an upstream server with one BinlogSyncer and saves it
+// into binlog files with the StartBackupWithHandler of the syncer. Any number of downstream
+// replicas, each from its own position or GTID set, are served from the files by
+// BinlogFileHandler, so they don't need their own connections to upstream.
+//
+// The relayed files always start from the beginning of the upstream files, so they have
+// the same names and positions as upstream.
+type BinlogRelay struct {
+	cfg BinlogRelayConfig
+
+	m         sync.Mutex
+	closed    bool
+	syncer    *replication.BinlogSyncer
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+
+	// the file to append to when Run continues from the end of an existing file
+	appendFile string
+}
+
+// NewBinlogRelay creates a BinlogRelay, use Run to pull the binlog and Serve to serve the replicas.
+func NewBinlogRelay(cfg BinlogRelayConfig) *BinlogRelay {
+	cfg.Downstream.Dir = cfg.Dir
+	if cfg.Server == nil {
+		cfg.Server = defaultServer()
+	}
+
+	return &BinlogRelay{
+		cfg:   cfg,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Run pulls the binlog from upstream until the relay is closed or an error occurs. If the
+// relay directory already has binlog files, it continues from the end of the last file,
+// otherwise it starts from the beginning of the upstream file, or the first upstream file if
+// file is empty.
+func (r *BinlogRelay) Run(file string) error {
+	if err := os.MkdirAll(r.cfg.Dir, 0o755); err != nil {
+		return errors.Trace(err)
+	}
+
+	pos, err := r.startPosition(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	r.m.Lock()
+	if r.closed {
+		r.m.Unlock()
+		return ErrRelayClosed
+	}
+	if r.syncer != nil {
+		r.m.Unlock()
+		return errors.New("binlog relay is already running")
+	}
+	r.syncer = replication.NewBinlogSyncer(r.cfg.Upstream)
+	r.appendFile = ""
+	if pos.Pos > 4 {
+		r.appendFile = pos.Name
+	}
+	r.m.Unlock()
+
+	defer func() {
+		r.m.Lock()
+		r.syncer.Close()
+		r.syncer = nil
+		r.m.Unlock()
+	}()
+
+	return errors.Trace(r.syncer.StartBackupWithHandler(pos, 0, r.openFile))
+}
+
+// startPosition returns the position to pull the binlog from. An incomplete event at the end
+// of the last relayed file, e.g, the relay crashed while writing, is truncated.
+func (r *BinlogRelay) startPosition(file string) (mysql.Position, error) {
+	files, err := listBinlogFiles(r.cfg.Dir)
+	if err != nil {
+		return mysql.Position{}, errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return mysql.Position{Name: file, Pos: 4}, nil
+	}
+
+	last := files[len(files)-1]
+	path := filepath.Join(r.cfg.Dir, last)
+	offset, next := scanBinlogFile(path)
+	if next != "" {
+		return mysql.Position{Name: next, Pos: 4}, nil
+	}
+	if offset <= 4 {
+		// the file is created again from the beginning
+		return mysql.Position{Name: last, Pos: 4}, nil
+	}
+
+	if err = os.Truncate(path, offset); err != nil {
+		return mysql.Position{}, errors.Trace(err)
+	}
+	return mysql.Position{Name: last, Pos: uint32(offset)}, nil
+}
+
+// scanBinlogFile returns the end offset of the last complete event in the file, and the next
+// file name if the last event is a rotate event.
+func scanBinlogFile(path string) (int64, string) {
+	offset := int64(4)
+	var next string
+
+	p := replication.NewBinlogParser()
+	p.SetRawMode(true)
+	_ = p.ParseFile(path, offset, func(e *replication.BinlogEvent) error {
+		offset += int64(e.Header.EventSize)
+		next = ""
+		if e.Header.EventType == replication.ROTATE_EVENT {
+			next = string(e.Event.(*replication.RotateEvent).NextLogName)
+		}
+		return nil
+	})
+	if offset == 4 {
+		// the file has no complete format description event
+		return 0, ""
+	}
+
+	return offset, next
+}
+
+func (r *BinlogRelay) openFile(name string) (io.WriteCloser, error) {
+	path := filepath.Join(r.cfg.Dir, filepath.Base(name))
+
+	r.m.Lock()
+	appendFile := r.appendFile == name
+	r.appendFile = ""
+	r.m.Unlock()
+
+	if appendFile {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return &binlogAppendWriter{File: f}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	return f, errors.Trace(err)
+}
+
+// binlogAppendWriter appends the events to an existing binlog file. The binlog file header
+// and the format description event written by the backup handler at first are dropped, they
+// are already at the beginning of the file.
+type binlogAppendWriter struct {
+	*os.File
+
+	formatSkipped bool
+}
+
+func (w *binlogAppendWriter) Write(p []byte) (int, error) {
+	if !w.formatSkipped {
+		if bytes.Equal(p, replication.BinLogFileHeader) {
+			return len(p), nil
+		}
+		if len(p) > 4 && replication.EventType(p[4]) == replication.FORMAT_DESCRIPTION_EVENT {
+			w.formatSkipped = true
+			return len(p), nil
+		}
+	}
+	return w.File.Write(p)
+}
+
+// Serve accepts the downstream replicas from l until the relay is closed.
+func (r *BinlogRelay) Serve(l net.Listener) error {
+	r.m.Lock()
+	if r.closed {
+		r.m.Unlock()
+		return ErrRelayClosed
+	}
+	r.listeners = append(r.listeners, l)
+	r.m.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if r.isClosed() {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+
+		go r.serveConn(c)
+	}
+}
+
+func (r *BinlogRelay) serveConn(c net.Conn) {
+	r.m.Lock()
+	if r.closed {
+		r.m.Unlock()
+		c.Close()
+		return
+	}
+	r.conns[c] = struct{}{}
+	r.m.Unlock()
+
+	defer func() {
+		r.m.Lock()
+		delete(r.conns, c)
+		r.m.Unlock()
+		c.Close()
+	}()
+
+	conn, err := r.cfg.Server.NewConn(c, r.cfg.User, r.cfg.Password, NewBinlogFileHandler(r.cfg.Downstream))
+	if err != nil {
+		return
+	}
+
+	for conn.HandleCommand() == nil {
+	}
+}
+
+func (r *BinlogRelay) isClosed() bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.closed
+}
+
+// Close stops pulling the binlog and serving the replicas.
+func (r *BinlogRelay) Close() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	if r.syncer != nil {
+		r.syncer.Close()
+	}
+	for _, l := range r.listeners {
+		_ = l.Close()
+	}
+	for c := range r.conns {
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func startTestBinlogRelay(t *testing.T, dir string, host string, port uint16) (*BinlogRelay, string, uint16, chan error) {
+	r := NewBinlogRelay(BinlogRelayConfig{
+		Dir: dir,
+		Upstream: replication.BinlogSyncerConfig{
+			ServerID:        101,
+			Flavor:          mysql.MySQLFlavor,
+			Host:            host,
+			Port:            port,
+			User:            "root",
+			HeartbeatPeriod: 20 * time.Millisecond,
+			VerifyChecksum:  true,
+		},
+		Downstream: BinlogFileHandlerConfig{
+			ServerID:     2,
+			ServerUUID:   testBinlogFileSID,
+			PollInterval: 10 * time.Millisecond,
+		},
+		User: "root",
+	})
+	t.Cleanup(r.Close)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = r.Serve(l)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run("")
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return r, addr.IP.String(), uint16(addr.Port), done
+}
+
+func requireRelayedFile(t *testing.T, dir string, name string, f *testBinlogFile) {
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		return err == nil && bytes.Equal(data, f.buf.Bytes())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func appendTestBinlogFile(t *testing.T, path string, data []byte) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(data)
+	require.NoError(t, err)
+}
+
+func TestBinlogRelay(t *testing.T) {
+	upstreamDir := t.TempDir()
+	relayDir := t.TempDir()
+
+	file1 := newTestBinlogFile(t, "")
+	file1.writeTransaction(t, 1)
+	file1.writeTransaction(t, 2)
+	file1.writeRotate(t, "mysql-bin.000002")
+	require.NoError(t, os.WriteFile(filepath.Join(upstreamDir, "mysql-bin.000001"), file1.buf.Bytes(), 0o644))
+
+	file2 := newTestBinlogFile(t, testBinlogFileSID+":1-2")
+	file2.writeTransaction(t, 3)
+	require.NoError(t, os.WriteFile(filepath.Join(upstreamDir, "mysql-bin.000002"), file2.buf.Bytes(), 0o644))
+
+	// the upstream is a fake primary serving the binlog files
+	upstreamHost, upstreamPort := startTestBinlogFileServer(t, upstreamDir)
+
+	relay, host, port, done := startTestBinlogRelay(t, relayDir, upstreamHost, upstreamPort)
+	requireRelayedFile(t, relayDir, "mysql-bin.000001", file1)
+	requireRelayedFile(t, relayDir, "mysql-bin.000002", file2)
+
+	b1 := newTestBinlogFileSyncer(t, host, port)
+	s1, err := b1.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+	requireFakeRotate(t, s1, "mysql-bin.000001", 4)
+	requireFileEvents(t, s1, file1.events)
+	requireFileEvents(t, s1, file2.events)
+
+	gset, err := mysql.ParseMysqlGTIDSet(testBinlogFileSID + ":1-2")
+	require.NoError(t, err)
+	b2 := newTestBinlogFileSyncer(t, host, port)
+	s2, err := b2.StartSyncGTID(gset)
+	require.NoError(t, err)
+	requireFakeRotate(t, s2, "mysql-bin.000002", 4)
+	requireFileEvents(t, s2, file2.events)
+
+	// new events of upstream are relayed to all the replicas
+	written := file2.buf.Len()
+	file2.writeTransaction(t, 4)
+	appendTestBinlogFile(t, filepath.Join(upstreamDir, "mysql-bin.000002"), file2.buf.Bytes()[written:])
+	requireRelayedFile(t, relayDir, "mysql-bin.000002", file2)
+
+	for _, s := range []*replication.BinlogStreamer{s1, s2} {
+		for _, expected := range file2.events[len(file2.events)-3:] {
+			e := getTestEvent(t, s)
+			for e.Header.EventType == replication.HEARTBEAT_EVENT {
+				e = getTestEvent(t, s)
+			}
+			require.Equal(t, stripTestChecksum(expected.RawData), e.RawData)
+		}
+	}
+
+	b1.Close()
+	b2.Close()
+	relay.Close()
+	require.NoError(t, <-done)
+
+	// the relay crashed while writing an event, it continues from the last complete event
+	info, err := os.Stat(filepath.Join(relayDir, "mysql-bin.000002"))
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(filepath.Join(relayDir, "mysql-bin.000002"), info.Size()-5))
+
+	written = file2.buf.Len()
+	file2.writeTransaction(t, 5)
+	appendTestBinlogFile(t, filepath.Join(upstreamDir, "mysql-bin.000002"), file2.buf.Bytes()[written:])
+
+	relay, _, _, done = startTestBinlogRelay(t, relayDir, upstreamHost, upstreamPort)
+	requireRelayedFile(t, relayDir, "mysql-bin.000001", file1)
+	requireRelayedFile(t, relayDir, "mysql-bin.000002", file2)
+
+	relay.Close()
+	require.NoError(t, <-done)
+}
@@ -313,6 +313,8 @@ func (c *Conn) writeBinlogEvents(s *replication.BinlogStreamer) error {
 
 		data = append(data, ev.RawData...)
 		if err := c.WritePacket(data); err != nil {
+			// tell the handler that the replica has gone
+			s.AddErrorToStreamer(err)
 			return err
 		}
 	}